@@ -0,0 +1,423 @@
+// Command crmctl administers the CRM database: tenants, users, sessions, migrations, tenant data and reminders.
+//
+//	crmctl [-actor name] tenant create <tenant> <domain>...
+//	crmctl [-actor name] tenant disable|enable <tenant>
+//	crmctl [-actor name] tenant require-2fa|optional-2fa <tenant>
+//	crmctl [-actor name] tenant sso -issuer url -client-id id [-client-secret s] -domains d,... [-role-claim c -admin-value v] <tenant>
+//	crmctl [-actor name] tenant sso-off <tenant>
+//	crmctl [-actor name] tenant llm-budget [-soft usd] [-hard usd] [-reset] <tenant>
+//	crmctl [-actor name] tenant timezone <tenant> [zone]
+//	crmctl [-actor name] user create [-password p] [-role r] <email>
+//	crmctl [-actor name] user role <email> Admin|Member
+//	crmctl [-actor name] user disable|enable <email>
+//	crmctl [-actor name] user reset-password [-password p] <email>
+//	crmctl [-actor name] user reset-2fa <email>
+//	crmctl sessions revoke <tenant> [email]
+//	crmctl migrate [-status]
+//	crmctl export [-o file] <tenant>
+//	crmctl [-actor name] import <tenant> <file>
+//	crmctl reminders [-tenant t] [-at time]
+//
+// It reads the same environment as the server, DATABASE_URL and DATABASE_NAME. Changes are recorded in the audit log
+// with the source "CLI" and the actor given with -actor, $USER by default.
+package main
+
+import (
+	"backend-crm/internal/admin"
+	"backend-crm/internal/config"
+	"backend-crm/internal/database/migrations"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/internal/handler"
+	"backend-crm/pkg/enum"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	log.SetFlags(0)
+	actor := flag.String("actor", os.Getenv("USER"), "who the changes are recorded as made by")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := database.WithActor(database.WithSource(context.Background(), enum.AUDIT_SOURCE_CLI), *actor)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Database.DatabaseURL))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database(cfg.Database.DatabaseName)
+	a := admin.NewAdmin(db, database.NewAuditLog(db.Collection(database.AuditLogCollectionName)))
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "tenant":
+		err = tenantCommand(ctx, a, args)
+	case "user":
+		err = userCommand(ctx, a, args)
+	case "sessions":
+		err = sessionsCommand(ctx, a, args)
+	case "migrate":
+		err = migrateCommand(ctx, db, args)
+	case "export":
+		err = exportCommand(ctx, a, args)
+	case "import":
+		err = importCommand(ctx, a, args)
+	case "reminders":
+		err = remindersCommand(ctx, db, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  crmctl [-actor name] tenant create <tenant> <domain>...
+  crmctl [-actor name] tenant disable|enable <tenant>
+  crmctl [-actor name] tenant require-2fa|optional-2fa <tenant>
+  crmctl [-actor name] tenant sso -issuer url -client-id id [-client-secret s] -domains d,... [-role-claim c -admin-value v] <tenant>
+  crmctl [-actor name] tenant sso-off <tenant>
+  crmctl [-actor name] tenant llm-budget [-soft usd] [-hard usd] [-reset] <tenant>
+  crmctl [-actor name] tenant timezone <tenant> [zone]
+  crmctl [-actor name] user create [-password p] [-role r] <email>
+  crmctl [-actor name] user role <email> Admin|Member
+  crmctl [-actor name] user disable|enable <email>
+  crmctl [-actor name] user reset-password [-password p] <email>
+  crmctl [-actor name] user reset-2fa <email>
+  crmctl sessions revoke <tenant> [email]
+  crmctl migrate [-status]
+  crmctl export [-o file] <tenant>
+  crmctl [-actor name] import <tenant> <file>
+  crmctl reminders [-tenant t] [-at time]`)
+}
+
+func tenantCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	if len(args) > 0 && args[0] == "sso" {
+		return tenantSSOCommand(ctx, a, args[1:])
+	}
+	if len(args) > 0 && args[0] == "llm-budget" {
+		return tenantLLMBudgetCommand(ctx, a, args[1:])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: crmctl tenant create|disable|enable|require-2fa|optional-2fa|sso|sso-off|llm-budget|timezone <tenant>")
+	}
+	switch action, tenant := args[0], args[1]; action {
+	case "create":
+		if err := a.CreateTenant(ctx, tenant, args[2:]); err != nil {
+			return err
+		}
+		fmt.Printf("created tenant %s\n", tenant)
+	case "disable", "enable":
+		if err := a.SetTenantDisabled(ctx, tenant, action == "disable"); err != nil {
+			return err
+		}
+		fmt.Printf("%sd tenant %s\n", action, tenant)
+	case "require-2fa", "optional-2fa":
+		if err := a.SetTenantRequireTOTP(ctx, tenant, action == "require-2fa"); err != nil {
+			return err
+		}
+		fmt.Printf("two-factor authentication is now %s for tenant %s\n", strings.TrimSuffix(action, "-2fa"), tenant)
+	case "sso-off":
+		if err := a.SetTenantSSO(ctx, tenant, nil); err != nil {
+			return err
+		}
+		fmt.Printf("single sign-on is now off for tenant %s\n", tenant)
+	case "timezone":
+		// without a zone the tenant's port is in config.DEFAULT_TIMEZONE again
+		timezone := ""
+		if len(args) > 2 {
+			timezone = args[2]
+		}
+		if err := a.SetTenantTimezone(ctx, tenant, timezone); err != nil {
+			return err
+		}
+		if timezone == "" {
+			timezone = config.DEFAULT_TIMEZONE
+		}
+		fmt.Printf("the port of tenant %s is now in %s\n", tenant, timezone)
+	default:
+		return fmt.Errorf("unknown tenant command %s", action)
+	}
+	return nil
+}
+
+// tenantLLMBudgetCommand sets what a tenant may spend on LLM calls a month, in US dollars, instead of
+// $LLM_SOFT_BUDGET_USD and $LLM_HARD_BUDGET_USD. A budget of 0 is no limit.
+func tenantLLMBudgetCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	flags := flag.NewFlagSet("tenant llm-budget", flag.ExitOnError)
+	soft := flags.Float64("soft", 0, "the spend past which the tenant is warned about, 0 for no limit")
+	hard := flags.Float64("hard", 0, "the spend past which the tenant's emails are sent to review instead of being read, 0 for no limit")
+	reset := flags.Bool("reset", false, "use the configured budget again")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crmctl tenant llm-budget [-soft usd] [-hard usd] [-reset] <tenant>")
+	}
+
+	tenant := flags.Arg(0)
+	if *reset {
+		if err := a.SetTenantLLMBudget(ctx, tenant, nil); err != nil {
+			return err
+		}
+		fmt.Printf("tenant %s now has the configured LLM budget\n", tenant)
+		return nil
+	}
+	if err := a.SetTenantLLMBudget(ctx, tenant, &database.TenantLLMBudget{SoftUSD: *soft, HardUSD: *hard}); err != nil {
+		return err
+	}
+	fmt.Printf("tenant %s may now spend $%.2f (soft) and $%.2f (hard) on LLM calls a month\n", tenant, *soft, *hard)
+	return nil
+}
+
+// tenantSSOCommand lets a tenant's users log in with their OpenID Connect identity provider, where the CRM is
+// registered as a client with the redirect URI $SSO_CALLBACK_BASE_URL/login/sso/<tenant>/callback.
+func tenantSSOCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	flags := flag.NewFlagSet("tenant sso", flag.ExitOnError)
+	issuer := flags.String("issuer", "", "the identity provider's issuer URL")
+	clientID := flags.String("client-id", "", "the client ID the CRM is registered with")
+	clientSecret := flags.String("client-secret", "", "the client secret, empty for a public client")
+	domains := flags.String("domains", "", "the comma separated email domains users may log in from")
+	roleClaim := flags.String("role-claim", "", "the ID token claim users' roles are taken from, e.g. groups; roles are kept as they are if empty")
+	adminValue := flags.String("admin-value", "", "the value of the role claim that makes a user an admin")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crmctl tenant sso -issuer url -client-id id [-client-secret s] -domains d,... [-role-claim c -admin-value v] <tenant>")
+	}
+
+	tenant := flags.Arg(0)
+	sso := &database.TenantSSO{
+		Issuer:       *issuer,
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		RoleClaim:    *roleClaim,
+		AdminValue:   *adminValue,
+	}
+	for _, domain := range strings.Split(*domains, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			sso.AllowedDomains = append(sso.AllowedDomains, domain)
+		}
+	}
+	if err := a.SetTenantSSO(ctx, tenant, sso); err != nil {
+		return err
+	}
+	fmt.Printf("single sign-on with %s is now on for tenant %s\n", *issuer, tenant)
+	return nil
+}
+
+func userCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: crmctl user create|role|disable|enable|reset-password|reset-2fa <email>")
+	}
+	action := args[0]
+	if action == "role" {
+		if len(args) != 3 {
+			return fmt.Errorf("usage: crmctl user role <email> Admin|Member")
+		}
+		if err := a.SetUserRole(ctx, args[1], enum.UserRole(args[2])); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", args[1], args[2])
+		return nil
+	}
+
+	flags := flag.NewFlagSet("user "+action, flag.ExitOnError)
+	password := flags.String("password", "", "the password to set, generated if empty")
+	role := flags.String("role", string(enum.USER_ROLE_MEMBER), "the role of a new user, Admin or Member")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crmctl user %s <email>", action)
+	}
+	email := flags.Arg(0)
+
+	switch action {
+	case "create":
+		generated, err := a.CreateUser(ctx, email, *password, enum.UserRole(*role))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created user %s\n", email)
+		if *password == "" {
+			fmt.Printf("password: %s\n", generated)
+		}
+	case "disable", "enable":
+		if err := a.SetUserDisabled(ctx, email, action == "disable"); err != nil {
+			return err
+		}
+		fmt.Printf("%sd user %s\n", action, email)
+	case "reset-password":
+		generated, err := a.ResetPassword(ctx, email, *password)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reset the password of %s\n", email)
+		if *password == "" {
+			fmt.Printf("password: %s\n", generated)
+		}
+	case "reset-2fa":
+		if err := a.ResetTOTP(ctx, email); err != nil {
+			return err
+		}
+		fmt.Printf("reset the two-factor authentication of %s\n", email)
+	default:
+		return fmt.Errorf("unknown user command %s", action)
+	}
+	return nil
+}
+
+func sessionsCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "revoke" {
+		return fmt.Errorf("usage: crmctl sessions revoke <tenant> [email]")
+	}
+	email := ""
+	if len(args) == 3 {
+		email = args[2]
+	}
+	revoked, err := a.RevokeSessions(ctx, args[1], email)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("revoked %d sessions\n", revoked)
+	return nil
+}
+
+func migrateCommand(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "list applied and pending migrations instead of applying them")
+	flags.Parse(args)
+
+	migrator, err := migrations.NewMigrator(db, migrations.All)
+	if err != nil {
+		return err
+	}
+
+	if *status {
+		applied, err := migrator.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Printf("applied  %3d  %s  %s\n", migration.Version, migration.AppliedAt.Format("2006-01-02 15:04"), migration.Description)
+		}
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			fmt.Printf("pending  %3d  %s\n", migration.Version, migration.Description)
+		}
+		return nil
+	}
+
+	ran, err := migrator.Run(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("applied %d migrations\n", len(ran))
+	return nil
+}
+
+func exportCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "the file to write, standard output if empty")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crmctl export [-o file] <tenant>")
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	return a.ExportTenant(ctx, flags.Arg(0), w)
+}
+
+func importCommand(ctx context.Context, a *admin.Admin, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: crmctl import <tenant> <file>")
+	}
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imported, err := a.ImportTenant(ctx, args[0], file)
+	names := make([]string, 0, len(imported))
+	for name := range imported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-42s %d\n", name, imported[name])
+	}
+	return err
+}
+
+// remindersCommand lists the reminders the timer would send, without sending them. The server keeps the reminders
+// it has sent in memory, so every reminder due is listed, including those already sent.
+func remindersCommand(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("reminders", flag.ExitOnError)
+	tenant := flags.String("tenant", "", "only the reminders of this tenant, all tenants if empty")
+	at := flags.String("at", "", "the time to evaluate the reminders at, RFC 3339, now if empty")
+	flags.Parse(args)
+
+	currentTime := time.Now()
+	if *at != "" {
+		var err error
+		if currentTime, err = time.Parse(time.RFC3339, *at); err != nil {
+			return fmt.Errorf("-at must be an RFC 3339 time: %w", err)
+		}
+	}
+
+	shipments, err := database.NewShipmentCollection(db.Collection(database.ShipmentsCollectionName)).GetAll(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+	crewChanges, err := database.NewCrewChangeCollection(db.Collection(database.CrewChangesCollectionName)).GetAll(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	reminders := append(handler.DueETAReminders(shipments, currentTime), handler.DueCrewDocumentsReminders(shipments, crewChanges, currentTime)...)
+	for _, reminder := range reminders {
+		shipment := reminder.Shipment
+		detail := reminder.HoursBeforeETA
+		if len(reminder.MissingCrewDocuments) > 0 {
+			var missing []string
+			for name, documents := range reminder.MissingCrewDocuments {
+				missing = append(missing, name+" ("+strings.Join(documents, ", ")+")")
+			}
+			sort.Strings(missing)
+			detail = strings.Join(missing, "; ")
+		}
+		fmt.Printf("%-14s %s  %-4s  %s  %s\n", shipment.Tenant, shipment.ID, reminder.Key, shipment.VesselSpecifications.VesselName, detail)
+	}
+	fmt.Printf("%d reminders due at %s\n", len(reminders), currentTime.Format(time.RFC3339))
+	return nil
+}
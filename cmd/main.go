@@ -2,9 +2,11 @@ package main
 
 import (
 	"backend-crm/internal/config"
+	"backend-crm/internal/database/migrations"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/internal/handler"
 	"backend-crm/internal/server"
+	"backend-crm/pkg/auth"
 	"context"
 	"log"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // port timezones must resolve even in images without zoneinfo
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -27,25 +30,60 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(cfg.JWT.JWTKeys) > 0 {
+		keys, err := auth.NewKeySet(cfg.JWT.JWTKeys, cfg.JWT.JWTSigningKeyID)
+		if err != nil {
+			log.Fatalf("Error loading the JWT keys: %v", err)
+		}
+		auth.SetKeys(keys)
+	} else {
+		log.Println("JWT_KEYS is not set, tokens are signed with a random key and sessions end when the server restarts")
+	}
+
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Database.DatabaseURL))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer client.Disconnect(ctx)
+	if err := database.CheckTransactions(ctx, client); err != nil {
+		log.Fatalf("Error checking the database: %v", err)
+	}
 
-	customerCollection := client.Database(cfg.Database.DatabaseName).Collection("CustomerManagementCollection")
-	vesselCollection := client.Database(cfg.Database.DatabaseName).Collection("VesselManagementCollection")
-	supplierCollection := client.Database(cfg.Database.DatabaseName).Collection("SupplierManagementCollection")
-	terminalCollection := client.Database(cfg.Database.DatabaseName).Collection("TerminalManagementCollection")
-	agentCollection := client.Database(cfg.Database.DatabaseName).Collection("AgentManagementCollection")
-	categoryManagementActivityTypeCollection := client.Database(cfg.Database.DatabaseName).Collection("CategoryManagementActivityTypeCollection")
-	categoryManagementProductTypeCollection := client.Database(cfg.Database.DatabaseName).Collection("CategoryManagementProductTypeCollection")
-	shipmentCollection := client.Database(cfg.Database.DatabaseName).Collection("ShipmentsCollection")
-	feedEmailCollection := client.Database(cfg.Database.DatabaseName).Collection("FeedEmailCollection")
-	loginCollection := client.Database(cfg.Database.DatabaseName).Collection("LoginCollection")
-	invoicePricingCollection := client.Database(cfg.Database.DatabaseName).Collection("InvoicePricingCollection")
-	sessionCollection := client.Database(cfg.Database.DatabaseName).Collection("SessionCollection")
-	checklistCollection := client.Database(cfg.Database.DatabaseName).Collection("ChecklistCollection")
+	if cfg.Migrations.MigrateOnStartup {
+		migrator, err := migrations.NewMigrator(client.Database(cfg.Database.DatabaseName), migrations.All)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := migrator.Run(ctx); err != nil {
+			log.Fatalf("Error migrating the database: %v", err)
+		}
+	}
+
+	customerCollection := client.Database(cfg.Database.DatabaseName).Collection(database.CustomersCollectionName)
+	vesselCollection := client.Database(cfg.Database.DatabaseName).Collection(database.VesselsCollectionName)
+	supplierCollection := client.Database(cfg.Database.DatabaseName).Collection(database.SuppliersCollectionName)
+	terminalCollection := client.Database(cfg.Database.DatabaseName).Collection(database.TerminalsCollectionName)
+	agentCollection := client.Database(cfg.Database.DatabaseName).Collection(database.AgentsCollectionName)
+	categoryManagementActivityTypeCollection := client.Database(cfg.Database.DatabaseName).Collection(database.ActivityTypesCollectionName)
+	categoryManagementProductTypeCollection := client.Database(cfg.Database.DatabaseName).Collection(database.ProductTypesCollectionName)
+	shipmentCollection := client.Database(cfg.Database.DatabaseName).Collection(database.ShipmentsCollectionName)
+	feedEmailCollection := client.Database(cfg.Database.DatabaseName).Collection(database.FeedEmailsCollectionName)
+	loginCollection := client.Database(cfg.Database.DatabaseName).Collection(database.UsersCollectionName)
+	invoicePricingCollection := client.Database(cfg.Database.DatabaseName).Collection(database.InvoicesCollectionName)
+	sessionCollection := client.Database(cfg.Database.DatabaseName).Collection(database.SessionsCollectionName)
+	checklistCollection := client.Database(cfg.Database.DatabaseName).Collection(database.ChecklistsCollectionName)
+	crewChangeCollection := client.Database(cfg.Database.DatabaseName).Collection(database.CrewChangesCollectionName)
+	checklistTemplateCollection := client.Database(cfg.Database.DatabaseName).Collection(database.ChecklistTemplatesCollectionName)
+	notificationCollection := client.Database(cfg.Database.DatabaseName).Collection(database.NotificationsCollectionName)
+	auditCollection := client.Database(cfg.Database.DatabaseName).Collection(database.AuditLogCollectionName)
+	tenantCollection := client.Database(cfg.Database.DatabaseName).Collection(database.TenantsCollectionName)
+	invitationCollection := client.Database(cfg.Database.DatabaseName).Collection(database.InvitationsCollectionName)
+	passwordResetCollection := client.Database(cfg.Database.DatabaseName).Collection(database.PasswordResetsCollectionName)
+	loginAttemptCollection := client.Database(cfg.Database.DatabaseName).Collection(database.LoginAttemptsCollectionName)
+	apiKeyCollection := client.Database(cfg.Database.DatabaseName).Collection(database.APIKeysCollectionName)
+	ssoLoginCollection := client.Database(cfg.Database.DatabaseName).Collection(database.SSOLoginsCollectionName)
+	llmUsageCollection := client.Database(cfg.Database.DatabaseName).Collection(database.LLMUsagesCollectionName)
+	llmSpendCollection := client.Database(cfg.Database.DatabaseName).Collection(database.LLMSpendsCollectionName)
 
 	customerNewCollection := database.NewCustomerCollection(customerCollection)
 	shipmentNewCollection := database.NewShipmentCollection(shipmentCollection)
@@ -60,16 +98,83 @@ func main() {
 	invoicePricingNewCollection := database.NewInvoicePricingCollection(invoicePricingCollection)
 	sessionNewCollection := database.NewSessionCollection(sessionCollection)
 	checklistNewCollection := database.NewChecklistCollection(checklistCollection)
+	crewChangeNewCollection := database.NewCrewChangeCollection(crewChangeCollection)
+	checklistTemplateNewCollection := database.NewChecklistTemplateCollection(checklistTemplateCollection)
+	notificationNewCollection := database.NewNotificationCollection(notificationCollection)
+	tenantNewCollection := database.NewTenantCollection(tenantCollection)
+	invitationNewCollection := database.NewInvitationCollection(invitationCollection)
+	passwordResetNewCollection := database.NewPasswordResetCollection(passwordResetCollection)
+	loginAttempts := database.NewLoginAttempts(loginAttemptCollection)
+	apiKeyNewCollection := database.NewAPIKeyCollection(apiKeyCollection)
+	ssoLoginNewCollection := database.NewSSOLoginCollection(ssoLoginCollection)
+	llmUsageNewCollection := database.NewLLMUsageCollection(llmUsageCollection)
+	llmSpends := database.NewLLMSpends(llmSpendCollection)
+	auditLog := database.NewAuditLog(auditCollection)
+	// Sessions, notifications, single sign-on logins and LLM usage are bookkeeping, every other collection is audited
+	shipmentNewCollection.EnableAudit(auditLog, "shipments")
+	customerNewCollection.EnableAudit(auditLog, "customers")
+	vesselNewCollection.EnableAudit(auditLog, "vessels")
+	supplierNewCollection.EnableAudit(auditLog, "suppliers")
+	terminalNewCollection.EnableAudit(auditLog, "terminals")
+	agentNewCollection.EnableAudit(auditLog, "agents")
+	categoryManagementActivityTypeNewCollection.EnableAudit(auditLog, "activity_types")
+	categoryManagementProductTypeNewCollection.EnableAudit(auditLog, "product_types")
+	checklistNewCollection.EnableAudit(auditLog, "checklists")
+	checklistTemplateNewCollection.EnableAudit(auditLog, "checklist_templates")
+	invoicePricingNewCollection.EnableAudit(auditLog, "invoices")
+	crewChangeNewCollection.EnableAudit(auditLog, "crew_changes")
+	feedNewCollection.EnableAudit(auditLog, "feed_emails")
+	loginNewCollection.EnableAudit(auditLog, "users")
+	tenantNewCollection.EnableAudit(auditLog, "tenants")
+	invitationNewCollection.EnableAudit(auditLog, "invitations")
+	apiKeyNewCollection.EnableAudit(auditLog, "api_keys")
+
+	if err := handler.LoadTenants(ctx, tenantNewCollection); err != nil {
+		log.Fatalf("Error loading tenants: %v", err)
+	}
+	unitOfWork := database.NewUnitOfWork(database.NewMongoTransactor(client))
+	trashBins := map[string]database.Trash{
+		handler.TRASH_SHIPMENTS:           shipmentNewCollection,
+		handler.TRASH_CUSTOMERS:           customerNewCollection,
+		handler.TRASH_VESSELS:             vesselNewCollection,
+		handler.TRASH_SUPPLIERS:           supplierNewCollection,
+		handler.TRASH_TERMINALS:           terminalNewCollection,
+		handler.TRASH_AGENTS:              agentNewCollection,
+		handler.TRASH_ACTIVITY_TYPES:      categoryManagementActivityTypeNewCollection,
+		handler.TRASH_PRODUCT_TYPES:       categoryManagementProductTypeNewCollection,
+		handler.TRASH_CHECKLISTS:          checklistNewCollection,
+		handler.TRASH_CHECKLIST_TEMPLATES: checklistTemplateNewCollection,
+		handler.TRASH_INVOICES:            invoicePricingNewCollection,
+		handler.TRASH_CREW_CHANGES:        crewChangeNewCollection,
+		handler.TRASH_FEED_EMAILS:         feedNewCollection,
+		handler.TRASH_NOTIFICATIONS:       notificationNewCollection,
+	}
+
+	// limits hold across instances of the server when their buckets are kept in Mongo
+	var rateLimitStore database.RateLimitStore = database.NewMemoryRateLimitBuckets()
+	if cfg.RateLimit.RateLimitStore == "mongo" {
+		rateLimitStore = database.NewRateLimitBuckets(client.Database(cfg.Database.DatabaseName).Collection(database.RateLimitsCollectionName))
+	}
 
 	server := server.NewServer(cfg.HTTPServer, customerNewCollection,
 		vesselNewCollection, supplierNewCollection, terminalNewCollection, agentNewCollection, categoryManagementActivityTypeNewCollection, categoryManagementProductTypeNewCollection, shipmentNewCollection, feedNewCollection, loginNewCollection,
-		invoicePricingNewCollection, sessionNewCollection, checklistNewCollection)
+		invoicePricingNewCollection, sessionNewCollection, checklistNewCollection, crewChangeNewCollection, checklistTemplateNewCollection,
+		notificationNewCollection, unitOfWork, cfg.Provisioning, trashBins, auditLog,
+		invitationNewCollection, cfg.Invitations, passwordResetNewCollection, loginAttempts, cfg.Lockout, apiKeyNewCollection, cfg.EmailWebhook,
+		tenantNewCollection, ssoLoginNewCollection, cfg.SSO, cfg.RateLimit, rateLimitStore,
+		llmUsageNewCollection, llmSpends, cfg.LLMUsage)
 
 	stopChan := make(chan struct{})
 	wg := &sync.WaitGroup{}
 
 	wg.Add(1)
-	go handler.StartTimer(stopChan, wg, shipmentNewCollection, 2*time.Minute)
+	go handler.StartTimer(stopChan, wg, shipmentNewCollection, crewChangeNewCollection, notificationNewCollection, 2*time.Minute)
+
+	wg.Add(1)
+	go handler.StartTenantRefresh(stopChan, wg, tenantNewCollection, time.Minute)
+
+	wg.Add(1)
+	go handler.StartTrashPurge(stopChan, wg, trashBins, cfg.Trash.TrashRetention, cfg.Trash.TrashPurgeInterval)
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
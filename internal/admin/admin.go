@@ -0,0 +1,281 @@
+// Package admin holds the operations behind crmctl: managing tenants, users and sessions, and moving a tenant's data in and out.
+package admin
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/internal/handler"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Admin struct {
+	db       *mongo.Database
+	tenants  *database.TenantCollection
+	users    *database.LoginCollection
+	sessions *database.SessionCollection
+	client   *mongo.Client
+	work     *database.UnitOfWork
+}
+
+// NewAdmin works on db. Changes to tenants and users are recorded in auditLog, as the server records them.
+func NewAdmin(db *mongo.Database, auditLog *database.AuditLog) *Admin {
+	tenants := database.NewTenantCollection(db.Collection(database.TenantsCollectionName))
+	tenants.EnableAudit(auditLog, "tenants")
+	users := database.NewLoginCollection(db.Collection(database.UsersCollectionName))
+	users.EnableAudit(auditLog, "users")
+
+	return &Admin{
+		db:       db,
+		tenants:  tenants,
+		users:    users,
+		sessions: database.NewSessionCollection(db.Collection(database.SessionsCollectionName)),
+		client:   db.Client(),
+		work:     database.NewUnitOfWork(database.NewMongoTransactor(db.Client())),
+	}
+}
+
+// CreateTenant adds a tenant whose users are those with an email in one of domains, e.g. "customerc.com".
+func (a *Admin) CreateTenant(ctx context.Context, name string, domains []string) error {
+	if name == "" || name == config.UNKNOWN {
+		return fmt.Errorf("invalid tenant name %q", name)
+	}
+	if len(domains) == 0 {
+		return errors.New("a tenant needs at least one email domain")
+	}
+	if err := handler.LoadTenants(ctx, a.tenants); err != nil {
+		return err
+	}
+	if config.IsKnownTenant(name) {
+		return fmt.Errorf("tenant %s already exists", name)
+	}
+
+	for i, domain := range domains {
+		domain = "@" + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if tenant := config.MakeMapping("user" + domain); tenant != config.UNKNOWN {
+			return fmt.Errorf("domain %s already belongs to tenant %s", domain, tenant)
+		}
+		domains[i] = domain
+	}
+
+	_, err := a.tenants.Create(ctx, database.Tenant{Tenant: name, Domains: domains})
+	return err
+}
+
+// SetTenantDisabled disables or enables a tenant. The users of a disabled tenant cannot log in, and their sessions are revoked.
+func (a *Admin) SetTenantDisabled(ctx context.Context, name string, disabled bool) error {
+	err := a.setTenant(ctx, name, database.Tenant{Tenant: name, Disabled: disabled}, "disabled", disabled)
+	if err != nil || !disabled {
+		return err
+	}
+	_, err = a.RevokeSessions(ctx, name, "")
+	return err
+}
+
+// SetTenantRequireTOTP makes a tenant's users set up two-factor authentication before they can log in, or makes it optional.
+func (a *Admin) SetTenantRequireTOTP(ctx context.Context, name string, required bool) error {
+	return a.setTenant(ctx, name, database.Tenant{Tenant: name, RequireTOTP: required}, "requiretotp", required)
+}
+
+// SetTenantSSO makes a tenant's users log in with the identity provider sso instead of a password,
+// or with a password again when sso is nil.
+func (a *Admin) SetTenantSSO(ctx context.Context, name string, sso *database.TenantSSO) error {
+	if sso != nil {
+		if sso.Issuer == "" || sso.ClientID == "" || len(sso.AllowedDomains) == 0 {
+			return fmt.Errorf("single sign-on needs an issuer, a client ID and allowed domains")
+		}
+		if sso.RoleClaim != "" && sso.AdminValue == "" {
+			return fmt.Errorf("single sign-on with a role claim needs the value that makes a user an admin")
+		}
+	}
+	return a.setTenant(ctx, name, database.Tenant{Tenant: name, SSO: sso}, "sso", sso)
+}
+
+// SetTenantLLMBudget sets what a tenant may spend on LLM calls a month, or makes it the configured budget again when budget is nil.
+func (a *Admin) SetTenantLLMBudget(ctx context.Context, name string, budget *database.TenantLLMBudget) error {
+	if budget != nil {
+		if budget.SoftUSD < 0 || budget.HardUSD < 0 {
+			return fmt.Errorf("an LLM budget cannot be negative")
+		}
+		if budget.SoftUSD > 0 && budget.HardUSD > 0 && budget.SoftUSD > budget.HardUSD {
+			return fmt.Errorf("the soft LLM budget is above the hard one")
+		}
+	}
+	return a.setTenant(ctx, name, database.Tenant{Tenant: name, LLMBudget: budget}, "llmbudget", budget)
+}
+
+// SetTenantTimezone sets the IANA timezone of the port a tenant operates in, e.g. "Asia/Singapore", which ETAs
+// without a zone are read in and reminders are sent in, or makes it config.DEFAULT_TIMEZONE again when timezone is empty.
+func (a *Admin) SetTenantTimezone(ctx context.Context, name string, timezone string) error {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("unknown timezone %s: %w", timezone, err)
+		}
+	}
+	return a.setTenant(ctx, name, database.Tenant{Tenant: name, Timezone: timezone}, "timezone", timezone)
+}
+
+// setTenant sets field of a known tenant to value, storing the tenant as created when it is built in and has no document yet.
+func (a *Admin) setTenant(ctx context.Context, name string, created database.Tenant, field string, value interface{}) error {
+	if err := handler.LoadTenants(ctx, a.tenants); err != nil {
+		return err
+	}
+	if !config.IsKnownTenant(name) {
+		return fmt.Errorf("unknown tenant %s", name)
+	}
+
+	tenant, err := a.tenants.GetByKeyValue(ctx, "tenant", name, name)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		// a built in tenant, it is stored from the first time it is changed
+		_, err = a.tenants.Create(ctx, created)
+	case err == nil:
+		err = a.tenants.Patch(ctx, tenant.ID, name, database.Patch{Set: bson.D{{Key: field, Value: value}}})
+	}
+	return err
+}
+
+// CreateUser adds a user with role to the tenant of their email, with their email verified.
+// When password is empty one is generated; the password is returned either way.
+func (a *Admin) CreateUser(ctx context.Context, email string, password string, role enum.UserRole) (string, error) {
+	if !enum.IsValidUserRole(role) {
+		return "", fmt.Errorf("unknown role %s", role)
+	}
+	if err := handler.LoadTenants(ctx, a.tenants); err != nil {
+		return "", err
+	}
+	tenant := config.MakeMapping(email)
+	if tenant == config.UNKNOWN {
+		return "", fmt.Errorf("no tenant has the domain of %s", email)
+	}
+	if _, err := a.users.GetByKeyValue(ctx, "email", email, tenant); err != mongo.ErrNoDocuments {
+		if err == nil {
+			err = fmt.Errorf("user %s already exists", email)
+		}
+		return "", err
+	}
+
+	password, hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	_, err = a.users.Create(ctx, database.TenantUser{Email: email, Password: hashedPassword, Tenant: tenant, Role: role, EmailVerified: true})
+	return password, err
+}
+
+// SetUserDisabled disables or enables a user. A disabled user cannot log in, and their sessions are revoked.
+func (a *Admin) SetUserDisabled(ctx context.Context, email string, disabled bool) error {
+	user, err := a.user(ctx, email)
+	if err != nil {
+		return err
+	}
+	err = a.users.Patch(ctx, user.ID, user.Tenant, database.Patch{Set: bson.D{{Key: "disabled", Value: disabled}}})
+	if err != nil || !disabled {
+		return err
+	}
+	_, err = a.RevokeSessions(ctx, user.Tenant, email)
+	return err
+}
+
+// SetUserRole changes what a user may do within their tenant.
+func (a *Admin) SetUserRole(ctx context.Context, email string, role enum.UserRole) error {
+	if !enum.IsValidUserRole(role) {
+		return fmt.Errorf("unknown role %s", role)
+	}
+	user, err := a.user(ctx, email)
+	if err != nil {
+		return err
+	}
+	return a.users.Patch(ctx, user.ID, user.Tenant, database.Patch{Set: bson.D{{Key: "role", Value: role}}})
+}
+
+// ResetPassword sets a user's password, generating one when password is empty, and revokes their sessions.
+// The new password is returned.
+func (a *Admin) ResetPassword(ctx context.Context, email string, password string) (string, error) {
+	user, err := a.user(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	password, hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if err = a.users.Patch(ctx, user.ID, user.Tenant, database.Patch{Set: bson.D{{Key: "password", Value: hashedPassword}}}); err != nil {
+		return "", err
+	}
+	_, err = a.RevokeSessions(ctx, user.Tenant, email)
+	return password, err
+}
+
+// ResetTOTP turns off the two-factor authentication of a user who lost their authenticator and recovery codes,
+// and revokes their sessions. In a tenant that requires it they set it up again at their next login.
+func (a *Admin) ResetTOTP(ctx context.Context, email string) error {
+	user, err := a.user(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := a.users.Patch(ctx, user.ID, user.Tenant, database.DisableTOTPPatch()); err != nil {
+		return err
+	}
+	_, err = a.RevokeSessions(ctx, user.Tenant, email)
+	return err
+}
+
+// RevokeSessions logs out the tenant's users, or only the user with email if it is set, and returns how many sessions ended.
+func (a *Admin) RevokeSessions(ctx context.Context, tenant string, email string) (int, error) {
+	if tenant == "" {
+		return 0, errors.New("a tenant is required")
+	}
+
+	var sessions []database.SessionResponse
+	var err error
+	if email != "" {
+		sessions, err = a.sessions.GetAllByKeyValue(ctx, "email", email, tenant)
+	} else {
+		sessions, err = a.sessions.GetAll(ctx, tenant)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for i, session := range sessions {
+		if err := a.sessions.HardDelete(ctx, session.ID, session.Tenant); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func (a *Admin) user(ctx context.Context, email string) (database.TenantUserResponse, error) {
+	if err := handler.LoadTenants(ctx, a.tenants); err != nil {
+		return database.TenantUserResponse{}, err
+	}
+	user, err := a.users.GetByKeyValue(ctx, "email", email, config.MakeMapping(email))
+	if err == mongo.ErrNoDocuments {
+		err = fmt.Errorf("unknown user %s", email)
+	}
+	return user, err
+}
+
+// hashPassword hashes password, or a generated one when it is empty, and returns both.
+func hashPassword(password string) (string, string, error) {
+	if password == "" {
+		random := make([]byte, 12)
+		if _, err := rand.Read(random); err != nil {
+			return "", "", err
+		}
+		password = base64.RawURLEncoding.EncodeToString(random)
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	return password, hashedPassword, err
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TenantExport is a tenant's data, every document of database.TenantDataCollectionNames as stored, deleted ones included.
+// It is written as canonical Extended JSON, so IDs, dates and numbers keep their types when it is imported.
+type TenantExport struct {
+	Tenant      string              `bson:"tenant"`
+	ExportedAt  time.Time           `bson:"exported_at"`
+	Collections map[string][]bson.M `bson:"collections"`
+}
+
+// ExportTenant writes the tenant's data to w.
+func (a *Admin) ExportTenant(ctx context.Context, tenant string, w io.Writer) error {
+	export := TenantExport{Tenant: tenant, ExportedAt: time.Now().UTC(), Collections: map[string][]bson.M{}}
+	for _, name := range database.TenantDataCollectionNames {
+		cursor, err := a.db.Collection(name).Find(ctx, bson.M{"tenant": tenant}, options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		documents := []bson.M{}
+		err = cursor.All(ctx, &documents)
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+		export.Collections[name] = documents
+	}
+
+	data, err := bson.MarshalExtJSONIndent(export, true, false, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ImportTenant reads an export of the tenant from r and writes its documents, replacing those with the same ID.
+// It returns how many documents were written to each collection. The documents are written in one transaction,
+// so either all of them are stored or none are, and nothing is written unless every document belongs to tenant
+// and none has the ID of a document of another tenant.
+func (a *Admin) ImportTenant(ctx context.Context, tenant string, r io.Reader) (map[string]int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var export TenantExport
+	if err = bson.UnmarshalExtJSON(data, true, &export); err != nil {
+		return nil, err
+	}
+	if err = validateImport(export, tenant); err != nil {
+		return nil, err
+	}
+	if err = database.CheckTransactions(ctx, a.client); err != nil {
+		return nil, err
+	}
+
+	var imported map[string]int
+	err = a.work.Do(ctx, func(ctx context.Context) error {
+		// a retried transaction starts over
+		imported = make(map[string]int, len(export.Collections))
+		for _, name := range database.TenantDataCollectionNames {
+			documents := export.Collections[name]
+			if len(documents) == 0 {
+				continue
+			}
+			var taken bson.M
+			err := a.db.Collection(name).FindOne(ctx, otherTenantsFilter(documents, tenant), options.FindOne().SetProjection(bson.M{"tenant": 1})).Decode(&taken)
+			if err == nil {
+				return fmt.Errorf("%s %v belongs to tenant %v", name, taken["_id"], taken["tenant"])
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return err
+			}
+
+			for _, document := range documents {
+				filter := bson.M{"_id": document["_id"], "tenant": tenant}
+				if _, err := a.db.Collection(name).ReplaceOne(ctx, filter, document, options.Replace().SetUpsert(true)); err != nil {
+					return fmt.Errorf("%s %v: %w", name, document["_id"], err)
+				}
+				imported[name]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// otherTenantsFilter matches the documents of tenants other than tenant that have the ID of one of documents.
+// Importing those would fail on the duplicate ID, or worse, take them over.
+func otherTenantsFilter(documents []bson.M, tenant string) bson.M {
+	ids := make(bson.A, len(documents))
+	for i, document := range documents {
+		ids[i] = document["_id"]
+	}
+	return bson.M{"_id": bson.M{"$in": ids}, "tenant": bson.M{"$ne": tenant}}
+}
+
+// validateImport checks that export is of tenant, and only holds documents with an ID, of tenant, in its data collections.
+func validateImport(export TenantExport, tenant string) error {
+	if export.Tenant != tenant {
+		return fmt.Errorf("the export is of tenant %s, not %s", export.Tenant, tenant)
+	}
+
+	known := make(map[string]bool, len(database.TenantDataCollectionNames))
+	for _, name := range database.TenantDataCollectionNames {
+		known[name] = true
+	}
+	for name, documents := range export.Collections {
+		if !known[name] {
+			return fmt.Errorf("unknown collection %s", name)
+		}
+		for i, document := range documents {
+			if document["_id"] == nil {
+				return fmt.Errorf("%s document %d has no _id", name, i)
+			}
+			if document["tenant"] != tenant {
+				return fmt.Errorf("%s %v belongs to tenant %v", name, document["_id"], document["tenant"])
+			}
+		}
+	}
+	return nil
+}
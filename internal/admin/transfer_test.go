@@ -0,0 +1,56 @@
+package admin
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateImport(t *testing.T) {
+	customer := bson.M{"_id": primitive.NewObjectID(), "tenant": "tenantA", "customer": "Acme"}
+	export := TenantExport{Tenant: "tenantA", Collections: map[string][]bson.M{database.CustomersCollectionName: {customer}}}
+	assert.NoError(t, validateImport(export, "tenantA"))
+	assert.Error(t, validateImport(export, "tenantB"))
+
+	other := bson.M{"_id": primitive.NewObjectID(), "tenant": "tenantB"}
+	export.Collections[database.VesselsCollectionName] = []bson.M{other}
+	assert.ErrorContains(t, validateImport(export, "tenantA"), "belongs to tenant tenantB")
+
+	delete(export.Collections, database.VesselsCollectionName)
+	export.Collections[database.SessionsCollectionName] = []bson.M{customer}
+	assert.ErrorContains(t, validateImport(export, "tenantA"), "unknown collection")
+
+	delete(export.Collections, database.SessionsCollectionName)
+	export.Collections[database.AgentsCollectionName] = []bson.M{{"tenant": "tenantA"}}
+	assert.ErrorContains(t, validateImport(export, "tenantA"), "has no _id")
+}
+
+func TestOtherTenantsFilter(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	filter := otherTenantsFilter([]bson.M{{"_id": first, "tenant": "tenantA"}, {"_id": second, "tenant": "tenantA"}}, "tenantA")
+	assert.Equal(t, bson.M{"_id": bson.M{"$in": bson.A{first, second}}, "tenant": bson.M{"$ne": "tenantA"}}, filter)
+}
+
+func TestTenantExport_RoundTripsTypes(t *testing.T) {
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2024, time.May, 22, 8, 30, 0, 0, time.UTC)
+	export := TenantExport{Tenant: "tenantA", ExportedAt: createdAt, Collections: map[string][]bson.M{
+		database.ShipmentsCollectionName: {{"_id": id, "tenant": "tenantA", "version": int64(3), "createdat": primitive.NewDateTimeFromTime(createdAt)}},
+	}}
+
+	data, err := bson.MarshalExtJSONIndent(export, true, false, "", "  ")
+	require.NoError(t, err)
+	var imported TenantExport
+	require.NoError(t, bson.UnmarshalExtJSON(data, true, &imported))
+
+	shipment := imported.Collections[database.ShipmentsCollectionName][0]
+	assert.Equal(t, id, shipment["_id"])
+	assert.Equal(t, int64(3), shipment["version"])
+	assert.Equal(t, primitive.NewDateTimeFromTime(createdAt), shipment["createdat"])
+	assert.NoError(t, validateImport(imported, "tenantA"))
+}
@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"backend-crm/pkg/external/email"
 	"backend-crm/pkg/external/openai"
 	"backend-crm/pkg/external/whatsapp"
 	"log"
@@ -8,6 +9,7 @@ import (
 
 var WhatsAppClient *whatsapp.WhatsAppClient
 var OpenAIClient *openai.OpenAIClient
+var EmailClient *email.EmailClient
 
 func InitClients() {
 	var err error
@@ -19,5 +21,9 @@ func InitClients() {
 	if err != nil {
 		log.Fatalf("Error initializing OpenAI client: %v", err)
 	}
+	EmailClient, err = email.NewEmailClient()
+	if err != nil {
+		log.Fatalf("Error initializing email client: %v", err)
+	}
 
 }
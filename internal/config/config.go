@@ -11,13 +11,28 @@ const envPrefix = ""
 type Configuration struct {
 	HTTPServer
 	Database
+	Provisioning
+	Trash
+	Migrations
+	Invitations
+	Lockout
+	JWT
+	EmailWebhook
+	SSO
+	RateLimit
+	LLMUsage
 }
 
+// HTTPServer is how the server listens. MetricsToken, when set, is the bearer token Prometheus scrapes /metrics with.
+// TrustedProxies are the CIDRs or IP addresses of the load balancers in front of the server, whose X-Forwarded-For
+// says where the requests they forward come from.
 type HTTPServer struct {
-	IdleTimeout  time.Duration `envconfig:"HTTP_SERVER_IDLE_TIMEOUT" default:"60s"`
-	Port         int           `envconfig:"PORT" default:"8080"`
-	ReadTimeout  time.Duration `envconfig:"HTTP_SERVER_READ_TIMEOUT" default:"5s"`
-	WriteTimeout time.Duration `envconfig:"HTTP_SERVER_WRITE_TIMEOUT" default:"5s"`
+	IdleTimeout    time.Duration `envconfig:"HTTP_SERVER_IDLE_TIMEOUT" default:"60s"`
+	Port           int           `envconfig:"PORT" default:"8080"`
+	ReadTimeout    time.Duration `envconfig:"HTTP_SERVER_READ_TIMEOUT" default:"5s"`
+	WriteTimeout   time.Duration `envconfig:"HTTP_SERVER_WRITE_TIMEOUT" default:"5s"`
+	MetricsToken   string        `envconfig:"METRICS_TOKEN"`
+	TrustedProxies []string      `envconfig:"TRUSTED_PROXIES"`
 }
 
 type Database struct {
@@ -27,6 +42,85 @@ type Database struct {
 	CustomerManagementCollectionName string `envconfig:"CUSTOMER_MANAGEMENT_COLLECTION_NAME" default:"CustomerManagementCollection"`
 }
 
+// Provisioning lists what is created alongside a new shipment, in order.
+// The known steps are "checklist", "pda" and "notifications".
+type Provisioning struct {
+	ShipmentProvisioningSteps []string `envconfig:"SHIPMENT_PROVISIONING_STEPS" default:"checklist,pda,notifications"`
+}
+
+// Trash is how long deleted documents can be restored before they are purged, and how often that is checked.
+type Trash struct {
+	TrashRetention     time.Duration `envconfig:"TRASH_RETENTION" default:"720h"`
+	TrashPurgeInterval time.Duration `envconfig:"TRASH_PURGE_INTERVAL" default:"1h"`
+}
+
+// Migrations sets whether the server applies pending database migrations when it starts.
+// With it off they are applied with crmctl migrate before deploying.
+type Migrations struct {
+	MigrateOnStartup bool `envconfig:"MIGRATE_ON_STARTUP" default:"true"`
+}
+
+// Invitations is how long a tenant admin's invitation to register can be used for.
+type Invitations struct {
+	InvitationTTL time.Duration `envconfig:"INVITATION_TTL" default:"168h"`
+}
+
+// Lockout is when repeated failed logins lock an account, or an IP address, out. After Threshold failures
+// it is locked for LockoutDuration, doubled with every further failure up to LockoutMaxDuration.
+// Failures are forgotten LockoutWindow after the last one, or for an account when its user logs in.
+type Lockout struct {
+	LockoutAccountThreshold int           `envconfig:"LOCKOUT_ACCOUNT_THRESHOLD" default:"5"`
+	LockoutIPThreshold      int           `envconfig:"LOCKOUT_IP_THRESHOLD" default:"50"`
+	LockoutDuration         time.Duration `envconfig:"LOCKOUT_DURATION" default:"1m"`
+	LockoutMaxDuration      time.Duration `envconfig:"LOCKOUT_MAX_DURATION" default:"1h"`
+	LockoutWindow           time.Duration `envconfig:"LOCKOUT_WINDOW" default:"24h"`
+}
+
+// JWT lists the keys tokens are signed and verified with, each "kid:algorithm:key" as auth.NewKeySet takes them,
+// and the kid of the one new tokens are signed with, the first if it is empty. Without keys a random key is used,
+// and sessions end when the server restarts.
+type JWT struct {
+	JWTKeys         []string `envconfig:"JWT_KEYS"`
+	JWTSigningKeyID string   `envconfig:"JWT_SIGNING_KEY_ID"`
+}
+
+// EmailWebhook is how the forwarder posting emails to /master_email_messages signs them, besides using an API key.
+// Secrets are "tenant:secret", more than one for a tenant while its secret is rotated; AllowedIPs are "tenant:CIDR",
+// and a tenant without any takes emails from any address. Signatures are refused Tolerance before or after their timestamp.
+type EmailWebhook struct {
+	EmailWebhookSecrets    []string      `envconfig:"EMAIL_WEBHOOK_SECRETS"`
+	EmailWebhookAllowedIPs []string      `envconfig:"EMAIL_WEBHOOK_ALLOWED_IPS"`
+	EmailWebhookTolerance  time.Duration `envconfig:"EMAIL_WEBHOOK_TOLERANCE" default:"5m"`
+}
+
+// SSO is where identity providers send users back to: SSOCallbackBaseURL followed by /login/sso/{tenant}/callback,
+// which is registered with each tenant's provider. Users are then sent on to SSOSuccessURL, the frontend, logged in.
+type SSO struct {
+	SSOCallbackBaseURL string `envconfig:"SSO_CALLBACK_BASE_URL"`
+	SSOSuccessURL      string `envconfig:"SSO_SUCCESS_URL"`
+}
+
+// RateLimit limits how fast each route group, "login", "email" or "api", may be called, with a token bucket for each
+// tenant, user (or API key) and IP address. RateLimits are "group:scope:requests/period" or, to allow bursts of more
+// requests than that, "group:scope:requests/period:burst", e.g. "api:user:20/1s:100"; scopes are tenant, user and ip.
+// BodyLimits are "group:bytes", the largest request body a group takes. The buckets are kept in memory, for each
+// instance of the server, unless RateLimitStore is "mongo".
+type RateLimit struct {
+	RateLimits     []string `envconfig:"RATE_LIMITS" default:"login:ip:20/1m:40,email:tenant:300/1m:600,email:ip:300/1m:600,api:ip:50/1s:200,api:user:20/1s:100,api:tenant:100/1s:400"`
+	BodyLimits     []string `envconfig:"BODY_LIMITS" default:"login:65536,email:10485760,api:1048576"`
+	RateLimitStore string   `envconfig:"RATE_LIMIT_STORE" default:"memory"`
+}
+
+// LLMUsage is what LLM calls cost and what each tenant may spend on them a month, unless crmctl sets its own budget.
+// LLMPrices are "model:input:output", the US dollars a million prompt and completion tokens of the model cost.
+// Past LLMSoftBudgetUSD a tenant is warned about, past LLMHardBudgetUSD its emails are sent to review instead of
+// being read by the LLM. Zero is no limit.
+type LLMUsage struct {
+	LLMPrices        []string `envconfig:"LLM_PRICES" default:"gpt-4o-mini:0.15:0.60"`
+	LLMSoftBudgetUSD float64  `envconfig:"LLM_SOFT_BUDGET_USD" default:"0"`
+	LLMHardBudgetUSD float64  `envconfig:"LLM_HARD_BUDGET_USD" default:"0"`
+}
+
 func Load() (Configuration, error) {
 	var cfg Configuration
 	err := envconfig.Process(envPrefix, &cfg)
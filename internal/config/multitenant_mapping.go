@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"strings"
+	"sync"
 )
 
 // type string string
@@ -15,19 +16,85 @@ const (
 	UNKNOWN       string = "unknown"
 )
 
+// builtInTenants maps the email domains of the tenants that are not stored in the database to their tenant.
+var builtInTenants = map[string]string{
+	"@customera.com":   CUSTOMERA,
+	"@customerb.com":   CUSTOMERB,
+	"@blushipping.com": BLUSHIPPING,
+	"@outlook.com":     COLUMBUS_TEST,
+}
+
 func MakeMapping(email string) string {
 	log.Println(email)
-	mapping := map[string]string{
-		"@customera.com":   CUSTOMERA,
-		"@customerb.com":   CUSTOMERB,
-		"@blushipping.com": BLUSHIPPING,
-		"@outlook.com":     COLUMBUS_TEST,
+	for domain, tenant := range builtInTenants {
+		if strings.HasSuffix(email, domain) {
+			return tenant
+		}
 	}
 
-	for domain, tenant := range mapping {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	for domain, tenant := range tenantDomains {
 		if strings.HasSuffix(email, domain) {
 			return tenant
 		}
 	}
 	return UNKNOWN
 }
+
+// Tenants added with crmctl, the tenants that have been disabled, those that require two-factor authentication
+// and those that log in with single sign-on, as last loaded from the database.
+var (
+	tenantsMu           sync.RWMutex
+	tenantDomains       = map[string]string{}
+	disabledTenants     = map[string]bool{}
+	totpRequiredTenants = map[string]bool{}
+	ssoTenants          = map[string]bool{}
+)
+
+// SetTenants replaces the tenants known on top of the built in ones: the tenant of each email domain,
+// the tenants whose users cannot log in, the tenants whose users must log in with a TOTP code
+// and the tenants whose users log in with their identity provider instead of a password.
+func SetTenants(domains map[string]string, disabled map[string]bool, totpRequired map[string]bool, sso map[string]bool) {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	tenantDomains = domains
+	disabledTenants = disabled
+	totpRequiredTenants = totpRequired
+	ssoTenants = sso
+}
+
+// IsTOTPRequired reports whether tenant's users must set up two-factor authentication, see SetTenants.
+func IsTOTPRequired(tenant string) bool {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	return totpRequiredTenants[tenant]
+}
+
+// IsSSOEnabled reports whether tenant's users log in with single sign-on, and so have no password, see SetTenants.
+func IsSSOEnabled(tenant string) bool {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	return ssoTenants[tenant]
+}
+
+// IsTenantDisabled reports whether tenant has been disabled, see SetTenants.
+func IsTenantDisabled(tenant string) bool {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	return disabledTenants[tenant]
+}
+
+// IsKnownTenant reports whether tenant is built in or has been loaded with SetTenants.
+func IsKnownTenant(tenant string) bool {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	for _, domains := range []map[string]string{builtInTenants, tenantDomains} {
+		for _, known := range domains {
+			if known == tenant {
+				return true
+			}
+		}
+	}
+	return disabledTenants[tenant] || totpRequiredTenants[tenant] || ssoTenants[tenant]
+}
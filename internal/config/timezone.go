@@ -0,0 +1,58 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// DEFAULT_TIMEZONE is the port timezone used when neither the tenant nor the
+// recipient has one configured. The built in tenants operate out of Singapore.
+const DEFAULT_TIMEZONE string = "Asia/Singapore"
+
+// tenantTimezones maps a tenant to the IANA timezone of the port it operates in, as set with crmctl
+// and last loaded from the database, see SetTenantTimezones.
+var tenantTimezones = map[string]string{}
+
+// LoadLocation resolves an IANA timezone name, falling back to the default
+// port timezone if the name is empty or unknown.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		name = DEFAULT_TIMEZONE
+	}
+	location, err := time.LoadLocation(name)
+	if err == nil {
+		return location
+	}
+	log.Printf("Unknown timezone %q, falling back to %s: %v", name, DEFAULT_TIMEZONE, err)
+
+	location, err = time.LoadLocation(DEFAULT_TIMEZONE)
+	if err != nil {
+		// tzdata is unavailable, Singapore has had a fixed +8 offset since 1982
+		return time.FixedZone("SGT", 8*60*60)
+	}
+	return location
+}
+
+// SetTenantTimezones replaces the port timezones of the tenants that have one set.
+func SetTenantTimezones(timezones map[string]string) {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	tenantTimezones = timezones
+}
+
+// TenantLocation returns the port timezone for the given tenant, DEFAULT_TIMEZONE when it has none set.
+func TenantLocation(tenant string) *time.Location {
+	tenantsMu.RLock()
+	name := tenantTimezones[tenant]
+	tenantsMu.RUnlock()
+	return LoadLocation(name)
+}
+
+// RecipientLocation returns the timezone a message recipient should see times in,
+// preferring their own configured timezone over the tenant's port timezone.
+func RecipientLocation(recipientTimezone string, tenant string) *time.Location {
+	if recipientTimezone != "" {
+		return LoadLocation(recipientTimezone)
+	}
+	return TenantLocation(tenant)
+}
@@ -0,0 +1,115 @@
+// Package migrations brings the database's indexes and stored documents up to date with the code.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollectionName is where the versions that have been applied are recorded.
+const MigrationsCollectionName = "SchemaMigrations"
+
+// Migration is one versioned change to the database. Up must be idempotent: it is run again
+// if it fails part way, or if two instances start at the same time.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// AppliedMigration is the record of a migration having been applied.
+type AppliedMigration struct {
+	Version     int       `bson:"_id" json:"version"`
+	Description string    `json:"description"`
+	AppliedAt   time.Time `json:"applied_at"`
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewMigrator applies migrations, which must have unique versions, to db in order of version.
+func NewMigrator(db *mongo.Database, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("migration version %d is used twice", sorted[i].Version)
+		}
+	}
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// Applied returns the migrations applied so far, oldest first.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := m.db.Collection(MigrationsCollectionName).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := []AppliedMigration{}
+	if err = cursor.All(ctx, &applied); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Pending returns the migrations that have not been applied, in the order they will be.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(m.migrations, applied), nil
+}
+
+// Run applies the pending migrations in order and returns the versions it applied.
+// It stops at the first that fails, leaving it and the ones after it pending.
+func (m *Migrator) Run(ctx context.Context) ([]int, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []int
+	for _, migration := range pending {
+		log.Printf("Applying migration %d: %s", migration.Version, migration.Description)
+		if err := migration.Up(ctx, m.db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+		_, err := m.db.Collection(MigrationsCollectionName).ReplaceOne(ctx,
+			bson.M{"_id": migration.Version},
+			AppliedMigration{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()},
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration.Version)
+	}
+	return ran, nil
+}
+
+func pendingMigrations(migrations []Migration, applied []AppliedMigration) []Migration {
+	done := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
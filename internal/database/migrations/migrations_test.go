@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewMigrator(t *testing.T) {
+	_, err := NewMigrator(nil, All)
+	assert.NoError(t, err)
+
+	_, err = NewMigrator(nil, []Migration{{Version: 1}, {Version: 2}, {Version: 1}})
+	assert.Error(t, err)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil, []Migration{{Version: 3}, {Version: 1}, {Version: 2}})
+	assert.NoError(t, err)
+
+	pending := pendingMigrations(migrator.migrations, []AppliedMigration{{Version: 2}})
+	assert.Len(t, pending, 2)
+	assert.Equal(t, 1, pending[0].Version)
+	assert.Equal(t, 3, pending[1].Version)
+}
+
+func TestLegacyChecklistItems(t *testing.T) {
+	items := legacyChecklistItems(bson.M{
+		"portdues": bson.M{"checklistinformation": bson.M{"supplier": "MPA", "serviceprovided": true}},
+		"repairs": bson.M{
+			"deslopping": bson.M{"checklistinformation": bson.M{"supplier": "Clean Seas", "serviceprovided": false}},
+		},
+		"extras": bson.M{
+			"sludge": bson.M{"name": "Sludge Removal", "supplier": "Sludge Co", "serviceprovided": true},
+			"pilot":  bson.M{"name": "Pilotage", "supplier": "dup"},
+		},
+	})
+
+	portDues := items.Find("port_dues")
+	assert.Equal(t, "MPA", portDues.Supplier)
+	assert.True(t, portDues.ServiceProvided)
+	assert.Equal(t, "Clean Seas", items.Find("deslopping").Supplier)
+	assert.Equal(t, "", items.Find("pilotage").Supplier, "extras do not overwrite template items")
+
+	sludge := items.Find("sludge_removal")
+	assert.Equal(t, "Extras", sludge.Category)
+	assert.Equal(t, "Sludge Co", sludge.Supplier)
+	assert.True(t, sludge.ServiceProvided)
+	assert.Equal(t, sludge, items[len(items)-1])
+}
@@ -0,0 +1,340 @@
+package migrations
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All is every migration, in the order they are applied. Append new migrations with the next version,
+// never change or renumber one that has been released.
+var All = []Migration{
+	{Version: 1, Description: "index tenant and shipment lookups", Up: createLookupIndexes},
+	{Version: 2, Description: "expire sessions with a TTL index", Up: createSessionIndexes},
+	{Version: 3, Description: "unique user emails and master data per tenant", Up: createUniqueIndexes},
+	{Version: 4, Description: "move legacy checklist services into items", Up: migrateLegacyChecklists},
+	{Version: 5, Description: "unique tenant names", Up: createTenantIndexes},
+	{Version: 6, Description: "verify and give a role to users registered before invitations", Up: migrateUsersToInvitations},
+	{Version: 7, Description: "expire login attempts and password resets", Up: createLoginAttemptIndexes},
+	{Version: 8, Description: "look up API keys by their hash", Up: createAPIKeyIndexes},
+	{Version: 9, Description: "expire single sign-ons and look them up by state", Up: createSSOLoginIndexes},
+	{Version: 10, Description: "expire full rate limit buckets", Up: createRateLimitIndexes},
+	{Version: 11, Description: "look up LLM usage by month", Up: createLLMUsageIndexes},
+	{Version: 12, Description: "redact secrets recorded in the audit log", Up: redactAuditLog},
+	{Version: 13, Description: "one crew roster per shipment", Up: createCrewChangeIndexes},
+}
+
+func createLookupIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{
+		database.ShipmentsCollectionName, database.CustomersCollectionName, database.VesselsCollectionName, database.SuppliersCollectionName, database.TerminalsCollectionName,
+		database.AgentsCollectionName, database.ActivityTypesCollectionName, database.ProductTypesCollectionName, database.ChecklistTemplatesCollectionName, database.NotificationsCollectionName,
+	} {
+		if err := createIndexes(ctx, db, name, mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}}}); err != nil {
+			return err
+		}
+	}
+
+	// documents that belong to a shipment are looked up by it
+	for _, name := range []string{database.ChecklistsCollectionName, database.InvoicesCollectionName, database.CrewChangesCollectionName, database.FeedEmailsCollectionName, database.NotificationsCollectionName} {
+		if err := createIndexes(ctx, db, name, mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "shipmentid", Value: 1}}}); err != nil {
+			return err
+		}
+	}
+
+	if err := createIndexes(ctx, db, database.FeedEmailsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "masteremail", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "reviewstatus", Value: 1}}},
+	); err != nil {
+		return err
+	}
+	if err := createIndexes(ctx, db, database.ShipmentsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "masteremail", Value: 1}}},
+	); err != nil {
+		return err
+	}
+	return createIndexes(ctx, db, database.AuditLogCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "createdat", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "entitytype", Value: 1}, {Key: "entityid", Value: 1}, {Key: "createdat", Value: -1}}},
+	)
+}
+
+func createSessionIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.SessionsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "jwt_token", Value: 1}}},
+		// Mongo removes sessions once they expire
+		mongo.IndexModel{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+// Unique keys include deletedat, so a deleted document does not keep its key from being used again,
+// and restoring it fails with a duplicate key if it has been. Documents without the key at all are not checked.
+func createUniqueIndexes(ctx context.Context, db *mongo.Database) error {
+	unique := func(field string, present bson.M) mongo.IndexModel {
+		return mongo.IndexModel{
+			Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: field, Value: 1}, {Key: "deletedat", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: present}),
+		}
+	}
+	nonEmpty := bson.M{"$gt": ""}
+
+	for name, model := range map[string]mongo.IndexModel{
+		database.UsersCollectionName:     unique("email", nonEmpty),
+		database.CustomersCollectionName: unique("customer", nonEmpty),
+		database.VesselsCollectionName:   unique("vesselspecifications.imonumber", bson.M{"$gt": 0}),
+		database.AgentsCollectionName:    unique("email", nonEmpty),
+		database.TerminalsCollectionName: unique("terminalspecifications.email", nonEmpty),
+	} {
+		if err := createIndexes(ctx, db, name, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTenantIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.TenantsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}}, Options: options.Index().SetUnique(true)},
+	)
+}
+
+// Users registered before invitations never verified their email, but have been using it to log in,
+// and had no role. They are kept able to log in as members; tenant admins are then chosen with crmctl.
+func migrateUsersToInvitations(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection(database.UsersCollectionName)
+	if _, err := users.UpdateMany(ctx, bson.M{"emailverified": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"emailverified": true}}); err != nil {
+		return err
+	}
+	if _, err := users.UpdateMany(ctx, bson.M{"role": bson.M{"$in": bson.A{nil, ""}}}, bson.M{"$set": bson.M{"role": enum.USER_ROLE_MEMBER}}); err != nil {
+		return err
+	}
+	return createIndexes(ctx, db, database.InvitationsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "email", Value: 1}}},
+	)
+}
+
+func createLoginAttemptIndexes(ctx context.Context, db *mongo.Database) error {
+	expire := mongo.IndexModel{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+	if err := createIndexes(ctx, db, database.LoginAttemptsCollectionName, expire); err != nil {
+		return err
+	}
+	return createIndexes(ctx, db, database.PasswordResetsCollectionName, expire)
+}
+
+func createAPIKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.APIKeysCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}}},
+	)
+}
+
+func createSSOLoginIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.SSOLoginsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		mongo.IndexModel{Keys: bson.D{{Key: "state", Value: 1}}, Options: options.Index().SetUnique(true)},
+	)
+}
+
+func createRateLimitIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.RateLimitsCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "expiresat", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	)
+}
+
+func createLLMUsageIndexes(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, database.LLMUsagesCollectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "tenant", Value: 1}, {Key: "month", Value: 1}}},
+	)
+}
+
+// redactAuditLog redacts the secrets, see database.RedactAuditChanges, that were recorded in the audit log
+// before their fields were redacted.
+func redactAuditLog(ctx context.Context, db *mongo.Database) error {
+	auditLog := db.Collection(database.AuditLogCollectionName)
+	cursor, err := auditLog.Find(ctx, bson.M{"changes.path": bson.M{"$regex": database.RedactedPathPattern()}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry struct {
+			ID      primitive.ObjectID     `bson:"_id"`
+			Changes []database.AuditChange `bson:"changes"`
+		}
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if !database.RedactAuditChanges(entry.Changes) {
+			continue
+		}
+		if _, err := auditLog.UpdateOne(ctx, bson.M{"_id": entry.ID}, bson.M{"$set": bson.M{"changes": entry.Changes}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// createCrewChangeIndexes keeps a shipment to one crew roster, so that two first saves of it at the same time
+// do not create two. Rosters already duplicated are moved to the trash, all but the last updated, so that the index
+// can be built; they stay there to be looked at, and cannot be restored over the one kept.
+func createCrewChangeIndexes(ctx context.Context, db *mongo.Database) error {
+	crewChanges := db.Collection(database.CrewChangesCollectionName)
+	cursor, err := crewChanges.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deletedat": nil}}},
+		{{Key: "$sort", Value: bson.D{{Key: "updatedat", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"tenant": "$tenant", "shipmentid": "$shipmentid"}, "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var duplicates struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.Decode(&duplicates); err != nil {
+			return err
+		}
+		for i, id := range duplicates.IDs[1:] {
+			// each is deleted at a time of its own, as the time is part of the unique key
+			deletedAt := now.Add(time.Duration(i) * time.Millisecond)
+			update := bson.M{"$set": bson.M{"deletedat": deletedAt, "deletedby": "migration"}, "$inc": bson.M{"version": 1}}
+			if _, err := crewChanges.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return createIndexes(ctx, db, database.CrewChangesCollectionName, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "shipmentid", Value: 1}, {Key: "deletedat", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+}
+
+// createIndexes creates the indexes that do not exist yet. Creating an index that exists with the same options does nothing.
+func createIndexes(ctx context.Context, db *mongo.Database, collection string, models ...mongo.IndexModel) error {
+	_, err := db.Collection(collection).Indexes().CreateMany(ctx, models)
+	return err
+}
+
+// Checklists stored before templates kept each service in a field of its own, e.g. portdues,
+// with its supplier under checklistinformation, and any other services under extras.
+var legacyChecklistPaths = map[string]string{
+	"port_dues":          "portdues",
+	"pilotage":           "pilotage",
+	"service_launch":     "servicelaunch",
+	"logistics":          "logistics",
+	"hotel_charges":      "hotelcharges",
+	"air_tickets":        "airtickets",
+	"transport_charges":  "transportcharges",
+	"medicine_supplies":  "medicinesupplies",
+	"fresh_water_supply": "freshwatersupply",
+	"marine_advisory":    "marineadvisory",
+	"courier_services":   "courierservices",
+	"cross_harbour_fees": "crossharbourfees",
+	"supply_boat":        "supplyboat",
+	"deslopping":         "repairs.deslopping",
+	"lift_repair":        "repairs.liftrepair",
+	"uw_clean":           "repairs.uwclean",
+}
+
+var legacyChecklistFields = []string{
+	"portdues", "pilotage", "servicelaunch", "logistics", "hotelcharges", "airtickets", "transportcharges", "medicinesupplies",
+	"freshwatersupply", "marineadvisory", "courierservices", "crossharbourfees", "supplyboat", "repairs", "extras",
+}
+
+func migrateLegacyChecklists(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection(database.ChecklistsCollectionName)
+
+	hasLegacyField := bson.A{}
+	unset := bson.M{}
+	for _, field := range legacyChecklistFields {
+		hasLegacyField = append(hasLegacyField, bson.M{field: bson.M{"$exists": true}})
+		unset[field] = ""
+	}
+	cursor, err := collection.Find(ctx, bson.M{"$or": hasLegacyField})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document bson.M
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		update := bson.M{"$unset": unset, "$inc": bson.M{"version": 1}}
+		// checklists already given items keep them, only the legacy fields go
+		if items, ok := document["items"].(bson.A); !ok || len(items) == 0 {
+			update["$set"] = bson.M{"items": legacyChecklistItems(document)}
+		}
+		id, _ := document["_id"].(primitive.ObjectID)
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// legacyChecklistItems makes the items of a legacy checklist: the default template's items with the
+// supplier and progress the checklist recorded for them, then its extras in name order.
+func legacyChecklistItems(document bson.M) core.ChecklistItems {
+	items := core.NewChecklistItems(core.DefaultChecklistTemplateItems)
+	for _, item := range items {
+		if info, ok := lookupDocument(document, legacyChecklistPaths[item.Key]+".checklistinformation"); ok {
+			item.Supplier, _ = info["supplier"].(string)
+			item.ServiceProvided, _ = info["serviceprovided"].(bool)
+		}
+	}
+
+	extras, _ := document["extras"].(bson.M)
+	names := make([]string, 0, len(extras))
+	for name := range extras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		extra, ok := extras[name].(bson.M)
+		if !ok {
+			continue
+		}
+		if extraName, _ := extra["name"].(string); extraName != "" {
+			name = extraName
+		}
+		key := core.ChecklistItemKey(name)
+		if key == "" || items.Find(key) != nil {
+			continue
+		}
+		item := core.NewChecklistItem(core.ChecklistTemplateItem{Key: key, Name: name, Category: "Extras"})
+		item.Supplier, _ = extra["supplier"].(string)
+		item.ServiceProvided, _ = extra["serviceprovided"].(bool)
+		items = append(items, item)
+	}
+	return items
+}
+
+func lookupDocument(document bson.M, path string) (bson.M, bool) {
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := document[key].(bson.M)
+		if !ok {
+			return nil, false
+		}
+		document = nested
+	}
+	return document, true
+}
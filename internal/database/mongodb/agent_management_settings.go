@@ -11,19 +11,24 @@ type Agent struct {
 	Name      string     `json:"name"`
 	Email     string     `json:"email"`
 	Contact   string     `json:"contact"`
+	Timezone  string     `json:"timezone"`
 	Tenant    string     `json:"tenant"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 type AgentManagementResponse struct {
-	ID        string    `bson:"_id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Contact   string    `json:"contact"`
-	Tenant    string    `json:"tenant"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `bson:"_id"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Contact   string     `json:"contact"`
+	Timezone  string     `json:"timezone"`
+	Tenant    string     `json:"tenant"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 type AgentCollection struct {
@@ -44,6 +49,7 @@ func (r *AgentCollection) Create(ctx context.Context, entity Agent) (string, err
 		Name:      entity.Name,
 		Email:     entity.Email,
 		Contact:   entity.Contact,
+		Timezone:  entity.Timezone,
 		Tenant:    entity.Tenant,
 		CreatedAt: &now,
 		UpdatedAt: &now,
@@ -51,18 +57,19 @@ func (r *AgentCollection) Create(ctx context.Context, entity Agent) (string, err
 	return r.GenericCollection.Create(ctx, agent)
 }
 
-func (r *AgentCollection) Update(ctx context.Context, id string, entity Agent) error {
+func (r *AgentCollection) Update(ctx context.Context, id string, tenant string, entity Agent) error {
 	now := time.Now()
 
 	agent := Agent{
 		Name:      entity.Name,
 		Email:     entity.Email,
 		Contact:   entity.Contact,
+		Timezone:  entity.Timezone,
 		Tenant:    entity.Tenant,
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: &now,
 	}
-	return r.GenericCollection.Update(ctx, id, agent)
+	return r.GenericCollection.Update(ctx, id, tenant, agent)
 }
 
 func (r *AgentCollection) GetAll(ctx context.Context, tenant string) ([]AgentManagementResponse, error) {
@@ -73,6 +80,6 @@ func (r *AgentCollection) GetByID(ctx context.Context, id string, tenant string)
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *AgentCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *AgentCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
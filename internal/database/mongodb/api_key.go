@@ -0,0 +1,62 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// APIKey lets a script or partner system call the API as Tenant, for Scopes, until ExpiresAt.
+// Only the Hash of the key is stored; a revoked key is deleted.
+type APIKey struct {
+	Tenant     string             `json:"tenant"`
+	Name       string             `json:"name"`
+	Hash       string             `json:"-"`
+	Scopes     []enum.APIKeyScope `json:"scopes"`
+	CreatedBy  string             `json:"created_by"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	LastUsedAt time.Time          `json:"last_used_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type APIKeyResponse struct {
+	ID         string             `bson:"_id" json:"id"`
+	Version    int64              `json:"version"`
+	DeletedAt  *time.Time         `json:"deleted_at,omitempty"`
+	DeletedBy  string             `json:"deleted_by,omitempty"`
+	Tenant     string             `json:"tenant"`
+	Name       string             `json:"name"`
+	Hash       string             `json:"-"`
+	Scopes     []enum.APIKeyScope `json:"scopes"`
+	CreatedBy  string             `json:"created_by"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	LastUsedAt time.Time          `json:"last_used_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type APIKeyCollection struct {
+	*GenericCollection[APIKey, APIKeyResponse]
+}
+
+func NewAPIKeyCollection(collection *mongo.Collection) *APIKeyCollection {
+	return &APIKeyCollection{
+		GenericCollection: NewGenericCollection[APIKey, APIKeyResponse](collection),
+	}
+}
+
+var _ Collection[APIKey, APIKeyResponse] = (*APIKeyCollection)(nil)
+
+func (r *APIKeyCollection) Create(ctx context.Context, entity APIKey) (string, error) {
+	apiKey := APIKey{
+		Tenant:    entity.Tenant,
+		Name:      entity.Name,
+		Hash:      entity.Hash,
+		Scopes:    entity.Scopes,
+		CreatedBy: entity.CreatedBy,
+		ExpiresAt: entity.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, apiKey)
+}
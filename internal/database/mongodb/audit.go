@@ -0,0 +1,381 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections with an audit log, see GenericCollection.EnableAudit, record every document they change:
+// who changed it, from where, and the fields that changed with their values before and after.
+
+// AuditEntry is one change to one document.
+type AuditEntry struct {
+	Tenant     string           `json:"tenant"`
+	Actor      string           `json:"actor"`
+	EntityType string           `json:"entity_type"`
+	EntityID   string           `json:"entity_id"`
+	Action     enum.AuditAction `json:"action"`
+	Changes    []AuditChange    `json:"changes"`
+	RequestID  string           `json:"request_id"`
+	Source     enum.AuditSource `json:"source"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+type AuditEntryResponse struct {
+	ID         string           `bson:"_id,omitempty" json:"id"`
+	Tenant     string           `json:"tenant"`
+	Actor      string           `json:"actor"`
+	EntityType string           `json:"entity_type"`
+	EntityID   string           `json:"entity_id"`
+	Action     enum.AuditAction `json:"action"`
+	Changes    []AuditChange    `json:"changes"`
+	RequestID  string           `json:"request_id"`
+	Source     enum.AuditSource `json:"source"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// AuditChange is the value of one field before and after a change, by its bson path, e.g. "vesselspecifications.vesselname".
+// Before is nil for a field the change added and After is nil for one it removed.
+type AuditChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter picks audit entries. Only the tenant is required, empty fields match everything.
+type AuditFilter struct {
+	Tenant     string
+	Actor      string
+	EntityType string
+	EntityID   string
+	Action     enum.AuditAction
+	Source     enum.AuditSource
+	RequestID  string
+	From       time.Time
+	To         time.Time
+	Limit      int64
+}
+
+const (
+	defaultAuditLimit int64 = 100
+	maxAuditLimit     int64 = 1000
+)
+
+// AuditTrail is the audit log as it is read.
+type AuditTrail interface {
+	Find(ctx context.Context, filter AuditFilter) ([]AuditEntryResponse, error)
+}
+
+type AuditLog struct {
+	collection *mongo.Collection
+}
+
+func NewAuditLog(collection *mongo.Collection) *AuditLog {
+	return &AuditLog{collection: collection}
+}
+
+var _ AuditTrail = (*AuditLog)(nil)
+
+// Record writes an entry for each document whose snapshot differs before and after a write.
+// Entries are written with ctx, so within a unit of work they are stored only if the write is.
+func (l *AuditLog) Record(ctx context.Context, entityType string, action enum.AuditAction, before map[primitive.ObjectID]bson.M, after map[primitive.ObjectID]bson.M) error {
+	ids := make([]primitive.ObjectID, 0, len(before)+len(after))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Hex() < ids[j].Hex() })
+
+	var entries []interface{}
+	now := time.Now()
+	for _, id := range ids {
+		changes := AuditChanges(before[id], after[id])
+		if len(changes) == 0 {
+			continue
+		}
+		tenant, _ := after[id]["tenant"].(string)
+		if tenant == "" {
+			tenant, _ = before[id]["tenant"].(string)
+		}
+		entries = append(entries, AuditEntry{
+			Tenant:     tenant,
+			Actor:      Actor(ctx),
+			EntityType: entityType,
+			EntityID:   id.Hex(),
+			Action:     action,
+			Changes:    changes,
+			RequestID:  RequestID(ctx),
+			Source:     Source(ctx),
+			CreatedAt:  now,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := l.collection.InsertMany(ctx, entries)
+	return err
+}
+
+// Find returns the entries matching filter, newest first.
+func (l *AuditLog) Find(ctx context.Context, filter AuditFilter) ([]AuditEntryResponse, error) {
+	query := bson.D{{Key: "tenant", Value: filter.Tenant}}
+	for key, value := range map[string]string{
+		"actor":      filter.Actor,
+		"entitytype": filter.EntityType,
+		"entityid":   filter.EntityID,
+		"action":     string(filter.Action),
+		"source":     string(filter.Source),
+		"requestid":  filter.RequestID,
+	} {
+		if value != "" {
+			query = append(query, bson.E{Key: key, Value: value})
+		}
+	}
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query = append(query, bson.E{Key: "createdat", Value: createdAt})
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}}).SetLimit(limit)
+	cursor, err := l.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []AuditEntryResponse{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// fields left out of audit entries: they change with every write and say nothing about what changed
+var unauditedPaths = map[string]bool{
+	"_id":        true,
+	"updatedat":  true,
+	versionField: true,
+}
+
+const redacted = "[redacted]"
+
+// redactedFields are the fields whose values are secrets, or hashes of secrets, and are never written to the audit log,
+// at any depth: the users' passwords, TOTP secrets and recovery code hashes, the hashes of the API keys
+// and the tenants' single sign-on client secrets.
+var redactedFields = map[string]bool{
+	"password":      true,
+	"totpsecret":    true,
+	"recoverycodes": true,
+	"hash":          true,
+	"clientsecret":  true,
+}
+
+// isRedacted reports whether the field at path holds a secret, see redactedFields.
+func isRedacted(path string) bool {
+	return redactedFields[path[strings.LastIndex(path, ".")+1:]]
+}
+
+// redact replaces the values of the change with redacted if its field holds a secret, and reports whether it did.
+func (c *AuditChange) redact() bool {
+	if !isRedacted(c.Path) {
+		return false
+	}
+	changed := false
+	if c.Before != nil && c.Before != redacted {
+		c.Before, changed = redacted, true
+	}
+	if c.After != nil && c.After != redacted {
+		c.After, changed = redacted, true
+	}
+	return changed
+}
+
+// RedactAuditChanges redacts the secrets among changes recorded before their field was redacted,
+// and reports whether there were any.
+func RedactAuditChanges(changes []AuditChange) bool {
+	changed := false
+	for i := range changes {
+		if changes[i].redact() {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// RedactedPathPattern is a regular expression matching the paths of the fields that are redacted.
+func RedactedPathPattern() string {
+	fields := make([]string, 0, len(redactedFields))
+	for field := range redactedFields {
+		fields = append(fields, regexp.QuoteMeta(field))
+	}
+	sort.Strings(fields)
+	return `(^|\.)(` + strings.Join(fields, "|") + `)$`
+}
+
+// AuditChanges compares two snapshots of a document field by field, in path order.
+// Arrays are compared whole, and the values of secret fields, see redactedFields, are redacted.
+func AuditChanges(before bson.M, after bson.M) []AuditChange {
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+	flattenDocument(beforeFields, "", before)
+	flattenDocument(afterFields, "", after)
+
+	paths := make([]string, 0, len(beforeFields)+len(afterFields))
+	for path := range beforeFields {
+		paths = append(paths, path)
+	}
+	for path := range afterFields {
+		if _, ok := beforeFields[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var changes []AuditChange
+	for _, path := range paths {
+		if unauditedPaths[path] {
+			continue
+		}
+		beforeValue, afterValue := beforeFields[path], afterFields[path]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		change := AuditChange{Path: path, Before: beforeValue, After: afterValue}
+		change.redact()
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func flattenDocument(fields map[string]interface{}, path string, document map[string]interface{}) {
+	for key, value := range document {
+		switch nested := value.(type) {
+		case bson.M:
+			flattenDocument(fields, joinPath(path, key), nested)
+		case bson.D:
+			nestedFields := make(map[string]interface{}, len(nested))
+			for _, e := range nested {
+				nestedFields[e.Key] = e.Value
+			}
+			flattenDocument(fields, joinPath(path, key), nestedFields)
+		default:
+			if value != nil {
+				fields[joinPath(path, key)] = value
+			}
+		}
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID tags the writes done with the returned ctx with the ID of the request that made them.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID is the request ID set with WithRequestID, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+type sourceKey struct{}
+
+// WithSource names where the writes done with the returned ctx come from.
+func WithSource(ctx context.Context, source enum.AuditSource) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// Source is the source set with WithSource, or "" if there is none.
+func Source(ctx context.Context) enum.AuditSource {
+	source, _ := ctx.Value(sourceKey{}).(enum.AuditSource)
+	return source
+}
+
+// EnableAudit makes the collection record every document it changes in log, as entityType.
+func (r *GenericCollection[S, T]) EnableAudit(log *AuditLog, entityType string) {
+	r.auditLog = log
+	r.entityType = entityType
+}
+
+// audited runs write, and records the documents matching filter, and those it returns the IDs of, as changed by action.
+// filter is nil for writes that only add documents.
+func (r *GenericCollection[S, T]) audited(ctx context.Context, action enum.AuditAction, filter interface{}, write func() ([]primitive.ObjectID, error)) error {
+	if r.auditLog == nil {
+		_, err := write()
+		return err
+	}
+
+	before := map[primitive.ObjectID]bson.M{}
+	if filter != nil {
+		var err error
+		if before, err = r.snapshot(ctx, filter); err != nil {
+			return err
+		}
+	}
+	written, err := write()
+	if err != nil {
+		return err
+	}
+
+	ids := written
+	for id := range before {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	after, err := r.snapshot(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	return r.auditLog.Record(ctx, r.entityType, action, before, after)
+}
+
+// snapshot reads the documents matching filter as stored, by ID.
+func (r *GenericCollection[S, T]) snapshot(ctx context.Context, filter interface{}) (map[primitive.ObjectID]bson.M, error) {
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []bson.M
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	snapshot := make(map[primitive.ObjectID]bson.M, len(documents))
+	for _, document := range documents {
+		if id, ok := document["_id"].(primitive.ObjectID); ok {
+			snapshot[id] = document
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuditChanges(t *testing.T) {
+	id := primitive.NewObjectID()
+	before := bson.M{
+		"_id":                  id,
+		"tenant":               "tenantA",
+		"version":              int64(1),
+		"currentstatus":        "Vessel Arrived",
+		"vesselspecifications": bson.M{"vesselname": "UOG IOANNIS V", "imonumber": int64(9434345)},
+		"remarks":              "berth 3",
+		"password":             "$2a$hash",
+		"sso":                  bson.M{"issuer": "https://idp.tenanta.com", "clientsecret": "old-secret"},
+	}
+	after := bson.M{
+		"_id":                  id,
+		"tenant":               "tenantA",
+		"version":              int64(2),
+		"currentstatus":        "NOR Tendered",
+		"vesselspecifications": bson.M{"vesselname": "UOG IOANNIS", "imonumber": int64(9434345)},
+		"deletedby":            "ops@tenanta.com",
+		"password":             "$2a$newhash",
+		"hash":                 "9f86d081",
+		"sso":                  bson.M{"issuer": "https://idp.tenanta.com", "clientsecret": "new-secret"},
+	}
+
+	assert.Equal(t, []AuditChange{
+		{Path: "currentstatus", Before: "Vessel Arrived", After: "NOR Tendered"},
+		{Path: "deletedby", Before: nil, After: "ops@tenanta.com"},
+		{Path: "hash", Before: nil, After: redacted},
+		{Path: "password", Before: redacted, After: redacted},
+		{Path: "remarks", Before: "berth 3", After: nil},
+		{Path: "sso.clientsecret", Before: redacted, After: redacted},
+		{Path: "vesselspecifications.vesselname", Before: "UOG IOANNIS V", After: "UOG IOANNIS"},
+	}, AuditChanges(before, after))
+
+	assert.Empty(t, AuditChanges(before, before))
+
+	// changes recorded before a field was redacted are redacted afterwards
+	recorded := []AuditChange{
+		{Path: "currentstatus", Before: "Vessel Arrived", After: "NOR Tendered"},
+		{Path: "sso.clientsecret", Before: nil, After: "secret"},
+		{Path: "totpsecret", Before: "JBSWY3DPEHPK3PXP", After: nil},
+		{Path: "recoverycodes", Before: bson.A{"9f86d081"}, After: bson.A{}},
+	}
+	assert.True(t, RedactAuditChanges(recorded))
+	assert.Equal(t, AuditChange{Path: "sso.clientsecret", Before: nil, After: redacted}, recorded[1])
+	assert.Equal(t, AuditChange{Path: "totpsecret", Before: redacted, After: nil}, recorded[2])
+	assert.Equal(t, AuditChange{Path: "recoverycodes", Before: redacted, After: redacted}, recorded[3])
+	assert.False(t, RedactAuditChanges(recorded))
+	assert.Regexp(t, RedactedPathPattern(), "sso.clientsecret")
+	assert.NotRegexp(t, RedactedPathPattern(), "hashtag")
+}
+
+func TestRequestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", RequestID(ctx))
+	assert.Equal(t, enum.AuditSource(""), Source(ctx))
+
+	ctx = WithSource(WithRequestID(ctx, "host/abc-000001"), enum.AUDIT_SOURCE_EMAIL)
+	assert.Equal(t, "host/abc-000001", RequestID(ctx))
+	assert.Equal(t, enum.AUDIT_SOURCE_EMAIL, Source(ctx))
+}
@@ -1,23 +1,53 @@
 package database
 
 import (
+	"backend-crm/pkg/enum"
 	"context"
 	"log"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type TenantUser struct {
-	Email    string `json:"email"`
-	Password string `json:"password"` // Ensure passwords are hashed and never stored as plain text
-	Tenant   string `json:"tenant"`
+	Email         string        `json:"email"`
+	Password      string        `json:"password"` // Ensure passwords are hashed and never stored as plain text
+	Tenant        string        `json:"tenant"`
+	Disabled      bool          `json:"disabled"`
+	Role          enum.UserRole `json:"role"`
+	EmailVerified bool          `json:"email_verified"`
+	// TOTPSecret is set from enrolment, TOTPEnabled once the user has confirmed it with a code.
+	// TOTPLastStep is the time step of the last code used, RecoveryCodes the hashes of the unused recovery codes.
+	TOTPEnabled   bool     `json:"totp_enabled"`
+	TOTPSecret    string   `json:"-"`
+	TOTPLastStep  int64    `json:"-"`
+	RecoveryCodes []string `json:"-"`
 }
 
 type TenantUserResponse struct {
-	ID       string `bson:"_id,omitempty"`
-	Email    string `json:"email"`
-	Password string `json:"password"` // Ensure passwords are hashed and never stored as plain text
-	Tenant   string `json:"tenant"`
+	ID            string        `bson:"_id,omitempty"`
+	Version       int64         `json:"version"`
+	DeletedAt     *time.Time    `json:"deleted_at,omitempty"`
+	DeletedBy     string        `json:"deleted_by,omitempty"`
+	Email         string        `json:"email"`
+	Password      string        `json:"password"` // Ensure passwords are hashed and never stored as plain text
+	Tenant        string        `json:"tenant"`
+	Disabled      bool          `json:"disabled"`
+	Role          enum.UserRole `json:"role"`
+	EmailVerified bool          `json:"email_verified"`
+	TOTPEnabled   bool          `json:"totp_enabled"`
+	TOTPSecret    string        `json:"-"`
+	TOTPLastStep  int64         `json:"-"`
+	RecoveryCodes []string      `json:"-"`
+}
+
+// DisableTOTPPatch turns a user's two-factor authentication off and forgets its secret and recovery codes.
+func DisableTOTPPatch() Patch {
+	return Patch{
+		Set:   bson.D{{Key: "totpenabled", Value: false}},
+		Unset: bson.D{{Key: "totpsecret", Value: ""}, {Key: "totplaststep", Value: ""}, {Key: "recoverycodes", Value: ""}},
+	}
 }
 
 type LoginCollection struct {
@@ -34,9 +64,12 @@ var _ Collection[TenantUser, TenantUserResponse] = (*LoginCollection)(nil)
 
 func (r *LoginCollection) Create(ctx context.Context, entity TenantUser) (string, error) {
 	tenantUser := TenantUser{
-		Email:    entity.Email,
-		Password: entity.Password,
-		Tenant:   entity.Tenant,
+		Email:         entity.Email,
+		Password:      entity.Password,
+		Tenant:        entity.Tenant,
+		Disabled:      entity.Disabled,
+		Role:          entity.Role,
+		EmailVerified: entity.EmailVerified,
 	}
 	log.Println(tenantUser)
 	return r.GenericCollection.Create(ctx, tenantUser)
@@ -46,6 +79,6 @@ func (r *LoginCollection) GetByKeyValue(ctx context.Context, key string, value s
 	return r.GenericCollection.GetByKeyValue(ctx, key, value, tenant)
 }
 
-func (r *LoginCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *LoginCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -12,9 +13,12 @@ type CategoryManagementActivityType struct {
 }
 
 type CategoryManagementActivityTypeResponse struct {
-	ID           string `bson:"_id"`
-	ActivityType string `json:"activity_type"`
-	Tenant       string `json:"tenant"`
+	ID           string     `bson:"_id"`
+	Version      int64      `json:"version"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy    string     `json:"deleted_by,omitempty"`
+	ActivityType string     `json:"activity_type"`
+	Tenant       string     `json:"tenant"`
 }
 
 type ActivityTypeCollection struct {
@@ -54,6 +58,6 @@ func (r *ActivityTypeCollection) GetByID(ctx context.Context, id string, tenant
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *ActivityTypeCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *ActivityTypeCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -18,10 +19,13 @@ type CategoryManagementProductType struct {
 }
 
 type CategoryManagementProductTypeResponse struct {
-	ID              string   `bson:"_id"`
-	ProductType     string   `json:"product_type"`
-	SubProductsType []string `json:"sub_products_type"`
-	Tenant          string   `json:"tenant"`
+	ID              string     `bson:"_id"`
+	Version         int64      `json:"version"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy       string     `json:"deleted_by,omitempty"`
+	ProductType     string     `json:"product_type"`
+	SubProductsType []string   `json:"sub_products_type"`
+	Tenant          string     `json:"tenant"`
 }
 
 type ProductTypeCollection struct {
@@ -45,14 +49,14 @@ func (r *ProductTypeCollection) Create(ctx context.Context, entity CategoryManag
 	return r.GenericCollection.Create(ctx, ProductType)
 }
 
-func (r *ProductTypeCollection) Update(ctx context.Context, id string, entity CategoryManagementProductType) error {
+func (r *ProductTypeCollection) Update(ctx context.Context, id string, tenant string, entity CategoryManagementProductType) error {
 
 	ProductType := CategoryManagementProductType{
 		ProductType:     entity.ProductType,
 		SubProductsType: entity.SubProductsType,
 		Tenant:          entity.Tenant,
 	}
-	return r.GenericCollection.Update(ctx, id, ProductType)
+	return r.GenericCollection.Update(ctx, id, tenant, ProductType)
 }
 
 func (r *ProductTypeCollection) GetAll(ctx context.Context, tenant string) ([]CategoryManagementProductTypeResponse, error) {
@@ -63,6 +67,6 @@ func (r *ProductTypeCollection) GetByID(ctx context.Context, id string, tenant s
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *ProductTypeCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *ProductTypeCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
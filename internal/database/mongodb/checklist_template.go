@@ -0,0 +1,81 @@
+package database
+
+import (
+	"backend-crm/pkg/core"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ChecklistTemplate lists the services a tenant provides for an activity type.
+// A template with an empty ActivityType is the tenant's default.
+type ChecklistTemplate struct {
+	Tenant       string                       `json:"tenant"`
+	Name         string                       `json:"name"`
+	ActivityType string                       `json:"activity_type"`
+	Items        []core.ChecklistTemplateItem `json:"items"`
+	CreatedAt    time.Time                    `json:"created_at"`
+	UpdatedAt    time.Time                    `json:"updated_at"`
+}
+
+type ChecklistTemplateResponse struct {
+	ID           string                       `bson:"_id"`
+	Version      int64                        `json:"version"`
+	DeletedAt    *time.Time                   `json:"deleted_at,omitempty"`
+	DeletedBy    string                       `json:"deleted_by,omitempty"`
+	Tenant       string                       `json:"tenant"`
+	Name         string                       `json:"name"`
+	ActivityType string                       `json:"activity_type"`
+	Items        []core.ChecklistTemplateItem `json:"items"`
+	CreatedAt    time.Time                    `json:"created_at"`
+	UpdatedAt    time.Time                    `json:"updated_at"`
+}
+
+type ChecklistTemplateCollection struct {
+	*GenericCollection[ChecklistTemplate, ChecklistTemplateResponse]
+}
+
+func NewChecklistTemplateCollection(collection *mongo.Collection) *ChecklistTemplateCollection {
+	return &ChecklistTemplateCollection{
+		GenericCollection: NewGenericCollection[ChecklistTemplate, ChecklistTemplateResponse](collection),
+	}
+}
+
+var _ Collection[ChecklistTemplate, ChecklistTemplateResponse] = (*ChecklistTemplateCollection)(nil)
+
+func (r *ChecklistTemplateCollection) Create(ctx context.Context, entity ChecklistTemplate) (string, error) {
+	checklistTemplate := ChecklistTemplate{
+		Tenant:       entity.Tenant,
+		Name:         entity.Name,
+		ActivityType: entity.ActivityType,
+		Items:        entity.Items,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, checklistTemplate)
+}
+
+func (r *ChecklistTemplateCollection) Update(ctx context.Context, id string, tenant string, entity ChecklistTemplate) error {
+	checklistTemplate := ChecklistTemplate{
+		Tenant:       entity.Tenant,
+		Name:         entity.Name,
+		ActivityType: entity.ActivityType,
+		Items:        entity.Items,
+		CreatedAt:    entity.CreatedAt,
+		UpdatedAt:    time.Now(),
+	}
+	return r.GenericCollection.Update(ctx, id, tenant, checklistTemplate)
+}
+
+func (r *ChecklistTemplateCollection) GetAll(ctx context.Context, tenant string) ([]ChecklistTemplateResponse, error) {
+	return r.GenericCollection.GetAll(ctx, tenant)
+}
+
+func (r *ChecklistTemplateCollection) GetByID(ctx context.Context, id string, tenant string) (ChecklistTemplateResponse, error) {
+	return r.GenericCollection.GetByID(ctx, id, tenant)
+}
+
+func (r *ChecklistTemplateCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
+}
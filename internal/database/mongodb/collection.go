@@ -8,6 +8,7 @@ type Collection[S any, T any] interface {
 	GetByKeyValue(ctx context.Context, key string, value string, tenant string) (T, error)
 	GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]T, error)
 	Create(ctx context.Context, entity S) (string, error)
-	Update(ctx context.Context, id string, entity S) error
-	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, tenant string, entity S) error
+	Patch(ctx context.Context, id string, tenant string, patch Patch) error
+	Delete(ctx context.Context, id string, tenant string) error
 }
@@ -0,0 +1,42 @@
+package database
+
+// Names of the MongoDB collections.
+const (
+	ShipmentsCollectionName          = "ShipmentsCollection"
+	CustomersCollectionName          = "CustomerManagementCollection"
+	VesselsCollectionName            = "VesselManagementCollection"
+	SuppliersCollectionName          = "SupplierManagementCollection"
+	TerminalsCollectionName          = "TerminalManagementCollection"
+	AgentsCollectionName             = "AgentManagementCollection"
+	ActivityTypesCollectionName      = "CategoryManagementActivityTypeCollection"
+	ProductTypesCollectionName       = "CategoryManagementProductTypeCollection"
+	FeedEmailsCollectionName         = "FeedEmailCollection"
+	UsersCollectionName              = "LoginCollection"
+	InvoicesCollectionName           = "InvoicePricingCollection"
+	SessionsCollectionName           = "SessionCollection"
+	ChecklistsCollectionName         = "ChecklistCollection"
+	CrewChangesCollectionName        = "CrewChangeCollection"
+	ChecklistTemplatesCollectionName = "ChecklistTemplateCollection"
+	NotificationsCollectionName      = "NotificationCollection"
+	AuditLogCollectionName           = "AuditLogCollection"
+	TenantsCollectionName            = "TenantCollection"
+	InvitationsCollectionName        = "InvitationCollection"
+	PasswordResetsCollectionName     = "PasswordResetCollection"
+	LoginAttemptsCollectionName      = "LoginAttemptCollection"
+	APIKeysCollectionName            = "APIKeyCollection"
+	SSOLoginsCollectionName          = "SSOLoginCollection"
+	RateLimitsCollectionName         = "RateLimitCollection"
+	LLMUsagesCollectionName          = "LLMUsageCollection"
+	LLMSpendsCollectionName          = "LLMSpendCollection"
+)
+
+// TenantDataCollectionNames are the collections holding a tenant's data, which is exported and imported together.
+// Sessions, password resets, login attempts, single sign-ons and rate limits are left out, they are only kept for a short while,
+// and so are the monthly LLM spends, which sum up the LLM usage.
+var TenantDataCollectionNames = []string{
+	ShipmentsCollectionName, CustomersCollectionName, VesselsCollectionName, SuppliersCollectionName,
+	TerminalsCollectionName, AgentsCollectionName, ActivityTypesCollectionName, ProductTypesCollectionName,
+	FeedEmailsCollectionName, UsersCollectionName, InvoicesCollectionName, ChecklistsCollectionName,
+	CrewChangesCollectionName, ChecklistTemplatesCollectionName, NotificationsCollectionName, AuditLogCollectionName,
+	TenantsCollectionName, InvitationsCollectionName, APIKeysCollectionName, LLMUsagesCollectionName,
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"backend-crm/pkg/core"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CrewChange struct {
+	Tenant      string            `json:"tenant"`
+	ShipmentID  string            `json:"shipment_id"`
+	CrewMembers []core.CrewMember `json:"crew_members"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type CrewChangeResponse struct {
+	ID          string            `bson:"_id"`
+	Version     int64             `json:"version"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+	DeletedBy   string            `json:"deleted_by,omitempty"`
+	Tenant      string            `json:"tenant"`
+	ShipmentID  string            `json:"shipment_id"`
+	CrewMembers []core.CrewMember `json:"crew_members"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type CrewChangeCollection struct {
+	*GenericCollection[CrewChange, CrewChangeResponse]
+}
+
+func NewCrewChangeCollection(collection *mongo.Collection) *CrewChangeCollection {
+	return &CrewChangeCollection{
+		GenericCollection: NewGenericCollection[CrewChange, CrewChangeResponse](collection),
+	}
+}
+
+var _ Collection[CrewChange, CrewChangeResponse] = (*CrewChangeCollection)(nil)
+
+func (r *CrewChangeCollection) Create(ctx context.Context, entity CrewChange) (string, error) {
+	crewChange := CrewChange{
+		Tenant:      entity.Tenant,
+		ShipmentID:  entity.ShipmentID,
+		CrewMembers: entity.CrewMembers,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, crewChange)
+}
+
+func (r *CrewChangeCollection) Update(ctx context.Context, id string, tenant string, entity CrewChange) error {
+	crewChange := CrewChange{
+		Tenant:      entity.Tenant,
+		ShipmentID:  entity.ShipmentID,
+		CrewMembers: entity.CrewMembers,
+		CreatedAt:   entity.CreatedAt,
+		UpdatedAt:   time.Now(),
+	}
+	return r.GenericCollection.Update(ctx, id, tenant, crewChange)
+}
+
+func (r *CrewChangeCollection) GetAll(ctx context.Context, tenant string) ([]CrewChangeResponse, error) {
+	return r.GenericCollection.GetAll(ctx, tenant)
+}
+
+func (r *CrewChangeCollection) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (CrewChangeResponse, error) {
+	return r.GenericCollection.GetByKeyValue(ctx, key, value, tenant)
+}
+
+func (r *CrewChangeCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
+}
@@ -18,14 +18,17 @@ type Customer struct {
 }
 
 type CustomerResponse struct {
-	ID        string    `bson:"_id"`
-	Tenant    string    `json:"tenant"`
-	Customer  string    `json:"customer"`
-	Company   string    `json:"company"`
-	Email     string    `json:"email"`
-	Contact   string    `json:"contact"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `bson:"_id"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	Tenant    string     `json:"tenant"`
+	Customer  string     `json:"customer"`
+	Company   string     `json:"company"`
+	Email     string     `json:"email"`
+	Contact   string     `json:"contact"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 type CustomerCollection struct {
@@ -54,7 +57,7 @@ func (r *CustomerCollection) Create(ctx context.Context, entity Customer) (strin
 	return r.GenericCollection.Create(ctx, customer)
 }
 
-func (r *CustomerCollection) Update(ctx context.Context, id string, entity Customer) error {
+func (r *CustomerCollection) Update(ctx context.Context, id string, tenant string, entity Customer) error {
 	customer := Customer{
 		Tenant:    entity.Tenant,
 		Customer:  entity.Customer,
@@ -64,7 +67,7 @@ func (r *CustomerCollection) Update(ctx context.Context, id string, entity Custo
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, customer)
+	return r.GenericCollection.Update(ctx, id, tenant, customer)
 }
 
 func (r *CustomerCollection) GetAll(ctx context.Context, tenant string) ([]CustomerResponse, error) {
@@ -75,6 +78,6 @@ func (r *CustomerCollection) GetByID(ctx context.Context, id string, tenant stri
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *CustomerCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *CustomerCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
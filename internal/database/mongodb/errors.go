@@ -6,6 +6,9 @@ import (
 
 var ErrDuplicateKey = errors.New("duplicate key error")
 
+// ErrVersionConflict is returned by an update made with WithExpectedVersion when the document has been changed since that version.
+var ErrVersionConflict = errors.New("document was changed by another update")
+
 var DBError = errors.New("mongodb error")
 
 type RecordNotFoundError struct{}
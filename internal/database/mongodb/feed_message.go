@@ -1,6 +1,8 @@
 package database
 
 import (
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
 	"context"
 	"time"
 
@@ -15,17 +17,26 @@ type FeedEmail struct {
 	Subject          string    `json:"subject"`
 	BodyContent      string    `json:"body_content"`
 	ShipmentId       string    `json:"shipment_id"`
+
+	ReviewStatus    enum.FeedReviewStatus    `json:"review_status"`
+	MatchCandidates []core.ShipmentCandidate `json:"match_candidates"`
 }
 
 type FeedEmailResponse struct {
-	ID               string    `bson:"_id"`
-	Tenant           string    `json:"tenant"`
-	MasterEmail      string    `json:"master_email"`
-	ReceivedDateTime time.Time `json:"received_date_time"`
-	ToEmailAddress   string    `json:"to_email_address"`
-	Subject          string    `json:"subject"`
-	BodyContent      string    `json:"body_content"`
-	ShipmentId       string    `json:"shipment_id"`
+	ID               string     `bson:"_id"`
+	Version          int64      `json:"version"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy        string     `json:"deleted_by,omitempty"`
+	Tenant           string     `json:"tenant"`
+	MasterEmail      string     `json:"master_email"`
+	ReceivedDateTime time.Time  `json:"received_date_time"`
+	ToEmailAddress   string     `json:"to_email_address"`
+	Subject          string     `json:"subject"`
+	BodyContent      string     `json:"body_content"`
+	ShipmentId       string     `json:"shipment_id"`
+
+	ReviewStatus    enum.FeedReviewStatus    `json:"review_status"`
+	MatchCandidates []core.ShipmentCandidate `json:"match_candidates"`
 }
 
 type FeedEmailCollection struct {
@@ -49,10 +60,27 @@ func (r *FeedEmailCollection) Create(ctx context.Context, entity FeedEmail) (str
 		Subject:          entity.Subject,
 		BodyContent:      entity.BodyContent,
 		ShipmentId:       entity.ShipmentId,
+		ReviewStatus:     entity.ReviewStatus,
+		MatchCandidates:  entity.MatchCandidates,
 	}
 	return r.GenericCollection.Create(ctx, feedEmail)
 }
 
+func (r *FeedEmailCollection) Update(ctx context.Context, id string, tenant string, entity FeedEmail) error {
+	feedEmail := FeedEmail{
+		Tenant:           entity.Tenant,
+		MasterEmail:      entity.MasterEmail,
+		ReceivedDateTime: entity.ReceivedDateTime,
+		ToEmailAddress:   entity.ToEmailAddress,
+		Subject:          entity.Subject,
+		BodyContent:      entity.BodyContent,
+		ShipmentId:       entity.ShipmentId,
+		ReviewStatus:     entity.ReviewStatus,
+		MatchCandidates:  entity.MatchCandidates,
+	}
+	return r.GenericCollection.Update(ctx, id, tenant, feedEmail)
+}
+
 func (r *FeedEmailCollection) GetAll(ctx context.Context, tenant string) ([]FeedEmailResponse, error) {
 	return r.GenericCollection.GetAll(ctx, tenant)
 }
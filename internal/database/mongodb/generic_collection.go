@@ -3,8 +3,11 @@
 package database
 
 import (
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/metrics"
 	"context"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,24 +16,35 @@ import (
 
 type GenericCollection[S any, T any] struct {
 	collection *mongo.Collection
+	auditLog   *AuditLog
+	entityType string
 }
 
 func NewGenericCollection[S any, T any](collection *mongo.Collection) *GenericCollection[S, T] {
 	return &GenericCollection[S, T]{collection: collection}
 }
 
+var mongoOperationSeconds = metrics.NewHistogramVec("mongo_operation_duration_seconds",
+	"How long operations on the collections take, in seconds.", metrics.DefBuckets, "collection", "operation")
+
+// timed records how long operation has taken since start, e.g. defer r.timed("get_all", time.Now()).
+func (r *GenericCollection[S, T]) timed(operation string, start time.Time) {
+	mongoOperationSeconds.Since(start, r.collection.Name(), operation)
+}
+
 // TenantFilter creates a BSON filter to match documents by tenant
 func TenantFilter(tenant string) bson.D {
 	return bson.D{{Key: "tenant", Value: tenant}}
 }
 
 func (r *GenericCollection[S, T]) GetAll(ctx context.Context, tenant string) ([]T, error) {
+	defer r.timed("get_all", time.Now())
 	var filter interface{}
 
 	if tenant == "" {
-		filter = bson.D{}
+		filter = bson.D{notDeleted()}
 	} else {
-		filter = TenantFilter(tenant)
+		filter = append(TenantFilter(tenant), notDeleted())
 	}
 	// filter := TenantFilter(tenant)
 	cursor, err := r.collection.Find(ctx, filter)
@@ -50,6 +64,7 @@ func (r *GenericCollection[S, T]) GetAll(ctx context.Context, tenant string) ([]
 }
 
 func (r *GenericCollection[S, T]) GetByID(ctx context.Context, id string, tenant string) (T, error) {
+	defer r.timed("get_by_id", time.Now())
 	var result T
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -57,8 +72,9 @@ func (r *GenericCollection[S, T]) GetByID(ctx context.Context, id string, tenant
 	}
 	// Combine tenant and ID filters
 	filter := bson.M{
-		"_id":    objectId,
-		"tenant": tenant,
+		"_id":          objectId,
+		"tenant":       tenant,
+		deletedAtField: nil,
 	}
 
 	err = r.collection.FindOne(ctx, filter).Decode(&result)
@@ -69,6 +85,7 @@ func (r *GenericCollection[S, T]) GetByID(ctx context.Context, id string, tenant
 }
 
 func (r *GenericCollection[S, T]) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (T, error) {
+	defer r.timed("get_by_key_value", time.Now())
 	var result T
 
 	// . In MongoDB, when you use a dynamic key in a BSON query,
@@ -76,12 +93,14 @@ func (r *GenericCollection[S, T]) GetByKeyValue(ctx context.Context, key string,
 	// Use bson.D instead of bson.M
 	invalid := r.collection.FindOne(ctx, bson.D{{Key: key, Value: value},
 		{Key: "tenant", Value: tenant},
+		notDeleted(),
 	}).Decode(&result)
 	log.Println(invalid, "invalid")
 	return result, invalid
 }
 
 func (r *GenericCollection[S, T]) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]T, error) {
+	defer r.timed("get_all_by_key_value", time.Now())
 	var results []T
 	log.Println(key)
 	log.Println(value)
@@ -89,6 +108,7 @@ func (r *GenericCollection[S, T]) GetAllByKeyValue(ctx context.Context, key stri
 
 	cursor, err := r.collection.Find(ctx, bson.D{{Key: key, Value: value},
 		{Key: "tenant", Value: tenant},
+		notDeleted(),
 	})
 	if err != nil {
 		return nil, err
@@ -112,42 +132,157 @@ func (r *GenericCollection[S, T]) GetAllByKeyValue(ctx context.Context, key stri
 }
 
 func (r *GenericCollection[S, T]) Create(ctx context.Context, entity S) (string, error) {
-	// Insert the entity into the collection
-	result, err := r.collection.InsertOne(ctx, entity)
+	defer r.timed("create", time.Now())
+	document, err := versionedDocument(entity, 1)
 	if err != nil {
-		// Handle duplicate key error
-		if mongo.IsDuplicateKeyError(err) {
-			return "", ErrDuplicateKey // Assuming ErrDuplicateKey is a pre-defined error
-		}
-		// Return other errors as is
 		return "", err
 	}
-	print(result)
-	// Extract the inserted ID and convert it to string
-	id, ok := result.InsertedID.(primitive.ObjectID)
-	print(ok)
-	if !ok {
-		return "", DBError
+	var id primitive.ObjectID
+	err = r.audited(ctx, enum.AUDIT_ACTION_CREATE, nil, func() ([]primitive.ObjectID, error) {
+		// Insert the entity into the collection
+		result, err := r.collection.InsertOne(ctx, document)
+		if err != nil {
+			// Handle duplicate key error
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicateKey // Assuming ErrDuplicateKey is a pre-defined error
+			}
+			// Return other errors as is
+			return nil, err
+		}
+		print(result)
+		// Extract the inserted ID and convert it to string
+		var ok bool
+		id, ok = result.InsertedID.(primitive.ObjectID)
+		print(ok)
+		if !ok {
+			return nil, DBError
+		}
+		return []primitive.ObjectID{id}, nil
+	})
+	if err != nil {
+		return "", err
 	}
 	return id.Hex(), nil
 }
 
-func (r *GenericCollection[S, T]) Update(ctx context.Context, id string, entity S) error {
+// Update replaces the fields of the tenant's document with id with those of entity.
+// It returns mongo.ErrNoDocuments when there is no such document.
+func (r *GenericCollection[S, T]) Update(ctx context.Context, id string, tenant string, entity S) error {
+	defer r.timed("update", time.Now())
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	_, invalid := r.collection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": entity})
+	filter := bson.M{"_id": objectId, "tenant": tenant, deletedAtField: nil}
+	expected, checkVersion := ExpectedVersion(ctx)
+	if checkVersion {
+		filter[versionField] = versionFilter(expected)
+	}
 
-	return invalid
+	return r.audited(ctx, enum.AUDIT_ACTION_UPDATE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+			"$set": entity,
+			"$inc": bson.M{versionField: 1},
+		})
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicateKey
+			}
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			if !checkVersion {
+				return nil, mongo.ErrNoDocuments
+			}
+			return nil, r.missingOrConflict(ctx, bson.M{"_id": objectId, "tenant": tenant, deletedAtField: nil})
+		}
+		return nil, nil
+	})
 }
 
-func (r *GenericCollection[S, T]) Delete(ctx context.Context, id string) error {
+// Patch changes only the fields in patch, of the tenant's document with id.
+// Like Update, it honours the version set with WithExpectedVersion.
+func (r *GenericCollection[S, T]) Patch(ctx context.Context, id string, tenant string, patch Patch) error {
+	defer r.timed("patch", time.Now())
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
+	filter := bson.M{"_id": objectId, "tenant": tenant, deletedAtField: nil}
+	expected, checkVersion := ExpectedVersion(ctx)
+	if checkVersion {
+		filter[versionField] = versionFilter(expected)
+	}
+
+	update := bson.M{"$inc": bson.M{versionField: 1}}
+	if len(patch.Set) > 0 {
+		update["$set"] = patch.Set
+	}
+	if len(patch.Unset) > 0 {
+		update["$unset"] = patch.Unset
+	}
+	return r.audited(ctx, enum.AUDIT_ACTION_UPDATE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicateKey
+			}
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			if !checkVersion {
+				return nil, mongo.ErrNoDocuments
+			}
+			return nil, r.missingOrConflict(ctx, bson.M{"_id": objectId, "tenant": tenant, deletedAtField: nil})
+		}
+		return nil, nil
+	})
+}
 
-	_, invalid := r.collection.DeleteOne(ctx, bson.M{"_id": objectId})
-	return invalid
+// missingOrConflict tells why a versioned update matched nothing: the document changed since it was read, or it is gone.
+func (r *GenericCollection[S, T]) missingOrConflict(ctx context.Context, filter bson.M) error {
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrVersionConflict
+}
+
+// Delete moves the tenant's document with id to the trash, see Trash. The actor set with WithActor is recorded as who deleted it.
+func (r *GenericCollection[S, T]) Delete(ctx context.Context, id string, tenant string) error {
+	defer r.timed("delete", time.Now())
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objectId, "tenant": tenant, deletedAtField: nil}
+	return r.audited(ctx, enum.AUDIT_ACTION_DELETE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateOne(ctx, filter, deletion(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		return nil, nil
+	})
+}
+
+// HardDelete removes the tenant's document with id for good, for documents that are of no use in the trash.
+func (r *GenericCollection[S, T]) HardDelete(ctx context.Context, id string, tenant string) error {
+	defer r.timed("hard_delete", time.Now())
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objectId, "tenant": tenant}
+	return r.audited(ctx, enum.AUDIT_ACTION_PURGE, filter, func() ([]primitive.ObjectID, error) {
+		_, invalid := r.collection.DeleteOne(ctx, filter)
+		return nil, invalid
+	})
 }
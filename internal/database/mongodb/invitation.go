@@ -0,0 +1,59 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Invitation lets the person with Email register as a user of Tenant with Role, once, until ExpiresAt.
+// AcceptedAt is zero until it is used.
+type Invitation struct {
+	Tenant     string        `json:"tenant"`
+	Email      string        `json:"email"`
+	Role       enum.UserRole `json:"role"`
+	InvitedBy  string        `json:"invited_by"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	AcceptedAt time.Time     `json:"accepted_at"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type InvitationResponse struct {
+	ID         string        `bson:"_id" json:"id"`
+	Version    int64         `json:"version"`
+	DeletedAt  *time.Time    `json:"deleted_at,omitempty"`
+	DeletedBy  string        `json:"deleted_by,omitempty"`
+	Tenant     string        `json:"tenant"`
+	Email      string        `json:"email"`
+	Role       enum.UserRole `json:"role"`
+	InvitedBy  string        `json:"invited_by"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	AcceptedAt time.Time     `json:"accepted_at"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type InvitationCollection struct {
+	*GenericCollection[Invitation, InvitationResponse]
+}
+
+func NewInvitationCollection(collection *mongo.Collection) *InvitationCollection {
+	return &InvitationCollection{
+		GenericCollection: NewGenericCollection[Invitation, InvitationResponse](collection),
+	}
+}
+
+var _ Collection[Invitation, InvitationResponse] = (*InvitationCollection)(nil)
+
+func (r *InvitationCollection) Create(ctx context.Context, entity Invitation) (string, error) {
+	invitation := Invitation{
+		Tenant:    entity.Tenant,
+		Email:     entity.Email,
+		Role:      entity.Role,
+		InvitedBy: entity.InvitedBy,
+		ExpiresAt: entity.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, invitation)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"backend-crm/pkg/core"
 	"context"
 	"log"
 	"time"
@@ -12,15 +13,22 @@ type InvoicePricing struct {
 	Tenant                string            `json:"tenant"`
 	ShipmentID            string            `json:"shipment_id"`
 	InvoicePricingDetails map[string]string `json:"invoice_pricing_details"`
+	FDACosts              []core.FDACost    `json:"fda_costs"`
+	IsDraft               bool              `json:"is_draft"`
 	CreatedAt             time.Time         `json:"created_at"`
 	UpdatedAt             time.Time         `json:"updated_at"`
 }
 
 type InvoicePricingResponse struct {
 	ID                    string            `bson:"_id"`
+	Version               int64             `json:"version"`
+	DeletedAt             *time.Time        `json:"deleted_at,omitempty"`
+	DeletedBy             string            `json:"deleted_by,omitempty"`
 	Tenant                string            `json:"tenant"`
 	ShipmentID            string            `json:"shipment_id"`
 	InvoicePricingDetails map[string]string `json:"invoice_pricing_details"`
+	FDACosts              []core.FDACost    `json:"fda_costs"`
+	IsDraft               bool              `json:"is_draft"`
 	CreatedAt             time.Time         `json:"created_at"`
 	UpdatedAt             time.Time         `json:"updated_at"`
 }
@@ -52,20 +60,24 @@ func (r *InvoicePricingCollection) Create(ctx context.Context, entity InvoicePri
 		Tenant:                entity.Tenant,
 		ShipmentID:            entity.ShipmentID,
 		InvoicePricingDetails: entity.InvoicePricingDetails,
+		FDACosts:              entity.FDACosts,
+		IsDraft:               entity.IsDraft,
 		CreatedAt:             time.Now(),
 		UpdatedAt:             time.Now(),
 	}
 	return r.GenericCollection.Create(ctx, invoicePricing)
 }
 
-func (r *InvoicePricingCollection) Update(ctx context.Context, id string, entity InvoicePricing) error {
+func (r *InvoicePricingCollection) Update(ctx context.Context, id string, tenant string, entity InvoicePricing) error {
 	log.Println(entity, "enettt")
 	invoicePricing := InvoicePricing{
 		Tenant:                entity.Tenant,
 		ShipmentID:            entity.ShipmentID,
 		InvoicePricingDetails: entity.InvoicePricingDetails,
+		FDACosts:              entity.FDACosts,
+		IsDraft:               entity.IsDraft,
 		CreatedAt:             entity.CreatedAt,
 		UpdatedAt:             time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, invoicePricing)
+	return r.GenericCollection.Update(ctx, id, tenant, invoicePricing)
 }
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LLMUsageMonthFormat is the format of the Month of LLM usage, e.g. "2024-03".
+const LLMUsageMonthFormat = "2006-01"
+
+// LLMUsage is one LLM call made for Tenant, and for ShipmentID once the email it read has been matched to a shipment.
+// CostUSD is what its tokens cost at the prices configured when it was made.
+type LLMUsage struct {
+	Tenant           string          `json:"tenant"`
+	ShipmentID       string          `json:"shipment_id,omitempty"`
+	Purpose          enum.LLMPurpose `json:"purpose"`
+	Model            string          `json:"model"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TotalTokens      int             `json:"total_tokens"`
+	CostUSD          float64         `json:"cost_usd"`
+	Month            string          `json:"month"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type LLMUsageResponse struct {
+	ID               string          `bson:"_id" json:"id"`
+	Version          int64           `json:"version"`
+	DeletedAt        *time.Time      `json:"deleted_at,omitempty"`
+	DeletedBy        string          `json:"deleted_by,omitempty"`
+	Tenant           string          `json:"tenant"`
+	ShipmentID       string          `json:"shipment_id,omitempty"`
+	Purpose          enum.LLMPurpose `json:"purpose"`
+	Model            string          `json:"model"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TotalTokens      int             `json:"total_tokens"`
+	CostUSD          float64         `json:"cost_usd"`
+	Month            string          `json:"month"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type LLMUsageCollection struct {
+	*GenericCollection[LLMUsage, LLMUsageResponse]
+}
+
+func NewLLMUsageCollection(collection *mongo.Collection) *LLMUsageCollection {
+	return &LLMUsageCollection{
+		GenericCollection: NewGenericCollection[LLMUsage, LLMUsageResponse](collection),
+	}
+}
+
+var _ Collection[LLMUsage, LLMUsageResponse] = (*LLMUsageCollection)(nil)
+
+func (r *LLMUsageCollection) Create(ctx context.Context, entity LLMUsage) (string, error) {
+	usage := LLMUsage{
+		Tenant:           entity.Tenant,
+		ShipmentID:       entity.ShipmentID,
+		Purpose:          entity.Purpose,
+		Model:            entity.Model,
+		PromptTokens:     entity.PromptTokens,
+		CompletionTokens: entity.CompletionTokens,
+		TotalTokens:      entity.TotalTokens,
+		CostUSD:          entity.CostUSD,
+		Month:            entity.Month,
+		CreatedAt:        time.Now(),
+	}
+	if usage.Month == "" {
+		usage.Month = usage.CreatedAt.UTC().Format(LLMUsageMonthFormat)
+	}
+	return r.GenericCollection.Create(ctx, usage)
+}
+
+// LLMSpend sums up a tenant's LLM usage in one month, by Key, e.g. "customerA:2024-03".
+type LLMSpend struct {
+	Key         string  `bson:"_id" json:"-"`
+	Tenant      string  `bson:"tenant" json:"tenant"`
+	Month       string  `bson:"month" json:"month"`
+	Calls       int     `bson:"calls" json:"calls"`
+	TotalTokens int     `bson:"totaltokens" json:"total_tokens"`
+	CostUSD     float64 `bson:"costusd" json:"cost_usd"`
+}
+
+// LLMSpendCounter keeps what each tenant spends on LLM calls a month, shared by every instance of the server,
+// so that a budget can be checked without summing up the month's usage.
+type LLMSpendCounter interface {
+	// Get returns the tenant's spend in month, the zero LLMSpend of the tenant and month if there is none.
+	Get(ctx context.Context, tenant string, month string) (LLMSpend, error)
+	// Add adds the usage to its tenant's spend in its month.
+	Add(ctx context.Context, usage LLMUsage) error
+}
+
+type LLMSpends struct {
+	collection *mongo.Collection
+}
+
+func NewLLMSpends(collection *mongo.Collection) *LLMSpends {
+	return &LLMSpends{collection: collection}
+}
+
+var _ LLMSpendCounter = (*LLMSpends)(nil)
+
+func llmSpendKey(tenant string, month string) string {
+	return tenant + ":" + month
+}
+
+func (s *LLMSpends) Get(ctx context.Context, tenant string, month string) (LLMSpend, error) {
+	var spend LLMSpend
+	err := s.collection.FindOne(ctx, bson.M{"_id": llmSpendKey(tenant, month)}).Decode(&spend)
+	if err == mongo.ErrNoDocuments {
+		return LLMSpend{Key: llmSpendKey(tenant, month), Tenant: tenant, Month: month}, nil
+	}
+	return spend, err
+}
+
+func (s *LLMSpends) Add(ctx context.Context, usage LLMUsage) error {
+	update := bson.M{
+		"$setOnInsert": bson.M{"tenant": usage.Tenant, "month": usage.Month},
+		"$inc":         bson.M{"calls": 1, "totaltokens": usage.TotalTokens, "costusd": usage.CostUSD},
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": llmSpendKey(usage.Tenant, usage.Month)}, update, options.Update().SetUpsert(true))
+	return err
+}
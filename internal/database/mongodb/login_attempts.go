@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttempt counts the failed logins of one account or IP address, by Key, e.g. "account:ops@customera.com".
+// It is forgotten at ExpiresAt, which moves on with every failure.
+type LoginAttempt struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LockedUntil time.Time `bson:"lockeduntil"`
+	ExpiresAt   time.Time `bson:"expiresat"`
+}
+
+// LoginAttemptCounter keeps the failed login counts, shared by every instance of the server.
+type LoginAttemptCounter interface {
+	// Get returns the attempt counted under key, the zero LoginAttempt if there is none.
+	Get(ctx context.Context, key string) (LoginAttempt, error)
+	// RecordFailure counts one more failure under key, to be forgotten at expiresAt, and returns the count.
+	RecordFailure(ctx context.Context, key string, expiresAt time.Time) (LoginAttempt, error)
+	// Lock locks key until until.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures counted under key.
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginAttempts struct {
+	collection *mongo.Collection
+}
+
+func NewLoginAttempts(collection *mongo.Collection) *LoginAttempts {
+	return &LoginAttempts{collection: collection}
+}
+
+var _ LoginAttemptCounter = (*LoginAttempts)(nil)
+
+func (a *LoginAttempts) Get(ctx context.Context, key string) (LoginAttempt, error) {
+	var attempt LoginAttempt
+	err := a.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return LoginAttempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+func (a *LoginAttempts) RecordFailure(ctx context.Context, key string, expiresAt time.Time) (LoginAttempt, error) {
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"expiresat": expiresAt},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var attempt LoginAttempt
+	err := a.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempt)
+	return attempt, err
+}
+
+func (a *LoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := a.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"lockeduntil": until}})
+	return err
+}
+
+func (a *LoginAttempts) Reset(ctx context.Context, key string) error {
+	_, err := a.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
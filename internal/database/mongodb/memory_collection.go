@@ -0,0 +1,355 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryCollection is a Collection kept in memory, for tests. Documents are stored as the driver would
+// store them, so reads, key/value lookups and patches see the same bson field names as GenericCollection,
+// and it keeps the same tenant filtering, versioning and soft delete rules.
+type MemoryCollection[S any, T any] struct {
+	mu        sync.Mutex
+	documents []bson.M
+	unique    [][]string
+}
+
+// NewMemoryCollection creates an empty collection. Each of unique lists the bson fields of a unique index,
+// e.g. []string{"tenant", "email"}. Like the partial unique indexes created by the migrations, only documents
+// that are not deleted and have a value for every field are checked.
+func NewMemoryCollection[S any, T any](unique ...[]string) *MemoryCollection[S, T] {
+	return &MemoryCollection[S, T]{unique: unique}
+}
+
+var _ Collection[Customer, CustomerResponse] = (*MemoryCollection[Customer, CustomerResponse])(nil)
+
+func (r *MemoryCollection[S, T]) GetAll(ctx context.Context, tenant string) ([]T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var results []T
+	for _, document := range r.documents {
+		if isDeleted(document) || (tenant != "" && document["tenant"] != tenant) {
+			continue
+		}
+		result, err := decodeDocument[T](document)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (r *MemoryCollection[S, T]) GetByID(ctx context.Context, id string, tenant string) (T, error) {
+	var result T
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return result, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	document := r.find(objectId)
+	if document == nil || isDeleted(document) || document["tenant"] != tenant {
+		return result, mongo.ErrNoDocuments
+	}
+	return decodeDocument[T](document)
+}
+
+func (r *MemoryCollection[S, T]) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (T, error) {
+	results, err := r.GetAllByKeyValue(ctx, key, value, tenant)
+	if err != nil || len(results) == 0 {
+		var result T
+		if err == nil {
+			err = mongo.ErrNoDocuments
+		}
+		return result, err
+	}
+	return results[0], nil
+}
+
+func (r *MemoryCollection[S, T]) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var results []T
+	for _, document := range r.documents {
+		if isDeleted(document) || document["tenant"] != tenant || !matchesValue(lookupPath(document, key), value) {
+			continue
+		}
+		result, err := decodeDocument[T](document)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (r *MemoryCollection[S, T]) Create(ctx context.Context, entity S) (string, error) {
+	fields, err := versionedDocument(entity, 1)
+	if err != nil {
+		return "", err
+	}
+	document, err := normalizeDocument(fields)
+	if err != nil {
+		return "", err
+	}
+	id := primitive.NewObjectID()
+	document["_id"] = id
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.violatesUnique(document) {
+		return "", ErrDuplicateKey
+	}
+	r.documents = append(r.documents, document)
+	return id.Hex(), nil
+}
+
+func (r *MemoryCollection[S, T]) Update(ctx context.Context, id string, tenant string, entity S) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	fields, err := normalizeDocument(entity)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	document := r.find(objectId)
+	if document == nil || isDeleted(document) || document["tenant"] != tenant {
+		return mongo.ErrNoDocuments
+	}
+	if !matchesExpectedVersion(ctx, document) {
+		return ErrVersionConflict
+	}
+
+	updated, err := normalizeDocument(document)
+	if err != nil {
+		return err
+	}
+	for key, value := range fields {
+		updated[key] = value
+	}
+	return r.replace(document, updated)
+}
+
+func (r *MemoryCollection[S, T]) Patch(ctx context.Context, id string, tenant string, patch Patch) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	document := r.find(objectId)
+	if document == nil || isDeleted(document) || document["tenant"] != tenant {
+		return mongo.ErrNoDocuments
+	}
+	if !matchesExpectedVersion(ctx, document) {
+		return ErrVersionConflict
+	}
+
+	updated, err := normalizeDocument(document)
+	if err != nil {
+		return err
+	}
+	for _, e := range patch.Set {
+		normalized, err := normalizeDocument(bson.M{"value": e.Value})
+		if err != nil {
+			return err
+		}
+		setPath(updated, e.Key, normalized["value"])
+	}
+	for _, e := range patch.Unset {
+		unsetPath(updated, e.Key)
+	}
+	return r.replace(document, updated)
+}
+
+// Delete marks the tenant's document with id as deleted, with the actor set with WithActor, as GenericCollection does.
+func (r *MemoryCollection[S, T]) Delete(ctx context.Context, id string, tenant string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	document := r.find(objectId)
+	if document == nil || isDeleted(document) || document["tenant"] != tenant {
+		return mongo.ErrNoDocuments
+	}
+	updated, err := normalizeDocument(document)
+	if err != nil {
+		return err
+	}
+	updated[deletedAtField] = primitive.NewDateTimeFromTime(time.Now())
+	updated[deletedByField] = Actor(ctx)
+	return r.replace(document, updated)
+}
+
+// replace stores updated in place of document, with its version incremented, unless it breaks a unique index.
+func (r *MemoryCollection[S, T]) replace(document bson.M, updated bson.M) error {
+	updated[versionField] = storedVersion(document) + 1
+	for i, stored := range r.documents {
+		if stored["_id"] != document["_id"] {
+			continue
+		}
+		if r.violatesUnique(updated) {
+			return ErrDuplicateKey
+		}
+		r.documents[i] = updated
+		return nil
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (r *MemoryCollection[S, T]) find(id primitive.ObjectID) bson.M {
+	for _, document := range r.documents {
+		if document["_id"] == id {
+			return document
+		}
+	}
+	return nil
+}
+
+func (r *MemoryCollection[S, T]) violatesUnique(document bson.M) bool {
+	if isDeleted(document) {
+		return false
+	}
+	for _, fields := range r.unique {
+		key, ok := uniqueKey(document, fields)
+		if !ok {
+			continue
+		}
+		for _, stored := range r.documents {
+			if isDeleted(stored) || stored["_id"] == document["_id"] {
+				continue
+			}
+			if storedKey, ok := uniqueKey(stored, fields); ok && reflect.DeepEqual(key, storedKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func uniqueKey(document bson.M, fields []string) ([]interface{}, bool) {
+	key := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		value := lookupPath(document, field)
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return nil, false
+		}
+		key = append(key, value)
+	}
+	return key, true
+}
+
+func isDeleted(document bson.M) bool {
+	return document[deletedAtField] != nil
+}
+
+func storedVersion(document bson.M) int64 {
+	switch version := document[versionField].(type) {
+	case int64:
+		return version
+	case int32:
+		return int64(version)
+	}
+	return 0
+}
+
+func matchesExpectedVersion(ctx context.Context, document bson.M) bool {
+	expected, checkVersion := ExpectedVersion(ctx)
+	return !checkVersion || storedVersion(document) == expected
+}
+
+// matchesValue reports whether a stored value equals value, or is an array holding it, as a Mongo equality filter does.
+func matchesValue(stored interface{}, value string) bool {
+	if values, ok := stored.(bson.A); ok {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	return stored == value
+}
+
+func lookupPath(document bson.M, path string) interface{} {
+	var value interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(bson.M)
+		if !ok {
+			return nil
+		}
+		value = nested[key]
+	}
+	return value
+}
+
+func setPath(document bson.M, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := document[key].(bson.M)
+		if !ok {
+			nested = bson.M{}
+			document[key] = nested
+		}
+		document = nested
+	}
+	document[keys[len(keys)-1]] = value
+}
+
+func unsetPath(document bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := document[key].(bson.M)
+		if !ok {
+			return
+		}
+		document = nested
+	}
+	delete(document, keys[len(keys)-1])
+}
+
+// normalizeDocument encodes value as the driver would store it, and decodes it back as nested bson.M.
+// The result shares nothing with value, so it also serves to copy a stored document before changing it.
+func normalizeDocument(value interface{}) (bson.M, error) {
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.M
+	err = bson.Unmarshal(data, &document)
+	return document, err
+}
+
+func decodeDocument[T any](document bson.M) (T, error) {
+	var result T
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return result, err
+	}
+	err = bson.Unmarshal(data, &result)
+	return result, err
+}
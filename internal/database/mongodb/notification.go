@@ -0,0 +1,86 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Notification is an outgoing message waiting to be sent. Notifications are written in the same
+// transaction as the change that causes them, and sent once it has committed.
+type Notification struct {
+	Tenant     string                  `json:"tenant"`
+	ShipmentID string                  `json:"shipment_id"`
+	Kind       enum.NotificationKind   `json:"kind"`
+	Recipient  string                  `json:"recipient"`
+	Params     map[string]string       `json:"params"`
+	Status     enum.NotificationStatus `json:"status"`
+	Attempts   int                     `json:"attempts"`
+	LastError  string                  `json:"last_error"`
+	SentAt     time.Time               `json:"sent_at"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
+
+type NotificationResponse struct {
+	ID         string                  `bson:"_id"`
+	Version    int64                   `json:"version"`
+	DeletedAt  *time.Time              `json:"deleted_at,omitempty"`
+	DeletedBy  string                  `json:"deleted_by,omitempty"`
+	Tenant     string                  `json:"tenant"`
+	ShipmentID string                  `json:"shipment_id"`
+	Kind       enum.NotificationKind   `json:"kind"`
+	Recipient  string                  `json:"recipient"`
+	Params     map[string]string       `json:"params"`
+	Status     enum.NotificationStatus `json:"status"`
+	Attempts   int                     `json:"attempts"`
+	LastError  string                  `json:"last_error"`
+	SentAt     time.Time               `json:"sent_at"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
+
+type NotificationCollection struct {
+	*GenericCollection[Notification, NotificationResponse]
+}
+
+func NewNotificationCollection(collection *mongo.Collection) *NotificationCollection {
+	return &NotificationCollection{
+		GenericCollection: NewGenericCollection[Notification, NotificationResponse](collection),
+	}
+}
+
+var _ Collection[Notification, NotificationResponse] = (*NotificationCollection)(nil)
+
+func (r *NotificationCollection) Create(ctx context.Context, entity Notification) (string, error) {
+	notification := Notification{
+		Tenant:     entity.Tenant,
+		ShipmentID: entity.ShipmentID,
+		Kind:       entity.Kind,
+		Recipient:  entity.Recipient,
+		Params:     entity.Params,
+		Status:     enum.NOTIFICATION_STATUS_PENDING,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, notification)
+}
+
+func (r *NotificationCollection) Update(ctx context.Context, id string, tenant string, entity Notification) error {
+	notification := Notification{
+		Tenant:     entity.Tenant,
+		ShipmentID: entity.ShipmentID,
+		Kind:       entity.Kind,
+		Recipient:  entity.Recipient,
+		Params:     entity.Params,
+		Status:     entity.Status,
+		Attempts:   entity.Attempts,
+		LastError:  entity.LastError,
+		SentAt:     entity.SentAt,
+		CreatedAt:  entity.CreatedAt,
+		UpdatedAt:  time.Now(),
+	}
+	return r.GenericCollection.Update(ctx, id, tenant, notification)
+}
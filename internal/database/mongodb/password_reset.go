@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordReset lets the user with Email set a new password, once, until ExpiresAt. UsedAt is zero until it is used.
+type PasswordReset struct {
+	Tenant    string    `json:"tenant"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"used_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PasswordResetResponse struct {
+	ID        string     `bson:"_id" json:"id"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	Tenant    string     `json:"tenant"`
+	Email     string     `json:"email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    time.Time  `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type PasswordResetCollection struct {
+	*GenericCollection[PasswordReset, PasswordResetResponse]
+}
+
+func NewPasswordResetCollection(collection *mongo.Collection) *PasswordResetCollection {
+	return &PasswordResetCollection{
+		GenericCollection: NewGenericCollection[PasswordReset, PasswordResetResponse](collection),
+	}
+}
+
+var _ Collection[PasswordReset, PasswordResetResponse] = (*PasswordResetCollection)(nil)
+
+func (r *PasswordResetCollection) Create(ctx context.Context, entity PasswordReset) (string, error) {
+	passwordReset := PasswordReset{
+		Tenant:    entity.Tenant,
+		Email:     entity.Email,
+		ExpiresAt: entity.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, passwordReset)
+}
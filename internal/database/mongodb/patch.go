@@ -0,0 +1,216 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Patch is the set of fields a partial update changes, as bson paths such as "vesselspecifications.vesselname".
+// Build it from a JSON merge patch with NewMergePatch.
+type Patch struct {
+	Set   bson.D
+	Unset bson.D
+}
+
+// Value is the new value of the field at path, if the patch sets it.
+func (p Patch) Value(path string) (interface{}, bool) {
+	for _, e := range p.Set {
+		if e.Key == path {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Unsets reports whether the patch removes the field at path, as a JSON merge patch does for null.
+func (p Patch) Unsets(path string) bool {
+	for _, e := range p.Unset {
+		if e.Key == path {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchError is a patch that does not fit the entity, e.g. one naming an unknown field or giving a field the wrong type.
+type PatchError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PatchError) Error() string {
+	return e.Path + ": " + e.Reason
+}
+
+// fields no patch may change, as bson paths
+var readOnlyPatchPaths = map[string]bool{
+	"_id":          true,
+	"tenant":       true,
+	"createdat":    true,
+	"updatedat":    true,
+	versionField:   true,
+	deletedAtField: true,
+	deletedByField: true,
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// NewMergePatch translates a JSON merge patch (RFC 7386) of an S into the bson paths it sets and unsets.
+// Objects are merged field by field, into nested structs and maps alike, while arrays and other values
+// replace what is stored and null removes it. Each value is decoded into the type of its field, so a patch
+// that would not decode as an S is rejected with a *PatchError, as is one changing a field of readOnly,
+// given by its top level JSON name, or the tenant, timestamps and version that every entity keeps.
+func NewMergePatch[S any](data []byte, readOnly ...string) (Patch, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Patch{}, &PatchError{Path: "/", Reason: "patch must be a JSON object"}
+	}
+
+	entityType := reflect.TypeOf((*S)(nil)).Elem()
+	var patch Patch
+	for _, name := range sortedKeys(fields) {
+		raw := fields[name]
+		for _, field := range readOnly {
+			if name == field {
+				return Patch{}, &PatchError{Path: name, Reason: "field cannot be changed"}
+			}
+		}
+		if err := patch.addStructField(entityType, "", "", name, raw); err != nil {
+			return Patch{}, err
+		}
+	}
+
+	if _, ok := entityType.FieldByName("UpdatedAt"); ok {
+		patch.Set = append(patch.Set, bson.E{Key: "updatedat", Value: time.Now()})
+	}
+	return patch, nil
+}
+
+func (p *Patch) addStructField(structType reflect.Type, path string, jsonPath string, name string, raw json.RawMessage) error {
+	jsonPath = joinPath(jsonPath, name)
+	field, ok := structFieldForJSONName(structType, name)
+	if !ok {
+		return &PatchError{Path: jsonPath, Reason: "unknown field"}
+	}
+	path = joinPath(path, bsonFieldName(field))
+	if readOnlyPatchPaths[path] {
+		return &PatchError{Path: jsonPath, Reason: "field cannot be changed"}
+	}
+	return p.addValue(field.Type, path, jsonPath, raw)
+}
+
+func (p *Patch) addValue(valueType reflect.Type, path string, jsonPath string, raw json.RawMessage) error {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		p.Unset = append(p.Unset, bson.E{Key: path, Value: ""})
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if mergesFields(valueType) && json.Unmarshal(raw, &fields) == nil {
+		for _, name := range sortedKeys(fields) {
+			fieldRaw := fields[name]
+			if valueType.Kind() == reflect.Struct {
+				if err := p.addStructField(valueType, path, jsonPath, name, fieldRaw); err != nil {
+					return err
+				}
+				continue
+			}
+			if name == "" || strings.ContainsAny(name, ".$") {
+				return &PatchError{Path: joinPath(jsonPath, name), Reason: "key cannot be empty or contain '.' or '$'"}
+			}
+			if err := p.addValue(valueType.Elem(), joinPath(path, name), joinPath(jsonPath, name), fieldRaw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value := reflect.New(valueType)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &PatchError{Path: jsonPath, Reason: "expected " + typeErr.Type.String() + ", got " + typeErr.Value}
+		}
+		return &PatchError{Path: jsonPath, Reason: err.Error()}
+	}
+	p.Set = append(p.Set, bson.E{Key: path, Value: value.Elem().Interface()})
+	return nil
+}
+
+// mergesFields reports whether an object patching a value of valueType is merged into it, rather than replacing it.
+// Values that decode themselves, such as times, are replaced.
+func mergesFields(valueType reflect.Type) bool {
+	if valueType == timeType || reflect.PointerTo(valueType).Implements(jsonUnmarshalerType) {
+		return false
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Map:
+		return valueType.Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// structFieldForJSONName finds the field that encoding/json decodes name into.
+func structFieldForJSONName(structType reflect.Type, name string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		if jsonName == name {
+			return field, true
+		}
+		if folded == nil && strings.EqualFold(jsonName, name) {
+			folded = &field
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+// bsonFieldName is the key the driver stores field under: its bson tag, or its lowercased name.
+func bsonFieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("bson"), ","); name != "" && name != "-" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// sortedKeys keeps the order of a patch's paths stable from one request to the next.
+func sortedKeys(fields map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewMergePatch(t *testing.T) {
+	patch, err := NewMergePatch[Shipment]([]byte(`{
+		"current_status": "Berthed",
+		"vessel_specifications": {"vessel_name": "UOG IOANNIS V", "grt": 5000},
+		"voyage_number": null
+	}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, bson.D{{Key: "voyagenumber", Value: ""}}, patch.Unset)
+	assert.Len(t, patch.Set, 4)
+	status, _ := patch.Value("currentstatus")
+	assert.Equal(t, enum.SHIPMENT_STATUS_BERTHED, status)
+	name, _ := patch.Value("vesselspecifications.vesselname")
+	assert.Equal(t, "UOG IOANNIS V", name)
+	grt, _ := patch.Value("vesselspecifications.grt")
+	assert.Equal(t, int64(5000), grt)
+	_, ok := patch.Value("updatedat")
+	assert.True(t, ok)
+}
+
+func TestNewMergePatch_MergesMaps(t *testing.T) {
+	patch, err := NewMergePatch[InvoicePricing]([]byte(`{"invoice_pricing_details": {"pilotage": "1200", "mooring": null}}`))
+	assert.NoError(t, err)
+
+	pilotage, _ := patch.Value("invoicepricingdetails.pilotage")
+	assert.Equal(t, "1200", pilotage)
+	assert.Equal(t, bson.D{{Key: "invoicepricingdetails.mooring", Value: ""}}, patch.Unset)
+	assert.True(t, patch.Unsets("invoicepricingdetails.mooring"))
+	assert.False(t, patch.Unsets("invoicepricingdetails.pilotage"))
+}
+
+func TestNewMergePatch_Rejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		path  string
+	}{
+		{name: "not an object", patch: `[]`, path: "/"},
+		{name: "unknown field", patch: `{"vessel_specifications": {"colour": "red"}}`, path: "vessel_specifications.colour"},
+		{name: "wrong type", patch: `{"vessel_specifications": {"grt": "heavy"}}`, path: "vessel_specifications.grt"},
+		{name: "tenant", patch: `{"tenant": "tenantB"}`, path: "tenant"},
+		{name: "read only", patch: `{"master_email": "master@example.com"}`, path: "master_email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMergePatch[Shipment]([]byte(tt.patch), "master_email")
+			var patchErr *PatchError
+			assert.True(t, errors.As(err, &patchErr))
+			assert.Equal(t, tt.path, patchErr.Path)
+		})
+	}
+}
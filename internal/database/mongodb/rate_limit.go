@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitBucket is the token bucket of one route group and tenant, user or IP address, by Key,
+// e.g. "api:user:ops@customera.com". It holds Tokens as of UpdatedAt, and is forgotten at ExpiresAt, once it is full again.
+type RateLimitBucket struct {
+	Key       string    `bson:"_id"`
+	Tokens    float64   `bson:"tokens"`
+	Allowed   bool      `bson:"allowed"`
+	UpdatedAt time.Time `bson:"updatedat"`
+	ExpiresAt time.Time `bson:"expiresat"`
+}
+
+// RateLimitStore keeps the token buckets requests are limited with.
+type RateLimitStore interface {
+	// Take takes a token from the bucket key, which holds up to burst tokens and gains perSecond tokens a second,
+	// and returns how long until it has one if it is empty.
+	Take(ctx context.Context, key string, burst float64, perSecond float64, now time.Time) (time.Duration, error)
+}
+
+// RateLimitBuckets keeps the token buckets in Mongo, so that a limit holds across every instance of the server.
+type RateLimitBuckets struct {
+	collection *mongo.Collection
+}
+
+func NewRateLimitBuckets(collection *mongo.Collection) *RateLimitBuckets {
+	return &RateLimitBuckets{collection: collection}
+}
+
+var _ RateLimitStore = (*RateLimitBuckets)(nil)
+
+// Take refills and takes from the bucket in a single update, so that concurrent requests each see the tokens the other left.
+func (b *RateLimitBuckets) Take(ctx context.Context, key string, burst float64, perSecond float64, now time.Time) (time.Duration, error) {
+	elapsedSeconds := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedat", now}}}}, 1000}}
+	refilled := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", burst}},
+		bson.M{"$multiply": bson.A{bson.M{"$max": bson.A{elapsedSeconds, 0}}, perSecond}},
+	}}}}
+	hasToken := bson.M{"$gte": bson.A{"$tokens", 1}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedat": now, "expiresat": now.Add(fullAfter(0, burst, perSecond))}}},
+		// both fields are computed from the refilled tokens
+		{{Key: "$set", Value: bson.M{
+			"allowed": hasToken,
+			"tokens":  bson.M{"$cond": bson.A{hasToken, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var bucket RateLimitBucket
+	if err := b.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&bucket); err != nil {
+		return 0, err
+	}
+	if bucket.Allowed {
+		return 0, nil
+	}
+	return untilToken(bucket.Tokens, perSecond), nil
+}
+
+// MemoryRateLimitBuckets keeps the token buckets in memory, for a single instance of the server.
+type MemoryRateLimitBuckets struct {
+	mu        sync.Mutex
+	buckets   map[string]RateLimitBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitBuckets() *MemoryRateLimitBuckets {
+	return &MemoryRateLimitBuckets{buckets: make(map[string]RateLimitBucket)}
+}
+
+var _ RateLimitStore = (*MemoryRateLimitBuckets)(nil)
+
+func (b *MemoryRateLimitBuckets) Take(ctx context.Context, key string, burst float64, perSecond float64, now time.Time) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// full buckets are forgotten, as the TTL index forgets them in Mongo
+	if now.Sub(b.lastSweep) >= time.Minute {
+		for k, bucket := range b.buckets {
+			if !now.Before(bucket.ExpiresAt) {
+				delete(b.buckets, k)
+			}
+		}
+		b.lastSweep = now
+	}
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = RateLimitBucket{Key: key, Tokens: burst, UpdatedAt: now}
+	}
+	if elapsed := now.Sub(bucket.UpdatedAt).Seconds(); elapsed > 0 {
+		bucket.Tokens = math.Min(burst, bucket.Tokens+elapsed*perSecond)
+	}
+	bucket.UpdatedAt = now
+	bucket.Allowed = bucket.Tokens >= 1
+	if bucket.Allowed {
+		bucket.Tokens--
+	}
+	bucket.ExpiresAt = now.Add(fullAfter(bucket.Tokens, burst, perSecond))
+	b.buckets[key] = bucket
+
+	if bucket.Allowed {
+		return 0, nil
+	}
+	return untilToken(bucket.Tokens, perSecond), nil
+}
+
+// fullAfter is how long a bucket holding tokens takes to fill up to burst.
+func fullAfter(tokens float64, burst float64, perSecond float64) time.Duration {
+	return time.Duration((burst - tokens) / perSecond * float64(time.Second))
+}
+
+// untilToken is how long an empty bucket holding tokens takes to gain a whole token.
+func untilToken(tokens float64, perSecond float64) time.Duration {
+	return time.Duration((1 - tokens) / perSecond * float64(time.Second))
+}
@@ -15,17 +15,27 @@ type Session struct {
 	Tenant    string    `json:"tenant"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// UserAgent and IP are those the session logged in from, LastSeenAt when it was last used, to the minute
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	LastSeenAt time.Time `json:"last_seen_at"`
 }
 
 // SessionResponse represents the response structure for a session.
 type SessionResponse struct {
-	ID        string    `bson:"_id,omitempty"`
-	SessionID string    `json:"session_id"`
-	Email     string    `json:"email"`
-	JWTToken  string    `bson:"jwt_token"`
-	Tenant    string    `json:"tenant"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID         string     `bson:"_id,omitempty"`
+	Version    int64      `json:"version"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy  string     `json:"deleted_by,omitempty"`
+	SessionID  string     `json:"session_id"`
+	Email      string     `json:"email"`
+	JWTToken   string     `bson:"jwt_token"`
+	Tenant     string     `json:"tenant"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
 }
 
 // SessionCollection provides methods to interact with the session collection in MongoDB.
@@ -46,26 +56,32 @@ var _ Collection[Session, SessionResponse] = (*SessionCollection)(nil)
 // Create stores a new session in the collection.
 func (r *SessionCollection) Create(ctx context.Context, entity Session) (string, error) {
 	session := Session{
-		SessionID: entity.SessionID,
-		Email:     entity.Email,
-		JWTToken:  entity.JWTToken,
-		Tenant:    entity.Tenant,
-		CreatedAt: entity.CreatedAt,
-		ExpiresAt: entity.ExpiresAt,
+		SessionID:  entity.SessionID,
+		Email:      entity.Email,
+		JWTToken:   entity.JWTToken,
+		Tenant:     entity.Tenant,
+		CreatedAt:  entity.CreatedAt,
+		ExpiresAt:  entity.ExpiresAt,
+		UserAgent:  entity.UserAgent,
+		IP:         entity.IP,
+		LastSeenAt: entity.LastSeenAt,
 	}
 	return r.GenericCollection.Create(ctx, session)
 }
 
-func (r *SessionCollection) Update(ctx context.Context, id string, entity Session) error {
+func (r *SessionCollection) Update(ctx context.Context, id string, tenant string, entity Session) error {
 	session := Session{
-		SessionID: entity.SessionID,
-		Email:     entity.Email,
-		JWTToken:  entity.JWTToken,
-		Tenant:    entity.Tenant,
-		CreatedAt: entity.CreatedAt,
-		ExpiresAt: entity.ExpiresAt,
+		SessionID:  entity.SessionID,
+		Email:      entity.Email,
+		JWTToken:   entity.JWTToken,
+		Tenant:     entity.Tenant,
+		CreatedAt:  entity.CreatedAt,
+		ExpiresAt:  entity.ExpiresAt,
+		UserAgent:  entity.UserAgent,
+		IP:         entity.IP,
+		LastSeenAt: entity.LastSeenAt,
 	}
-	return r.GenericCollection.Update(ctx, id, session)
+	return r.GenericCollection.Update(ctx, id, tenant, session)
 }
 
 // GetBySessionID retrieves a session by its session ID.
@@ -73,7 +89,7 @@ func (r *SessionCollection) GetBySessionID(ctx context.Context, sessionID string
 	return r.GenericCollection.GetByKeyValue(ctx, "session_id", sessionID, tenant)
 }
 
-// Delete removes a session from the collection.
-func (r *SessionCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+// Delete removes a session from the collection. Sessions are not kept in the trash.
+func (r *SessionCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.HardDelete(ctx, id, tenant)
 }
@@ -15,6 +15,7 @@ type Shipment struct {
 	MasterEmail          string               `json:"master_email"`
 	InitialETA           time.Time            `json:"initial_ETA"`
 	CurrentETA           time.Time            `json:"current_ETA"`
+	CurrentETAText       string               `json:"current_ETA_text"`
 	VoyageNumber         string               `json:"voyage_number"`
 	CurrentStatus        enum.ShipmentStatus  `json:"current_status"`
 	ShipmentDetails      ShipmentDetails      `json:"shipment_details"`
@@ -62,10 +63,14 @@ type ShipmentDetails struct {
 
 type ShipmentResponse struct {
 	ID                   string               `bson:"_id"`
+	Version              int64                `json:"version"`
+	DeletedAt            *time.Time           `json:"deleted_at,omitempty"`
+	DeletedBy            string               `json:"deleted_by,omitempty"`
 	Tenant               string               `json:"tenant"`
 	MasterEmail          string               `json:"master_email"`
 	InitialETA           time.Time            `json:"initial_ETA"`
 	CurrentETA           time.Time            `json:"current_ETA"`
+	CurrentETAText       string               `json:"current_ETA_text"`
 	VoyageNumber         string               `json:"voyage_number"`
 	CurrentStatus        enum.ShipmentStatus  `json:"current_status"`
 	ShipmentType         ShipmentType         `json:"shipment_type"`
@@ -91,8 +96,9 @@ func (r *ShipmentCollection) Create(ctx context.Context, entity Shipment) (strin
 	shipment := Shipment{
 		Tenant:               entity.Tenant,
 		MasterEmail:          entity.MasterEmail,
-		InitialETA:           entity.InitialETA,
-		CurrentETA:           entity.CurrentETA,
+		InitialETA:           entity.InitialETA.UTC(),
+		CurrentETA:           entity.CurrentETA.UTC(),
+		CurrentETAText:       entity.CurrentETAText,
 		VoyageNumber:         entity.VoyageNumber,
 		CurrentStatus:        entity.CurrentStatus,
 		ShipmentType:         entity.ShipmentType,
@@ -105,12 +111,13 @@ func (r *ShipmentCollection) Create(ctx context.Context, entity Shipment) (strin
 	return id, err
 }
 
-func (r *ShipmentCollection) Update(ctx context.Context, id string, entity Shipment) error {
+func (r *ShipmentCollection) Update(ctx context.Context, id string, tenant string, entity Shipment) error {
 	shipment := Shipment{
 		Tenant:               entity.Tenant,
 		MasterEmail:          entity.MasterEmail,
-		InitialETA:           entity.InitialETA,
-		CurrentETA:           entity.CurrentETA,
+		InitialETA:           entity.InitialETA.UTC(),
+		CurrentETA:           entity.CurrentETA.UTC(),
+		CurrentETAText:       entity.CurrentETAText,
 		VoyageNumber:         entity.VoyageNumber,
 		CurrentStatus:        entity.CurrentStatus,
 		ShipmentType:         entity.ShipmentType,
@@ -120,7 +127,7 @@ func (r *ShipmentCollection) Update(ctx context.Context, id string, entity Shipm
 		UpdatedAt:            time.Now(),
 	}
 	log.Println(entity)
-	return r.GenericCollection.Update(ctx, id, shipment)
+	return r.GenericCollection.Update(ctx, id, tenant, shipment)
 }
 
 func (r *ShipmentCollection) GetAll(ctx context.Context, tenant string) ([]ShipmentResponse, error) {
@@ -131,6 +138,6 @@ func (r *ShipmentCollection) GetByID(ctx context.Context, id string, tenant stri
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *ShipmentCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *ShipmentCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -9,22 +9,8 @@ import (
 )
 
 type Checklist struct {
-	PortDues         core.PortDues                      `json:"port_dues"`
-	Pilotage         core.Pilotage                      `json:"pilotage"`
-	ServiceLaunch    core.ServiceLaunch                 `json:"service_launch"`
-	Logistics        core.Logistics                     `json:"logistics"`
-	HotelCharges     core.HotelCharges                  `json:"hotel_charges"`
-	AirTickets       core.AirTickets                    `json:"air_tickets"`
-	TransportCharges core.TransportCharges              `json:"transport_charges"`
-	MedicineSupplies core.MedicineSupplies              `json:"medicine_supplies"`
-	FreshWaterSupply core.FreshWaterSupply              `json:"fresh_water_supply"`
-	MarineAdvisory   core.MarineAdvisory                `json:"marine_advisory"`
-	CourierServices  core.CourierServices               `json:"courier_services"`
-	CrossHarbourFees core.CrossHarbourFees              `json:"cross_harbour_fees"`
-	SupplyBoat       core.SupplyBoat                    `json:"supply_boat"`
-	Repairs          core.Repairs                       `json:"repairs"`
-	CrewChange       core.CrewChange                    `json:"crew_change"`
-	Extras           map[string]*core.ExtrasInformation `json:"extras"`
+	Items      core.ChecklistItems `json:"items"`
+	CrewChange core.CrewChange     `json:"crew_change"`
 
 	ShipmentID string    `json:"shipment_id"`
 	Tenant     string    `json:"tenant"`
@@ -33,23 +19,12 @@ type Checklist struct {
 }
 
 type ChecklistResponse struct {
-	ID               string                             `bson:"_id"`
-	PortDues         core.PortDues                      `json:"port_dues"`
-	Pilotage         core.Pilotage                      `json:"pilotage"`
-	ServiceLaunch    core.ServiceLaunch                 `json:"service_launch"`
-	Logistics        core.Logistics                     `json:"logistics"`
-	HotelCharges     core.HotelCharges                  `json:"hotel_charges"`
-	AirTickets       core.AirTickets                    `json:"air_tickets"`
-	TransportCharges core.TransportCharges              `json:"transport_charges"`
-	MedicineSupplies core.MedicineSupplies              `json:"medicine_supplies"`
-	FreshWaterSupply core.FreshWaterSupply              `json:"fresh_water_supply"`
-	MarineAdvisory   core.MarineAdvisory                `json:"marine_advisory"`
-	CourierServices  core.CourierServices               `json:"courier_services"`
-	CrossHarbourFees core.CrossHarbourFees              `json:"cross_harbour_fees"`
-	SupplyBoat       core.SupplyBoat                    `json:"supply_boat"`
-	Repairs          core.Repairs                       `json:"repairs"`
-	CrewChange       core.CrewChange                    `json:"crew_change"`
-	Extras           map[string]*core.ExtrasInformation `json:"extras"`
+	ID         string              `bson:"_id"`
+	Version    int64               `json:"version"`
+	DeletedAt  *time.Time          `json:"deleted_at,omitempty"`
+	DeletedBy  string              `json:"deleted_by,omitempty"`
+	Items      core.ChecklistItems `json:"items"`
+	CrewChange core.CrewChange     `json:"crew_change"`
 
 	ShipmentID string    `json:"shipment_id"`
 	Tenant     string    `json:"tenant"`
@@ -72,56 +47,28 @@ var _ Collection[Checklist, ChecklistResponse] = (*ChecklistCollection)(nil)
 func (r *ChecklistCollection) Create(ctx context.Context, entity Checklist) (string, error) {
 
 	Checklist := Checklist{
-		PortDues:         entity.PortDues,
-		Pilotage:         entity.Pilotage,
-		ServiceLaunch:    entity.ServiceLaunch,
-		Logistics:        entity.Logistics,
-		HotelCharges:     entity.HotelCharges,
-		AirTickets:       entity.AirTickets,
-		TransportCharges: entity.TransportCharges,
-		MedicineSupplies: entity.MedicineSupplies,
-		FreshWaterSupply: entity.FreshWaterSupply,
-		MarineAdvisory:   entity.MarineAdvisory,
-		CourierServices:  entity.CourierServices,
-		CrossHarbourFees: entity.CrossHarbourFees,
-		SupplyBoat:       entity.SupplyBoat,
-		Repairs:          entity.Repairs,
-		Tenant:           entity.Tenant,
-		Extras:           entity.Extras,
-		CrewChange:       entity.CrewChange,
-		ShipmentID:       entity.ShipmentID,
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
+		Items:      entity.Items,
+		Tenant:     entity.Tenant,
+		CrewChange: entity.CrewChange,
+		ShipmentID: entity.ShipmentID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
 
 	return r.GenericCollection.Create(ctx, Checklist)
 }
 
-func (r *ChecklistCollection) Update(ctx context.Context, id string, entity Checklist) error {
+func (r *ChecklistCollection) Update(ctx context.Context, id string, tenant string, entity Checklist) error {
 	Checklist := Checklist{
-		PortDues:         entity.PortDues,
-		Pilotage:         entity.Pilotage,
-		ServiceLaunch:    entity.ServiceLaunch,
-		Logistics:        entity.Logistics,
-		HotelCharges:     entity.HotelCharges,
-		AirTickets:       entity.AirTickets,
-		TransportCharges: entity.TransportCharges,
-		MedicineSupplies: entity.MedicineSupplies,
-		FreshWaterSupply: entity.FreshWaterSupply,
-		MarineAdvisory:   entity.MarineAdvisory,
-		CourierServices:  entity.CourierServices,
-		CrossHarbourFees: entity.CrossHarbourFees,
-		SupplyBoat:       entity.SupplyBoat,
-		Repairs:          entity.Repairs,
-		ShipmentID:       entity.ShipmentID,
-		Tenant:           entity.Tenant,
-		Extras:           entity.Extras,
-		CrewChange:       entity.CrewChange,
+		Items:      entity.Items,
+		ShipmentID: entity.ShipmentID,
+		Tenant:     entity.Tenant,
+		CrewChange: entity.CrewChange,
 
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, Checklist)
+	return r.GenericCollection.Update(ctx, id, tenant, Checklist)
 }
 
 func (r *ChecklistCollection) GetAll(ctx context.Context, tenant string) ([]ChecklistResponse, error) {
@@ -136,6 +83,6 @@ func (r *ChecklistCollection) GetByID(ctx context.Context, id string, tenant str
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *ChecklistCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *ChecklistCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
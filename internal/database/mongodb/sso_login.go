@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SSOLogin is a single sign-on a user has started with their tenant's identity provider, found by its State when
+// the provider sends them back. It is deleted then, so it is only used once, and expires at ExpiresAt otherwise.
+type SSOLogin struct {
+	Tenant       string    `json:"tenant"`
+	State        string    `json:"state"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type SSOLoginResponse struct {
+	ID           string     `bson:"_id" json:"id"`
+	Version      int64      `json:"version"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy    string     `json:"deleted_by,omitempty"`
+	Tenant       string     `json:"tenant"`
+	State        string     `json:"state"`
+	Nonce        string     `json:"-"`
+	CodeVerifier string     `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type SSOLoginCollection struct {
+	*GenericCollection[SSOLogin, SSOLoginResponse]
+}
+
+func NewSSOLoginCollection(collection *mongo.Collection) *SSOLoginCollection {
+	return &SSOLoginCollection{
+		GenericCollection: NewGenericCollection[SSOLogin, SSOLoginResponse](collection),
+	}
+}
+
+var _ Collection[SSOLogin, SSOLoginResponse] = (*SSOLoginCollection)(nil)
+
+func (r *SSOLoginCollection) Create(ctx context.Context, entity SSOLogin) (string, error) {
+	login := SSOLogin{
+		Tenant:       entity.Tenant,
+		State:        entity.State,
+		Nonce:        entity.Nonce,
+		CodeVerifier: entity.CodeVerifier,
+		ExpiresAt:    entity.ExpiresAt,
+		CreatedAt:    time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, login)
+}
@@ -17,6 +17,9 @@ type Supplier struct {
 
 type SupplierManagementResponse struct {
 	ID                     string                      `bson:"_id"`
+	Version                int64                       `json:"version"`
+	DeletedAt              *time.Time                  `json:"deleted_at,omitempty"`
+	DeletedBy              string                      `json:"deleted_by,omitempty"`
 	Tenant                 string                      `json:"tenant"`
 	SupplierSpecifications core.SupplierSpecifications `json:"supplier_specifications"`
 	CreatedAt              time.Time                   `json:"created_at"`
@@ -47,14 +50,14 @@ func (r *SupplierCollection) Create(ctx context.Context, entity Supplier) (strin
 	return r.GenericCollection.Create(ctx, Supplier)
 }
 
-func (r *SupplierCollection) Update(ctx context.Context, id string, entity Supplier) error {
+func (r *SupplierCollection) Update(ctx context.Context, id string, tenant string, entity Supplier) error {
 	Supplier := Supplier{
 		Tenant:                 entity.Tenant,
 		SupplierSpecifications: entity.SupplierSpecifications,
 		CreatedAt:              entity.CreatedAt,
 		UpdatedAt:              time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, Supplier)
+	return r.GenericCollection.Update(ctx, id, tenant, Supplier)
 }
 
 func (r *SupplierCollection) GetAll(ctx context.Context, tenant string) ([]SupplierManagementResponse, error) {
@@ -65,6 +68,6 @@ func (r *SupplierCollection) GetByID(ctx context.Context, id string, tenant stri
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *SupplierCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *SupplierCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Tenant is a tenant added or changed with crmctl. Its users are those whose email ends in one of its domains,
+// e.g. "@customera.com". The tenants built into config.MakeMapping only have a document once they are first changed.
+type Tenant struct {
+	Tenant   string   `json:"tenant"`
+	Domains  []string `json:"domains"`
+	Disabled bool     `json:"disabled"`
+	// RequireTOTP makes the tenant's users set up two-factor authentication before they can log in
+	RequireTOTP bool `json:"require_totp"`
+	// SSO lets the tenant's users log in with their identity provider, when it is set
+	SSO *TenantSSO `json:"sso,omitempty"`
+	// LLMBudget is what the tenant may spend on LLM calls a month, instead of the configured budget
+	LLMBudget *TenantLLMBudget `json:"llm_budget,omitempty"`
+	// Timezone is the IANA timezone of the port the tenant operates in, config.DEFAULT_TIMEZONE when empty
+	Timezone  string    `json:"timezone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TenantSSO is the tenant's OpenID Connect identity provider, and the client registered with it. Only users with an
+// email in AllowedDomains log in with it. When RoleClaim is set, e.g. "groups", users whose claim is or contains
+// AdminValue are admins and the others members; otherwise new users are members and roles are left to crmctl.
+type TenantSSO struct {
+	Issuer         string   `json:"issuer"`
+	ClientID       string   `json:"client_id"`
+	ClientSecret   string   `json:"-"`
+	AllowedDomains []string `json:"allowed_domains"`
+	RoleClaim      string   `json:"role_claim,omitempty"`
+	AdminValue     string   `json:"admin_value,omitempty"`
+}
+
+// TenantLLMBudget is what a tenant may spend on LLM calls a month, in US dollars. Past SoftUSD it is warned about,
+// past HardUSD its emails are no longer read by the LLM but sent to review. Zero is no limit.
+type TenantLLMBudget struct {
+	SoftUSD float64 `json:"soft_usd"`
+	HardUSD float64 `json:"hard_usd"`
+}
+
+type TenantResponse struct {
+	ID          string           `bson:"_id"`
+	Version     int64            `json:"version"`
+	DeletedAt   *time.Time       `json:"deleted_at,omitempty"`
+	DeletedBy   string           `json:"deleted_by,omitempty"`
+	Tenant      string           `json:"tenant"`
+	Domains     []string         `json:"domains"`
+	Disabled    bool             `json:"disabled"`
+	RequireTOTP bool             `json:"require_totp"`
+	SSO         *TenantSSO       `json:"sso,omitempty"`
+	LLMBudget   *TenantLLMBudget `json:"llm_budget,omitempty"`
+	Timezone    string           `json:"timezone,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type TenantCollection struct {
+	*GenericCollection[Tenant, TenantResponse]
+}
+
+func NewTenantCollection(collection *mongo.Collection) *TenantCollection {
+	return &TenantCollection{
+		GenericCollection: NewGenericCollection[Tenant, TenantResponse](collection),
+	}
+}
+
+var _ Collection[Tenant, TenantResponse] = (*TenantCollection)(nil)
+
+func (r *TenantCollection) Create(ctx context.Context, entity Tenant) (string, error) {
+	tenant := Tenant{
+		Tenant:      entity.Tenant,
+		Domains:     entity.Domains,
+		Disabled:    entity.Disabled,
+		RequireTOTP: entity.RequireTOTP,
+		SSO:         entity.SSO,
+		LLMBudget:   entity.LLMBudget,
+		Timezone:    entity.Timezone,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	return r.GenericCollection.Create(ctx, tenant)
+}
+
+func (r *TenantCollection) Update(ctx context.Context, id string, tenant string, entity Tenant) error {
+	updated := Tenant{
+		Tenant:      entity.Tenant,
+		Domains:     entity.Domains,
+		Disabled:    entity.Disabled,
+		RequireTOTP: entity.RequireTOTP,
+		SSO:         entity.SSO,
+		LLMBudget:   entity.LLMBudget,
+		Timezone:    entity.Timezone,
+		CreatedAt:   entity.CreatedAt,
+		UpdatedAt:   time.Now(),
+	}
+	return r.GenericCollection.Update(ctx, id, tenant, updated)
+}
@@ -17,6 +17,9 @@ type Terminal struct {
 
 type TerminalManagementResponse struct {
 	ID                     string                      `bson:"_id"`
+	Version                int64                       `json:"version"`
+	DeletedAt              *time.Time                  `json:"deleted_at,omitempty"`
+	DeletedBy              string                      `json:"deleted_by,omitempty"`
 	Tenant                 string                      `json:"tenant"`
 	TerminalSpecifications core.TerminalSpecifications `json:"terminal_specifications"`
 	CreatedAt              time.Time                   `json:"created_at"`
@@ -47,14 +50,14 @@ func (r *TerminalCollection) Create(ctx context.Context, entity Terminal) (strin
 	return r.GenericCollection.Create(ctx, Terminal)
 }
 
-func (r *TerminalCollection) Update(ctx context.Context, id string, entity Terminal) error {
+func (r *TerminalCollection) Update(ctx context.Context, id string, tenant string, entity Terminal) error {
 	Terminal := Terminal{
 		Tenant:                 entity.Tenant,
 		TerminalSpecifications: entity.TerminalSpecifications,
 		CreatedAt:              entity.CreatedAt,
 		UpdatedAt:              time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, Terminal)
+	return r.GenericCollection.Update(ctx, id, tenant, Terminal)
 }
 
 func (r *TerminalCollection) GetAll(ctx context.Context, tenant string) ([]TerminalManagementResponse, error) {
@@ -65,6 +68,6 @@ func (r *TerminalCollection) GetByID(ctx context.Context, id string, tenant stri
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *TerminalCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *TerminalCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs fn inside a database transaction. Collection calls made with the ctx
+// passed to fn take part in the transaction, and are rolled back if fn returns an error.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type MongoTransactor struct {
+	client *mongo.Client
+}
+
+func NewMongoTransactor(client *mongo.Client) *MongoTransactor {
+	return &MongoTransactor{client: client}
+}
+
+var _ Transactor = (*MongoTransactor)(nil)
+
+// WithTransaction needs MongoDB to run as a replica set, standalone servers do not support transactions.
+// The driver retries fn on transient transaction errors, so fn must be safe to run more than once.
+func (t *MongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+// ErrNoTransactions is returned by CheckTransactions when MongoDB runs as a standalone server.
+var ErrNoTransactions = errors.New("MongoDB is a standalone server, it must run as a replica set (a single node is enough) for transactions")
+
+// CheckTransactions makes sure the server client is connected to supports transactions,
+// so that the server refuses to start rather than fail every unit of work.
+func CheckTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	// a replica set member has a set name, a mongos of a sharded cluster says it is one
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrNoTransactions
+	}
+	return nil
+}
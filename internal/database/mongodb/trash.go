@@ -0,0 +1,177 @@
+package database
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Deleting a document only marks it as deleted, with when and by whom. Deleted documents are left out of
+// every read, can be listed and restored through the collection's Trash, and are purged after a while.
+const (
+	deletedAtField = "deletedat"
+	deletedByField = "deletedby"
+)
+
+// Trash is a collection's deleted documents.
+type Trash interface {
+	GetDeleted(ctx context.Context, tenant string) (interface{}, error)
+	DeletedAt(ctx context.Context, id string, tenant string) (time.Time, error)
+	Restore(ctx context.Context, id string, tenant string) error
+	DeleteByKeyValue(ctx context.Context, key string, value string, tenant string) (int64, error)
+	RestoreByKeyValue(ctx context.Context, key string, value string, tenant string, deletedSince time.Time) (int64, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ Trash = (*GenericCollection[Shipment, ShipmentResponse])(nil)
+
+type actorKey struct{}
+
+// WithActor names who the writes done with the returned ctx are made by, e.g. the email of the logged in user.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor is the actor set with WithActor, or "" if there is none.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// notDeleted matches documents that are not in the trash
+func notDeleted() bson.E {
+	return bson.E{Key: deletedAtField, Value: nil}
+}
+
+func inTrash() bson.E {
+	return bson.E{Key: deletedAtField, Value: bson.M{"$ne": nil}}
+}
+
+func deletion(ctx context.Context) bson.M {
+	return bson.M{
+		"$set": bson.M{deletedAtField: time.Now(), deletedByField: Actor(ctx)},
+		"$inc": bson.M{versionField: 1},
+	}
+}
+
+func restoration() bson.M {
+	return bson.M{
+		"$unset": bson.M{deletedAtField: "", deletedByField: ""},
+		"$inc":   bson.M{versionField: 1},
+	}
+}
+
+// GetDeleted returns the tenant's deleted documents as a []T, most recently deleted first.
+func (r *GenericCollection[S, T]) GetDeleted(ctx context.Context, tenant string) (interface{}, error) {
+	defer r.timed("get_deleted", time.Now())
+	opts := options.Find().SetSort(bson.D{{Key: deletedAtField, Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.D{{Key: "tenant", Value: tenant}, inTrash()}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []T{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeletedAt is when the tenant's deleted document with id was deleted.
+func (r *GenericCollection[S, T]) DeletedAt(ctx context.Context, id string, tenant string) (time.Time, error) {
+	defer r.timed("deleted_at", time.Now())
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var result struct {
+		DeletedAt time.Time `bson:"deletedat"`
+	}
+	filter := bson.D{{Key: "_id", Value: objectId}, {Key: "tenant", Value: tenant}, inTrash()}
+	err = r.collection.FindOne(ctx, filter).Decode(&result)
+	return result.DeletedAt, err
+}
+
+// Restore takes the tenant's document with id out of the trash.
+func (r *GenericCollection[S, T]) Restore(ctx context.Context, id string, tenant string) error {
+	defer r.timed("restore", time.Now())
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	filter := bson.D{{Key: "_id", Value: objectId}, {Key: "tenant", Value: tenant}, inTrash()}
+	return r.audited(ctx, enum.AUDIT_ACTION_RESTORE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateOne(ctx, filter, restoration())
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicateKey
+			}
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		return nil, nil
+	})
+}
+
+// DeleteByKeyValue moves all of the tenant's documents where key is value to the trash, and returns how many there were.
+func (r *GenericCollection[S, T]) DeleteByKeyValue(ctx context.Context, key string, value string, tenant string) (int64, error) {
+	defer r.timed("delete_by_key_value", time.Now())
+	filter := bson.D{{Key: key, Value: value}, {Key: "tenant", Value: tenant}, notDeleted()}
+	var deleted int64
+	err := r.audited(ctx, enum.AUDIT_ACTION_DELETE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateMany(ctx, filter, deletion(ctx))
+		if err != nil {
+			return nil, err
+		}
+		deleted = result.ModifiedCount
+		return nil, nil
+	})
+	return deleted, err
+}
+
+// RestoreByKeyValue takes the tenant's documents where key is value, and that were deleted since deletedSince, out of the trash.
+func (r *GenericCollection[S, T]) RestoreByKeyValue(ctx context.Context, key string, value string, tenant string, deletedSince time.Time) (int64, error) {
+	defer r.timed("restore_by_key_value", time.Now())
+	filter := bson.D{
+		{Key: key, Value: value},
+		{Key: "tenant", Value: tenant},
+		{Key: deletedAtField, Value: bson.M{"$gte": deletedSince}},
+	}
+	var restored int64
+	err := r.audited(ctx, enum.AUDIT_ACTION_RESTORE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.UpdateMany(ctx, filter, restoration())
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicateKey
+			}
+			return nil, err
+		}
+		restored = result.ModifiedCount
+		return nil, nil
+	})
+	return restored, err
+}
+
+// PurgeDeleted removes the documents of every tenant that were deleted before before, for good.
+func (r *GenericCollection[S, T]) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	defer r.timed("purge_deleted", time.Now())
+	filter := bson.M{deletedAtField: bson.M{"$lt": before}}
+	var purged int64
+	err := r.audited(ctx, enum.AUDIT_ACTION_PURGE, filter, func() ([]primitive.ObjectID, error) {
+		result, err := r.collection.DeleteMany(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		purged = result.DeletedCount
+		return nil, nil
+	})
+	return purged, err
+}
@@ -0,0 +1,46 @@
+package database
+
+import "context"
+
+// UnitOfWork runs a group of collection writes as one transaction: either all of them are stored or none are.
+// Work that must not happen unless the writes are stored, such as sending a message, is registered with AfterCommit.
+type UnitOfWork struct {
+	transactor Transactor
+}
+
+func NewUnitOfWork(transactor Transactor) *UnitOfWork {
+	return &UnitOfWork{transactor: transactor}
+}
+
+type afterCommitKey struct{}
+
+// Do runs fn in a transaction. Collection calls must use the ctx passed to fn to take part in it.
+// fn may be run more than once if the transaction is retried, so it should not have side effects outside the database.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	var hooks *[]func(ctx context.Context)
+	err := u.transactor.WithTransaction(ctx, func(txCtx context.Context) error {
+		// a retried attempt starts with no hooks, the previous attempt's writes were rolled back
+		attemptHooks := []func(ctx context.Context){}
+		hooks = &attemptHooks
+		return fn(context.WithValue(txCtx, afterCommitKey{}, hooks))
+	})
+	if err != nil || hooks == nil {
+		return err
+	}
+
+	for _, hook := range *hooks {
+		hook(ctx)
+	}
+	return nil
+}
+
+// AfterCommit runs hook once the unit of work that ctx belongs to has committed, and not at all if it rolls back.
+// Outside a unit of work the hook runs straight away.
+func AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*[]func(ctx context.Context))
+	if !ok {
+		hook(ctx)
+		return
+	}
+	*hooks = append(*hooks, hook)
+}
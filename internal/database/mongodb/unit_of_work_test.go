@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// retryingTransactor runs fn the given number of times, as the driver does on transient transaction errors.
+type retryingTransactor struct {
+	attempts int
+}
+
+func (t *retryingTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for i := 0; i < t.attempts; i++ {
+		err = fn(ctx)
+	}
+	return err
+}
+
+func TestUnitOfWork_RunsHooksOnceAfterCommit(t *testing.T) {
+	unitOfWork := NewUnitOfWork(&retryingTransactor{attempts: 2})
+
+	hookRuns := 0
+	err := unitOfWork.Do(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func(ctx context.Context) {
+			hookRuns++
+		})
+		assert.Equal(t, 0, hookRuns)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hookRuns)
+}
+
+func TestUnitOfWork_SkipsHooksOnRollback(t *testing.T) {
+	unitOfWork := NewUnitOfWork(&retryingTransactor{attempts: 1})
+
+	hookRan := false
+	err := unitOfWork.Do(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, func(ctx context.Context) {
+			hookRan = true
+		})
+		return errors.New("checklist update failed")
+	})
+
+	assert.Error(t, err)
+	assert.False(t, hookRan)
+}
+
+func TestAfterCommit_OutsideUnitOfWork(t *testing.T) {
+	hookRan := false
+	AfterCommit(context.Background(), func(ctx context.Context) {
+		hookRan = true
+	})
+	assert.True(t, hookRan)
+}
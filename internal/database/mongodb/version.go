@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Every document carries a version, starting at 1 and incremented by each update.
+// An update made with a ctx from WithExpectedVersion only applies if the document is still at that version,
+// so two writers that read the same version cannot overwrite each other's changes.
+const versionField = "version"
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion makes the updates done with the returned ctx fail with ErrVersionConflict
+// unless the document is at version.
+func WithExpectedVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// ExpectedVersion is the version set with WithExpectedVersion, if any.
+func ExpectedVersion(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(expectedVersionKey{}).(int64)
+	return version, ok
+}
+
+// versionFilter matches documents at version. Documents stored before versioning have no version field and count as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// versionedDocument is entity as a document with its version field set.
+func versionedDocument(entity interface{}, version int64) (bson.D, error) {
+	data, err := bson.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return append(document, bson.E{Key: versionField, Value: version}), nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	_, ok := ExpectedVersion(context.Background())
+	assert.False(t, ok)
+
+	version, ok := ExpectedVersion(WithExpectedVersion(context.Background(), 3))
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), version)
+}
+
+func TestVersionedDocument(t *testing.T) {
+	document, err := versionedDocument(Customer{Tenant: "tenantA", Customer: "Acme"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenantA", document.Map()["tenant"])
+	assert.Equal(t, int64(1), document.Map()["version"])
+}
+
+func TestVersionFilter(t *testing.T) {
+	// documents stored before versioning have no version field
+	assert.Equal(t, bson.M{"$in": bson.A{0, nil}}, versionFilter(0))
+	assert.Equal(t, int64(2), versionFilter(2))
+}
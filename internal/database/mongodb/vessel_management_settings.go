@@ -16,6 +16,9 @@ type Vessel struct {
 
 type VesselManagementResponse struct {
 	ID                   string               `bson:"_id"`
+	Version              int64                `json:"version"`
+	DeletedAt            *time.Time           `json:"deleted_at,omitempty"`
+	DeletedBy            string               `json:"deleted_by,omitempty"`
 	Tenant               string               `json:"tenant"`
 	VesselSpecifications VesselSpecifications `json:"vessel_specifications"`
 	CreatedAt            time.Time            `json:"created_at"`
@@ -46,14 +49,14 @@ func (r *VesselCollection) Create(ctx context.Context, entity Vessel) (string, e
 	return r.GenericCollection.Create(ctx, vessel)
 }
 
-func (r *VesselCollection) Update(ctx context.Context, id string, entity Vessel) error {
+func (r *VesselCollection) Update(ctx context.Context, id string, tenant string, entity Vessel) error {
 	vessel := Vessel{
 		Tenant:               entity.Tenant,
 		VesselSpecifications: entity.VesselSpecifications,
 		CreatedAt:            entity.CreatedAt,
 		UpdatedAt:            time.Now(),
 	}
-	return r.GenericCollection.Update(ctx, id, vessel)
+	return r.GenericCollection.Update(ctx, id, tenant, vessel)
 }
 
 func (r *VesselCollection) GetAll(ctx context.Context, tenant string) ([]VesselManagementResponse, error) {
@@ -64,6 +67,6 @@ func (r *VesselCollection) GetByID(ctx context.Context, id string, tenant string
 	return r.GenericCollection.GetByID(ctx, id, tenant)
 }
 
-func (r *VesselCollection) Delete(ctx context.Context, id string) error {
-	return r.GenericCollection.Delete(ctx, id)
+func (r *VesselCollection) Delete(ctx context.Context, id string, tenant string) error {
+	return r.GenericCollection.Delete(ctx, id, tenant)
 }
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RecordActor passes the logged in user, or the API key, on to the data layer, which records them e.g. as who deleted
+// a document. It goes after ValidateCookie or APIKeyHandler.Authenticate, which put the principal in the request.
+func RecordActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := auth.GetPrincipal(r.Context()).Actor()
+		if actor == "" {
+			actor = auth.GetEmailFromToken(r.Context())
+		}
+		ctx := database.WithActor(r.Context(), actor)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RecordRequest passes the request's ID and where it comes from on to the data layer, for the audit log.
+// It goes after chi's middleware.RequestID, which gives the request its ID.
+func RecordRequest(source enum.AuditSource) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := database.WithRequestID(r.Context(), middleware.GetReqID(r.Context()))
+			ctx = database.WithSource(ctx, source)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -31,8 +29,7 @@ type getAllAgentsResponse struct {
 }
 
 func (h *AgentHandler) GetAllAgents(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var agentsList []database.AgentManagementResponse
@@ -53,10 +50,12 @@ func (h *AgentHandler) GetAllAgents(w http.ResponseWriter, r *http.Request) {
 	for _, agent := range agentsList {
 		agents = append(agents, database.AgentManagementResponse{
 			ID:        agent.ID,
+			Version:   agent.Version,
 			Tenant:    agent.Tenant,
 			Name:      agent.Name,
 			Email:     agent.Email,
 			Contact:   agent.Contact,
+			Timezone:  agent.Timezone,
 			CreatedAt: agent.CreatedAt,
 			UpdatedAt: agent.UpdatedAt,
 		})
@@ -68,8 +67,7 @@ func (h *AgentHandler) GetAllAgents(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) CreateAgent(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.Agent
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -97,10 +95,11 @@ func (h *AgentHandler) CreateAgent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) DeleteAgentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "agent_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.AgentCollection.Delete(r.Context(), _id)
+	err := h.AgentCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
@@ -117,20 +116,29 @@ func (h *AgentHandler) DeleteAgentById(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) UpdateAgentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "agent_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Agent
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.AgentCollection.Update(r.Context(), _id, updateParams)
+	err := h.AgentCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -143,9 +151,15 @@ func (h *AgentHandler) UpdateAgentById(w http.ResponseWriter, r *http.Request) {
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *AgentHandler) PatchAgentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "agent_id")
+
+	patchDocument(w, r, h.AgentCollection, _id, tenant, nil)
+}
+
 func (h *AgentHandler) GetAgentFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "agent_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -163,20 +177,22 @@ func (h *AgentHandler) GetAgentFromId(w http.ResponseWriter, r *http.Request) {
 
 	response := database.AgentManagementResponse{
 		ID:        agent.ID,
+		Version:   agent.Version,
 		Tenant:    agent.Tenant,
 		Name:      agent.Name,
 		Email:     agent.Email,
 		Contact:   agent.Contact,
+		Timezone:  agent.Timezone,
 		CreatedAt: agent.CreatedAt,
 		UpdatedAt: agent.UpdatedAt,
 	}
 
+	setETag(w, agent.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *AgentHandler) FilterAgent(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -192,10 +208,12 @@ func (h *AgentHandler) FilterAgent(w http.ResponseWriter, r *http.Request) {
 
 	response := database.AgentManagementResponse{
 		ID:        agent.ID,
+		Version:   agent.Version,
 		Tenant:    agent.Tenant,
 		Name:      agent.Name,
 		Email:     agent.Email,
 		Contact:   agent.Contact,
+		Timezone:  agent.Timezone,
 		CreatedAt: agent.CreatedAt,
 		UpdatedAt: agent.UpdatedAt,
 	}
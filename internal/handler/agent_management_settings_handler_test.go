@@ -44,13 +44,18 @@ func (m *MockAgentCollection) GetAllByKeyValue(ctx context.Context, key string,
 	return args.Get(0).([]database.AgentManagementResponse), args.Error(1)
 }
 
-func (m *MockAgentCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockAgentCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func (m *MockAgentCollection) Update(ctx context.Context, id string, tenant string, agent database.Agent) error {
+	args := m.Called(ctx, id, tenant, agent)
 	return args.Error(0)
 }
 
-func (m *MockAgentCollection) Update(ctx context.Context, id string, agent database.Agent) error {
-	args := m.Called(ctx, id, agent)
+func (m *MockAgentCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
 	return args.Error(0)
 }
 
@@ -118,7 +123,7 @@ func TestAgentHandler_DeleteAgentById(t *testing.T) {
 	r.Delete("/agent_management/{agent_id}", handler.DeleteAgentById)
 
 	// Mock the Delete method
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/agent_management/1", nil)
 	// This creates a new instance of chi.RouteContext, which is used by the chi router to hold route-specific information such as URL parameters (route variables).
@@ -141,7 +146,7 @@ func TestAgentHandler_UpdateAgentById(t *testing.T) {
 	r.Put("/agent_management/{agent_id}", handler.UpdateAgentById)
 
 	// Mock the Update method
-	mockCollection.On("Update", mock.Anything, "1", mock.MatchedBy(func(agent database.Agent) bool {
+	mockCollection.On("Update", mock.Anything, "1", mock.Anything, mock.MatchedBy(func(agent database.Agent) bool {
 		return agent.Name == "John Updated" && agent.Email == "john.updated@example.com" && agent.Contact == "987-654-3210"
 	})).Return(nil)
 
@@ -149,6 +154,7 @@ func TestAgentHandler_UpdateAgentById(t *testing.T) {
 	chiCtx := chi.NewRouteContext()
 	chiCtx.URLParams.Add("agent_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// API keys let scripts and partner systems call the API without logging in, with an "Authorization: Bearer <key>" header.
+// Tenant admins create them for their tenant, with the scopes they need and an expiry; the key is only shown once.
+
+const (
+	// defaultAPIKeyTTL is how long an API key created without an expiry lasts
+	defaultAPIKeyTTL = 90 * 24 * time.Hour
+	// apiKeyLastUsedInterval is how often using an API key is recorded, so as not to write, and audit, on every request
+	apiKeyLastUsedInterval = time.Hour
+)
+
+type APIKeyHandler struct {
+	APIKeyCollection database.Collection[database.APIKey, database.APIKeyResponse]
+}
+
+func NewAPIKeyHandler(apiKeyCollection database.Collection[database.APIKey, database.APIKeyResponse]) *APIKeyHandler {
+	return &APIKeyHandler{
+		APIKeyCollection: apiKeyCollection,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name      string             `json:"name"`
+	Scopes    []enum.APIKeyScope `json:"scopes"`
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+// createAPIKeyResponse is a new API key, with the key itself, which is not stored and cannot be shown again.
+type createAPIKeyResponse struct {
+	database.APIKeyResponse
+	Key string `json:"key"`
+}
+
+// Authenticate puts the principal of the request in its context: the API key in its Authorization header if it has one,
+// limited to reading for safe methods, or else the user of its session cookie, checked by validateCookie.
+func (h *APIKeyHandler) Authenticate(validateCookie func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withCookie := validateCookie(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := bearerToken(r); !ok {
+				withCookie.ServeHTTP(w, r)
+				return
+			}
+			scope := enum.API_KEY_SCOPE_WRITE
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				scope = enum.API_KEY_SCOPE_READ
+			}
+			h.RequireAPIKey(scope)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAPIKey only lets through requests with an API key that has scope, and puts its principal in their context.
+func (h *APIKeyHandler) RequireAPIKey(scope enum.APIKeyScope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := bearerToken(r)
+			if !ok {
+				http.Error(w, "Unauthorized: No API key found in the request", http.StatusUnauthorized)
+				return
+			}
+			tenant, ok := auth.APIKeyTenant(key)
+			if !ok {
+				http.Error(w, "Unauthorized: Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			apiKey, err := h.APIKeyCollection.GetByKeyValue(r.Context(), "hash", auth.HashAPIKey(key), tenant)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					http.Error(w, "Unauthorized: Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if time.Now().After(apiKey.ExpiresAt) {
+				http.Error(w, "Unauthorized: API key expired", http.StatusUnauthorized)
+				return
+			}
+			if config.IsTenantDisabled(apiKey.Tenant) {
+				http.Error(w, "Unauthorized: Tenant disabled", http.StatusUnauthorized)
+				return
+			}
+
+			principal := auth.Principal{Tenant: apiKey.Tenant, APIKeyID: apiKey.ID, Scopes: apiKey.Scopes}
+			if !principal.HasScope(scope) {
+				render.Render(w, r, ErrForbidden)
+				return
+			}
+			h.touchAPIKey(r, apiKey)
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// touchAPIKey records that the API key is being used, at most once every apiKeyLastUsedInterval.
+func (h *APIKeyHandler) touchAPIKey(r *http.Request, apiKey database.APIKeyResponse) {
+	if time.Since(apiKey.LastUsedAt) < apiKeyLastUsedInterval {
+		return
+	}
+	ctx := database.WithActor(r.Context(), auth.Principal{APIKeyID: apiKey.ID}.Actor())
+	used := database.Patch{Set: bson.D{{Key: "lastusedat", Value: time.Now()}}}
+	if err := h.APIKeyCollection.Patch(ctx, apiKey.ID, apiKey.Tenant, used); err != nil {
+		log.Printf("Error recording API key last used: %v", err)
+	}
+}
+
+// bearerToken is the token of the request's "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// RequireUser only lets through logged in users, not API keys, e.g. to their account or to manage the tenant.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.GetPrincipal(r.Context()).IsAPIKey() {
+			render.Render(w, r, ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTenant is the tenant of the request's principal, the API key's or the logged in user's.
+func requestTenant(ctx context.Context) string {
+	if tenant := auth.GetPrincipal(ctx).Tenant; tenant != "" {
+		return tenant
+	}
+	return config.MakeMapping(auth.GetEmailFromToken(ctx))
+}
+
+// CreateAPIKey creates an API key of the tenant, and returns it with the key, which is only shown this once.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	creator := auth.GetEmailFromToken(r.Context())
+	tenant := requestTenant(r.Context())
+
+	var params createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+	if len(params.Scopes) == 0 {
+		render.Render(w, r, ErrInvalidRequest(errors.New("at least one scope is required")))
+		return
+	}
+	for _, scope := range params.Scopes {
+		if !enum.IsValidAPIKeyScope(scope) {
+			render.Render(w, r, ErrInvalidRequest(errors.New("unknown scope: "+string(scope))))
+			return
+		}
+	}
+	if params.ExpiresAt.IsZero() {
+		params.ExpiresAt = time.Now().Add(defaultAPIKeyTTL)
+	}
+	if !params.ExpiresAt.After(time.Now()) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("expires_at must be in the future")))
+		return
+	}
+
+	key, hash, err := auth.GenerateAPIKey(tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	id, err := h.APIKeyCollection.Create(r.Context(), database.APIKey{
+		Tenant:    tenant,
+		Name:      params.Name,
+		Hash:      hash,
+		Scopes:    params.Scopes,
+		CreatedBy: creator,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	apiKey, err := h.APIKeyCollection.GetByID(r.Context(), id, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, createAPIKeyResponse{APIKeyResponse: apiKey, Key: key})
+}
+
+// GetAPIKeys lists the tenant's API keys that have not been revoked, expired ones included, without the keys.
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	apiKeys, err := h.APIKeyCollection.GetAll(r.Context(), requestTenant(r.Context()))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if apiKeys == nil {
+		apiKeys = []database.APIKeyResponse{}
+	}
+	render.JSON(w, r, apiKeys)
+}
+
+// RevokeAPIKey deletes an API key, so it can no longer be used.
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	id := chi.URLParam(r, "api_key_id")
+
+	if _, err := h.APIKeyCollection.GetByID(r.Context(), id, tenant); err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err := h.APIKeyCollection.Delete(r.Context(), id, tenant); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Render(w, r, SuccessOK)
+}
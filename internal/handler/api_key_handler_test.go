@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	apiKeys := database.NewMemoryCollection[database.APIKey, database.APIKeyResponse]()
+	handler := NewAPIKeyHandler(apiKeys)
+
+	// the cookie is not checked here, requests without an API key are let through as the user
+	validateCookie := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := auth.WithPrincipal(r.Context(), auth.Principal{Email: "admin@customera.com", Tenant: config.CUSTOMERA})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, map[string]string{"tenant": requestTenant(r.Context()), "actor": auth.GetPrincipal(r.Context()).Actor()})
+	}
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(handler.Authenticate(validateCookie))
+		r.Get("/whoami", whoami)
+		r.Post("/whoami", whoami)
+		r.With(RequireUser).Post("/api_keys", handler.CreateAPIKey)
+		r.With(RequireUser).Get("/api_keys", handler.GetAPIKeys)
+		r.With(RequireUser).Delete("/api_keys/{api_key_id}", handler.RevokeAPIKey)
+	})
+	r.With(handler.RequireAPIKey(enum.API_KEY_SCOPE_EMAIL_INGEST)).Post("/master_email_messages", whoami)
+
+	send := func(method string, path string, key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(body string) createAPIKeyResponse {
+		w := send("POST", "/api_keys", "", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created createAPIKeyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api_keys", "", `{"name": "sync", "scopes": ["Admin"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/api_keys", "", `{"name": "sync", "scopes": []}`).Code)
+	reader := create(`{"name": "reporting", "scopes": ["Read"]}`)
+	writer := create(`{"name": "sync", "scopes": ["Write"]}`)
+	ingest := create(`{"name": "mail forwarder", "scopes": ["EmailIngest"]}`)
+	assert.Equal(t, config.CUSTOMERA, reader.Tenant)
+	assert.Equal(t, "admin@customera.com", reader.CreatedBy)
+	assert.WithinDuration(t, time.Now().Add(defaultAPIKeyTTL), reader.ExpiresAt, time.Minute)
+
+	stored, err := apiKeys.GetByID(context.Background(), reader.ID, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, auth.HashAPIKey(reader.Key), stored.Hash, "keys are stored hashed")
+	w := send("GET", "/api_keys", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), reader.Key)
+	assert.NotContains(t, w.Body.String(), stored.Hash)
+
+	// a key acts as its tenant, within its scopes
+	w = send("GET", "/whoami", reader.Key, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"tenant": "`+config.CUSTOMERA+`", "actor": "api_key:`+reader.ID+`"}`, w.Body.String())
+	assert.Equal(t, http.StatusForbidden, send("POST", "/whoami", reader.Key, "").Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/whoami", writer.Key, "").Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/whoami", writer.Key, "").Code)
+	assert.Equal(t, http.StatusForbidden, send("GET", "/api_keys", writer.Key, "").Code, "keys cannot manage keys")
+
+	// only email ingest keys forward emails, and the cookie is not enough
+	assert.Equal(t, http.StatusUnauthorized, send("POST", "/master_email_messages", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, send("POST", "/master_email_messages", writer.Key, "").Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/master_email_messages", ingest.Key, "").Code)
+
+	used, err := apiKeys.GetByID(context.Background(), reader.ID, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), used.LastUsedAt, time.Minute)
+
+	// unknown, expired and revoked keys are refused
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/whoami", "crm_"+config.CUSTOMERA+"_0000", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/whoami", "not-a-key", "").Code)
+	require.NoError(t, apiKeys.Patch(context.Background(), writer.ID, config.CUSTOMERA, database.Patch{Set: bson.D{{Key: "expiresat", Value: time.Now().Add(-time.Minute)}}}))
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/whoami", writer.Key, "").Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", "/api_keys/"+reader.ID, "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/whoami", reader.Key, "").Code)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type AuditHandler struct {
+	AuditTrail database.AuditTrail
+}
+
+func NewAuditHandler(auditTrail database.AuditTrail) *AuditHandler {
+	return &AuditHandler{
+		AuditTrail: auditTrail,
+	}
+}
+
+type getAuditResponse struct {
+	Entries []database.AuditEntryResponse `json:"entries"`
+}
+
+// GetAuditEntries lists the tenant's audit log, newest first. The query parameters entity_type, entity_id, actor,
+// action, source and request_id filter the entries, from and to (RFC 3339) bound when they were made, and limit caps how many are returned.
+func (h *AuditHandler) GetAuditEntries(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	query := r.URL.Query()
+	filter := database.AuditFilter{
+		Tenant:     tenant,
+		Actor:      query.Get("actor"),
+		EntityType: query.Get("entity_type"),
+		EntityID:   query.Get("entity_id"),
+		Action:     enum.AuditAction(query.Get("action")),
+		Source:     enum.AuditSource(query.Get("source")),
+		RequestID:  query.Get("request_id"),
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			render.Render(w, r, ErrInvalidRequest(errors.New("from must be an RFC 3339 time")))
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			render.Render(w, r, ErrInvalidRequest(errors.New("to must be an RFC 3339 time")))
+			return
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || filter.Limit <= 0 {
+			render.Render(w, r, ErrInvalidRequest(errors.New("limit must be a positive number")))
+			return
+		}
+	}
+
+	entries, err := h.AuditTrail.Find(r.Context(), filter)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.JSON(w, r, getAuditResponse{Entries: entries})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAuditTrail records the filter it was asked for.
+type fakeAuditTrail struct {
+	filter database.AuditFilter
+}
+
+func (a *fakeAuditTrail) Find(ctx context.Context, filter database.AuditFilter) ([]database.AuditEntryResponse, error) {
+	a.filter = filter
+	return []database.AuditEntryResponse{{EntityType: filter.EntityType, EntityID: "abc123"}}, nil
+}
+
+func TestAuditHandler_GetAuditEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+		filter   database.AuditFilter
+	}{
+		{
+			name:     "filtered",
+			url:      "/audit?entity_type=shipments&entity_id=abc123&source=Email&from=2024-05-01T00:00:00Z&limit=10",
+			expected: http.StatusOK,
+			filter: database.AuditFilter{
+				EntityType: "shipments",
+				EntityID:   "abc123",
+				Source:     enum.AUDIT_SOURCE_EMAIL,
+				From:       time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+				Limit:      10,
+			},
+		},
+		{name: "bad time", url: "/audit?to=yesterday", expected: http.StatusBadRequest},
+		{name: "bad limit", url: "/audit?limit=-1", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trail := &fakeAuditTrail{}
+			handler := NewAuditHandler(trail)
+
+			r := chi.NewRouter()
+			r.Get("/audit", handler.GetAuditEntries)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusOK {
+				assert.Equal(t, tt.filter.EntityType, trail.filter.EntityType)
+				assert.Equal(t, tt.filter.EntityID, trail.filter.EntityID)
+				assert.Equal(t, tt.filter.Source, trail.filter.Source)
+				assert.True(t, tt.filter.From.Equal(trail.filter.From))
+				assert.Equal(t, tt.filter.Limit, trail.filter.Limit)
+				assert.Contains(t, w.Body.String(), "abc123")
+			}
+		})
+	}
+}
+
+func TestRecordRequest(t *testing.T) {
+	var requestID string
+	var source enum.AuditSource
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(RecordRequest(enum.AUDIT_SOURCE_API))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		requestID = database.RequestID(r.Context())
+		source = database.Source(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "req-42", requestID)
+	assert.Equal(t, enum.AUDIT_SOURCE_API, source)
+}
@@ -4,6 +4,7 @@ import (
 	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
 	"context"
 
 	"encoding/json"
@@ -15,29 +16,37 @@ import (
 	"github.com/go-chi/render"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var jwtKey = []byte("jameslsy")
 var cookieMaxAge = 86400
 
-type Claims struct {
-	Email string `json:"email"`
-	jwt.RegisteredClaims
+// sessionLastSeenInterval is how often a session's last use is recorded, rather than on every request
+const sessionLastSeenInterval = time.Minute
+
+type loginRequest struct {
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	TOTPCode     string `json:"totp_code"`
+	RecoveryCode string `json:"recovery_code"`
 }
 
 type LoginHandler struct {
 	LoginCollection   database.Collection[database.TenantUser, database.TenantUserResponse]
 	SessionCollection database.Collection[database.Session, database.SessionResponse]
+	Lockout           *LoginLockout
 }
 
 func NewLoginHandler(
 	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
 	sessionCollection database.Collection[database.Session, database.SessionResponse],
+	lockout *LoginLockout,
 ) *LoginHandler {
 	return &LoginHandler{
 		LoginCollection:   loginCollection,
 		SessionCollection: sessionCollection, // Add this line
+		Lockout:           lockout,
 	}
 }
 
@@ -53,41 +62,9 @@ func (h *LoginHandler) StatusCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *LoginHandler) CreateTenantUser(w http.ResponseWriter, r *http.Request) {
-	var createTenantUserParams database.TenantUser
-	log.Println(r.Body)
-
-	err := json.NewDecoder(r.Body).Decode(&createTenantUserParams)
-	if err != nil {
-		render.Render(w, r, ErrBadRequest)
-		return
-	}
-	tenant := config.MakeMapping(createTenantUserParams.Email)
-
-	// Hash the password
-	hashedPassword, err := auth.HashPassword(createTenantUserParams.Password)
-	if err != nil {
-		render.Render(w, r, ErrInternalServerError)
-		return
-	}
-	createTenantUserParams.Password = hashedPassword
-	createTenantUserParams.Tenant = tenant
-	log.Println(createTenantUserParams, "as")
-	_, err = h.LoginCollection.Create(r.Context(), createTenantUserParams)
-
-	if err != nil {
-		if errors.Is(err, database.ErrDuplicateKey) {
-			render.Render(w, r, ErrDuplicate(err))
-			return
-		}
-		render.Render(w, r, ErrInternalServerError)
-		return
-	}
-
-	w.WriteHeader(201)
-	w.Write(nil)
-
-	render.Render(w, r, SuccessCreated)
+// GetJWKS publishes the public keys tokens are signed with, for services that verify them. HS256 keys are never published.
+func (h *LoginHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, auth.PublicKeys())
 }
 
 // func (h *LoginHandler) ValidateCookie(next http.Handler) http.Handler {
@@ -207,7 +184,7 @@ func (h *LoginHandler) CreateTenantUser(w http.ResponseWriter, r *http.Request)
 
 func (h *LoginHandler) LoginAndAuth(w http.ResponseWriter, r *http.Request) {
 
-	var tenantUserCredentials database.TenantUser
+	var tenantUserCredentials loginRequest
 	err := json.NewDecoder(r.Body).Decode(&tenantUserCredentials)
 	if err != nil {
 		render.Render(w, r, ErrBadRequest)
@@ -216,38 +193,125 @@ func (h *LoginHandler) LoginAndAuth(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.Body, "sddd")
 	tenant := config.MakeMapping(tenantUserCredentials.Email)
 
+	// Locked out accounts and addresses are refused before their password costs a hash
+	ip := clientIP(r)
+	lockedUntil, err := h.Lockout.LockedUntil(r.Context(), tenantUserCredentials.Email, ip)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		writeLockedOut(w, lockedUntil)
+		return
+	}
+	// Users of tenants with single sign-on log in with their identity provider, never with a password
+	if config.IsSSOEnabled(tenant) {
+		http.Error(w, errSSOTenant.Error(), http.StatusForbidden)
+		return
+	}
+
 	tenantUserResponse, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", tenantUserCredentials.Email, tenant)
 	log.Println(tenantUserResponse, "hi")
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-			return
-		}
+	if err != nil && err != mongo.ErrNoDocuments {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if !auth.CheckPasswordHash(tenantUserCredentials.Password, tenantUserResponse.Password) {
+	if err == mongo.ErrNoDocuments || !auth.CheckPasswordHash(tenantUserCredentials.Password, tenantUserResponse.Password) {
+		if err := h.Lockout.RecordFailure(r.Context(), tenantUserCredentials.Email, ip); err != nil {
+			log.Printf("Error recording failed login: %v", err)
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Step 2: Generate JWT token
-	expirationTime := time.Now().Add(30 * time.Minute)
-	claims := &Claims{
-		Email: tenantUserCredentials.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	if tenantUserResponse.Disabled || config.IsTenantDisabled(tenant) {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return
+	}
+	if !tenantUserResponse.EmailVerified {
+		http.Error(w, "Email not verified", http.StatusForbidden)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// Users with two-factor authentication log in with a TOTP or recovery code as well as their password,
+	// the failures counted like wrong passwords. In tenants that require it, users without it are sent to set it up.
+	if tenantUserResponse.TOTPEnabled {
+		if tenantUserCredentials.TOTPCode == "" && tenantUserCredentials.RecoveryCode == "" {
+			http.Error(w, "Two-factor code required", http.StatusUnauthorized)
+			return
+		}
+		ok, err := checkSecondFactor(r.Context(), h.LoginCollection, tenantUserResponse, tenantUserCredentials.TOTPCode, tenantUserCredentials.RecoveryCode)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			if err := h.Lockout.RecordFailure(r.Context(), tenantUserCredentials.Email, ip); err != nil {
+				log.Printf("Error recording failed login: %v", err)
+			}
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+	} else if config.IsTOTPRequired(tenant) {
+		enrolmentToken, err := auth.SignAudienceToken(tenantUserResponse.Email, "", totpEnrolmentAudience, time.Now().Add(totpEnrolmentTTL))
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]string{
+			"error":           "Two-factor authentication must be set up",
+			"enrolment_token": enrolmentToken,
+		})
+		return
+	}
+	if err := h.Lockout.RecordSuccess(r.Context(), tenantUserCredentials.Email); err != nil {
+		log.Printf("Error recording login: %v", err)
+	}
+
+	tokenString, sessionID, err := h.startSession(w, r, tenantUserCredentials.Email, tenant)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// Step 4: Return both JWT token and sessionID
+	response := map[string]string{
+		"jwtToken":  tokenString,
+		"sessionID": sessionID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// startSession logs the user in: it stores a new session for them and sets its JWT token in the cookie.
+func (h *LoginHandler) startSession(w http.ResponseWriter, r *http.Request, email string, tenant string) (string, string, error) {
+	// Step 2: Generate JWT token
+	expirationTime := time.Now().Add(30 * time.Minute)
+	tokenString, err := auth.GenerateJWT(email, expirationTime)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Step 3: Generate sessionID
+	sessionID := uuid.NewString()
+
+	// Store the sessionID in MongoDB session collection
+	session := database.Session{
+		SessionID:  sessionID,
+		Email:      email,
+		JWTToken:   tokenString,
+		Tenant:     tenant,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  time.Now().Add(24 * time.Hour), // Set session expiration time
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		LastSeenAt: time.Now(),
+	}
+	if _, err := h.SessionCollection.Create(r.Context(), session); err != nil {
+		return "", "", err
+	}
+
 	// Set the JWT token in a cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "jwtToken",  // The name of the cookie
@@ -258,31 +322,7 @@ func (h *LoginHandler) LoginAndAuth(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,         // Prevents client-side scripts from accessing the cookie
 		Secure:   true,         // Ensures the cookie is only sent over HTTPS
 	})
-
-	// Step 3: Generate sessionID
-	sessionID := uuid.NewString()
-
-	// Store the sessionID in MongoDB session collection
-	session := database.Session{
-		SessionID: sessionID,
-		Email:     tenantUserCredentials.Email,
-		JWTToken:  tokenString,
-		Tenant:    tenant,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour), // Set session expiration time
-	}
-	_, err = h.SessionCollection.Create(r.Context(), session)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	// Step 4: Return both JWT token and sessionID
-	response := map[string]string{
-		"jwtToken":  tokenString,
-		"sessionID": sessionID,
-	}
-	json.NewEncoder(w).Encode(response)
+	return tokenString, sessionID, nil
 }
 
 func (h *LoginHandler) ValidateCookie(next http.Handler) http.Handler {
@@ -296,23 +336,20 @@ func (h *LoginHandler) ValidateCookie(next http.Handler) http.Handler {
 
 		tokenString := cookie.Value
 
-		// Parse the JWT token
-		claims := &Claims{}
-		_, invalid := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, http.ErrAbortHandler
-			}
-			return jwtKey, nil
-		})
-
-		email := claims.Email
-		if email == "" {
-			http.Error(w, "Unauthorized: Invalid JWT token, email missing", http.StatusUnauthorized)
+		// Parse the JWT token, expired tokens included so that their session can be refreshed
+		claims, invalid := auth.ParseSessionToken(tokenString)
+		if claims == nil {
+			http.Error(w, "Unauthorized: Invalid JWT token", http.StatusUnauthorized)
 			return
 		}
+		email := claims.Email
 
 		// Map the tenant based on the email
 		tenant := config.MakeMapping(email)
+		if config.IsTenantDisabled(tenant) {
+			http.Error(w, "Unauthorized: Tenant disabled", http.StatusUnauthorized)
+			return
+		}
 
 		// Check if the session exists in the MongoDB session collection
 		sessionResponse, err := h.SessionCollection.GetByKeyValue(r.Context(), "jwt_token", tokenString, tenant)
@@ -332,27 +369,19 @@ func (h *LoginHandler) ValidateCookie(next http.Handler) http.Handler {
 			http.Error(w, "Unauthorized: Session expired", http.StatusUnauthorized)
 			log.Println("unauthorized, session expired, deleting old session")
 			log.Println(sessionResponse)
-			deleteSuccess := h.SessionCollection.Delete(r.Context(), sessionResponse.ID)
+			deleteSuccess := h.SessionCollection.Delete(r.Context(), sessionResponse.ID, sessionResponse.Tenant)
 			if deleteSuccess != nil {
 				log.Println("Error deleting session")
 			}
 			return
 		}
 
-		// Handle different cases based on the parsing result
-		switch {
-		case invalid != nil && errors.Is(invalid, jwt.ErrTokenExpired):
-			// If the token is expired, refresh the JWT token and session
+		// If the token is expired, refresh the JWT token and session
+		if errors.Is(invalid, jwt.ErrTokenExpired) {
 			log.Println("Token expired.. Refreshing session")
 
 			h.refreshJWTAndSession(w, r, claims, sessionResponse, next)
 
-			return
-		case invalid != nil:
-			// If there's any other error, return an internal server error
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			log.Println("Token expired.. Internal server error")
-
 			return
 		}
 
@@ -362,19 +391,30 @@ func (h *LoginHandler) ValidateCookie(next http.Handler) http.Handler {
 			h.refreshJWTAndSession(w, r, claims, sessionResponse, next)
 		} else {
 			// JWT token and session are valid, proceed with the request
+			h.touchSession(r, sessionResponse)
 			ctx := context.WithValue(r.Context(), auth.ContextKeySession, sessionResponse.JWTToken)
-			ctx = context.WithValue(ctx, auth.ContextKeyEmail, email)
+			ctx = auth.WithPrincipal(ctx, auth.Principal{Email: email, Tenant: tenant})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 	})
 }
 
-func (h *LoginHandler) refreshJWTAndSession(w http.ResponseWriter, r *http.Request, claims *Claims, sessionResponse database.SessionResponse, next http.Handler) {
+// touchSession records that the session is being used, from where, at most once every sessionLastSeenInterval.
+func (h *LoginHandler) touchSession(r *http.Request, session database.SessionResponse) {
+	if time.Since(session.LastSeenAt) < sessionLastSeenInterval {
+		return
+	}
+	seen := database.Patch{Set: bson.D{{Key: "lastseenat", Value: time.Now()}, {Key: "ip", Value: clientIP(r)}}}
+	if err := h.SessionCollection.Patch(r.Context(), session.ID, session.Tenant, seen); err != nil {
+		log.Printf("Error recording session last seen: %v", err)
+	}
+}
+
+func (h *LoginHandler) refreshJWTAndSession(w http.ResponseWriter, r *http.Request, claims *auth.Claims, sessionResponse database.SessionResponse, next http.Handler) {
 	// Generate a new JWT token with extended expiration time
 	newExpirationTime := time.Now().Add(30 * time.Minute)
 	claims.ExpiresAt = jwt.NewNumericDate(newExpirationTime)
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	newTokenString, err := newToken.SignedString(jwtKey)
+	newTokenString, err := auth.SignClaims(claims)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -391,17 +431,13 @@ func (h *LoginHandler) refreshJWTAndSession(w http.ResponseWriter, r *http.Reque
 		Secure:   true,
 	})
 
-	// Create and update the new session with the new JWT token
-	newSession := database.Session{
-		SessionID: sessionResponse.SessionID,
-		Email:     sessionResponse.Email,
-		JWTToken:  newTokenString,
-		Tenant:    sessionResponse.Tenant,
-		CreatedAt: time.Now(),
-		ExpiresAt: sessionResponse.ExpiresAt,
-	}
-
-	err = h.SessionCollection.Update(r.Context(), sessionResponse.ID, newSession)
+	// Only the token and where the session was last seen change, the rest of the session, its device included, stays
+	refreshed := database.Patch{Set: bson.D{
+		{Key: "jwt_token", Value: newTokenString},
+		{Key: "ip", Value: clientIP(r)},
+		{Key: "lastseenat", Value: time.Now()},
+	}}
+	err = h.SessionCollection.Patch(r.Context(), sessionResponse.ID, sessionResponse.Tenant, refreshed)
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -410,7 +446,26 @@ func (h *LoginHandler) refreshJWTAndSession(w http.ResponseWriter, r *http.Reque
 	log.Println("refreshed token")
 
 	// Proceed with the request
-	ctx := context.WithValue(r.Context(), auth.ContextKeySession, newSession.JWTToken)
-	ctx = context.WithValue(ctx, auth.ContextKeyEmail, claims.Email)
+	ctx := context.WithValue(r.Context(), auth.ContextKeySession, newTokenString)
+	ctx = auth.WithPrincipal(ctx, auth.Principal{Email: claims.Email, Tenant: sessionResponse.Tenant})
 	next.ServeHTTP(w, r.WithContext(ctx))
 }
+
+// RequireRole only lets through users with role. It goes after ValidateCookie, which puts the user in the request.
+func (h *LoginHandler) RequireRole(role enum.UserRole) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			email := auth.GetEmailFromToken(r.Context())
+			user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, config.MakeMapping(email))
+			if err != nil && err != mongo.ErrNoDocuments {
+				render.Render(w, r, ErrInternalServerError)
+				return
+			}
+			if err != nil || user.Role != role {
+				render.Render(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
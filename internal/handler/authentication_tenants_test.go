@@ -1,19 +1,28 @@
 package handler
 
 import (
+	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/pkg/auth"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/go-chi/chi/v5"
@@ -48,13 +57,18 @@ func (m *MockLoginCollection) GetAllByKeyValue(ctx context.Context, key string,
 	return args.Get(0).([]database.TenantUserResponse), args.Error(1)
 }
 
-func (m *MockLoginCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockLoginCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func (m *MockLoginCollection) Update(ctx context.Context, id string, tenant string, updateTenantUserParams database.TenantUser) error {
+	args := m.Called(ctx, id, tenant, updateTenantUserParams)
 	return args.Error(0)
 }
 
-func (m *MockLoginCollection) Update(ctx context.Context, id string, updateTenantUserParams database.TenantUser) error {
-	args := m.Called(ctx, id, updateTenantUserParams)
+func (m *MockLoginCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
 	return args.Error(0)
 }
 
@@ -72,8 +86,8 @@ func (m *MockSessionCollection) GetByKeyValue(ctx context.Context, key string, v
 	return args.Get(0).(database.SessionResponse), args.Error(1)
 }
 
-func (m *MockSessionCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockSessionCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
@@ -92,41 +106,21 @@ func (m *MockSessionCollection) GetByID(ctx context.Context, id string, tenant s
 	return args.Get(0).(database.SessionResponse), args.Error(1)
 }
 
-func (m *MockSessionCollection) Update(ctx context.Context, id string, createSessionParams database.Session) error {
-	args := m.Called(ctx, id, createSessionParams)
+func (m *MockSessionCollection) Update(ctx context.Context, id string, tenant string, createSessionParams database.Session) error {
+	args := m.Called(ctx, id, tenant, createSessionParams)
 	return args.Error(0)
 }
 
-func TestHandler_CreateTenantUser(t *testing.T) {
-	mockLoginCollection := new(MockLoginCollection)
-	mockSessionCollection := new(MockSessionCollection)
-
-	handler := NewLoginHandler(mockLoginCollection, mockSessionCollection)
-
-	r := chi.NewRouter()
-	r.Post("/tenant_user", handler.CreateTenantUser)
-
-	// Mock the Create method
-	mockLoginCollection.On("Create", mock.Anything, mock.MatchedBy(func(user database.TenantUser) bool {
-		hashedPassword, _ := auth.HashPassword("password123")
-		return user.Email == "test@example.com" && auth.CheckPasswordHash("password123", hashedPassword)
-	})).Return("id123", nil)
-
-	req := httptest.NewRequest("POST", "/tenant_user", bytes.NewBufferString(`{"email":"test@example.com", "password":"password123"}`))
-	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, &chi.Context{}))
-	w := httptest.NewRecorder()
-
-	r.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusCreated, w.Code)
-	mockLoginCollection.AssertExpectations(t)
+func (m *MockSessionCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
 }
 
 func TestHandler_LoginAndAuth(t *testing.T) {
 	mockLoginCollection := new(MockLoginCollection)
 	mockSessionCollection := new(MockSessionCollection)
 
-	handler := NewLoginHandler(mockLoginCollection, mockSessionCollection)
+	handler := NewLoginHandler(mockLoginCollection, mockSessionCollection, nil)
 
 	r := chi.NewRouter()
 	r.Post("/login", handler.LoginAndAuth)
@@ -134,8 +128,9 @@ func TestHandler_LoginAndAuth(t *testing.T) {
 	// Mock the GetByKeyValue method
 	hashedPassword, _ := auth.HashPassword("password123")
 	mockLoginCollection.On("GetByKeyValue", mock.Anything, "email", "test@example.com", mock.Anything).Return(database.TenantUserResponse{
-		Email:    "test@example.com",
-		Password: string(hashedPassword),
+		Email:         "test@example.com",
+		Password:      string(hashedPassword),
+		EmailVerified: true,
 	}, nil)
 
 	mockSessionCollection.On("Create", mock.Anything, mock.Anything).Return("id123", nil)
@@ -184,15 +179,7 @@ func TestHandler_ValidateCookie(t *testing.T) {
 
 	// Step 1: Prepare a valid JWT token
 	email := "test@example.com"
-	claims := &Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString(jwtKey)
+	tokenString, _ := auth.GenerateJWT(email, time.Now().Add(10*time.Minute))
 
 	// Step 2: Mock the session collection to return a valid session
 	sessionResponse := database.SessionResponse{
@@ -205,6 +192,11 @@ func TestHandler_ValidateCookie(t *testing.T) {
 	}
 
 	mockSessionCollection.On("GetByKeyValue", mock.Anything, "jwt_token", tokenString, mock.Anything).Return(sessionResponse, nil)
+	// the session has not been seen for over a minute, so its use is recorded
+	mockSessionCollection.On("Patch", mock.Anything, sessionResponse.ID, sessionResponse.Tenant, mock.MatchedBy(func(patch database.Patch) bool {
+		_, ok := patch.Value("lastseenat")
+		return ok
+	})).Return(nil)
 
 	// Step 3: Create a request with the JWT token cookie to a protected route
 	req := httptest.NewRequest("GET", "/shipments", nil)
@@ -246,15 +238,7 @@ func TestHandler_ValidateCookie_ExpiredToken(t *testing.T) {
 
 	// Prepare an expired JWT token
 	email := "test@example.com"
-	claims := &Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-10 * time.Minute)),
-		},
-	}
-
-	expiredToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	expiredTokenString, _ := expiredToken.SignedString(jwtKey)
+	expiredTokenString, _ := auth.GenerateJWT(email, time.Now().Add(-10*time.Minute))
 
 	// Mock the session collection to return a valid session
 	sessionResponse := database.SessionResponse{
@@ -269,11 +253,9 @@ func TestHandler_ValidateCookie_ExpiredToken(t *testing.T) {
 	// Mock the refreshed session
 	mockSessionCollection.On("GetByKeyValue", mock.Anything, "jwt_token", expiredTokenString, mock.Anything).Return(sessionResponse, nil)
 
-	mockSessionCollection.On("Update", mock.Anything, sessionResponse.ID, mock.MatchedBy(func(session database.Session) bool {
-		return session.SessionID == sessionResponse.SessionID &&
-			session.Email == sessionResponse.Email &&
-			session.JWTToken != expiredTokenString &&
-			session.Tenant == sessionResponse.Tenant
+	mockSessionCollection.On("Patch", mock.Anything, sessionResponse.ID, sessionResponse.Tenant, mock.MatchedBy(func(patch database.Patch) bool {
+		token, ok := patch.Value("jwt_token")
+		return ok && token != expiredTokenString
 	})).Return(nil)
 
 	// Create a request with the expired JWT token cookie
@@ -316,15 +298,7 @@ func TestHandler_ValidateCookie_SessionNotFound(t *testing.T) {
 
 	// Step 1: Prepare a valid JWT token
 	email := "test@example.com"
-	claims := &Claims{
-		Email: email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString(jwtKey)
+	tokenString, _ := auth.GenerateJWT(email, time.Now().Add(10*time.Minute))
 
 	// Step 2: Mock the session collection to return a session not found error
 	mockSessionCollection.On("GetByKeyValue", mock.Anything, "jwt_token", tokenString, mock.Anything).Return(database.SessionResponse{}, mongo.ErrNoDocuments)
@@ -345,3 +319,162 @@ func TestHandler_ValidateCookie_SessionNotFound(t *testing.T) {
 
 	mockSessionCollection.AssertExpectations(t)
 }
+
+func TestHandler_LoginAndAuth_Forbidden(t *testing.T) {
+	mockLoginCollection := new(MockLoginCollection)
+	mockSessionCollection := new(MockSessionCollection)
+
+	handler := NewLoginHandler(mockLoginCollection, mockSessionCollection, nil)
+
+	r := chi.NewRouter()
+	r.Post("/login", handler.LoginAndAuth)
+
+	hashedPassword, _ := auth.HashPassword("password123")
+	mockLoginCollection.On("GetByKeyValue", mock.Anything, "email", "disabled@example.com", mock.Anything).Return(database.TenantUserResponse{
+		Email:    "disabled@example.com",
+		Password: hashedPassword,
+		Disabled: true,
+	}, nil)
+	mockLoginCollection.On("GetByKeyValue", mock.Anything, "email", "unverified@example.com", mock.Anything).Return(database.TenantUserResponse{
+		Email:    "unverified@example.com",
+		Password: hashedPassword,
+	}, nil)
+	mockLoginCollection.On("GetByKeyValue", mock.Anything, "email", "test@example.com", mock.Anything).Return(database.TenantUserResponse{
+		Email:         "test@example.com",
+		Password:      hashedPassword,
+		EmailVerified: true,
+	}, nil)
+
+	login := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", bytes.NewBufferString(`{"email":"`+email+`", "password":"password123"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, login("disabled@example.com").Code)
+	assert.Equal(t, http.StatusForbidden, login("unverified@example.com").Code)
+
+	config.SetTenants(map[string]string{"@example.com": "exampleTenant"}, map[string]bool{"exampleTenant": true}, map[string]bool{}, map[string]bool{})
+	t.Cleanup(func() {
+		config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{})
+	})
+	assert.Equal(t, http.StatusForbidden, login("test@example.com").Code)
+
+	// tenants with single sign-on have no password logins
+	config.SetTenants(map[string]string{"@example.com": "exampleTenant"}, map[string]bool{}, map[string]bool{}, map[string]bool{"exampleTenant": true})
+	sso := login("test@example.com")
+	assert.Equal(t, http.StatusForbidden, sso.Code)
+	assert.Contains(t, sso.Body.String(), "single sign-on")
+
+	mockSessionCollection.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestHandler_ValidateCookie_KeyRotation(t *testing.T) {
+	randomSecret := func() string {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(secret)
+	}
+	oldKey := "2024-01:HS256:" + randomSecret()
+	newKey := "2024-06:HS256:" + randomSecret()
+	legacyKey := "legacy:HS256:" + base64.StdEncoding.EncodeToString([]byte("jameslsy"))
+	setKeys := func(specs []string, signingKeyID string) {
+		keys, err := auth.NewKeySet(specs, signingKeyID)
+		require.NoError(t, err)
+		auth.SetKeys(keys)
+	}
+	t.Cleanup(func() { setKeys([]string{newKey}, "") })
+
+	sessions := database.NewMemoryCollection[database.Session, database.SessionResponse]()
+	newSession := func(token string) string {
+		_, err := sessions.Create(context.Background(), database.Session{Email: "ops@customera.com", JWTToken: token, Tenant: config.CUSTOMERA, ExpiresAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		return token
+	}
+	handler := NewLoginHandler(nil, sessions, nil)
+	protected := handler.ValidateCookie(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	validate := func(token string) int {
+		req := httptest.NewRequest("GET", "/shipments", nil)
+		req.AddCookie(&http.Cookie{Name: "jwtToken", Value: token})
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	setKeys([]string{oldKey, legacyKey}, "2024-01")
+	oldToken, err := auth.GenerateJWT("ops@customera.com", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	newSession(oldToken)
+	// tokens from before key IDs were signed with the hardcoded key
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		Email:            "ops@customera.com",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte("jameslsy"))
+	require.NoError(t, err)
+	newSession(legacyToken)
+	assert.Equal(t, http.StatusOK, validate(legacyToken))
+
+	// signing with a new key keeps the tokens signed with the old one valid while it is listed
+	setKeys([]string{newKey, oldKey}, "2024-06")
+	newToken, err := auth.GenerateJWT("ops@customera.com", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	newSession(newToken)
+	assert.Equal(t, http.StatusOK, validate(oldToken))
+	assert.Equal(t, http.StatusOK, validate(newToken))
+	assert.Equal(t, http.StatusUnauthorized, validate(legacyToken))
+
+	setKeys([]string{newKey}, "")
+	assert.Equal(t, http.StatusUnauthorized, validate(oldToken))
+	assert.Equal(t, http.StatusOK, validate(newToken))
+
+	// audience tokens are not sessions
+	invitationToken, err := auth.SignAudienceToken("ops@customera.com", "", invitationAudience, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	newSession(invitationToken)
+	assert.Equal(t, http.StatusUnauthorized, validate(invitationToken))
+}
+
+func TestLoginHandler_GetJWKS(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ed25519.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keys, err := auth.NewKeySet([]string{"ed-1:EdDSA:" + path, "hs-1:HS256:" + base64.StdEncoding.EncodeToString(make([]byte, 32))}, "")
+	require.NoError(t, err)
+	auth.SetKeys(keys)
+	t.Cleanup(func() {
+		keys, _ := auth.NewKeySet([]string{"hs-1:HS256:" + base64.StdEncoding.EncodeToString(make([]byte, 32))}, "")
+		auth.SetKeys(keys)
+	})
+
+	token, err := auth.GenerateJWT("ops@customera.com", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	claims, err := auth.ParseSessionToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "ops@customera.com", claims.Email)
+
+	w := httptest.NewRecorder()
+	NewLoginHandler(nil, nil, nil).GetJWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var jwks auth.JWKSet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	// the HS256 secret is not published
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "ed-1", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(private.Public().(ed25519.PublicKey)), jwks.Keys[0].X)
+
+	// a public key only verifies
+	der, err = x509.MarshalPKIXPublicKey(private.Public())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	_, err = auth.NewKeySet([]string{"ed-1:EdDSA:" + path}, "")
+	assert.Error(t, err)
+}
@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -31,8 +29,7 @@ type getAllCategoryManagementActivityTypeResponse struct {
 }
 
 func (h *CategoryManagementActivityTypeHandler) GetAllCategoryManagementActivityTypes(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var activityTypeList []database.CategoryManagementActivityTypeResponse
@@ -54,8 +51,7 @@ func (h *CategoryManagementActivityTypeHandler) GetAllCategoryManagementActivity
 }
 
 func (h *CategoryManagementActivityTypeHandler) CreateActivityType(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.CategoryManagementActivityType
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -83,10 +79,11 @@ func (h *CategoryManagementActivityTypeHandler) CreateActivityType(w http.Respon
 }
 
 func (h *CategoryManagementActivityTypeHandler) DeleteActivityTypeById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "activity_type_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.CategoryManagementActivityTypeCollection.Delete(r.Context(), _id)
+	err := h.CategoryManagementActivityTypeCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
@@ -130,8 +127,7 @@ func (h *CategoryManagementActivityTypeHandler) DeleteActivityTypeById(w http.Re
 // }
 
 func (h *CategoryManagementActivityTypeHandler) GetActivityTypeFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "activity_type_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -149,6 +145,7 @@ func (h *CategoryManagementActivityTypeHandler) GetActivityTypeFromId(w http.Res
 
 	response := database.CategoryManagementActivityTypeResponse{
 		ID:           activityType.ID,
+		Version:      activityType.Version,
 		Tenant:       activityType.Tenant,
 		ActivityType: activityType.ActivityType,
 	}
@@ -157,8 +154,7 @@ func (h *CategoryManagementActivityTypeHandler) GetActivityTypeFromId(w http.Res
 }
 
 func (h *CategoryManagementActivityTypeHandler) FilterActivityType(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -174,6 +170,7 @@ func (h *CategoryManagementActivityTypeHandler) FilterActivityType(w http.Respon
 
 	response := database.CategoryManagementActivityTypeResponse{
 		ID:           activityType.ID,
+		Version:      activityType.Version,
 		Tenant:       activityType.Tenant,
 		ActivityType: activityType.ActivityType,
 	}
@@ -42,13 +42,18 @@ func (m *MockCategoryManagementActivityTypeCollection) GetAllByKeyValue(ctx cont
 	return args.Get(0).([]database.CategoryManagementActivityTypeResponse), args.Error(1)
 }
 
-func (m *MockCategoryManagementActivityTypeCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockCategoryManagementActivityTypeCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func (m *MockCategoryManagementActivityTypeCollection) Update(ctx context.Context, id string, tenant string, updateParams database.CategoryManagementActivityType) error {
+	args := m.Called(ctx, id, tenant, updateParams)
 	return args.Error(0)
 }
 
-func (m *MockCategoryManagementActivityTypeCollection) Update(ctx context.Context, id string, updateParams database.CategoryManagementActivityType) error {
-	args := m.Called(ctx, id, updateParams)
+func (m *MockCategoryManagementActivityTypeCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
 	return args.Error(0)
 }
 
@@ -132,7 +137,7 @@ func TestCategoryManagementActivityTypeHandler_DeleteActivityTypeById(t *testing
 	r := chi.NewRouter()
 	r.Delete("/category_management/activity_type/{activity_type_id}", handler.DeleteActivityTypeById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/category_management/activity_type/1", nil)
 	rctx := chi.NewRouteContext()
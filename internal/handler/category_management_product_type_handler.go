@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -31,8 +29,7 @@ type getAllCategoryManagementProductTypeResponse struct {
 }
 
 func (h *CategoryManagementProductTypeHandler) GetAllCategoryManagementProductTypes(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var productTypeList []database.CategoryManagementProductTypeResponse
@@ -58,8 +55,7 @@ type GetAllOnlySubProductTypesResponse struct {
 }
 
 func (h *CategoryManagementProductTypeHandler) GetAllOnlySubProductTypes(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var subProductTypeListOnly []string
@@ -84,8 +80,7 @@ func (h *CategoryManagementProductTypeHandler) GetAllOnlySubProductTypes(w http.
 }
 
 func (h *CategoryManagementProductTypeHandler) CreateProductType(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.CategoryManagementProductType
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -113,10 +108,11 @@ func (h *CategoryManagementProductTypeHandler) CreateProductType(w http.Response
 }
 
 func (h *CategoryManagementProductTypeHandler) DeleteProductTypeById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "product_type_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.CategoryManagementProductTypeCollection.Delete(r.Context(), _id)
+	err := h.CategoryManagementProductTypeCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
@@ -133,8 +129,7 @@ func (h *CategoryManagementProductTypeHandler) DeleteProductTypeById(w http.Resp
 }
 
 func (h *CategoryManagementProductTypeHandler) GetProductTypeFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "product_type_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -152,29 +147,40 @@ func (h *CategoryManagementProductTypeHandler) GetProductTypeFromId(w http.Respo
 
 	response := database.CategoryManagementProductTypeResponse{
 		ID:              productType.ID,
+		Version:         productType.Version,
 		Tenant:          productType.Tenant,
 		ProductType:     productType.ProductType,
 		SubProductsType: productType.SubProductsType,
 	}
 
+	setETag(w, productType.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *CategoryManagementProductTypeHandler) UpdateProductTypeById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "product_type_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.CategoryManagementProductType
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.CategoryManagementProductTypeCollection.Update(r.Context(), _id, updateParams)
+	err := h.CategoryManagementProductTypeCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -187,9 +193,15 @@ func (h *CategoryManagementProductTypeHandler) UpdateProductTypeById(w http.Resp
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *CategoryManagementProductTypeHandler) PatchProductTypeById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "product_type_id")
+
+	patchDocument(w, r, h.CategoryManagementProductTypeCollection, _id, tenant, nil)
+}
+
 func (h *CategoryManagementProductTypeHandler) FilterProductType(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -205,6 +217,7 @@ func (h *CategoryManagementProductTypeHandler) FilterProductType(w http.Response
 
 	response := database.CategoryManagementProductTypeResponse{
 		ID:              productType.ID,
+		Version:         productType.Version,
 		Tenant:          productType.Tenant,
 		ProductType:     productType.ProductType,
 		SubProductsType: productType.SubProductsType,
@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +9,8 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ChecklistHandler struct {
@@ -30,8 +30,7 @@ type getAllChecklistResponse struct {
 }
 
 func (h *ChecklistHandler) GetAllChecklist(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var ChecklistsResult []database.ChecklistResponse
@@ -52,25 +51,12 @@ func (h *ChecklistHandler) GetAllChecklist(w http.ResponseWriter, r *http.Reques
 	var Checklist []database.ChecklistResponse
 	for _, cl := range ChecklistsResult {
 		Checklist = append(Checklist, database.ChecklistResponse{
-			ID:     cl.ID,
-			Tenant: cl.Tenant,
-
-			PortDues:         cl.PortDues,
-			Pilotage:         cl.Pilotage,
-			ServiceLaunch:    cl.ServiceLaunch,
-			Logistics:        cl.Logistics,
-			HotelCharges:     cl.HotelCharges,
-			AirTickets:       cl.AirTickets,
-			TransportCharges: cl.TransportCharges,
-			MedicineSupplies: cl.MedicineSupplies,
-			FreshWaterSupply: cl.FreshWaterSupply,
-			MarineAdvisory:   cl.MarineAdvisory,
-			CourierServices:  cl.CourierServices,
-			CrossHarbourFees: cl.CrossHarbourFees,
-			SupplyBoat:       cl.SupplyBoat,
-			Repairs:          cl.Repairs,
-			Extras:           cl.Extras,
-			CrewChange:       cl.CrewChange,
+			ID:      cl.ID,
+			Version: cl.Version,
+			Tenant:  cl.Tenant,
+
+			Items:      cl.Items,
+			CrewChange: cl.CrewChange,
 
 			ShipmentID: cl.ShipmentID,
 
@@ -85,8 +71,7 @@ func (h *ChecklistHandler) GetAllChecklist(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *ChecklistHandler) CreateChecklist(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.Checklist
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -114,13 +99,14 @@ func (h *ChecklistHandler) CreateChecklist(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *ChecklistHandler) DeleteChecklistById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipping_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.ChecklistCollection.Delete(r.Context(), _id)
+	err := h.ChecklistCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -134,22 +120,55 @@ func (h *ChecklistHandler) DeleteChecklistById(w http.ResponseWriter, r *http.Re
 	render.Render(w, r, SuccessOK)
 }
 
+// errChecklistItemsWhole refuses checklist items given as a whole, which would skip the status transitions of the
+// items and leave the FDA out of step with their costs.
+var errChecklistItemsWhole = errors.New("checklist items are changed one at a time, at /checklist/{shipment_id}/items/{item_key}")
+
+// UpdateChecklistById replaces the checklist but its items, which are kept as they are stored.
 func (h *ChecklistHandler) UpdateChecklistById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Checklist
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
+	if len(updateParams.Items) > 0 {
+		render.Render(w, r, ErrInvalidRequest(errChecklistItemsWhole))
+		return
+	}
 
-	err := h.ChecklistCollection.Update(r.Context(), _id, updateParams)
+	stored, err := h.ChecklistCollection.GetByID(r.Context(), _id, tenant)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+	updateParams.Items = stored.Items
+	if _, checkVersion := database.ExpectedVersion(ctx); !checkVersion {
+		// with If-Match: * the items must still be those just read
+		ctx = database.WithExpectedVersion(ctx, stored.Version)
+	}
+
+	err = h.ChecklistCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -162,9 +181,27 @@ func (h *ChecklistHandler) UpdateChecklistById(w http.ResponseWriter, r *http.Re
 	render.Render(w, r, SuccessOK)
 }
 
+// PatchChecklistById changes only the fields in the JSON merge patch, but the items, see errChecklistItemsWhole.
+// Items are refused even as null, which would remove every one of them.
+func (h *ChecklistHandler) PatchChecklistById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "shipment_id")
+
+	checklist, err := h.ChecklistCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	patchDocument(w, r, h.ChecklistCollection, checklist.ID, tenant, nil, "shipment_id", "items")
+}
+
 func (h *ChecklistHandler) GetChecklistById(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -183,34 +220,21 @@ func (h *ChecklistHandler) GetChecklistById(w http.ResponseWriter, r *http.Reque
 	}
 
 	response := database.ChecklistResponse{
-		ID:               Checklist.ID,
-		Tenant:           Checklist.Tenant,
-		PortDues:         Checklist.PortDues,
-		Pilotage:         Checklist.Pilotage,
-		ServiceLaunch:    Checklist.ServiceLaunch,
-		Logistics:        Checklist.Logistics,
-		HotelCharges:     Checklist.HotelCharges,
-		AirTickets:       Checklist.AirTickets,
-		TransportCharges: Checklist.TransportCharges,
-		MedicineSupplies: Checklist.MedicineSupplies,
-		FreshWaterSupply: Checklist.FreshWaterSupply,
-		MarineAdvisory:   Checklist.MarineAdvisory,
-		CourierServices:  Checklist.CourierServices,
-		CrossHarbourFees: Checklist.CrossHarbourFees,
-		SupplyBoat:       Checklist.SupplyBoat,
-		Repairs:          Checklist.Repairs,
-		Extras:           Checklist.Extras,
-		CrewChange:       Checklist.CrewChange,
-		ShipmentID:       Checklist.ShipmentID,
-		CreatedAt:        Checklist.CreatedAt,
-		UpdatedAt:        Checklist.UpdatedAt,
+		ID:         Checklist.ID,
+		Version:    Checklist.Version,
+		Tenant:     Checklist.Tenant,
+		Items:      Checklist.Items,
+		CrewChange: Checklist.CrewChange,
+		ShipmentID: Checklist.ShipmentID,
+		CreatedAt:  Checklist.CreatedAt,
+		UpdatedAt:  Checklist.UpdatedAt,
 	}
+	setETag(w, Checklist.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *ChecklistHandler) FilterChecklist(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -225,27 +249,14 @@ func (h *ChecklistHandler) FilterChecklist(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	response := database.ChecklistResponse{
-		ID:               Checklist.ID,
-		Tenant:           Checklist.Tenant,
-		PortDues:         Checklist.PortDues,
-		Pilotage:         Checklist.Pilotage,
-		ServiceLaunch:    Checklist.ServiceLaunch,
-		Logistics:        Checklist.Logistics,
-		HotelCharges:     Checklist.HotelCharges,
-		AirTickets:       Checklist.AirTickets,
-		TransportCharges: Checklist.TransportCharges,
-		MedicineSupplies: Checklist.MedicineSupplies,
-		FreshWaterSupply: Checklist.FreshWaterSupply,
-		MarineAdvisory:   Checklist.MarineAdvisory,
-		CourierServices:  Checklist.CourierServices,
-		CrossHarbourFees: Checklist.CrossHarbourFees,
-		SupplyBoat:       Checklist.SupplyBoat,
-		Repairs:          Checklist.Repairs,
-		Extras:           Checklist.Extras,
-		CrewChange:       Checklist.CrewChange,
-		ShipmentID:       Checklist.ShipmentID,
-		CreatedAt:        Checklist.CreatedAt,
-		UpdatedAt:        Checklist.UpdatedAt,
+		ID:         Checklist.ID,
+		Version:    Checklist.Version,
+		Tenant:     Checklist.Tenant,
+		Items:      Checklist.Items,
+		CrewChange: Checklist.CrewChange,
+		ShipmentID: Checklist.ShipmentID,
+		CreatedAt:  Checklist.CreatedAt,
+		UpdatedAt:  Checklist.UpdatedAt,
 	}
 	render.JSON(w, r, response)
 }
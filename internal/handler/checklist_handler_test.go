@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecklistItemsAreNotReplacedWhole(t *testing.T) {
+	ctx := context.Background()
+	checklists := database.NewMemoryCollection[database.Checklist, database.ChecklistResponse]()
+	item := core.NewChecklistItem(core.ChecklistTemplateItem{Key: "port_dues", Name: "Port dues"})
+	id, err := checklists.Create(ctx, database.Checklist{Tenant: config.CUSTOMERA, ShipmentID: "shipment-1", Items: core.ChecklistItems{item}})
+	require.NoError(t, err)
+	h := NewChecklistHandler(checklists)
+
+	router := chi.NewRouter()
+	router.Put("/checklist/{shipment_id}", h.UpdateChecklistById)
+	router.Patch("/checklist/{shipment_id}", h.PatchChecklistById)
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: config.CUSTOMERA}))
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	invoiced := `{"items": [{"key": "port_dues", "name": "Port dues", "status": "` + string(enum.CHECKLIST_ITEM_STATUS_INVOICED) + `"}]}`
+	w := send("PATCH", "/checklist/shipment-1", invoiced)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "items")
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", "/checklist/shipment-1", `{"items": null}`).Code)
+	w = send("PUT", "/checklist/"+id, invoiced)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "/items/{item_key}")
+
+	// a PUT without items keeps the stored ones
+	assert.Equal(t, http.StatusOK, send("PUT", "/checklist/"+id, `{"tenant": "`+config.CUSTOMERA+`", "shipment_id": "shipment-1"}`).Code)
+	stored, err := checklists.GetByID(ctx, id, config.CUSTOMERA)
+	require.NoError(t, err)
+	require.Len(t, stored.Items, 1)
+	assert.Equal(t, item.Status, stored.Items[0].Status)
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ChecklistItemHandler struct {
+	ChecklistCollection      database.Collection[database.Checklist, database.ChecklistResponse]
+	SupplierCollection       database.Collection[database.Supplier, database.SupplierManagementResponse]
+	InvoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse]
+	UnitOfWork               *database.UnitOfWork
+}
+
+func NewChecklistItemHandler(
+	checklistCollection database.Collection[database.Checklist, database.ChecklistResponse],
+	supplierCollection database.Collection[database.Supplier, database.SupplierManagementResponse],
+	invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
+	unitOfWork *database.UnitOfWork,
+) *ChecklistItemHandler {
+	return &ChecklistItemHandler{
+		ChecklistCollection:      checklistCollection,
+		SupplierCollection:       supplierCollection,
+		InvoicePricingCollection: invoicePricingCollection,
+		UnitOfWork:               unitOfWork,
+	}
+}
+
+// updateChecklistItemParams only changes the fields that are given.
+// Amount defaults to quantity times unit price when it is not given.
+type updateChecklistItemParams struct {
+	Quantity   *float64 `json:"quantity"`
+	Unit       *string  `json:"unit"`
+	SupplierID *string  `json:"supplier_id"`
+	UnitPrice  *float64 `json:"unit_price"`
+	Amount     *float64 `json:"amount"`
+	Currency   *string  `json:"currency"`
+	Notes      *string  `json:"notes"`
+}
+
+type updateChecklistItemStatusParams struct {
+	Status enum.ChecklistItemStatus `json:"status"`
+}
+
+type addChecklistAttachmentParams struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (h *ChecklistItemHandler) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	var params updateChecklistItemParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	var supplier *database.SupplierManagementResponse
+	if params.SupplierID != nil && *params.SupplierID != "" {
+		found, err := h.SupplierCollection.GetByID(r.Context(), *params.SupplierID, tenant)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				render.Render(w, r, ErrInvalidRequest(errors.New("unknown supplier: "+*params.SupplierID)))
+			} else {
+				render.Render(w, r, ErrInternalServerError)
+			}
+			return
+		}
+		supplier = &found
+	}
+
+	h.updateItem(w, r, tenant, func(item *core.ChecklistItem) error {
+		if params.Quantity != nil {
+			if *params.Quantity < 0 {
+				return errors.New("quantity cannot be negative")
+			}
+			item.Quantity = *params.Quantity
+		}
+		if params.Unit != nil {
+			item.Unit = *params.Unit
+		}
+		if params.Notes != nil {
+			item.Notes = *params.Notes
+		}
+
+		if supplier == nil && params.UnitPrice == nil && params.Amount == nil && params.Currency == nil && params.Quantity == nil {
+			return nil
+		}
+		if item.Cost == nil {
+			item.Cost = &core.ChecklistItemCost{}
+		}
+		if supplier != nil {
+			item.Cost.SupplierID = supplier.ID
+			item.Cost.SupplierName = supplier.SupplierSpecifications.Name
+			item.Supplier = supplier.SupplierSpecifications.Name
+		}
+		if params.UnitPrice != nil {
+			item.Cost.UnitPrice = *params.UnitPrice
+		}
+		if params.Currency != nil {
+			item.Cost.Currency = *params.Currency
+		}
+		if params.Amount != nil {
+			item.Cost.Amount = *params.Amount
+		} else if item.Cost.UnitPrice != 0 {
+			item.Cost.Amount = item.Cost.UnitPrice * item.Quantity
+		}
+		if item.Cost.Amount < 0 {
+			return errors.New("cost cannot be negative")
+		}
+		return nil
+	})
+}
+
+// UpdateChecklistItemStatus moves an item through its lifecycle, e.g. from ordered to confirmed.
+func (h *ChecklistItemHandler) UpdateChecklistItemStatus(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	var params updateChecklistItemStatusParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	h.updateItem(w, r, tenant, func(item *core.ChecklistItem) error {
+		return item.TransitionTo(params.Status, time.Now())
+	})
+}
+
+func (h *ChecklistItemHandler) AddChecklistItemAttachment(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	var params addChecklistAttachmentParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	if params.URL == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("attachment url is required")))
+		return
+	}
+
+	h.updateItem(w, r, tenant, func(item *core.ChecklistItem) error {
+		item.Attachments = append(item.Attachments, core.ChecklistAttachment{
+			Name:       params.Name,
+			URL:        params.URL,
+			UploadedAt: time.Now(),
+		})
+		return nil
+	})
+}
+
+// updateItem applies change to the item named in the URL, saves the checklist
+// and brings the shipment's FDA in line with the delivered and invoiced costs, both or neither.
+func (h *ChecklistItemHandler) updateItem(w http.ResponseWriter, r *http.Request, tenant string, change func(item *core.ChecklistItem) error) {
+	shipmentId := chi.URLParam(r, "shipment_id")
+	itemKey := chi.URLParam(r, "item_key")
+
+	checklist, err := h.ChecklistCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	item := checklist.Items.Find(itemKey)
+	if item == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err := change(item); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+		// only the one item changes, so the checklist is updated as read rather than as the client last saw it
+		err := h.ChecklistCollection.Update(database.WithExpectedVersion(ctx, checklist.Version), checklist.ID, tenant, database.Checklist{
+			Items:      checklist.Items,
+			CrewChange: checklist.CrewChange,
+			ShipmentID: checklist.ShipmentID,
+			Tenant:     checklist.Tenant,
+			CreatedAt:  checklist.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		return syncFDACosts(ctx, h.InvoicePricingCollection, shipmentId, tenant, checklist.Items)
+	})
+	if err != nil {
+		log.Println("Error saving checklist item and syncing FDA:", err)
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
+		} else if errors.Is(err, mongo.ErrNoDocuments) {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.JSON(w, r, item)
+}
+
+// deliverItem moves the item to delivered at now, for a service known to have been provided without an operator
+// marking it, such as one an email reports. It reports whether the item moved: one already delivered, or that
+// cannot be delivered yet because it was never confirmed, stays as it is.
+func deliverItem(item *core.ChecklistItem, now time.Time) bool {
+	if item.Status == enum.CHECKLIST_ITEM_STATUS_DELIVERED {
+		return false
+	}
+	if err := item.TransitionTo(enum.CHECKLIST_ITEM_STATUS_DELIVERED, now); err != nil {
+		log.Printf("Not delivering checklist item %s: %v", item.Key, err)
+		return false
+	}
+	return true
+}
+
+// syncFDACosts replaces the FDA costs on the shipment's invoice with those of the checklist,
+// creating the invoice if the shipment does not have one yet.
+func syncFDACosts(
+	ctx context.Context,
+	invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
+	shipmentId string,
+	tenant string,
+	items core.ChecklistItems,
+) error {
+	costs := items.FDACosts()
+
+	invoice, err := invoicePricingCollection.GetByKeyValue(ctx, "shipmentid", shipmentId, tenant)
+	if err == mongo.ErrNoDocuments {
+		if len(costs) == 0 {
+			return nil
+		}
+		_, err = invoicePricingCollection.Create(ctx, database.InvoicePricing{
+			Tenant:     tenant,
+			ShipmentID: shipmentId,
+			FDACosts:   costs,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	return invoicePricingCollection.Update(database.WithExpectedVersion(ctx, invoice.Version), invoice.ID, tenant, database.InvoicePricing{
+		Tenant:                invoice.Tenant,
+		ShipmentID:            invoice.ShipmentID,
+		InvoicePricingDetails: invoice.InvoicePricingDetails,
+		FDACosts:              costs,
+		IsDraft:               invoice.IsDraft,
+		CreatedAt:             invoice.CreatedAt,
+	})
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockInvoicePricingCollection struct {
+	mock.Mock
+}
+
+func (m *MockInvoicePricingCollection) GetAll(ctx context.Context, tenant string) ([]database.InvoicePricingResponse, error) {
+	args := m.Called(ctx, tenant)
+	return args.Get(0).([]database.InvoicePricingResponse), args.Error(1)
+}
+
+func (m *MockInvoicePricingCollection) Create(ctx context.Context, invoice database.InvoicePricing) (string, error) {
+	args := m.Called(ctx, invoice)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockInvoicePricingCollection) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]database.InvoicePricingResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).([]database.InvoicePricingResponse), args.Error(1)
+}
+
+func (m *MockInvoicePricingCollection) GetByID(ctx context.Context, id string, tenant string) (database.InvoicePricingResponse, error) {
+	args := m.Called(ctx, id, tenant)
+	return args.Get(0).(database.InvoicePricingResponse), args.Error(1)
+}
+
+func (m *MockInvoicePricingCollection) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (database.InvoicePricingResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).(database.InvoicePricingResponse), args.Error(1)
+}
+
+func (m *MockInvoicePricingCollection) Update(ctx context.Context, id string, tenant string, invoice database.InvoicePricing) error {
+	args := m.Called(ctx, id, tenant, invoice)
+	return args.Error(0)
+}
+
+func (m *MockInvoicePricingCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockInvoicePricingCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func TestChecklistItemHandler_UpdateChecklistItem(t *testing.T) {
+	mockChecklistCollection := new(MockChecklistCollection)
+	mockSupplierCollection := new(MockSupplierCollection)
+	mockInvoiceCollection := new(MockInvoicePricingCollection)
+	handler := NewChecklistItemHandler(mockChecklistCollection, mockSupplierCollection, mockInvoiceCollection, database.NewUnitOfWork(&fakeTransactor{}))
+
+	r := chi.NewRouter()
+	r.Put("/checklist/{shipment_id}/items/{item_key}", handler.UpdateChecklistItem)
+
+	mockSupplierCollection.On("GetByID", mock.Anything, "supplier1", mock.Anything).Return(database.SupplierManagementResponse{
+		ID:                     "supplier1",
+		SupplierSpecifications: core.SupplierSpecifications{Name: "Eco Marine"},
+	}, nil)
+	mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{
+		ID:         "checklist1",
+		ShipmentID: "abc123",
+		Items:      core.ChecklistItems{{Key: "fresh_water_supply", Name: "Fresh Water Supply"}},
+	}, nil)
+	mockChecklistCollection.On("Update", mock.Anything, "checklist1", mock.Anything, mock.MatchedBy(func(checklist database.Checklist) bool {
+		item := checklist.Items.Find("fresh_water_supply")
+		return item.Quantity == 200 && item.Supplier == "Eco Marine" &&
+			item.Cost.SupplierID == "supplier1" && item.Cost.Amount == 500
+	})).Return(nil)
+	// Nothing has been delivered yet, so there is no FDA to create
+	mockInvoiceCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.InvoicePricingResponse{}, mongo.ErrNoDocuments)
+
+	req := httptest.NewRequest("PUT", "/checklist/abc123/items/fresh_water_supply", bytes.NewBufferString(`{
+		"quantity": 200,
+		"unit": "MT",
+		"supplier_id": "supplier1",
+		"unit_price": 2.5,
+		"currency": "SGD"
+	}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockChecklistCollection.AssertExpectations(t)
+	mockInvoiceCollection.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestChecklistItemHandler_UpdateChecklistItemStatus_SyncsFDA(t *testing.T) {
+	mockChecklistCollection := new(MockChecklistCollection)
+	mockInvoiceCollection := new(MockInvoicePricingCollection)
+	handler := NewChecklistItemHandler(mockChecklistCollection, new(MockSupplierCollection), mockInvoiceCollection, database.NewUnitOfWork(&fakeTransactor{}))
+
+	r := chi.NewRouter()
+	r.Put("/checklist/{shipment_id}/items/{item_key}/status", handler.UpdateChecklistItemStatus)
+
+	mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{
+		ID:         "checklist1",
+		ShipmentID: "abc123",
+		Items: core.ChecklistItems{
+			{
+				Key:    "fresh_water_supply",
+				Status: enum.CHECKLIST_ITEM_STATUS_CONFIRMED,
+				Cost:   &core.ChecklistItemCost{SupplierID: "supplier1", Amount: 500, Currency: "SGD"},
+			},
+			{
+				Key:    "pilotage",
+				Status: enum.CHECKLIST_ITEM_STATUS_ORDERED,
+				Cost:   &core.ChecklistItemCost{Amount: 300},
+			},
+		},
+	}, nil)
+	mockChecklistCollection.On("Update", mock.Anything, "checklist1", mock.Anything, mock.Anything).Return(nil)
+	mockInvoiceCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.InvoicePricingResponse{
+		ID:                    "invoice1",
+		ShipmentID:            "abc123",
+		InvoicePricingDetails: map[string]string{"agency_fee": "1000"},
+	}, nil)
+	mockInvoiceCollection.On("Update", mock.Anything, "invoice1", mock.Anything, mock.MatchedBy(func(invoice database.InvoicePricing) bool {
+		return invoice.InvoicePricingDetails["agency_fee"] == "1000" && len(invoice.FDACosts) == 1 &&
+			invoice.FDACosts[0].ItemKey == "fresh_water_supply" && invoice.FDACosts[0].Amount == 500
+	})).Return(nil)
+
+	req := httptest.NewRequest("PUT", "/checklist/abc123/items/fresh_water_supply/status", bytes.NewBufferString(`{"status": "Delivered"}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"service_provided":true`)
+	mockInvoiceCollection.AssertExpectations(t)
+}
+
+func TestChecklistItemHandler_UpdateChecklistItemStatus_InvalidTransition(t *testing.T) {
+	mockChecklistCollection := new(MockChecklistCollection)
+	handler := NewChecklistItemHandler(mockChecklistCollection, new(MockSupplierCollection), new(MockInvoicePricingCollection), database.NewUnitOfWork(&fakeTransactor{}))
+
+	r := chi.NewRouter()
+	r.Put("/checklist/{shipment_id}/items/{item_key}/status", handler.UpdateChecklistItemStatus)
+
+	mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{
+		ID:    "checklist1",
+		Items: core.ChecklistItems{{Key: "pilotage", Status: enum.CHECKLIST_ITEM_STATUS_REQUESTED}},
+	}, nil)
+
+	req := httptest.NewRequest("PUT", "/checklist/abc123/items/pilotage/status", bytes.NewBufferString(`{"status": "Invoiced"}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockChecklistCollection.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestChecklistItemHandler_UpdateChecklistItemStatus_FDAFailureRollsBack(t *testing.T) {
+	mockChecklistCollection := new(MockChecklistCollection)
+	mockInvoiceCollection := new(MockInvoicePricingCollection)
+	transactor := &fakeTransactor{}
+	handler := NewChecklistItemHandler(mockChecklistCollection, new(MockSupplierCollection), mockInvoiceCollection, database.NewUnitOfWork(transactor))
+
+	r := chi.NewRouter()
+	r.Put("/checklist/{shipment_id}/items/{item_key}/status", handler.UpdateChecklistItemStatus)
+
+	mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{
+		ID:    "checklist1",
+		Items: core.ChecklistItems{{Key: "pilotage", Status: enum.CHECKLIST_ITEM_STATUS_CONFIRMED, Cost: &core.ChecklistItemCost{Amount: 300}}},
+	}, nil)
+	mockChecklistCollection.On("Update", mock.Anything, "checklist1", mock.Anything, mock.Anything).Return(nil)
+	mockInvoiceCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.InvoicePricingResponse{ID: "invoice1"}, nil)
+	mockInvoiceCollection.On("Update", mock.Anything, "invoice1", mock.Anything, mock.Anything).Return(database.ErrVersionConflict)
+
+	req := httptest.NewRequest("PUT", "/checklist/abc123/items/pilotage/status", bytes.NewBufferString(`{"status": "Delivered"}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	// the item is only delivered with its FDA cost, so the client can retry the transition
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.True(t, transactor.rolledBack)
+	assert.False(t, transactor.committed)
+}
@@ -0,0 +1,333 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BUNKERING_ACTIVITY_TYPE is the activity type bunkering shipments are matched against,
+// bunkering activities do not carry an activity type of their own.
+const BUNKERING_ACTIVITY_TYPE string = "Bunkering"
+
+type ChecklistTemplateHandler struct {
+	ChecklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse]
+	ShipmentCollection          database.Collection[database.Shipment, database.ShipmentResponse]
+	ChecklistCollection         database.Collection[database.Checklist, database.ChecklistResponse]
+}
+
+func NewChecklistTemplateHandler(
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
+	checklistCollection database.Collection[database.Checklist, database.ChecklistResponse],
+) *ChecklistTemplateHandler {
+	return &ChecklistTemplateHandler{
+		ChecklistTemplateCollection: checklistTemplateCollection,
+		ShipmentCollection:          shipmentCollection,
+		ChecklistCollection:         checklistCollection,
+	}
+}
+
+type getAllChecklistTemplatesResponse struct {
+	ChecklistTemplates []database.ChecklistTemplateResponse `json:"checklist_templates"`
+}
+
+func (h *ChecklistTemplateHandler) GetAllChecklistTemplates(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	checklistTemplates, err := h.ChecklistTemplateCollection.GetAll(r.Context(), tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	response := getAllChecklistTemplatesResponse{ChecklistTemplates: checklistTemplates}
+	render.JSON(w, r, response)
+}
+
+func (h *ChecklistTemplateHandler) GetChecklistTemplateById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "checklist_template_id")
+
+	checklistTemplate, err := h.ChecklistTemplateCollection.GetByID(r.Context(), _id, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	setETag(w, checklistTemplate.Version)
+	render.JSON(w, r, checklistTemplate)
+}
+
+func (h *ChecklistTemplateHandler) CreateChecklistTemplate(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	var createParams database.ChecklistTemplate
+	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	createParams.Tenant = tenant
+
+	if err := prepareChecklistTemplate(&createParams); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	_, err := h.ChecklistTemplateCollection.Create(r.Context(), createParams)
+	if err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			render.Render(w, r, ErrDuplicate(err))
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(201)
+	render.Render(w, r, SuccessCreated)
+}
+
+func (h *ChecklistTemplateHandler) UpdateChecklistTemplateById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "checklist_template_id")
+
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
+	var updateParams database.ChecklistTemplate
+	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	existing, err := h.ChecklistTemplateCollection.GetByID(r.Context(), _id, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+	updateParams.Tenant = tenant
+	updateParams.CreatedAt = existing.CreatedAt
+
+	if err := prepareChecklistTemplate(&updateParams); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := h.ChecklistTemplateCollection.Update(ctx, _id, tenant, updateParams); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
+		} else if errors.Is(err, mongo.ErrNoDocuments) {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
+
+func (h *ChecklistTemplateHandler) DeleteChecklistTemplateById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "checklist_template_id")
+
+	if _, err := h.ChecklistTemplateCollection.GetByID(r.Context(), _id, tenant); err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	if err := h.ChecklistTemplateCollection.Delete(r.Context(), _id, tenant); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
+
+// CreateChecklistFromTemplate creates the checklist for a shipment from the tenant's templates
+// for the shipment's activity types.
+func (h *ChecklistTemplateHandler) CreateChecklistFromTemplate(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "shipment_id")
+
+	shipment, err := h.ShipmentCollection.GetByID(r.Context(), shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	if _, err := h.ChecklistCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant); err == nil {
+		render.Render(w, r, ErrDuplicate(errors.New("shipment already has a checklist")))
+		return
+	} else if err != mongo.ErrNoDocuments {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	checklist, err := newChecklistFromTemplates(r.Context(), h.ChecklistTemplateCollection, shipment)
+	if err != nil {
+		log.Println("Error resolving checklist templates:", err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	if _, err := h.ChecklistCollection.Create(r.Context(), checklist); err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			render.Render(w, r, ErrDuplicate(err))
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(201)
+	render.Render(w, r, SuccessCreated)
+}
+
+// prepareChecklistTemplate validates a template submitted by a tenant,
+// deriving item keys from their names where none is given.
+func prepareChecklistTemplate(checklistTemplate *database.ChecklistTemplate) error {
+	if checklistTemplate.Name == "" {
+		return errors.New("checklist template name is required")
+	}
+	if len(checklistTemplate.Items) == 0 {
+		return errors.New("checklist template must have at least one item")
+	}
+
+	keys := make(map[string]bool, len(checklistTemplate.Items))
+	for i := range checklistTemplate.Items {
+		item := &checklistTemplate.Items[i]
+		if item.Name == "" {
+			return errors.New("checklist item name is required")
+		}
+		if item.Key == "" {
+			item.Key = core.ChecklistItemKey(item.Name)
+		}
+		if item.Key == core.CREW_CHANGE_INTENTION {
+			return errors.New("checklist item key \"" + item.Key + "\" is reserved")
+		}
+		if keys[item.Key] {
+			return errors.New("duplicate checklist item key: " + item.Key)
+		}
+		keys[item.Key] = true
+	}
+	return nil
+}
+
+// newChecklistFromTemplates builds an unsaved checklist for the shipment, see checklistTemplateItemsForShipment.
+func newChecklistFromTemplates(
+	ctx context.Context,
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	shipment database.ShipmentResponse,
+) (database.Checklist, error) {
+	templateItems, err := checklistTemplateItemsForShipment(ctx, checklistTemplateCollection, shipment)
+	if err != nil {
+		return database.Checklist{}, err
+	}
+	return database.Checklist{
+		Items:      core.NewChecklistItems(templateItems),
+		ShipmentID: shipment.ID,
+		Tenant:     shipment.Tenant,
+	}, nil
+}
+
+// checklistTemplateItemsForShipment merges the tenant's templates for each of the shipment's activity types,
+// followed by the tenant's default template. Tenants without any templates get core.DefaultChecklistTemplateItems.
+func checklistTemplateItemsForShipment(
+	ctx context.Context,
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	shipment database.ShipmentResponse,
+) ([]core.ChecklistTemplateItem, error) {
+	checklistTemplates, err := checklistTemplateCollection.GetAll(ctx, shipment.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(checklistTemplates) == 0 {
+		return core.DefaultChecklistTemplateItems, nil
+	}
+
+	var itemLists [][]core.ChecklistTemplateItem
+	for _, activityType := range shipmentActivityTypes(shipment) {
+		for _, checklistTemplate := range checklistTemplates {
+			if checklistTemplate.ActivityType == activityType {
+				itemLists = append(itemLists, checklistTemplate.Items)
+			}
+		}
+	}
+	for _, checklistTemplate := range checklistTemplates {
+		if checklistTemplate.ActivityType == "" {
+			itemLists = append(itemLists, checklistTemplate.Items)
+		}
+	}
+	return core.MergeChecklistTemplateItems(itemLists...), nil
+}
+
+// checklistTemplateItemsForTenant merges every template of the tenant, for when the shipment is not yet known.
+func checklistTemplateItemsForTenant(
+	ctx context.Context,
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	tenant string,
+) ([]core.ChecklistTemplateItem, error) {
+	checklistTemplates, err := checklistTemplateCollection.GetAll(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(checklistTemplates) == 0 {
+		return core.DefaultChecklistTemplateItems, nil
+	}
+
+	var itemLists [][]core.ChecklistTemplateItem
+	for _, checklistTemplate := range checklistTemplates {
+		itemLists = append(itemLists, checklistTemplate.Items)
+	}
+	return core.MergeChecklistTemplateItems(itemLists...), nil
+}
+
+func shipmentActivityTypes(shipment database.ShipmentResponse) []string {
+	var activityTypes []string
+	if shipment.ShipmentType.CargoOperations.CargoOperations {
+		for _, activity := range shipment.ShipmentType.CargoOperations.CargoOperationsActivity {
+			if activity != nil && activity.ActivityType != "" {
+				activityTypes = append(activityTypes, activity.ActivityType)
+			}
+		}
+	}
+	if shipment.ShipmentType.Bunkering.Bunkering {
+		activityTypes = append(activityTypes, BUNKERING_ACTIVITY_TYPE)
+	}
+	if shipment.ShipmentType.OwnerMatters.OwnerMatters {
+		for _, activity := range shipment.ShipmentType.OwnerMatters.Activity {
+			if activity != nil && activity.ActivityType != "" {
+				activityTypes = append(activityTypes, activity.ActivityType)
+			}
+		}
+	}
+	return activityTypes
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockChecklistTemplateCollection struct {
+	mock.Mock
+}
+
+func (m *MockChecklistTemplateCollection) GetAll(ctx context.Context, tenant string) ([]database.ChecklistTemplateResponse, error) {
+	args := m.Called(ctx, tenant)
+	return args.Get(0).([]database.ChecklistTemplateResponse), args.Error(1)
+}
+
+func (m *MockChecklistTemplateCollection) Create(ctx context.Context, checklistTemplate database.ChecklistTemplate) (string, error) {
+	args := m.Called(ctx, checklistTemplate)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockChecklistTemplateCollection) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]database.ChecklistTemplateResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).([]database.ChecklistTemplateResponse), args.Error(1)
+}
+
+func (m *MockChecklistTemplateCollection) GetByID(ctx context.Context, id string, tenant string) (database.ChecklistTemplateResponse, error) {
+	args := m.Called(ctx, id, tenant)
+	return args.Get(0).(database.ChecklistTemplateResponse), args.Error(1)
+}
+
+func (m *MockChecklistTemplateCollection) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (database.ChecklistTemplateResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).(database.ChecklistTemplateResponse), args.Error(1)
+}
+
+func (m *MockChecklistTemplateCollection) Update(ctx context.Context, id string, tenant string, checklistTemplate database.ChecklistTemplate) error {
+	args := m.Called(ctx, id, tenant, checklistTemplate)
+	return args.Error(0)
+}
+
+func (m *MockChecklistTemplateCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockChecklistTemplateCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func TestChecklistTemplateHandler_CreateChecklistTemplate(t *testing.T) {
+	mockTemplateCollection := new(MockChecklistTemplateCollection)
+	handler := NewChecklistTemplateHandler(mockTemplateCollection, new(MockShipmentCollection), new(MockChecklistCollection))
+
+	r := chi.NewRouter()
+	r.Post("/checklist_templates", handler.CreateChecklistTemplate)
+
+	mockTemplateCollection.On("Create", mock.Anything, mock.MatchedBy(func(checklistTemplate database.ChecklistTemplate) bool {
+		return checklistTemplate.ActivityType == "Discharging" &&
+			len(checklistTemplate.Items) == 2 &&
+			checklistTemplate.Items[0].Key == "garbage_disposal" &&
+			checklistTemplate.Items[1].Key == "sludge_removal"
+	})).Return("template1", nil)
+
+	req := httptest.NewRequest("POST", "/checklist_templates", bytes.NewBufferString(`{
+		"name": "Discharging",
+		"activity_type": "Discharging",
+		"items": [
+			{"name": "Garbage Disposal", "category": "Environmental", "required": true},
+			{"key": "sludge_removal", "name": "Sludge Removal", "default_supplier": "Eco Marine"}
+		]
+	}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockTemplateCollection.AssertExpectations(t)
+}
+
+func TestChecklistTemplateHandler_CreateChecklistTemplate_DuplicateKey(t *testing.T) {
+	mockTemplateCollection := new(MockChecklistTemplateCollection)
+	handler := NewChecklistTemplateHandler(mockTemplateCollection, new(MockShipmentCollection), new(MockChecklistCollection))
+
+	r := chi.NewRouter()
+	r.Post("/checklist_templates", handler.CreateChecklistTemplate)
+
+	req := httptest.NewRequest("POST", "/checklist_templates", bytes.NewBufferString(`{
+		"name": "Default",
+		"items": [
+			{"name": "Sludge Removal"},
+			{"key": "sludge_removal", "name": "Sludge Disposal"}
+		]
+	}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockTemplateCollection.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestChecklistTemplateHandler_CreateChecklistFromTemplate(t *testing.T) {
+	mockTemplateCollection := new(MockChecklistTemplateCollection)
+	mockShipmentCollection := new(MockShipmentCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	handler := NewChecklistTemplateHandler(mockTemplateCollection, mockShipmentCollection, mockChecklistCollection)
+
+	r := chi.NewRouter()
+	r.Post("/checklist/{shipment_id}/from_template", handler.CreateChecklistFromTemplate)
+
+	shipment := database.ShipmentResponse{ID: "abc123", Tenant: "tenantA"}
+	shipment.ShipmentType.CargoOperations.CargoOperations = true
+	shipment.ShipmentType.CargoOperations.CargoOperationsActivity = []*core.CargoOperationsActivity{{ActivityType: "Discharging"}}
+
+	mockShipmentCollection.On("GetByID", mock.Anything, "abc123", mock.Anything).Return(shipment, nil)
+	mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{}, mongo.ErrNoDocuments)
+	mockTemplateCollection.On("GetAll", mock.Anything, "tenantA").Return([]database.ChecklistTemplateResponse{
+		{
+			ID:   "default",
+			Name: "Default",
+			Items: []core.ChecklistTemplateItem{
+				{Key: "port_dues", Name: "Port Dues", Required: true},
+				{Key: "sludge_removal", Name: "Sludge Removal"},
+			},
+		},
+		{
+			ID:           "loading",
+			Name:         "Loading",
+			ActivityType: "Loading",
+			Items:        []core.ChecklistTemplateItem{{Key: "cargo_survey", Name: "Cargo Survey"}},
+		},
+		{
+			ID:           "discharging",
+			Name:         "Discharging",
+			ActivityType: "Discharging",
+			Items:        []core.ChecklistTemplateItem{{Key: "sludge_removal", Name: "Sludge Removal", DefaultSupplier: "Eco Marine"}},
+		},
+	}, nil)
+	mockChecklistCollection.On("Create", mock.Anything, mock.MatchedBy(func(checklist database.Checklist) bool {
+		return checklist.ShipmentID == "abc123" && len(checklist.Items) == 2 &&
+			checklist.Items[0].Key == "sludge_removal" && checklist.Items[0].Supplier == "Eco Marine" &&
+			checklist.Items[1].Key == "port_dues" && checklist.Items.Find("cargo_survey") == nil
+	})).Return("checklist1", nil)
+
+	req := httptest.NewRequest("POST", "/checklist/abc123/from_template", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockChecklistCollection.AssertExpectations(t)
+}
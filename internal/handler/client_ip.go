@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the load balancers and proxies in front of the server. A request they forward comes from the
+// address they put in X-Forwarded-For, which is only believed from them, as any client can send the header.
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// NewTrustedProxies trusts the proxies in specs, each a CIDR or a single IP address.
+func NewTrustedProxies(specs []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	for _, spec := range specs {
+		network, err := parseNetwork(spec)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", spec, err)
+		}
+		p.networks = append(p.networks, network)
+	}
+	return p, nil
+}
+
+// parseNetwork parses a CIDR, or a single IP address as the network of only that address.
+func parseNetwork(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	return network, err
+}
+
+func (p *TrustedProxies) trusts(ip net.IP) bool {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIP sets the RemoteAddr of a request forwarded by a trusted proxy to the address it was forwarded for: the
+// rightmost address of X-Forwarded-For that is not a trusted proxy. Addresses left of it were sent by the client
+// and may be made up. Requests from anywhere else keep their RemoteAddr, whatever X-Forwarded-For they send.
+func (p *TrustedProxies) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := p.forwardedFor(r); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor is the address a trusted proxy forwarded r for, or empty if r does not come from a trusted proxy.
+func (p *TrustedProxies) forwardedFor(r *http.Request) string {
+	remote := net.ParseIP(clientIP(r))
+	if remote == nil || !p.trusts(remote) {
+		return ""
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	forwarded := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// the address the last trusted proxy was reached from is the furthest that can be believed
+			break
+		}
+		forwarded = ip.String()
+		if !p.trusts(ip) {
+			break
+		}
+	}
+	return forwarded
+}
+
+// clientIP is the address the request came from, without its port. Behind a trusted proxy that is the address
+// RealIP found in X-Forwarded-For.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
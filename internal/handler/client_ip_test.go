@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies_RealIP(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/16", "192.0.2.7"})
+	require.NoError(t, err)
+	seen := ""
+	handler := proxies.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientIP(r)
+	}))
+	from := func(remoteAddr string, forwardedFor ...string) string {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = remoteAddr
+		for _, value := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return seen
+	}
+
+	// the load balancer forwards for the client it was reached from
+	assert.Equal(t, "203.0.113.5", from("10.0.1.2:41000", "203.0.113.5"))
+	// a client cannot choose its address by sending the header itself, only the rightmost untrusted one counts
+	assert.Equal(t, "203.0.113.5", from("10.0.1.2:41000", "198.51.100.1, 203.0.113.5"))
+	assert.Equal(t, "203.0.113.5", from("10.0.1.2:41000", "198.51.100.1", "203.0.113.5, 192.0.2.7"))
+	// nor from outside the trusted proxies
+	assert.Equal(t, "198.51.100.9", from("198.51.100.9:41000", "203.0.113.5"))
+	// a malformed hop ends the chain at the last proxy that can be believed
+	assert.Equal(t, "192.0.2.7", from("10.0.1.2:41000", "203.0.113.5, not-an-ip, 192.0.2.7"))
+	// without the header the proxy is the client
+	assert.Equal(t, "10.0.1.2", from("10.0.1.2:41000"))
+
+	_, err = NewTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
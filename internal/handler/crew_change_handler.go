@@ -0,0 +1,360 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CrewChangeHandler struct {
+	CrewChangeCollection     database.Collection[database.CrewChange, database.CrewChangeResponse]
+	ShipmentCollection       database.Collection[database.Shipment, database.ShipmentResponse]
+	ChecklistCollection      database.Collection[database.Checklist, database.ChecklistResponse]
+	InvoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse]
+
+	// UnitOfWork saves a roster together with the checklist it is mirrored on, see syncCrewChecklist
+	UnitOfWork *database.UnitOfWork
+}
+
+func NewCrewChangeHandler(
+	crewChangeCollection database.Collection[database.CrewChange, database.CrewChangeResponse],
+	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
+	checklistCollection database.Collection[database.Checklist, database.ChecklistResponse],
+	invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
+	unitOfWork *database.UnitOfWork,
+) *CrewChangeHandler {
+	return &CrewChangeHandler{
+		CrewChangeCollection:     crewChangeCollection,
+		ShipmentCollection:       shipmentCollection,
+		ChecklistCollection:      checklistCollection,
+		InvoicePricingCollection: invoicePricingCollection,
+		UnitOfWork:               unitOfWork,
+	}
+}
+
+type crewChangeResponse struct {
+	CrewChange       database.CrewChangeResponse `json:"crew_change"`
+	MissingDocuments map[string][]string         `json:"missing_documents"`
+}
+
+type upsertCrewChangeParams struct {
+	CrewMembers []core.CrewMember `json:"crew_members"`
+}
+
+type updateCrewMemberStatusParams struct {
+	Status          enum.CrewChangeStatus `json:"status"`
+	ClearanceStatus enum.ClearanceStatus  `json:"clearance_status"`
+}
+
+func (h *CrewChangeHandler) GetCrewChange(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "shipment_id")
+
+	shipment, err := h.ShipmentCollection.GetByID(r.Context(), shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	crewChange, err := h.CrewChangeCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	response := crewChangeResponse{
+		CrewChange:       crewChange,
+		MissingDocuments: missingCrewDocuments(crewChange.CrewMembers, shipment.CurrentETA),
+	}
+	setETag(w, crewChange.Version)
+	render.JSON(w, r, response)
+}
+
+// UpsertCrewChange replaces the crew roster for a shipment, creating it on first use.
+// New crew members are given an ID and start as pending.
+func (h *CrewChangeHandler) UpsertCrewChange(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "shipment_id")
+
+	var params upsertCrewChangeParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	if _, err := h.ShipmentCollection.GetByID(r.Context(), shipmentId, tenant); err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	existing, err := h.CrewChangeCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil && err != mongo.ErrNoDocuments {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	crewMembers, err := prepareCrewMembers(params.CrewMembers, existing.CrewMembers)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	crewChange := database.CrewChange{
+		Tenant:      tenant,
+		ShipmentID:  shipmentId,
+		CrewMembers: crewMembers,
+		CreatedAt:   existing.CreatedAt,
+	}
+	ctx := r.Context()
+	if existing.ID != "" {
+		// replacing an existing roster needs the ETag it was read with
+		var ok bool
+		if ctx, ok = ifMatchContext(w, r); !ok {
+			return
+		}
+	}
+	err = h.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if existing.ID == "" {
+			if _, err := h.CrewChangeCollection.Create(ctx, crewChange); err != nil {
+				return err
+			}
+		} else if err := h.CrewChangeCollection.Update(ctx, existing.ID, tenant, crewChange); err != nil {
+			return err
+		}
+		return syncCrewChecklist(ctx, h.ChecklistCollection, h.InvoicePricingCollection, shipmentId, tenant, crewMembers)
+	})
+	if err != nil {
+		log.Println("Error saving crew change:", err)
+		if errors.Is(err, database.ErrDuplicateKey) {
+			render.Render(w, r, ErrDuplicate(err))
+			return
+		}
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
+			return
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
+
+// UpdateCrewMemberStatus moves a single crew member through the crew change, e.g. once travel is booked.
+func (h *CrewChangeHandler) UpdateCrewMemberStatus(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "shipment_id")
+	crewMemberId := chi.URLParam(r, "crew_member_id")
+
+	var params updateCrewMemberStatusParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	if params.Status != "" && !enum.IsValidCrewChangeStatus(params.Status) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("unknown crew change status: "+string(params.Status))))
+		return
+	}
+
+	crewChange, err := h.CrewChangeCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	found := false
+	for i := range crewChange.CrewMembers {
+		member := &crewChange.CrewMembers[i]
+		if member.ID != crewMemberId {
+			continue
+		}
+		found = true
+		if params.Status != "" && params.Status != member.Status {
+			member.Status = params.Status
+			member.StatusUpdatedAt = time.Now()
+		}
+		if params.ClearanceStatus != "" {
+			member.ClearanceStatus = params.ClearanceStatus
+		}
+	}
+	if !found {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+		// only the one crew member changes, so the roster is updated as read rather than as the client last saw it
+		err := h.CrewChangeCollection.Update(database.WithExpectedVersion(ctx, crewChange.Version), crewChange.ID, tenant, database.CrewChange{
+			Tenant:      crewChange.Tenant,
+			ShipmentID:  crewChange.ShipmentID,
+			CrewMembers: crewChange.CrewMembers,
+			CreatedAt:   crewChange.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		return syncCrewChecklist(ctx, h.ChecklistCollection, h.InvoicePricingCollection, shipmentId, tenant, crewChange.CrewMembers)
+	})
+	if err != nil {
+		log.Println("Error saving crew member status:", err)
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
+		} else if errors.Is(err, mongo.ErrNoDocuments) {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
+
+// syncCrewChecklist mirrors the crew roster onto the shipment's checklist: the sign on and sign off names, and the
+// hotel, air ticket and transport items, delivered once any active crew member has them booked, with the FDA.
+// It is called in the unit of work that saves the roster. A missing checklist is not an error, the roster is still saved.
+func syncCrewChecklist(
+	ctx context.Context,
+	checklistCollection database.Collection[database.Checklist, database.ChecklistResponse],
+	invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
+	shipmentId string,
+	tenant string,
+	crewMembers []core.CrewMember,
+) error {
+	checklist, err := checklistCollection.GetByKeyValue(ctx, "shipmentid", shipmentId, tenant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Println("No checklist to sync with the crew change of shipment", shipmentId)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	updatedChecklist := database.Checklist{
+		Items:      checklist.Items,
+		CrewChange: core.CrewChange{},
+		ShipmentID: checklist.ShipmentID,
+		Tenant:     checklist.Tenant,
+		CreatedAt:  checklist.CreatedAt,
+	}
+
+	now := time.Now()
+	delivered := false
+	deliver := func(key string) {
+		if item := updatedChecklist.Items.Find(key); item != nil && deliverItem(item, now) {
+			delivered = true
+		}
+	}
+
+	for _, member := range crewMembers {
+		if !member.IsActive() {
+			continue
+		}
+		if member.Direction == enum.CREW_CHANGE_SIGN_OFF {
+			updatedChecklist.CrewChange.SignOff = append(updatedChecklist.CrewChange.SignOff, member.Name)
+		} else {
+			updatedChecklist.CrewChange.SignOn = append(updatedChecklist.CrewChange.SignOn, member.Name)
+		}
+		if member.Hotel != nil && member.Hotel.Name != "" {
+			deliver(core.CHECKLIST_ITEM_HOTEL_CHARGES)
+		}
+		if member.Flight != nil && member.Flight.FlightNumber != "" {
+			deliver(core.CHECKLIST_ITEM_AIR_TICKETS)
+		}
+		if member.Transport != nil && member.Transport.Provider != "" {
+			deliver(core.CHECKLIST_ITEM_TRANSPORT_CHARGES)
+		}
+	}
+
+	if err := checklistCollection.Update(database.WithExpectedVersion(ctx, checklist.Version), checklist.ID, tenant, updatedChecklist); err != nil {
+		return err
+	}
+	if !delivered {
+		return nil
+	}
+	return syncFDACosts(ctx, invoicePricingCollection, shipmentId, tenant, updatedChecklist.Items)
+}
+
+// prepareCrewMembers validates the submitted roster and fills in defaults,
+// keeping the status timestamp of crew members whose status did not change.
+func prepareCrewMembers(crewMembers []core.CrewMember, existing []core.CrewMember) ([]core.CrewMember, error) {
+	previous := make(map[string]core.CrewMember, len(existing))
+	for _, member := range existing {
+		previous[member.ID] = member
+	}
+
+	now := time.Now()
+	for i := range crewMembers {
+		member := &crewMembers[i]
+		if member.Name == "" {
+			return nil, errors.New("crew member name is required")
+		}
+		if member.Direction != enum.CREW_CHANGE_SIGN_ON && member.Direction != enum.CREW_CHANGE_SIGN_OFF {
+			return nil, errors.New("crew member direction must be \"Sign On\" or \"Sign Off\"")
+		}
+		if member.Status == "" {
+			member.Status = enum.CREW_CHANGE_STATUS_PENDING
+		}
+		if !enum.IsValidCrewChangeStatus(member.Status) {
+			return nil, errors.New("unknown crew change status: " + string(member.Status))
+		}
+		if member.ClearanceStatus == "" {
+			member.ClearanceStatus = enum.CLEARANCE_STATUS_NOT_SUBMITTED
+		}
+		if member.ID == "" {
+			member.ID = uuid.NewString()
+		}
+
+		if old, ok := previous[member.ID]; ok && old.Status == member.Status {
+			member.StatusUpdatedAt = old.StatusUpdatedAt
+		} else {
+			member.StatusUpdatedAt = now
+		}
+	}
+	return crewMembers, nil
+}
+
+// missingCrewDocuments returns the outstanding documents per active crew member, keyed by name.
+func missingCrewDocuments(crewMembers []core.CrewMember, eta time.Time) map[string][]string {
+	missing := make(map[string][]string)
+	for _, member := range crewMembers {
+		if !member.IsActive() || member.Status == enum.CREW_CHANGE_STATUS_COMPLETED {
+			continue
+		}
+		if documents := member.MissingDocuments(eta); len(documents) > 0 {
+			missing[member.Name] = documents
+		}
+	}
+	return missing
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MockCrewChangeCollection struct {
+	mock.Mock
+}
+
+func (m *MockCrewChangeCollection) GetAll(ctx context.Context, tenant string) ([]database.CrewChangeResponse, error) {
+	args := m.Called(ctx, tenant)
+	return args.Get(0).([]database.CrewChangeResponse), args.Error(1)
+}
+
+func (m *MockCrewChangeCollection) Create(ctx context.Context, crewChange database.CrewChange) (string, error) {
+	args := m.Called(ctx, crewChange)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockCrewChangeCollection) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]database.CrewChangeResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).([]database.CrewChangeResponse), args.Error(1)
+}
+
+func (m *MockCrewChangeCollection) GetByID(ctx context.Context, id string, tenant string) (database.CrewChangeResponse, error) {
+	args := m.Called(ctx, id, tenant)
+	return args.Get(0).(database.CrewChangeResponse), args.Error(1)
+}
+
+func (m *MockCrewChangeCollection) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (database.CrewChangeResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).(database.CrewChangeResponse), args.Error(1)
+}
+
+func (m *MockCrewChangeCollection) Update(ctx context.Context, id string, tenant string, crewChange database.CrewChange) error {
+	args := m.Called(ctx, id, tenant, crewChange)
+	return args.Error(0)
+}
+
+func (m *MockCrewChangeCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockCrewChangeCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func TestCrewChangeHandler_GetCrewChange(t *testing.T) {
+	mockCrewChangeCollection := new(MockCrewChangeCollection)
+	mockShipmentCollection := new(MockShipmentCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	handler := NewCrewChangeHandler(mockCrewChangeCollection, mockShipmentCollection, mockChecklistCollection, nil, database.NewUnitOfWork(&fakeTransactor{}))
+
+	r := chi.NewRouter()
+	r.Get("/shipments/{shipment_id}/crew_change", handler.GetCrewChange)
+
+	eta := time.Date(2024, time.May, 22, 12, 0, 0, 0, time.UTC)
+	mockShipmentCollection.On("GetByID", mock.Anything, "abc123", mock.Anything).Return(database.ShipmentResponse{ID: "abc123", CurrentETA: eta}, nil)
+	mockCrewChangeCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.CrewChangeResponse{
+		ID:         "crew1",
+		ShipmentID: "abc123",
+		CrewMembers: []core.CrewMember{
+			{
+				ID:               "m1",
+				Name:             "BAN CHI TAN",
+				Direction:        enum.CREW_CHANGE_SIGN_ON,
+				Status:           enum.CREW_CHANGE_STATUS_PENDING,
+				PassportNumber:   "E1234567",
+				PassportExpiry:   time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+				SeamanBookNumber: "S998877",
+				Flight:           &core.CrewFlight{FlightNumber: "SQ123"},
+			},
+			{
+				ID:        "m2",
+				Name:      "KI AISONG",
+				Direction: enum.CREW_CHANGE_SIGN_OFF,
+				Status:    enum.CREW_CHANGE_STATUS_CANCELLED,
+			},
+		},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/shipments/abc123/crew_change", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"BAN CHI TAN":["valid passport"]`)
+	assert.NotContains(t, w.Body.String(), `"KI AISONG":[`)
+	mockShipmentCollection.AssertExpectations(t)
+	mockCrewChangeCollection.AssertExpectations(t)
+}
+
+func TestCrewChangeHandler_UpsertCrewChange(t *testing.T) {
+	upsert := func(checklistErr error) (*httptest.ResponseRecorder, *fakeTransactor, database.Checklist) {
+		mockCrewChangeCollection := new(MockCrewChangeCollection)
+		mockShipmentCollection := new(MockShipmentCollection)
+		mockChecklistCollection := new(MockChecklistCollection)
+		transactor := &fakeTransactor{}
+		handler := NewCrewChangeHandler(mockCrewChangeCollection, mockShipmentCollection, mockChecklistCollection,
+			database.NewMemoryCollection[database.InvoicePricing, database.InvoicePricingResponse](), database.NewUnitOfWork(transactor))
+
+		r := chi.NewRouter()
+		r.Put("/shipments/{shipment_id}/crew_change", handler.UpsertCrewChange)
+
+		hotel := &core.ChecklistItem{Key: core.CHECKLIST_ITEM_HOTEL_CHARGES, Name: "Hotel Charges", Status: enum.CHECKLIST_ITEM_STATUS_CONFIRMED}
+		mockShipmentCollection.On("GetByID", mock.Anything, "abc123", mock.Anything).Return(database.ShipmentResponse{ID: "abc123"}, nil)
+		mockCrewChangeCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.CrewChangeResponse{}, mongo.ErrNoDocuments)
+		mockCrewChangeCollection.On("Create", mock.Anything, mock.MatchedBy(func(crewChange database.CrewChange) bool {
+			member := crewChange.CrewMembers[0]
+			return crewChange.ShipmentID == "abc123" && member.ID != "" &&
+				member.Status == enum.CREW_CHANGE_STATUS_PENDING &&
+				member.ClearanceStatus == enum.CLEARANCE_STATUS_NOT_SUBMITTED
+		})).Return("crew1", nil)
+		mockChecklistCollection.On("GetByKeyValue", mock.Anything, "shipmentid", "abc123", mock.Anything).Return(database.ChecklistResponse{
+			ID:         "checklist1",
+			ShipmentID: "abc123",
+			Items: core.ChecklistItems{
+				hotel,
+				{Key: core.CHECKLIST_ITEM_AIR_TICKETS, Name: "Air Tickets"},
+			},
+		}, nil)
+		var saved database.Checklist
+		mockChecklistCollection.On("Update", mock.Anything, "checklist1", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			saved = args.Get(3).(database.Checklist)
+		}).Return(checklistErr)
+
+		req := httptest.NewRequest("PUT", "/shipments/abc123/crew_change", bytes.NewBufferString(`{
+			"crew_members": [
+				{"name": "BAN CHI TAN", "direction": "Sign On", "hotel": {"name": "Changi Village Hotel"}}
+			]
+		}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		mockCrewChangeCollection.AssertExpectations(t)
+		mockChecklistCollection.AssertExpectations(t)
+		return w, transactor, saved
+	}
+
+	w, transactor, checklist := upsert(nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, transactor.committed)
+	// a booked hotel delivers the confirmed hotel item, an item never confirmed is left as it is
+	hotel := checklist.Items.Find(core.CHECKLIST_ITEM_HOTEL_CHARGES)
+	assert.Equal(t, enum.CHECKLIST_ITEM_STATUS_DELIVERED, hotel.Status)
+	assert.True(t, hotel.ServiceProvided)
+	assert.Len(t, hotel.StatusHistory, 1)
+	assert.False(t, checklist.Items.Find(core.CHECKLIST_ITEM_AIR_TICKETS).ServiceProvided)
+	assert.Equal(t, []string{"BAN CHI TAN"}, checklist.CrewChange.SignOn)
+
+	// the roster is not saved without its checklist
+	w, transactor, _ = upsert(database.ErrVersionConflict)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.True(t, transactor.rolledBack)
+	assert.False(t, transactor.committed)
+}
+
+func TestCrewChangeHandler_UpdateCrewMemberStatus_InvalidStatus(t *testing.T) {
+	mockCrewChangeCollection := new(MockCrewChangeCollection)
+	mockShipmentCollection := new(MockShipmentCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	handler := NewCrewChangeHandler(mockCrewChangeCollection, mockShipmentCollection, mockChecklistCollection, nil, database.NewUnitOfWork(&fakeTransactor{}))
+
+	r := chi.NewRouter()
+	r.Put("/shipments/{shipment_id}/crew_change/{crew_member_id}/status", handler.UpdateCrewMemberStatus)
+
+	req := httptest.NewRequest("PUT", "/shipments/abc123/crew_change/m1/status", bytes.NewBufferString(`{"status": "Teleported"}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockCrewChangeCollection.AssertNotCalled(t, "GetByKeyValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
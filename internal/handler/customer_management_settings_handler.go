@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +9,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type CustomerHandler struct {
@@ -31,8 +30,7 @@ type getAllCustomersResponse struct {
 
 func (h *CustomerHandler) GetAllCustomers(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.Context())
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var customersList []database.CustomerResponse
 
@@ -53,6 +51,7 @@ func (h *CustomerHandler) GetAllCustomers(w http.ResponseWriter, r *http.Request
 	for _, customer := range customersList {
 		customers = append(customers, database.CustomerResponse{
 			ID:        customer.ID,
+			Version:   customer.Version,
 			Tenant:    customer.Tenant,
 			Customer:  customer.Customer,
 			Company:   customer.Company,
@@ -72,8 +71,7 @@ func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request)
 	log.Println(r)
 	log.Println(r.Context())
 	log.Println("ss")
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	log.Println(tenant)
 	var createParams database.Customer
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -101,13 +99,14 @@ func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *CustomerHandler) DeleteCustomerById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "customer_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.CustomerCollection.Delete(r.Context(), _id)
+	err := h.CustomerCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -122,21 +121,30 @@ func (h *CustomerHandler) DeleteCustomerById(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *CustomerHandler) UpdateCustomerById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "customer_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Customer
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.CustomerCollection.Update(r.Context(), _id, updateParams)
+	err := h.CustomerCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -149,9 +157,15 @@ func (h *CustomerHandler) UpdateCustomerById(w http.ResponseWriter, r *http.Requ
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *CustomerHandler) PatchCustomerById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "customer_id")
+
+	patchDocument(w, r, h.CustomerCollection, _id, tenant, nil)
+}
+
 func (h *CustomerHandler) GetCustomerFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	_id := chi.URLParam(r, "customer_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
@@ -161,7 +175,7 @@ func (h *CustomerHandler) GetCustomerFromId(w http.ResponseWriter, r *http.Reque
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -171,6 +185,7 @@ func (h *CustomerHandler) GetCustomerFromId(w http.ResponseWriter, r *http.Reque
 
 	response := database.CustomerResponse{
 		ID:        customer.ID,
+		Version:   customer.Version,
 		Tenant:    customer.Tenant,
 		Customer:  customer.Customer,
 		Company:   customer.Company,
@@ -179,12 +194,12 @@ func (h *CustomerHandler) GetCustomerFromId(w http.ResponseWriter, r *http.Reque
 		CreatedAt: customer.CreatedAt,
 		UpdatedAt: customer.UpdatedAt,
 	}
+	setETag(w, customer.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *CustomerHandler) GetCustomerFromName(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	_name := chi.URLParam(r, "customer_name")
 	log.Printf("Retrieved Name from URL: %s", _name) // Confirm Name retrieval
@@ -204,6 +219,7 @@ func (h *CustomerHandler) GetCustomerFromName(w http.ResponseWriter, r *http.Req
 
 	response := database.CustomerResponse{
 		ID:        customer.ID,
+		Version:   customer.Version,
 		Tenant:    customer.Tenant,
 		Customer:  customer.Customer,
 		Company:   customer.Company,
@@ -216,8 +232,7 @@ func (h *CustomerHandler) GetCustomerFromName(w http.ResponseWriter, r *http.Req
 }
 
 func (h *CustomerHandler) FilterCustomer(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -233,6 +248,7 @@ func (h *CustomerHandler) FilterCustomer(w http.ResponseWriter, r *http.Request)
 	}
 	response := database.CustomerResponse{
 		ID:        customer.ID,
+		Version:   customer.Version,
 		Tenant:    customer.Tenant,
 		Customer:  customer.Customer,
 		Company:   customer.Company,
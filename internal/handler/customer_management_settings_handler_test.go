@@ -2,6 +2,7 @@ package handler
 
 import (
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
 	"bytes"
 	"context"
 	"net/http"
@@ -44,13 +45,18 @@ func (m *MockCustomerCollection) GetAllByKeyValue(ctx context.Context, key strin
 	return args.Get(0).([]database.CustomerResponse), args.Error(1)
 }
 
-func (m *MockCustomerCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockCustomerCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
-func (m *MockCustomerCollection) Update(ctx context.Context, id string, updateCustomerParams database.Customer) error {
-	args := m.Called(ctx, id, updateCustomerParams)
+func (m *MockCustomerCollection) Update(ctx context.Context, id string, tenant string, updateCustomerParams database.Customer) error {
+	args := m.Called(ctx, id, tenant, updateCustomerParams)
+	return args.Error(0)
+}
+
+func (m *MockCustomerCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
 	return args.Error(0)
 }
 
@@ -179,7 +185,7 @@ func TestCustomerHandler_UpdateCustomerById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Put("/customer_management/{customer_id}", handler.UpdateCustomerById)
 
-	mockCollection.On("Update", mock.Anything, "1", database.Customer{
+	mockCollection.On("Update", mock.Anything, "1", "customerA", database.Customer{
 		Tenant:   "customerA",
 		Customer: "Updated Customer",
 		Company:  "Updated Company",
@@ -191,6 +197,8 @@ func TestCustomerHandler_UpdateCustomerById(t *testing.T) {
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("customer_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -206,7 +214,7 @@ func TestCustomerHandler_DeleteCustomerById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Delete("/customer_management/{customer_id}", handler.DeleteCustomerById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/customer_management/1", nil)
 	rctx := chi.NewRouteContext()
@@ -219,3 +227,36 @@ func TestCustomerHandler_DeleteCustomerById(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockCollection.AssertExpectations(t)
 }
+
+func TestCustomerHandler_MemoryCollection(t *testing.T) {
+	customers := database.NewMemoryCollection[database.Customer, database.CustomerResponse]([]string{"tenant", "customer"})
+	handler := NewCustomerHandler(customers)
+
+	r := chi.NewRouter()
+	r.Post("/customer_management", handler.CreateCustomer)
+	r.Get("/customer_management", handler.GetAllCustomers)
+	r.Get("/customer_management/{customer_id}", handler.GetCustomerFromId)
+
+	serve := func(method string, url string, body string, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.ContextKeyEmail, email))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, serve("POST", "/customer_management", `{"customer": "Vitol"}`, "ops@customera.com").Code)
+	assert.Equal(t, http.StatusConflict, serve("POST", "/customer_management", `{"customer": "Vitol"}`, "ops@customera.com").Code)
+	assert.Equal(t, http.StatusCreated, serve("POST", "/customer_management", `{"customer": "Vitol"}`, "ops@customerb.com").Code)
+
+	stored, err := customers.GetAll(context.Background(), "customerA")
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+
+	w := serve("GET", "/customer_management/"+stored[0].ID, "", "ops@customera.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	// another tenant's customer is not found, rather than shown
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/customer_management/"+stored[0].ID, "", "ops@customerb.com").Code)
+}
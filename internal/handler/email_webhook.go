@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The forwarder posting emails to /master_email_messages authenticates with an EmailIngest API key, or signs each
+// request with its tenant's shared secret: the X-Webhook-Signature header is "sha256=" and the hex HMAC-SHA256 of
+// the X-Webhook-Timestamp header, a dot and the body, for the tenant in the X-Webhook-Tenant header.
+const (
+	webhookTenantHeader    = "X-Webhook-Tenant"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookSignaturePrefix = "sha256="
+)
+
+// EmailWebhook authenticates the emails forwarded to a tenant, and only takes them from the tenant's allowed addresses.
+type EmailWebhook struct {
+	APIKeys    *APIKeyHandler
+	secrets    map[string][][]byte
+	allowedIPs map[string][]*net.IPNet
+	tolerance  time.Duration
+	now        func() time.Time
+}
+
+func NewEmailWebhook(cfg config.EmailWebhook, apiKeys *APIKeyHandler) (*EmailWebhook, error) {
+	h := &EmailWebhook{
+		APIKeys:    apiKeys,
+		secrets:    make(map[string][][]byte),
+		allowedIPs: make(map[string][]*net.IPNet),
+		tolerance:  cfg.EmailWebhookTolerance,
+		now:        time.Now,
+	}
+	for _, spec := range cfg.EmailWebhookSecrets {
+		tenant, secret, ok := strings.Cut(spec, ":")
+		if !ok || tenant == "" || secret == "" {
+			return nil, errors.New("an email webhook secret is not tenant:secret")
+		}
+		h.secrets[tenant] = append(h.secrets[tenant], []byte(secret))
+	}
+	for _, spec := range cfg.EmailWebhookAllowedIPs {
+		tenant, cidr, ok := strings.Cut(spec, ":")
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("email webhook allowed IP %q is not tenant:CIDR", spec)
+		}
+		network, err := parseNetwork(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("email webhook allowed IP %q: %w", spec, err)
+		}
+		h.allowedIPs[tenant] = append(h.allowedIPs[tenant], network)
+	}
+	return h, nil
+}
+
+// Authenticate only lets through signed requests, or requests with an EmailIngest API key, from an address the
+// tenant allows, and puts the tenant in their context. Every request it refuses is logged.
+func (h *EmailWebhook) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(webhookSignatureHeader) == "" {
+			reached := false
+			checked := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				h.checkAllowedIP(next, auth.GetPrincipal(r.Context()).Tenant).ServeHTTP(w, r)
+			})
+			h.APIKeys.RequireAPIKey(enum.API_KEY_SCOPE_EMAIL_INGEST)(checked).ServeHTTP(w, r)
+			if !reached {
+				logWebhookRejection(r, "no signature and no valid EmailIngest API key")
+			}
+			return
+		}
+
+		tenant := r.Header.Get(webhookTenantHeader)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logWebhookRejection(r, "reading the body: "+err.Error())
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if reason := h.verifySignature(tenant, r.Header.Get(webhookTimestampHeader), r.Header.Get(webhookSignatureHeader), body); reason != "" {
+			logWebhookRejection(r, reason)
+			http.Error(w, "Unauthorized: Invalid webhook signature", http.StatusUnauthorized)
+			return
+		}
+		ctx := auth.WithPrincipal(r.Context(), auth.Principal{Tenant: tenant})
+		h.checkAllowedIP(next, tenant).ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verifySignature is why the signature of body is refused, or empty if it is valid for one of the tenant's secrets
+// and was made within the tolerance of now, so that it cannot be replayed later.
+func (h *EmailWebhook) verifySignature(tenant string, timestamp string, signature string, body []byte) string {
+	secrets := h.secrets[tenant]
+	if len(secrets) == 0 {
+		return fmt.Sprintf("no webhook secret for tenant %q", tenant)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "invalid timestamp"
+	}
+	if skew := h.now().Sub(time.Unix(unix, 0)); skew > h.tolerance || skew < -h.tolerance {
+		return fmt.Sprintf("timestamp is %s off", skew.Round(time.Second))
+	}
+	sent, err := hex.DecodeString(strings.TrimPrefix(signature, webhookSignaturePrefix))
+	if err != nil || !strings.HasPrefix(signature, webhookSignaturePrefix) {
+		return "malformed signature"
+	}
+	for _, secret := range secrets {
+		if hmac.Equal(sent, webhookSignature(secret, timestamp, body)) {
+			return ""
+		}
+	}
+	return "signature does not match"
+}
+
+func webhookSignature(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// checkAllowedIP only lets through requests from the tenant's allowed addresses, if it has any.
+func (h *EmailWebhook) checkAllowedIP(next http.Handler, tenant string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		networks := h.allowedIPs[tenant]
+		if len(networks) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ip := net.ParseIP(clientIP(r)); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		logWebhookRejection(r, fmt.Sprintf("address not allowed for tenant %q", tenant))
+		http.Error(w, "Forbidden: Address not allowed", http.StatusForbidden)
+	})
+}
+
+func logWebhookRejection(r *http.Request, reason string) {
+	log.Printf("Rejected email webhook from %s: %s", clientIP(r), reason)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailWebhook(t *testing.T) {
+	apiKeys := database.NewMemoryCollection[database.APIKey, database.APIKeyResponse]()
+	key, hash, err := auth.GenerateAPIKey(config.CUSTOMERA)
+	require.NoError(t, err)
+	_, err = apiKeys.Create(context.Background(), database.APIKey{Tenant: config.CUSTOMERA, Hash: hash, Scopes: []enum.APIKeyScope{enum.API_KEY_SCOPE_EMAIL_INGEST}, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	webhook, err := NewEmailWebhook(config.EmailWebhook{
+		EmailWebhookSecrets:    []string{config.CUSTOMERA + ":old-secret", config.CUSTOMERA + ":new-secret", config.CUSTOMERB + ":other-secret"},
+		EmailWebhookAllowedIPs: []string{config.CUSTOMERB + ":10.1.0.0/16", config.CUSTOMERB + ":192.0.2.7"},
+		EmailWebhookTolerance:  5 * time.Minute,
+	}, NewAPIKeyHandler(apiKeys))
+	require.NoError(t, err)
+	handler := webhook.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, map[string]string{"tenant": auth.GetPrincipal(r.Context()).Tenant})
+	}))
+
+	body := `{"to_email_address": "ops@customera.com"}`
+	send := func(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/master_email_messages", bytes.NewBufferString(body))
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	signed := func(tenant string, secret string, at time.Time) map[string]string {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		return map[string]string{
+			webhookTenantHeader:    tenant,
+			webhookTimestampHeader: timestamp,
+			webhookSignatureHeader: webhookSignaturePrefix + hex.EncodeToString(webhookSignature([]byte(secret), timestamp, []byte(body))),
+		}
+	}
+
+	w := send("203.0.113.1:1234", signed(config.CUSTOMERA, "new-secret", time.Now()))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"tenant": "`+config.CUSTOMERA+`"}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, send("203.0.113.1:1234", signed(config.CUSTOMERA, "old-secret", time.Now())).Code, "both secrets work while rotating")
+
+	// forged, replayed and unsigned requests are refused
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", signed(config.CUSTOMERA, "guessed", time.Now())).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", signed(config.CUSTOMERA, "other-secret", time.Now())).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", signed(config.CUSTOMERA, "new-secret", time.Now().Add(-10*time.Minute))).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", signed("unknown", "new-secret", time.Now())).Code)
+	tampered := signed(config.CUSTOMERA, "new-secret", time.Now())
+	tampered[webhookTimestampHeader] = strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10)
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", tampered).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.1:1234", nil).Code)
+
+	// an API key works instead of a signature
+	assert.Equal(t, http.StatusOK, send("203.0.113.1:1234", map[string]string{"Authorization": "Bearer " + key}).Code)
+
+	// a tenant with an allow-list only takes emails from its addresses
+	assert.Equal(t, http.StatusForbidden, send("203.0.113.1:1234", signed(config.CUSTOMERB, "other-secret", time.Now())).Code)
+	assert.Equal(t, http.StatusOK, send("10.1.2.3:1234", signed(config.CUSTOMERB, "other-secret", time.Now())).Code)
+	assert.Equal(t, http.StatusOK, send("192.0.2.7:1234", signed(config.CUSTOMERB, "other-secret", time.Now())).Code)
+
+	_, err = NewEmailWebhook(config.EmailWebhook{EmailWebhookAllowedIPs: []string{config.CUSTOMERA + ":not-an-ip"}}, nil)
+	assert.Error(t, err)
+}
@@ -23,7 +23,11 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 var (
 	ErrNotFound            = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
 	ErrBadRequest          = &ErrResponse{HTTPStatusCode: 400, StatusText: "Bad request. Please check your input fields."}
+	ErrForbidden           = &ErrResponse{HTTPStatusCode: 403, StatusText: "Forbidden."}
 	ErrInternalServerError = &ErrResponse{HTTPStatusCode: 500, StatusText: "Internal Server Error"}
+
+	ErrPreconditionFailed   = &ErrResponse{HTTPStatusCode: 412, StatusText: "Precondition failed.", ErrorText: "the resource was changed since it was read, fetch it again and retry"}
+	ErrPreconditionRequired = &ErrResponse{HTTPStatusCode: 428, StatusText: "Precondition required.", ErrorText: "send the ETag of the resource in the If-Match header"}
 )
 
 func ErrInvalidRequest(err error) render.Renderer {
@@ -35,6 +39,16 @@ func ErrInvalidRequest(err error) render.Renderer {
 	}
 }
 
+// ErrConflict reports a request that conflicts with the state of what it changes.
+func ErrConflict(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Conflict.",
+		ErrorText:      err.Error(),
+	}
+}
+
 func ErrDuplicate(err error) render.Renderer {
 	return &ErrResponse{
 		Err:            err,
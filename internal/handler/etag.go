@@ -0,0 +1,42 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+)
+
+// setETag sends the version of the resource, which the client sends back in If-Match to update it.
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// ifMatchContext returns the request's ctx, set to only update the version named in its If-Match header.
+// "*" updates whatever version is stored. Without the header, or with one that is not a strong ETag of ours,
+// the error has been rendered and ok is false. Weak ETags (W/"1") never match, as If-Match compares strongly.
+func ifMatchContext(w http.ResponseWriter, r *http.Request) (ctx context.Context, ok bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		render.Render(w, r, ErrPreconditionRequired)
+		return nil, false
+	}
+	if ifMatch == "*" {
+		return r.Context(), true
+	}
+
+	tag, err := strconv.Unquote(ifMatch)
+	if err != nil {
+		render.Render(w, r, ErrPreconditionFailed)
+		return nil, false
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrPreconditionFailed)
+		return nil, false
+	}
+	return database.WithExpectedVersion(r.Context(), version), true
+}
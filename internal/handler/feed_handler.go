@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"backend-crm/internal/clients"
 	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/nlp"
@@ -9,9 +8,10 @@ import (
 	"backend-crm/pkg/core"
 	"backend-crm/pkg/enum"
 	"backend-crm/pkg/external/openai"
-	"backend-crm/pkg/utils"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -26,17 +26,38 @@ type FeedHandler struct {
 	FeedEmailCollection database.Collection[database.FeedEmail, database.FeedEmailResponse]
 	ShipmentCollection  database.Collection[database.Shipment, database.ShipmentResponse]
 	ChecklistCollection database.Collection[database.Checklist, database.ChecklistResponse]
+
+	ChecklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse]
+	// InvoicePricingCollection holds the FDAs that items delivered by email are costed on
+	InvoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse]
+	// CrewChangeCollection holds the crew rosters that crew signing on and off by email are added to
+	CrewChangeCollection database.Collection[database.CrewChange, database.CrewChangeResponse]
+
+	// UnitOfWork keeps the writes for one email together, see CreateFeedMessage
+	UnitOfWork *database.UnitOfWork
+	// LLM reads the emails, within the tenant's budget
+	LLM *LLMMeter
 }
 
 func NewFeedHandler(
 	feedEmailCollection database.Collection[database.FeedEmail, database.FeedEmailResponse],
 	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
 	checklistCollection database.Collection[database.Checklist, database.ChecklistResponse],
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
+	crewChangeCollection database.Collection[database.CrewChange, database.CrewChangeResponse],
+	unitOfWork *database.UnitOfWork,
+	llm *LLMMeter,
 ) *FeedHandler {
 	return &FeedHandler{
-		FeedEmailCollection: feedEmailCollection,
-		ShipmentCollection:  shipmentCollection,
-		ChecklistCollection: checklistCollection,
+		FeedEmailCollection:         feedEmailCollection,
+		ShipmentCollection:          shipmentCollection,
+		ChecklistCollection:         checklistCollection,
+		ChecklistTemplateCollection: checklistTemplateCollection,
+		InvoicePricingCollection:    invoicePricingCollection,
+		CrewChangeCollection:        crewChangeCollection,
+		UnitOfWork:                  unitOfWork,
+		LLM:                         llm,
 	}
 }
 
@@ -45,8 +66,7 @@ type getAllFeedEmailsResponse struct {
 }
 
 func (h *FeedHandler) GetAllFeedEmails(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	var feedEmailsList []database.FeedEmailResponse
 
 	feedEmailsList, err := h.FeedEmailCollection.GetAll(r.Context(), tenant)
@@ -65,6 +85,7 @@ func (h *FeedHandler) GetAllFeedEmails(w http.ResponseWriter, r *http.Request) {
 	for _, feedEmail := range feedEmailsList {
 		feedEmails = append(feedEmails, database.FeedEmailResponse{
 			ID:               feedEmail.ID,
+			Version:          feedEmail.Version,
 			Tenant:           feedEmail.Tenant,
 			MasterEmail:      feedEmail.MasterEmail,
 			ReceivedDateTime: feedEmail.ReceivedDateTime,
@@ -72,6 +93,8 @@ func (h *FeedHandler) GetAllFeedEmails(w http.ResponseWriter, r *http.Request) {
 			Subject:          feedEmail.Subject,
 			BodyContent:      feedEmail.BodyContent,
 			ShipmentId:       feedEmail.ShipmentId,
+			ReviewStatus:     feedEmail.ReviewStatus,
+			MatchCandidates:  feedEmail.MatchCandidates,
 		})
 	}
 
@@ -81,8 +104,7 @@ func (h *FeedHandler) GetAllFeedEmails(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *FeedHandler) GetFeedEmailsByMasterEmail(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	masterEmail := r.URL.Query().Get("master_email")
 	var feedEmailsList []database.FeedEmailResponse
 
@@ -103,6 +125,7 @@ func (h *FeedHandler) GetFeedEmailsByMasterEmail(w http.ResponseWriter, r *http.
 	for _, feedEmail := range feedEmailsList {
 		feedEmails = append(feedEmails, database.FeedEmailResponse{
 			ID:               feedEmail.ID,
+			Version:          feedEmail.Version,
 			Tenant:           feedEmail.Tenant,
 			MasterEmail:      feedEmail.MasterEmail,
 			ReceivedDateTime: feedEmail.ReceivedDateTime,
@@ -110,6 +133,8 @@ func (h *FeedHandler) GetFeedEmailsByMasterEmail(w http.ResponseWriter, r *http.
 			Subject:          feedEmail.Subject,
 			BodyContent:      feedEmail.BodyContent,
 			ShipmentId:       feedEmail.ShipmentId,
+			ReviewStatus:     feedEmail.ReviewStatus,
+			MatchCandidates:  feedEmail.MatchCandidates,
 		})
 	}
 
@@ -119,8 +144,7 @@ func (h *FeedHandler) GetFeedEmailsByMasterEmail(w http.ResponseWriter, r *http.
 }
 
 func (h *FeedHandler) GetFeedEmailsByShipmentId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	shipmentId := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved shipment ID from URL: %s", shipmentId) // Confirm shipmentId retrieval
 	var feedEmailsList []database.FeedEmailResponse
@@ -142,6 +166,7 @@ func (h *FeedHandler) GetFeedEmailsByShipmentId(w http.ResponseWriter, r *http.R
 	for _, feedEmail := range feedEmailsList {
 		feedEmails = append(feedEmails, database.FeedEmailResponse{
 			ID:               feedEmail.ID,
+			Version:          feedEmail.Version,
 			Tenant:           feedEmail.Tenant,
 			MasterEmail:      feedEmail.MasterEmail,
 			ReceivedDateTime: feedEmail.ReceivedDateTime,
@@ -149,6 +174,8 @@ func (h *FeedHandler) GetFeedEmailsByShipmentId(w http.ResponseWriter, r *http.R
 			Subject:          feedEmail.Subject,
 			BodyContent:      feedEmail.BodyContent,
 			ShipmentId:       feedEmail.ShipmentId,
+			ReviewStatus:     feedEmail.ReviewStatus,
+			MatchCandidates:  feedEmail.MatchCandidates,
 		})
 	}
 
@@ -167,8 +194,37 @@ func (h *FeedHandler) CreateFeedMessage(w http.ResponseWriter, r *http.Request)
 	}
 	// Get tenant directly from the "to_email_address"
 	tenant := config.MakeMapping(createFeedEmailParams.ToEmailAddress)
+	// the forwarder only forwards emails to the tenant it authenticated as, see EmailWebhook
+	if auth.GetPrincipal(r.Context()).Tenant != tenant {
+		logWebhookRejection(r, fmt.Sprintf("email to %s is not for the tenant it authenticated as", createFeedEmailParams.ToEmailAddress))
+		render.Render(w, r, ErrForbidden)
+		return
+	}
 	createFeedEmailParams.Tenant = tenant
+	// The master who sent the email is who its changes are made by
+	r = r.WithContext(database.WithActor(r.Context(), createFeedEmailParams.MasterEmail))
 
+	// past its hard budget the tenant's emails are not read by the LLM, an operator links them to their shipment instead
+	overBudget, err := h.LLM.OverBudget(r.Context(), tenant)
+	if err != nil {
+		log.Println("Error checking the LLM budget:", err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if overBudget {
+		result, err := h.matchShipment(r.Context(), createFeedEmailParams, tenant)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		if err := h.sendToReview(w, r, createFeedEmailParams, result); err != nil {
+			return
+		}
+		render.Render(w, r, SuccessCreated)
+		return
+	}
+
+	// the response has been rendered when there is an error
 	updated, err := h.updateChecklistBasedOnEmailContent(w, r, createFeedEmailParams, tenant)
 	if err != nil {
 		log.Println(err)
@@ -176,13 +232,9 @@ func (h *FeedHandler) CreateFeedMessage(w http.ResponseWriter, r *http.Request)
 	}
 
 	if !updated {
-		// Get shipmentId according to master email address + status not completed
-		//    - there should only be one shipment+masteremail that is currently in progress
-
-		var shipmentsList []database.ShipmentResponse
-		shipmentsList, err := h.ShipmentCollection.GetAll(r.Context(), tenant)
-		log.Println(shipmentsList)
-
+		// Score the tenant's active shipments against the email instead of trusting the sender alone,
+		// the same master can be on more than one active shipment
+		result, err := h.matchShipment(r.Context(), createFeedEmailParams, tenant)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				render.Render(w, r, ErrNotFound)
@@ -191,30 +243,25 @@ func (h *FeedHandler) CreateFeedMessage(w http.ResponseWriter, r *http.Request)
 			}
 			return
 		}
-		for _, shipment := range shipmentsList {
-			if shipment.MasterEmail == createFeedEmailParams.MasterEmail && (shipment.CurrentStatus != enum.SHIPMENT_STATUS_COSP && shipment.CurrentStatus != enum.SHIPMENT_STATUS_ACTIVITY_COMPLETED) {
-				createFeedEmailParams.ShipmentId = shipment.ID
+		if result.Ambiguous {
+			if err := h.sendToReview(w, r, createFeedEmailParams, result); err != nil {
+				return
 			}
+			render.Render(w, r, SuccessCreated)
+			return
+		}
+		if result.Best != nil {
+			createFeedEmailParams.ShipmentId = result.Best.ShipmentID
 		}
 
 		log.Println(createFeedEmailParams)
 		if createFeedEmailParams.ShipmentId == "" {
 			// if no corresponding shipment meeting criteria, just skip
 			// WIP 2 Aug 2024 - need to add a whatsapp reminder to the team lead to create shipment
+			feedEmails.Inc(tenant, FEED_EMAIL_UNMATCHED)
 			render.Render(w, r, SuccessCreated)
 			return
 		} else {
-			_, err = h.FeedEmailCollection.Create(r.Context(), createFeedEmailParams)
-			if err != nil {
-				if errors.Is(err, database.ErrDuplicateKey) {
-					render.Render(w, r, ErrDuplicate(err))
-					return
-				}
-				render.Render(w, r, ErrInternalServerError)
-				return
-			}
-
-			// now we update the shipment collection
 			currentShipmentResponse, invalid := h.ShipmentCollection.GetByID(r.Context(), createFeedEmailParams.ShipmentId, tenant)
 			if invalid != nil {
 				if invalid == mongo.ErrNoDocuments {
@@ -225,79 +272,31 @@ func (h *FeedHandler) CreateFeedMessage(w http.ResponseWriter, r *http.Request)
 				return
 			}
 
-			// get the ETA and status from Master Email Content
-
-			_, newStatus := nlp.TranslateMasterEmailContentToStatusUpdate(createFeedEmailParams.Subject, createFeedEmailParams.BodyContent, currentShipmentResponse)
-			// use OpenAI to extract ETA
-			ETAPrompt := nlp.GetETAFromMasterEmailOpenAIPrompt()
-
-			// check openAI if the email contains any information that should update the checklist
-			parsedETA, invalid := clients.OpenAIClient.ExtractEntityFromText(openai.OpenAIRequest{
-				Model: "gpt-4o-mini",
-				Messages: []openai.Message{
-					{
-						Role:    "user",
-						Content: createFeedEmailParams.BodyContent + ETAPrompt,
-					},
-				},
-			})
-
+			// the status from the wording of the email, the ETA as read by the LLM
+			newShipment, invalid := h.shipmentFromEmail(r.Context(), createFeedEmailParams, tenant, currentShipmentResponse, true, time.Now())
 			if invalid != nil {
+				// nothing has been written yet, so the sender can safely retry the email
 				log.Println(invalid)
+				render.Render(w, r, ErrInternalServerError)
 				return
 			}
 
-			log.Println("openai", parsedETA)
-
-			systemTimeNow := time.Now()
-			systemTimeNowLocation := systemTimeNow.Location()
-			// Check if the location is not "Local"
-			if systemTimeNowLocation.String() != "Local" {
-				// Define a fixed time zone with +8 hours offset from UTC
-				systemTimeNowLocation = time.FixedZone("UTC+8", 8*60*60)
-
-			}
-			// Define the time format that matches the ETAPrompt
-			layout := "02 Jan 2006 15:04"
-			// Parse the ETAPrompt string into a time.Time object
-			newETA, err := time.ParseInLocation(layout, parsedETA, systemTimeNowLocation)
-
-			log.Println(newETA, "prasedTime")
-			if err != nil {
-				log.Println("Error parsing ETA:", err)
-				return
-			}
-			log.Println("Parsed Time (UTC+8):", newETA)
-
-			// Convert the parsed time to the specified time zone
-			// newETA := parsedTime.In(systemTimeNowLocation)
-
-			// log.Println(newETA, "eta from chatgpt")
-			log.Println(currentShipmentResponse.CreatedAt, "CREATEDAT")
-			newShipment := database.Shipment{
-				Tenant:               currentShipmentResponse.Tenant,
-				MasterEmail:          currentShipmentResponse.MasterEmail,
-				InitialETA:           currentShipmentResponse.InitialETA,
-				CurrentETA:           newETA,
-				VoyageNumber:         currentShipmentResponse.VoyageNumber,
-				CurrentStatus:        newStatus,
-				ShipmentDetails:      currentShipmentResponse.ShipmentDetails,
-				VesselSpecifications: currentShipmentResponse.VesselSpecifications,
-				ShipmentType:         currentShipmentResponse.ShipmentType,
-				CreatedAt:            currentShipmentResponse.CreatedAt,
-				UpdatedAt:            time.Now(),
-			}
-
-			invalid = h.ShipmentCollection.Update(r.Context(), createFeedEmailParams.ShipmentId, newShipment)
-			if invalid != nil {
-				if invalid == mongo.ErrNoDocuments {
-					render.Render(w, r, ErrNotFound)
-				} else {
-					render.Render(w, r, ErrInternalServerError)
+			// the feed record and the shipment update are stored together or not at all
+			err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+				if _, err := h.FeedEmailCollection.Create(ctx, createFeedEmailParams); err != nil {
+					return err
 				}
+				// an operator editing the shipment meanwhile wins, the sender retries the email
+				ctx = database.WithExpectedVersion(ctx, currentShipmentResponse.Version)
+				return h.ShipmentCollection.Update(ctx, createFeedEmailParams.ShipmentId, tenant, newShipment)
+			})
+			if err != nil {
+				log.Println("Error storing master email:", err)
+				renderFeedWriteError(w, r, err)
 				return
 			}
 			log.Println("shipment updated success after master email")
+			feedEmails.Inc(tenant, FEED_EMAIL_MATCHED)
 		}
 	}
 
@@ -308,225 +307,462 @@ func (h *FeedHandler) CreateFeedMessage(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *FeedHandler) updateChecklistBasedOnEmailContent(w http.ResponseWriter, r *http.Request, createFeedEmailParams database.FeedEmail, tenant string) (bool, error) {
-	prompt := nlp.GetIntentionsFromChecklistOpenAIPrompt()
+	// the email is not matched to a shipment yet
+	data, err := h.emailIntention(r.Context(), createFeedEmailParams, tenant, "")
+	if err != nil {
+		// nothing has been written yet, so the sender can safely retry the email
+		render.Render(w, r, ErrInternalServerError)
+		return false, err
+	}
+
+	if data != nil {
+		// Find the shipment the email is about from its IMO number, call sign, voyage, vessel name and ETA
+		result, err := h.matchShipment(r.Context(), createFeedEmailParams, tenant)
+		if err != nil {
+			log.Println("Error getting shipments:", err)
+			render.Render(w, r, ErrInternalServerError)
+			return false, err
+		}
+
+		if result.Ambiguous {
+			if err := h.sendToReview(w, r, createFeedEmailParams, result); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+
+		if result.Best == nil {
+			log.Println("No matching shipment found")
+			render.Render(w, r, ErrNotFound)
+			return false, errors.New("no shipment matches the email")
+		}
+		checklistShipmentID := result.Best.ShipmentID
+
+		apply, err := h.intentionWrites(r.Context(), checklistShipmentID, tenant, data)
+		if err != nil {
+			log.Println("Error reading the shipment the email is about:", err)
+			renderFeedWriteError(w, r, err)
+			return false, err
+		}
+		// appends the email in feed as well
+		createFeedEmailParams.ShipmentId = checklistShipmentID
+
+		// the email's changes and the feed record are stored together or not at all
+		err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+			if err := apply(ctx); err != nil {
+				return err
+			}
+			_, err := h.FeedEmailCollection.Create(ctx, createFeedEmailParams)
+			return err
+		})
+		if err != nil {
+			log.Println("Error storing the changes of an email:", err)
+			renderFeedWriteError(w, r, err)
+			return false, err
+		}
+		log.Println("checklist updated success after parsedIntention")
+		log.Println("feed updated success after parsedIntention")
+		feedEmails.Inc(tenant, FEED_EMAIL_MATCHED)
+
+		return true, nil
+	}
+	log.Println("detected intention not found, hence moving on")
+	return false, nil
+}
+
+// emailIntention asks the LLM which of the tenant's checklist items the email says were provided, or which crew
+// it signs on and off, for the shipment with shipmentID if it is known yet. It is nil when the email says neither.
+func (h *FeedHandler) emailIntention(ctx context.Context, email database.FeedEmail, tenant string, shipmentID string) ([]interface{}, error) {
+	templateItems, err := checklistTemplateItemsForTenant(ctx, h.ChecklistTemplateCollection, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("getting checklist templates: %w", err)
+	}
+	prompt := nlp.GetIntentionsFromChecklistOpenAIPrompt(templateItems)
 
 	// check openAI if the email contains any information that should update the checklist
-	parsedIntention, invalid := clients.OpenAIClient.ExtractEntityFromText(openai.OpenAIRequest{
+	parsedIntention, err := h.LLM.Extract(ctx, tenant, shipmentID, enum.LLM_PURPOSE_INTENTION, openai.OpenAIRequest{
 		Model: "gpt-4o-mini",
 		Messages: []openai.Message{
 			{
 				Role:    "user",
-				Content: createFeedEmailParams.BodyContent + prompt,
+				Content: email.BodyContent + prompt,
 			},
 		},
 	})
-
-	if invalid != nil {
-		log.Println(invalid)
-		return false, invalid
+	if err != nil {
+		return nil, err
 	}
 
 	log.Println("openai", parsedIntention)
 
 	var data []interface{}
-	err := json.Unmarshal([]byte(parsedIntention), &data)
+	err = json.Unmarshal([]byte(parsedIntention), &data)
 	if err != nil {
-		log.Println("Error unmarshalling JSON: %v", err)
+		log.Printf("Error unmarshalling JSON: %v", err)
 	}
+	if len(data) == 0 || data[0] == "intention not found" {
+		return nil, nil
+	}
+	return data, nil
+}
 
-	if data[0] != "intention not found" {
-		var shipmentsList []database.ShipmentResponse
-		var checklistShipmentID string
+// intentionWrites returns the writes that apply the intention of an email, see emailIntention, to the shipment with
+// shipmentID: crew signing on and off are added to its crew roster, services provided are delivered on its checklist.
+// It fails with mongo.ErrNoDocuments if the shipment has no checklist to deliver the services on.
+func (h *FeedHandler) intentionWrites(ctx context.Context, shipmentID string, tenant string, data []interface{}) (func(ctx context.Context) error, error) {
+	if data[0] == core.CREW_CHANGE_INTENTION {
+		signOn, signOff, ok := crewChangeIntention(data)
+		if !ok {
+			log.Println("Invalid crew change data format", data)
+			return func(ctx context.Context) error { return nil }, nil
+		}
+		return func(ctx context.Context) error {
+			return h.addCrewFromEmail(ctx, shipmentID, tenant, signOn, signOff)
+		}, nil
+	}
 
-		// Find matching shipment based on vessel name in email subject
-		shipmentsList, err := h.ShipmentCollection.GetAll(r.Context(), tenant)
-		if err != nil {
-			log.Println("Error getting shipments:", err)
-			render.Render(w, r, ErrInternalServerError)
-			return false, invalid
+	current, err := h.ChecklistCollection.GetByKeyValue(ctx, "shipmentid", shipmentID, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("checklist of shipment %s: %w", shipmentID, err)
+	}
+	updatedChecklist, delivered := checklistWithIntention(current, data, time.Now())
+	return func(ctx context.Context) error {
+		err := h.ChecklistCollection.Update(database.WithExpectedVersion(ctx, current.Version), current.ID, tenant, updatedChecklist)
+		if err != nil || !delivered {
+			return err
 		}
-		for _, shipment := range shipmentsList {
+		return syncFDACosts(ctx, h.InvoicePricingCollection, shipmentID, tenant, updatedChecklist.Items)
+	}, nil
+}
 
-			normalizedSubject := utils.NormalizeString(createFeedEmailParams.Subject)
-			normalizedVesselName := utils.NormalizeString(shipment.VesselSpecifications.VesselName)
-			log.Println("enter")
-			if strings.Contains(normalizedSubject, normalizedVesselName) &&
-				(shipment.CurrentStatus != enum.SHIPMENT_STATUS_COSP && shipment.CurrentStatus != enum.SHIPMENT_STATUS_ACTIVITY_COMPLETED) {
-				log.Println("enter2")
+// crewChangeIntention is the names of the crew signing on and off in a crew change intention,
+// [core.CREW_CHANGE_INTENTION, [sign on names], [sign off names]].
+func crewChangeIntention(data []interface{}) ([]string, []string, bool) {
+	if len(data) != 3 {
+		return nil, nil, false
+	}
+	names := func(value interface{}) ([]string, bool) {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		var names []string
+		for _, name := range list {
+			if name, ok := name.(string); ok && name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, true
+	}
+	signOn, ok := names(data[1])
+	if !ok {
+		return nil, nil, false
+	}
+	signOff, ok := names(data[2])
+	if !ok {
+		return nil, nil, false
+	}
+	return signOn, signOff, true
+}
 
-				checklistShipmentID = shipment.ID
-				break
+// addCrewFromEmail adds the crew an email signs on and off to the shipment's crew roster, creating it on first use,
+// and mirrors the roster onto the checklist, as UpsertCrewChange does. Crew already on the roster are left as they are.
+func (h *FeedHandler) addCrewFromEmail(ctx context.Context, shipmentID string, tenant string, signOn []string, signOff []string) error {
+	existing, err := h.CrewChangeCollection.GetByKeyValue(ctx, "shipmentid", shipmentID, tenant)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	crewMembers := append([]core.CrewMember(nil), existing.CrewMembers...)
+	add := func(names []string, direction enum.CrewChangeDirection) {
+		for _, name := range names {
+			listed := false
+			for _, member := range crewMembers {
+				if member.Direction == direction && strings.EqualFold(member.Name, name) {
+					listed = true
+				}
+			}
+			if !listed {
+				crewMembers = append(crewMembers, core.CrewMember{Name: name, Direction: direction})
 			}
 		}
+	}
+	add(signOn, enum.CREW_CHANGE_SIGN_ON)
+	add(signOff, enum.CREW_CHANGE_SIGN_OFF)
+	if crewMembers, err = prepareCrewMembers(crewMembers, existing.CrewMembers); err != nil {
+		return err
+	}
 
-		if checklistShipmentID == "" {
-			log.Println("No matching shipment found")
-			render.Render(w, r, ErrNotFound)
-			return false, invalid
+	crewChange := database.CrewChange{
+		Tenant:      tenant,
+		ShipmentID:  shipmentID,
+		CrewMembers: crewMembers,
+		CreatedAt:   existing.CreatedAt,
+	}
+	if existing.ID == "" {
+		_, err = h.CrewChangeCollection.Create(ctx, crewChange)
+	} else {
+		err = h.CrewChangeCollection.Update(database.WithExpectedVersion(ctx, existing.Version), existing.ID, tenant, crewChange)
+	}
+	if err != nil {
+		return err
+	}
+	return syncCrewChecklist(ctx, h.ChecklistCollection, h.InvoicePricingCollection, shipmentID, tenant, crewMembers)
+}
+
+// checklistWithIntention is the checklist with the services an email says were provided delivered, see
+// emailIntention, and whether any were, so that the shipment's FDA must be brought in line. Items are delivered at now.
+func checklistWithIntention(current database.ChecklistResponse, data []interface{}, now time.Time) (database.Checklist, bool) {
+	updatedChecklist := database.Checklist{
+		Items:      current.Items,
+		CrewChange: current.CrewChange,
+		ShipmentID: current.ShipmentID,
+		Tenant:     current.Tenant,
+		CreatedAt:  current.CreatedAt,
+		UpdatedAt:  time.Now(),
+	}
+
+	delivered := false
+	for _, intention := range data {
+		intentionStr, ok := intention.(string)
+		if !ok {
+			log.Println("Error parsing intention")
+			continue
+		}
+		// a service the email says was provided is delivered, as an operator would mark it, if it can be
+		if item := updatedChecklist.Items.Find(intentionStr); item != nil && deliverItem(item, now) {
+			delivered = true
+		}
+	}
+	return updatedChecklist, delivered
+}
+
+// shipmentFromEmail is the shipment as the email updates it: its status from the wording of the email and, when
+// readETA is set, its ETA as read by the LLM. now is used to infer the year of the ETA when the master leaves it out.
+func (h *FeedHandler) shipmentFromEmail(ctx context.Context, email database.FeedEmail, tenant string, current database.ShipmentResponse, readETA bool, now time.Time) (database.Shipment, error) {
+	_, newStatus := nlp.TranslateMasterEmailContentToStatusUpdate(email.Subject, email.BodyContent, current)
+
+	currentETA, currentETAText := current.CurrentETA, current.CurrentETAText
+	if readETA {
+		// use OpenAI to extract ETA
+		ETAPrompt := nlp.GetETAFromMasterEmailOpenAIPrompt()
+		parsedETA, err := h.LLM.Extract(ctx, tenant, current.ID, enum.LLM_PURPOSE_ETA, openai.OpenAIRequest{
+			Model: "gpt-4o-mini",
+			Messages: []openai.Message{
+				{
+					Role:    "user",
+					Content: email.BodyContent + ETAPrompt,
+				},
+			},
+		})
+		if err != nil {
+			return database.Shipment{}, err
+		}
+
+		log.Println("openai", parsedETA)
+
+		// The ETA is stored in UTC; markers such as "LT", "UTC" or "GMT+8" decide which zone it was written in,
+		// anything unmarked is taken to be local to the tenant's port
+		newETA, err := nlp.ParseETA(parsedETA, config.TenantLocation(tenant), now)
+		if err != nil {
+			log.Println("Error parsing ETA, keeping the current ETA:", err)
+		} else {
+			log.Println("Parsed ETA (UTC):", newETA.Time, newETA.Zone)
+			currentETA, currentETAText = newETA.Time, newETA.Text
+		}
+	}
+
+	return database.Shipment{
+		Tenant:               current.Tenant,
+		MasterEmail:          current.MasterEmail,
+		InitialETA:           current.InitialETA,
+		CurrentETA:           currentETA,
+		CurrentETAText:       currentETAText,
+		VoyageNumber:         current.VoyageNumber,
+		CurrentStatus:        newStatus,
+		ShipmentDetails:      current.ShipmentDetails,
+		VesselSpecifications: current.VesselSpecifications,
+		ShipmentType:         current.ShipmentType,
+		CreatedAt:            current.CreatedAt,
+		UpdatedAt:            time.Now(),
+	}, nil
+}
+
+// renderFeedWriteError reports a failed unit of work, after which none of the email's writes are stored.
+func renderFeedWriteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrDuplicateKey):
+		render.Render(w, r, ErrDuplicate(err))
+	case errors.Is(err, mongo.ErrNoDocuments):
+		render.Render(w, r, ErrNotFound)
+	case errors.Is(err, database.ErrVersionConflict):
+		render.Render(w, r, ErrPreconditionFailed)
+	default:
+		render.Render(w, r, ErrInternalServerError)
+	}
+}
+
+// matchShipment scores the tenant's shipments against the email, see nlp.MatchShipments.
+func (h *FeedHandler) matchShipment(ctx context.Context, email database.FeedEmail, tenant string) (nlp.ShipmentMatchResult, error) {
+	shipmentsList, err := h.ShipmentCollection.GetAll(ctx, tenant)
+	if err != nil {
+		return nlp.ShipmentMatchResult{}, err
+	}
+
+	result := nlp.MatchShipments(email, shipmentsList, config.TenantLocation(tenant), time.Now())
+	log.Println("Shipment match candidates:", result.Candidates)
+	return result, nil
+}
+
+// sendToReview stores an email that could belong to more than one shipment, or that was not read by the LLM,
+// without linking it, so that an operator can pick the right shipment from the scored candidates.
+func (h *FeedHandler) sendToReview(w http.ResponseWriter, r *http.Request, email database.FeedEmail, result nlp.ShipmentMatchResult) error {
+	email.ShipmentId = ""
+	email.ReviewStatus = enum.FEED_REVIEW_STATUS_PENDING
+	email.MatchCandidates = result.Candidates
+
+	_, err := h.FeedEmailCollection.Create(r.Context(), email)
+	if err != nil {
+		if errors.Is(err, database.ErrDuplicateKey) {
+			render.Render(w, r, ErrDuplicate(err))
+			return err
 		}
+		render.Render(w, r, ErrInternalServerError)
+		return err
+	}
+	log.Println("master email sent to review")
+	feedEmails.Inc(email.Tenant, FEED_EMAIL_REVIEW)
+	return nil
+}
+
+func (h *FeedHandler) GetFeedEmailsForReview(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 
-		// Get current checklist
-		currentChecklistResponses, err := h.ChecklistCollection.GetAllByKeyValue(r.Context(), "shipmentid", checklistShipmentID, tenant)
-		if err != nil || len(currentChecklistResponses) == 0 {
-			log.Println("Error getting checklist:", err)
+	feedEmailsList, err := h.FeedEmailCollection.GetAllByKeyValue(r.Context(), "reviewstatus", string(enum.FEED_REVIEW_STATUS_PENDING), tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
-			return false, invalid
-		}
-		currentChecklistResponse := currentChecklistResponses[0]
-		log.Println(currentChecklistResponse, "currentChecklistResponse")
-		// var updatedChecklist database.Checklist
-
-		updatedChecklist := database.Checklist{
-			PortDues:         currentChecklistResponse.PortDues,
-			Pilotage:         currentChecklistResponse.Pilotage,
-			ServiceLaunch:    currentChecklistResponse.ServiceLaunch,
-			Logistics:        currentChecklistResponse.Logistics,
-			HotelCharges:     currentChecklistResponse.HotelCharges,
-			AirTickets:       currentChecklistResponse.AirTickets,
-			TransportCharges: currentChecklistResponse.TransportCharges,
-			MedicineSupplies: currentChecklistResponse.MedicineSupplies,
-			FreshWaterSupply: currentChecklistResponse.FreshWaterSupply,
-			MarineAdvisory:   currentChecklistResponse.MarineAdvisory,
-			CourierServices:  currentChecklistResponse.CourierServices,
-			CrossHarbourFees: currentChecklistResponse.CrossHarbourFees,
-			SupplyBoat:       currentChecklistResponse.SupplyBoat,
-			Repairs:          currentChecklistResponse.Repairs,
-			Extras:           currentChecklistResponse.Extras,
-			CrewChange:       currentChecklistResponse.CrewChange,
-			ShipmentID:       currentChecklistResponse.ShipmentID,
-			Tenant:           currentChecklistResponse.Tenant,
-			CreatedAt:        currentChecklistResponse.CreatedAt,
-			UpdatedAt:        time.Now(),
-		}
-
-		if len(data) > 0 {
-			switch data[0] {
-			case "crew_change":
-				if len(data) == 3 { // must be 3
-					log.Println(data, "data")
-					signOn, ok := data[1].([]interface{})
-					if !ok {
-						log.Println("Error parsing sign on data")
-					}
-
-					signOff, ok := data[2].([]interface{})
-					if !ok {
-						log.Println("Error parsing sign off data")
-					}
-
-					var signOnList []string
-					for _, name := range signOn {
-						signOnList = append(signOnList, name.(string))
-					}
-
-					var signOffList []string
-					for _, name := range signOff {
-						signOffList = append(signOffList, name.(string))
-					}
-
-					updatedChecklist.CrewChange = core.CrewChange{
-						SignOn:  signOnList,
-						SignOff: signOffList,
-					}
-				} else {
-					log.Println("Invalid crew change data format")
-				}
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
 
-			default:
-				intentionsList := data
-
-				for _, intention := range intentionsList {
-					intentionStr, ok := intention.(string)
-					if !ok {
-						log.Println("Error parsing intention")
-					}
-
-					// Set the service provided flag based on intention
-					switch intentionStr {
-					case "logistics":
-						if !updatedChecklist.Logistics.ChecklistInformation.ServiceProvided {
-							updatedChecklist.Logistics.ChecklistInformation.ServiceProvided = true
-						}
-					case "hotel_charges":
-						if !updatedChecklist.Logistics.ChecklistInformation.ServiceProvided {
-							updatedChecklist.Logistics.ChecklistInformation.ServiceProvided = true
-						}
-					case "air_tickets":
-						if !updatedChecklist.AirTickets.ChecklistInformation.ServiceProvided {
-							updatedChecklist.AirTickets.ChecklistInformation.ServiceProvided = true
-						}
-					case "transport_charges":
-						if !updatedChecklist.TransportCharges.ChecklistInformation.ServiceProvided {
-							updatedChecklist.TransportCharges.ChecklistInformation.ServiceProvided = true
-						}
-					case "medicine_supplies":
-						if !updatedChecklist.MedicineSupplies.ChecklistInformation.ServiceProvided {
-							updatedChecklist.MedicineSupplies.ChecklistInformation.ServiceProvided = true
-						}
-					case "fresh_water_supply":
-						if !updatedChecklist.FreshWaterSupply.ChecklistInformation.ServiceProvided {
-							updatedChecklist.FreshWaterSupply.ChecklistInformation.ServiceProvided = true
-						}
-					case "marine_advisory":
-						if !updatedChecklist.MarineAdvisory.ChecklistInformation.ServiceProvided {
-							updatedChecklist.MarineAdvisory.ChecklistInformation.ServiceProvided = true
-						}
-					case "courier_services":
-						if !updatedChecklist.CourierServices.ChecklistInformation.ServiceProvided {
-							updatedChecklist.CourierServices.ChecklistInformation.ServiceProvided = true
-						}
-					case "cross_harbour_fees":
-						if !updatedChecklist.CrossHarbourFees.ChecklistInformation.ServiceProvided {
-							updatedChecklist.CrossHarbourFees.ChecklistInformation.ServiceProvided = true
-						}
-					case "supply_boat":
-						if !updatedChecklist.SupplyBoat.ChecklistInformation.ServiceProvided {
-							updatedChecklist.SupplyBoat.ChecklistInformation.ServiceProvided = true
-						}
-					case "deslopping":
-						if !updatedChecklist.Repairs.Deslopping.ChecklistInformation.ServiceProvided {
-							updatedChecklist.Repairs.Deslopping.ChecklistInformation.ServiceProvided = true
-						}
-					case "uw_clean":
-						if !updatedChecklist.Repairs.UWClean.ChecklistInformation.ServiceProvided {
-							updatedChecklist.Repairs.UWClean.ChecklistInformation.ServiceProvided = true
-						}
-					case "lift_repair":
-						if !updatedChecklist.Repairs.LiftRepair.ChecklistInformation.ServiceProvided {
-							updatedChecklist.Repairs.LiftRepair.ChecklistInformation.ServiceProvided = true
-						}
-					}
-				}
-			}
+	response := getAllFeedEmailsResponse{FeedEmails: feedEmailsList}
+	render.JSON(w, r, response)
+}
+
+type resolveFeedEmailReviewParams struct {
+	ShipmentID string `json:"shipment_id"`
+}
+
+// ResolveFeedEmailReview links an email waiting for review to the shipment chosen by an operator, and applies the
+// email to that shipment as if it had been matched when it arrived: its intention to the shipment's checklist, or
+// else its status and ETA to the shipment. Past the tenant's hard LLM budget the email is not read by the LLM, so only
+// the status is applied.
+func (h *FeedHandler) ResolveFeedEmailReview(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	feedId := chi.URLParam(r, "feed_id")
+
+	var params resolveFeedEmailReviewParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil || params.ShipmentID == "" {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	feedEmail, err := h.FeedEmailCollection.GetByID(r.Context(), feedId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
 		}
-		log.Println(updatedChecklist)
-		invalid = h.ChecklistCollection.Update(r.Context(), currentChecklistResponse.ID, updatedChecklist)
-		if invalid != nil {
-			if invalid == mongo.ErrNoDocuments {
-				render.Render(w, r, ErrNotFound)
-			} else {
-				render.Render(w, r, ErrInternalServerError)
-			}
-			return false, invalid
+		return
+	}
+	// an email is applied to its shipment once, resolving it again would apply it twice
+	if feedEmail.ReviewStatus != enum.FEED_REVIEW_STATUS_PENDING {
+		render.Render(w, r, ErrConflict(fmt.Errorf("the email is not waiting for review, it is %q", feedEmail.ReviewStatus)))
+		return
+	}
+
+	// the shipment must belong to the same tenant
+	currentShipment, err := h.ShipmentCollection.GetByID(r.Context(), params.ShipmentID, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
 		}
-		log.Println("checklist updated success after parsedIntention")
+		return
+	}
 
-		// appends the email in feed as well
-		createFeedEmailParams.ShipmentId = checklistShipmentID
+	resolvedEmail := database.FeedEmail{
+		Tenant:           feedEmail.Tenant,
+		MasterEmail:      feedEmail.MasterEmail,
+		ReceivedDateTime: feedEmail.ReceivedDateTime,
+		ToEmailAddress:   feedEmail.ToEmailAddress,
+		Subject:          feedEmail.Subject,
+		BodyContent:      feedEmail.BodyContent,
+		ShipmentId:       params.ShipmentID,
+		ReviewStatus:     enum.FEED_REVIEW_STATUS_RESOLVED,
+		MatchCandidates:  feedEmail.MatchCandidates,
+	}
 
-		_, err = h.FeedEmailCollection.Create(r.Context(), createFeedEmailParams)
+	overBudget, err := h.LLM.OverBudget(r.Context(), tenant)
+	if err != nil {
+		log.Println("Error checking the LLM budget:", err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	var data []interface{}
+	if !overBudget {
+		data, err = h.emailIntention(r.Context(), resolvedEmail, tenant, params.ShipmentID)
 		if err != nil {
-			if errors.Is(err, database.ErrDuplicateKey) {
-				render.Render(w, r, ErrDuplicate(err))
-				return false, err
-			}
+			log.Println(err)
 			render.Render(w, r, ErrInternalServerError)
-			return false, err
+			return
 		}
-		log.Println("feed updated success after parsedIntention")
+	}
 
-		return true, nil
+	// apply writes the email's changes to the shipment, its checklist or its crew roster
+	var apply func(ctx context.Context) error
+	if data != nil {
+		apply, err = h.intentionWrites(r.Context(), params.ShipmentID, tenant, data)
+		if err != nil {
+			log.Println("Error reading the shipment the email is about:", err)
+			renderFeedWriteError(w, r, err)
+			return
+		}
+	} else {
+		// relative ETAs such as "tomorrow" are relative to when the email was received, not to when it is resolved
+		received := feedEmail.ReceivedDateTime
+		if received.IsZero() {
+			received = time.Now()
+		}
+		newShipment, err := h.shipmentFromEmail(r.Context(), resolvedEmail, tenant, currentShipment, !overBudget, received)
+		if err != nil {
+			log.Println(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+		apply = func(ctx context.Context) error {
+			ctx = database.WithExpectedVersion(ctx, currentShipment.Version)
+			return h.ShipmentCollection.Update(ctx, params.ShipmentID, tenant, newShipment)
+		}
 	}
-	log.Println("detected intention not found, hence moving on")
-	return false, nil
+
+	// the email is resolved and applied together or not at all, an operator resolving it meanwhile wins
+	err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+		if err := h.FeedEmailCollection.Update(database.WithExpectedVersion(ctx, feedEmail.Version), feedEmail.ID, tenant, resolvedEmail); err != nil {
+			return err
+		}
+		return apply(ctx)
+	})
+	if err != nil {
+		log.Println("Error resolving reviewed email:", err)
+		renderFeedWriteError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
 }
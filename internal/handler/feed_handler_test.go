@@ -1,8 +1,15 @@
 package handler
 
 import (
+	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/external/openai"
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -11,6 +18,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockFeedMessageCollection struct {
@@ -42,13 +50,62 @@ func (m *MockFeedMessageCollection) GetByKeyValue(ctx context.Context, key strin
 	return args.Get(0).(database.FeedEmailResponse), args.Error(1)
 }
 
-func (m *MockFeedMessageCollection) Update(ctx context.Context, id string, email database.FeedEmail) error {
-	args := m.Called(ctx, id, email)
+func (m *MockFeedMessageCollection) Update(ctx context.Context, id string, tenant string, email database.FeedEmail) error {
+	args := m.Called(ctx, id, tenant, email)
 	return args.Error(0)
 }
 
-func (m *MockFeedMessageCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockFeedMessageCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockFeedMessageCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+type MockChecklistCollection struct {
+	mock.Mock
+}
+
+func (m *MockChecklistCollection) GetAll(ctx context.Context, tenant string) ([]database.ChecklistResponse, error) {
+	args := m.Called(ctx, tenant)
+	return args.Get(0).([]database.ChecklistResponse), args.Error(1)
+}
+
+func (m *MockChecklistCollection) Create(ctx context.Context, checklist database.Checklist) (string, error) {
+	args := m.Called(ctx, checklist)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockChecklistCollection) GetAllByKeyValue(ctx context.Context, key string, value string, tenant string) ([]database.ChecklistResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).([]database.ChecklistResponse), args.Error(1)
+}
+
+func (m *MockChecklistCollection) GetByID(ctx context.Context, id string, tenant string) (database.ChecklistResponse, error) {
+	args := m.Called(ctx, id, tenant)
+	return args.Get(0).(database.ChecklistResponse), args.Error(1)
+}
+
+func (m *MockChecklistCollection) GetByKeyValue(ctx context.Context, key string, value string, tenant string) (database.ChecklistResponse, error) {
+	args := m.Called(ctx, key, value, tenant)
+	return args.Get(0).(database.ChecklistResponse), args.Error(1)
+}
+
+func (m *MockChecklistCollection) Update(ctx context.Context, id string, tenant string, checklist database.Checklist) error {
+	args := m.Called(ctx, id, tenant, checklist)
+	return args.Error(0)
+}
+
+func (m *MockChecklistCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockChecklistCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
@@ -56,7 +113,8 @@ func TestFeedHandler_GetAllFeedMessages(t *testing.T) {
 	mockFeedCollection := new(MockFeedMessageCollection)
 	mockShipmentCollection := new(MockShipmentCollection)
 	mockChecklistCollection := new(MockChecklistCollection)
-	handler := NewFeedHandler(mockFeedCollection, mockShipmentCollection, mockChecklistCollection)
+	mockChecklistTemplateCollection := new(MockChecklistTemplateCollection)
+	handler := NewFeedHandler(mockFeedCollection, mockShipmentCollection, mockChecklistCollection, mockChecklistTemplateCollection, nil, nil, database.NewUnitOfWork(&fakeTransactor{}), nil)
 
 	r := chi.NewRouter()
 	r.Get("/feed", handler.GetAllFeedEmails)
@@ -126,7 +184,9 @@ func TestFeedHandler_GetAllFeedMessages(t *testing.T) {
 func TestFeedHandler_GetAllFeedMessageByKeyValue(t *testing.T) {
 	mockFeedCollection := new(MockFeedMessageCollection)
 	mockShipmentCollection := new(MockShipmentCollection)
-	handler := NewFeedHandler(mockFeedCollection, mockShipmentCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	mockChecklistTemplateCollection := new(MockChecklistTemplateCollection)
+	handler := NewFeedHandler(mockFeedCollection, mockShipmentCollection, mockChecklistCollection, mockChecklistTemplateCollection, nil, nil, database.NewUnitOfWork(&fakeTransactor{}), nil)
 
 	r := chi.NewRouter()
 	r.Get("/feed/{shipment_id}", handler.GetFeedEmailsByShipmentId)
@@ -156,3 +216,176 @@ func TestFeedHandler_GetAllFeedMessageByKeyValue(t *testing.T) {
 	// assert.Contains(t, w.Body.String(), "customerA")
 	mockFeedCollection.AssertExpectations(t)
 }
+
+func TestFeedHandler_GetFeedEmailsForReview(t *testing.T) {
+	mockFeedCollection := new(MockFeedMessageCollection)
+	mockShipmentCollection := new(MockShipmentCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	mockChecklistTemplateCollection := new(MockChecklistTemplateCollection)
+	handler := NewFeedHandler(mockFeedCollection, mockShipmentCollection, mockChecklistCollection, mockChecklistTemplateCollection, nil, nil, database.NewUnitOfWork(&fakeTransactor{}), nil)
+
+	r := chi.NewRouter()
+	r.Get("/feed/review", handler.GetFeedEmailsForReview)
+
+	mockFeedCollection.On("GetAllByKeyValue", mock.Anything, "reviewstatus", string(enum.FEED_REVIEW_STATUS_PENDING), mock.Anything).Return([]database.FeedEmailResponse{
+		{
+			ID:           "1234",
+			Tenant:       "customerA",
+			MasterEmail:  "yoke@captain.com",
+			Subject:      "Noon report",
+			ReviewStatus: enum.FEED_REVIEW_STATUS_PENDING,
+			MatchCandidates: []core.ShipmentCandidate{
+				{ShipmentID: "abc123", VesselName: "UOG IOANNIS V", Score: 40, Reasons: []string{"master_email"}},
+				{ShipmentID: "def456", VesselName: "UOG IOANNIS", Score: 40, Reasons: []string{"master_email"}},
+			},
+		},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/feed/review", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "def456")
+	mockFeedCollection.AssertExpectations(t)
+}
+
+func TestFeedHandler_ResolveFeedEmailReview(t *testing.T) {
+	ctx := context.Background()
+	feed := database.NewMemoryCollection[database.FeedEmail, database.FeedEmailResponse]()
+	shipments := database.NewMemoryCollection[database.Shipment, database.ShipmentResponse]()
+	checklists := database.NewMemoryCollection[database.Checklist, database.ChecklistResponse]()
+	templates := database.NewMemoryCollection[database.ChecklistTemplate, database.ChecklistTemplateResponse]()
+	meter, err := NewLLMMeter(config.LLMUsage{}, database.NewMemoryCollection[database.LLMUsage, database.LLMUsageResponse](), newFakeLLMSpends(), database.NewMemoryCollection[database.Tenant, database.TenantResponse]())
+	require.NoError(t, err)
+	// the LLM answers the intention prompt, then the ETA prompt
+	var answers []string
+	meter.extract = func(request openai.OpenAIRequest) (string, openai.Usage, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, openai.Usage{}, nil
+	}
+	invoices := database.NewMemoryCollection[database.InvoicePricing, database.InvoicePricingResponse]()
+	crewChanges := database.NewMemoryCollection[database.CrewChange, database.CrewChangeResponse]()
+	transactor := &fakeTransactor{}
+	handler := NewFeedHandler(feed, shipments, checklists, templates, invoices, crewChanges, database.NewUnitOfWork(transactor), meter)
+
+	r := chi.NewRouter()
+	r.Put("/feed/review/{feed_id}", handler.ResolveFeedEmailReview)
+	resolve := func(feedID string, shipmentID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/feed/review/"+feedID, bytes.NewBufferString(`{"shipment_id": "`+shipmentID+`"}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: config.CUSTOMERA}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	pending := func(body string) string {
+		id, err := feed.Create(ctx, database.FeedEmail{
+			Tenant:           config.CUSTOMERA,
+			MasterEmail:      "master@vessel.com",
+			ReceivedDateTime: time.Date(2024, 2, 20, 8, 0, 0, 0, time.UTC),
+			BodyContent:      body,
+			ReviewStatus:     enum.FEED_REVIEW_STATUS_PENDING,
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	shipmentID, err := shipments.Create(ctx, database.Shipment{Tenant: config.CUSTOMERA, MasterEmail: "master@vessel.com"})
+	require.NoError(t, err)
+	portDues := core.NewChecklistItem(core.ChecklistTemplateItem{Key: "port_dues", Name: "Port Dues"})
+	require.NoError(t, portDues.TransitionTo(enum.CHECKLIST_ITEM_STATUS_ORDERED, time.Now()))
+	require.NoError(t, portDues.TransitionTo(enum.CHECKLIST_ITEM_STATUS_CONFIRMED, time.Now()))
+	portDues.Quantity = 1
+	portDues.Cost = &core.ChecklistItemCost{UnitPrice: 1200, Amount: 1200, Currency: "SGD"}
+	pilotage := core.NewChecklistItem(core.ChecklistTemplateItem{Key: "pilotage", Name: "Pilotage"})
+	_, err = checklists.Create(ctx, database.Checklist{Tenant: config.CUSTOMERA, ShipmentID: shipmentID, Items: core.ChecklistItems{portDues, pilotage}})
+	require.NoError(t, err)
+
+	// an email with no intention updates the ETA of the shipment picked
+	etaEmail := pending("ETA 21 Feb 2024 12:00 GMT+8")
+	answers = []string{`["intention not found"]`, "21 Feb 2024 12:00 GMT+8"}
+	assert.Equal(t, http.StatusNotFound, resolve(etaEmail, "0123456789abcdef01234567").Code)
+	assert.Equal(t, http.StatusOK, resolve(etaEmail, shipmentID).Code)
+	shipment, err := shipments.GetByID(ctx, shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 21, 4, 0, 0, 0, time.UTC), shipment.CurrentETA)
+	resolved, err := feed.GetByID(ctx, etaEmail, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, shipmentID, resolved.ShipmentId)
+	assert.Equal(t, enum.FEED_REVIEW_STATUS_RESOLVED, resolved.ReviewStatus)
+	assert.True(t, transactor.committed)
+
+	// it is applied once
+	assert.Equal(t, http.StatusConflict, resolve(etaEmail, shipmentID).Code)
+
+	// an email with an intention delivers the confirmed items of the shipment picked, and puts them on its FDA
+	intentionEmail := pending("Port dues paid, pilot on board")
+	answers = []string{`["port_dues", "pilotage"]`}
+	assert.Equal(t, http.StatusOK, resolve(intentionEmail, shipmentID).Code)
+	checklist, err := checklists.GetAllByKeyValue(ctx, "shipmentid", shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	require.Len(t, checklist, 1)
+	delivered := checklist[0].Items.Find("port_dues")
+	assert.Equal(t, enum.CHECKLIST_ITEM_STATUS_DELIVERED, delivered.Status)
+	assert.True(t, delivered.ServiceProvided)
+	assert.Equal(t, enum.CHECKLIST_ITEM_STATUS_DELIVERED, delivered.StatusHistory[len(delivered.StatusHistory)-1].Status)
+	// an item never ordered cannot have been delivered
+	notOrdered := checklist[0].Items.Find("pilotage")
+	assert.Empty(t, notOrdered.Status)
+	assert.False(t, notOrdered.ServiceProvided)
+	invoice, err := invoices.GetByKeyValue(ctx, "shipmentid", shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	require.Len(t, invoice.FDACosts, 1)
+	assert.Equal(t, "port_dues", invoice.FDACosts[0].ItemKey)
+	assert.Equal(t, 1200.0, invoice.FDACosts[0].Amount)
+	assert.Empty(t, answers)
+
+	// a crew change email adds the crew to the shipment's roster, and the roster is mirrored on the checklist
+	crewEmail := pending("Crew change: BAN CHI TAN signs on, KI AISONG signs off")
+	answers = []string{`["crew_change", ["BAN CHI TAN"], ["KI AISONG"]]`}
+	assert.Equal(t, http.StatusOK, resolve(crewEmail, shipmentID).Code)
+	roster, err := crewChanges.GetByKeyValue(ctx, "shipmentid", shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	require.Len(t, roster.CrewMembers, 2)
+	assert.Equal(t, "BAN CHI TAN", roster.CrewMembers[0].Name)
+	assert.Equal(t, enum.CREW_CHANGE_SIGN_ON, roster.CrewMembers[0].Direction)
+	assert.Equal(t, enum.CREW_CHANGE_STATUS_PENDING, roster.CrewMembers[0].Status)
+	assert.NotEmpty(t, roster.CrewMembers[0].ID)
+	assert.Equal(t, enum.CREW_CHANGE_SIGN_OFF, roster.CrewMembers[1].Direction)
+	checklist, err = checklists.GetAllByKeyValue(ctx, "shipmentid", shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BAN CHI TAN"}, checklist[0].CrewChange.SignOn)
+	assert.Equal(t, []string{"KI AISONG"}, checklist[0].CrewChange.SignOff)
+
+	// crew already on the roster are not added twice
+	again := pending("Reminder: BAN CHI TAN signs on")
+	answers = []string{`["crew_change", ["Ban Chi Tan"], []]`}
+	assert.Equal(t, http.StatusOK, resolve(again, shipmentID).Code)
+	roster, err = crewChanges.GetByKeyValue(ctx, "shipmentid", shipmentID, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Len(t, roster.CrewMembers, 2)
+}
+
+func TestFeedHandler_CreateFeedMessage_LLMFailure(t *testing.T) {
+	feed := database.NewMemoryCollection[database.FeedEmail, database.FeedEmailResponse]()
+	meter, err := NewLLMMeter(config.LLMUsage{}, database.NewMemoryCollection[database.LLMUsage, database.LLMUsageResponse](), newFakeLLMSpends(), database.NewMemoryCollection[database.Tenant, database.TenantResponse]())
+	require.NoError(t, err)
+	meter.extract = func(request openai.OpenAIRequest) (string, openai.Usage, error) {
+		return "", openai.Usage{}, errors.New("the LLM is unavailable")
+	}
+	handler := NewFeedHandler(feed, database.NewMemoryCollection[database.Shipment, database.ShipmentResponse](), database.NewMemoryCollection[database.Checklist, database.ChecklistResponse](),
+		database.NewMemoryCollection[database.ChecklistTemplate, database.ChecklistTemplateResponse](), database.NewMemoryCollection[database.InvoicePricing, database.InvoicePricingResponse](), nil, database.NewUnitOfWork(&fakeTransactor{}), meter)
+
+	req := httptest.NewRequest("POST", "/master_email_messages", bytes.NewBufferString(`{"from_email_address": "master@vessel.com", "to_email_address": "ops@customera.com", "body_content": "ETA 21 Feb 2024 12:00"}`))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Tenant: config.CUSTOMERA}))
+	w := httptest.NewRecorder()
+	handler.CreateFeedMessage(w, req)
+
+	// the email is not stored, so that the forwarder retries it
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	stored, err := feed.GetAll(context.Background(), config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
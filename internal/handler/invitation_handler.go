@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Users join a tenant by invitation only. A tenant admin invites an email, which is sent a signed invitation token;
+// registering with it creates the user, who is sent a verification token and can log in once they have used it.
+
+const (
+	invitationAudience        = "invitation"
+	emailVerificationAudience = "email_verification"
+
+	// emailVerificationTTL is how long a new user has to verify their email
+	emailVerificationTTL = 24 * time.Hour
+	minPasswordLength    = 8
+)
+
+var errInvalidInvitation = errors.New("the invitation is invalid, has expired or has been used")
+
+type InvitationHandler struct {
+	InvitationCollection   database.Collection[database.Invitation, database.InvitationResponse]
+	LoginCollection        database.Collection[database.TenantUser, database.TenantUserResponse]
+	NotificationCollection database.Collection[database.Notification, database.NotificationResponse]
+	UnitOfWork             *database.UnitOfWork
+	InvitationTTL          time.Duration
+}
+
+func NewInvitationHandler(
+	invitationCollection database.Collection[database.Invitation, database.InvitationResponse],
+	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
+	notificationCollection database.Collection[database.Notification, database.NotificationResponse],
+	unitOfWork *database.UnitOfWork,
+	invitationTTL time.Duration,
+) *InvitationHandler {
+	return &InvitationHandler{
+		InvitationCollection:   invitationCollection,
+		LoginCollection:        loginCollection,
+		NotificationCollection: notificationCollection,
+		UnitOfWork:             unitOfWork,
+		InvitationTTL:          invitationTTL,
+	}
+}
+
+type createInvitationRequest struct {
+	Email string        `json:"email"`
+	Role  enum.UserRole `json:"role"`
+}
+
+type registerRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// CreateInvitation invites an email of one of the tenant's domains to register, as a member unless another role is given.
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	inviter := auth.GetEmailFromToken(r.Context())
+	tenant := config.MakeMapping(inviter)
+
+	var params createInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(params.Email))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		render.Render(w, r, ErrInvalidRequest(errors.New("email must be an email address")))
+		return
+	}
+	if params.Role == "" {
+		params.Role = enum.USER_ROLE_MEMBER
+	}
+	if !enum.IsValidUserRole(params.Role) {
+		render.Render(w, r, ErrInvalidRequest(errors.New("unknown role: "+string(params.Role))))
+		return
+	}
+	// users belong to the tenant of their email's domain
+	if config.MakeMapping(email) != tenant {
+		render.Render(w, r, ErrInvalidRequest(errors.New("email must be in one of the tenant's domains")))
+		return
+	}
+	if _, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, tenant); err != mongo.ErrNoDocuments {
+		if err == nil {
+			render.Render(w, r, ErrDuplicate(errors.New("a user with this email already exists")))
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	var id string
+	err := h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+		var err error
+		id, err = h.InvitationCollection.Create(ctx, database.Invitation{
+			Tenant:    tenant,
+			Email:     email,
+			Role:      params.Role,
+			InvitedBy: inviter,
+			ExpiresAt: time.Now().Add(h.InvitationTTL),
+		})
+		if err != nil {
+			return err
+		}
+		token, err := auth.SignAudienceToken(email, id, invitationAudience, time.Now().Add(h.InvitationTTL))
+		if err != nil {
+			return err
+		}
+		return queueEmail(ctx, h.NotificationCollection, tenant, enum.NOTIFICATION_KIND_INVITATION, email, map[string]string{
+			"tenant": tenant,
+			"role":   string(params.Role),
+			"token":  token,
+		})
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	invitation, err := h.InvitationCollection.GetByID(r.Context(), id, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, invitation)
+}
+
+// GetInvitations lists the tenant's invitations, those that have been used included.
+func (h *InvitationHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	tenant := config.MakeMapping(auth.GetEmailFromToken(r.Context()))
+
+	invitations, err := h.InvitationCollection.GetAll(r.Context(), tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if invitations == nil {
+		invitations = []database.InvitationResponse{}
+	}
+	render.JSON(w, r, invitations)
+}
+
+// RevokeInvitation deletes an invitation, so it can no longer be used to register.
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	tenant := config.MakeMapping(auth.GetEmailFromToken(r.Context()))
+	id := chi.URLParam(r, "invitation_id")
+
+	if _, err := h.InvitationCollection.GetByID(r.Context(), id, tenant); err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err := h.InvitationCollection.Delete(r.Context(), id, tenant); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+// Register creates the user an invitation token was sent to, with their password, and sends them an email to verify.
+// Each invitation can be used once.
+func (h *InvitationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var params registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	if err := validatePassword(params.Password); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	claims, err := auth.ParseAudienceToken(params.Token, invitationAudience)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(errInvalidInvitation))
+		return
+	}
+	tenant := config.MakeMapping(claims.Email)
+	invitation, err := h.InvitationCollection.GetByID(r.Context(), claims.ID, tenant)
+	if err != nil || invitation.Email != claims.Email || !invitation.AcceptedAt.IsZero() || time.Now().After(invitation.ExpiresAt) {
+		render.Render(w, r, ErrInvalidRequest(errInvalidInvitation))
+		return
+	}
+	if config.IsTenantDisabled(tenant) {
+		render.Render(w, r, ErrForbidden)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	ctx := database.WithActor(r.Context(), invitation.Email)
+	err = h.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		accepted := database.Patch{Set: bson.D{{Key: "acceptedat", Value: time.Now()}}}
+		if err := h.InvitationCollection.Patch(database.WithExpectedVersion(ctx, invitation.Version), invitation.ID, tenant, accepted); err != nil {
+			return err
+		}
+		_, err := h.LoginCollection.Create(ctx, database.TenantUser{
+			Email:    invitation.Email,
+			Password: hashedPassword,
+			Tenant:   tenant,
+			Role:     invitation.Role,
+		})
+		if err != nil {
+			return err
+		}
+		return h.sendEmailVerification(ctx, tenant, invitation.Email)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrVersionConflict):
+			render.Render(w, r, ErrInvalidRequest(errInvalidInvitation))
+		case errors.Is(err, database.ErrDuplicateKey):
+			render.Render(w, r, ErrDuplicate(errors.New("a user with this email already exists")))
+		default:
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.Render(w, r, SuccessCreated)
+}
+
+// VerifyEmail verifies the email of the user a verification token was sent to, after which they can log in.
+func (h *InvitationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var params verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+
+	claims, err := auth.ParseAudienceToken(params.Token, emailVerificationAudience)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(errors.New("the verification link is invalid or has expired")))
+		return
+	}
+	tenant := config.MakeMapping(claims.Email)
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", claims.Email, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	if !user.EmailVerified {
+		ctx := database.WithActor(r.Context(), user.Email)
+		verified := database.Patch{Set: bson.D{{Key: "emailverified", Value: true}}}
+		if err := h.LoginCollection.Patch(ctx, user.ID, tenant, verified); err != nil {
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+func (h *InvitationHandler) sendEmailVerification(ctx context.Context, tenant string, email string) error {
+	token, err := auth.SignAudienceToken(email, "", emailVerificationAudience, time.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+	return queueEmail(ctx, h.NotificationCollection, tenant, enum.NOTIFICATION_KIND_EMAIL_VERIFICATION, email, map[string]string{"token": token})
+}
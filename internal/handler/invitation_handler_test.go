@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"backend-crm/internal/clients"
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/external/email"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInvitationHandler(t *testing.T) (*InvitationHandler, *database.MemoryCollection[database.TenantUser, database.TenantUserResponse], *database.MemoryCollection[database.Notification, database.NotificationResponse]) {
+	// emails cannot be sent in tests, so they stay queued where the test can read them
+	emailClient := clients.EmailClient
+	clients.EmailClient = &email.EmailClient{}
+	t.Cleanup(func() { clients.EmailClient = emailClient })
+
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]([]string{"tenant", "email"})
+	notifications := database.NewMemoryCollection[database.Notification, database.NotificationResponse]()
+	handler := NewInvitationHandler(
+		database.NewMemoryCollection[database.Invitation, database.InvitationResponse](),
+		users,
+		notifications,
+		database.NewUnitOfWork(&fakeTransactor{}),
+		time.Hour,
+	)
+	return handler, users, notifications
+}
+
+// queuedToken is the token in the last email of kind queued for recipient.
+func queuedToken(t *testing.T, notifications database.Collection[database.Notification, database.NotificationResponse], kind enum.NotificationKind, recipient string) string {
+	queued, err := notifications.GetAll(context.Background(), "")
+	require.NoError(t, err)
+	token := ""
+	for _, notification := range queued {
+		if notification.Kind == kind && notification.Recipient == recipient {
+			token = notification.Params["token"]
+		}
+	}
+	require.NotEmpty(t, token, "no %s email for %s", kind, recipient)
+	return token
+}
+
+func TestInvitationHandler_InviteRegisterVerify(t *testing.T) {
+	handler, users, notifications := newTestInvitationHandler(t)
+
+	r := chi.NewRouter()
+	r.Post("/invitations", handler.CreateInvitation)
+	r.Post("/login/register", handler.Register)
+	r.Post("/login/verify_email", handler.VerifyEmail)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.ContextKeyEmail, "admin@customera.com"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// only emails of the inviter's tenant can be invited
+	assert.Equal(t, http.StatusBadRequest, post("/invitations", `{"email": "someone@outlook.com"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/invitations", `{"email": "new@customera.com", "role": "Owner"}`).Code)
+
+	w := post("/invitations", `{"email": " New@customera.com ", "role": "Admin"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var invitation database.InvitationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+	assert.Equal(t, "new@customera.com", invitation.Email)
+	assert.Equal(t, config.CUSTOMERA, invitation.Tenant)
+	assert.Equal(t, enum.USER_ROLE_ADMIN, invitation.Role)
+	assert.Equal(t, "admin@customera.com", invitation.InvitedBy)
+	invitationToken := queuedToken(t, notifications, enum.NOTIFICATION_KIND_INVITATION, "new@customera.com")
+
+	assert.Equal(t, http.StatusBadRequest, post("/login/register", `{"token": "`+invitationToken+`", "password": "short"}`).Code)
+	assert.Equal(t, http.StatusCreated, post("/login/register", `{"token": "`+invitationToken+`", "password": "password123"}`).Code)
+	// an invitation is used once
+	assert.Equal(t, http.StatusBadRequest, post("/login/register", `{"token": "`+invitationToken+`", "password": "password123"}`).Code)
+
+	user, err := users.GetByKeyValue(context.Background(), "email", "new@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, enum.USER_ROLE_ADMIN, user.Role)
+	assert.False(t, user.EmailVerified)
+	assert.True(t, auth.CheckPasswordHash("password123", user.Password))
+
+	verificationToken := queuedToken(t, notifications, enum.NOTIFICATION_KIND_EMAIL_VERIFICATION, "new@customera.com")
+	// tokens are only accepted for what they were issued for
+	assert.Equal(t, http.StatusBadRequest, post("/login/verify_email", `{"token": "`+invitationToken+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/login/register", `{"token": "`+verificationToken+`", "password": "password123"}`).Code)
+
+	assert.Equal(t, http.StatusOK, post("/login/verify_email", `{"token": "`+verificationToken+`"}`).Code)
+	user, err = users.GetByKeyValue(context.Background(), "email", "new@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	// registered users cannot be invited again
+	assert.Equal(t, http.StatusConflict, post("/invitations", `{"email": "new@customera.com"}`).Code)
+}
+
+func TestInvitationHandler_RevokedAndExpiredInvitations(t *testing.T) {
+	handler, _, notifications := newTestInvitationHandler(t)
+	ctx := context.WithValue(context.Background(), auth.ContextKeyEmail, "admin@customera.com")
+
+	r := chi.NewRouter()
+	r.Post("/invitations", handler.CreateInvitation)
+	r.Delete("/invitations/{invitation_id}", handler.RevokeInvitation)
+	r.Post("/login/register", handler.Register)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/invitations", `{"email": "revoked@customera.com"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var invitation database.InvitationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+	token := queuedToken(t, notifications, enum.NOTIFICATION_KIND_INVITATION, "revoked@customera.com")
+
+	assert.Equal(t, http.StatusOK, send("DELETE", "/invitations/"+invitation.ID, "").Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/login/register", `{"token": "`+token+`", "password": "password123"}`).Code)
+
+	expired, err := auth.SignAudienceToken("late@customera.com", invitation.ID, invitationAudience, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/login/register", `{"token": "`+expired+`", "password": "password123"}`).Code)
+}
+
+func TestLoginHandler_RequireRole(t *testing.T) {
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]()
+	ctx := context.Background()
+	_, err := users.Create(ctx, database.TenantUser{Email: "admin@customera.com", Tenant: config.CUSTOMERA, Role: enum.USER_ROLE_ADMIN})
+	require.NoError(t, err)
+	_, err = users.Create(ctx, database.TenantUser{Email: "member@customera.com", Tenant: config.CUSTOMERA, Role: enum.USER_ROLE_MEMBER})
+	require.NoError(t, err)
+
+	handler := NewLoginHandler(users, nil, nil)
+	admins := handler.RequireRole(enum.USER_ROLE_ADMIN)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for email, code := range map[string]int{
+		"admin@customera.com":  http.StatusNoContent,
+		"member@customera.com": http.StatusForbidden,
+		"nobody@customera.com": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", "/invitations", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.ContextKeyEmail, email))
+		w := httptest.NewRecorder()
+		admins.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, email)
+	}
+}
@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"backend-crm/pkg/utils"
 	"encoding/json"
 	"errors"
@@ -30,8 +28,7 @@ func NewInvoicePricingHandler(
 
 func (h *InvoicePricingHandler) GetTenant(w http.ResponseWriter, r *http.Request) {
 
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	response := struct {
 		Tenant string `json:"tenant"`
@@ -43,8 +40,7 @@ func (h *InvoicePricingHandler) GetTenant(w http.ResponseWriter, r *http.Request
 
 func (h *InvoicePricingHandler) GetInvoiceFeesFromPortAuthority(w http.ResponseWriter, r *http.Request) {
 
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	// Load BluShipping data
 	data, err := utils.LoadInvoiceFeesData(tenant)
@@ -64,8 +60,7 @@ func (h *InvoicePricingHandler) GetInvoiceFeesFromPortAuthority(w http.ResponseW
 }
 
 func (h *InvoicePricingHandler) CreatePDAInvoicePricing(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createPDAInvoicePricingParams database.InvoicePricing
 	// Read the body into a byte slice
@@ -104,8 +99,7 @@ func (h *InvoicePricingHandler) CreatePDAInvoicePricing(w http.ResponseWriter, r
 }
 
 func (h *InvoicePricingHandler) GetPDAInvoicePricingFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	_id := chi.URLParam(r, "invoice_id")
 	log.Printf("Retrieved invoice ID from URL: %s", _id) // Confirm ID retrieval
@@ -123,21 +117,29 @@ func (h *InvoicePricingHandler) GetPDAInvoicePricingFromId(w http.ResponseWriter
 
 	response := database.InvoicePricingResponse{
 		ID:                    invoice.ID,
+		Version:               invoice.Version,
 		Tenant:                invoice.Tenant,
 		ShipmentID:            invoice.ShipmentID,
 		InvoicePricingDetails: invoice.InvoicePricingDetails,
+		FDACosts:              invoice.FDACosts,
+		IsDraft:               invoice.IsDraft,
 		CreatedAt:             invoice.CreatedAt,
 		UpdatedAt:             invoice.UpdatedAt,
 	}
 
+	setETag(w, invoice.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *InvoicePricingHandler) EditPDAInvoicePricing(w http.ResponseWriter, r *http.Request) {
 	_id := chi.URLParam(r, "invoice_id")
 	log.Printf("Retrieved invoice ID from URL: %s", _id) // Confirm ID retrieval
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
+
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
 
 	var updatePDAInvoicePricingParams database.InvoicePricing
 	if err := json.NewDecoder(r.Body).Decode(&updatePDAInvoicePricingParams); err != nil {
@@ -150,11 +152,16 @@ func (h *InvoicePricingHandler) EditPDAInvoicePricing(w http.ResponseWriter, r *
 		return
 	}
 
-	invalid := h.InvoicePricingCollection.Update(r.Context(), invoice.ID, updatePDAInvoicePricingParams)
-	log.Println(err, "err")
-	if err != nil {
+	// FDA costs come from the checklist, they are not edited with the PDA
+	updatePDAInvoicePricingParams.FDACosts = invoice.FDACosts
+
+	invalid := h.InvoicePricingCollection.Update(ctx, invoice.ID, tenant, updatePDAInvoicePricingParams)
+	log.Println(invalid, "err")
+	if invalid != nil {
 		if invalid == mongo.ErrNoDocuments {
 			render.JSON(w, r, struct{}{}) // Return empty JSON payload so that frontend can handle
+		} else if errors.Is(invalid, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -166,3 +173,23 @@ func (h *InvoicePricingHandler) EditPDAInvoicePricing(w http.ResponseWriter, r *
 
 	render.Render(w, r, SuccessOK)
 }
+
+// PatchPDAInvoicePricing changes only the fields in the JSON merge patch. Pricing details are merged
+// line by line, so {"invoice_pricing_details": {"pilotage": "1200", "mooring": null}} leaves the other lines alone.
+func (h *InvoicePricingHandler) PatchPDAInvoicePricing(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	shipmentId := chi.URLParam(r, "invoice_id")
+
+	invoice, err := h.InvoicePricingCollection.GetByKeyValue(r.Context(), "shipmentid", shipmentId, tenant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, ErrNotFound)
+		} else {
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	// FDA costs come from the checklist, they are not edited with the PDA
+	patchDocument(w, r, h.InvoicePricingCollection, invoice.ID, tenant, nil, "shipment_id", "fda_costs")
+}
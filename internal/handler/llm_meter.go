@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"backend-crm/internal/clients"
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/external/openai"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type llmPrice struct {
+	inputPerMillion  float64
+	outputPerMillion float64
+}
+
+// LLMMeter makes the LLM calls of the feed, recording the tokens each uses and what they cost, and keeps each tenant
+// within its monthly budget, see config.LLMUsage. A nil LLMMeter makes the calls without recording them.
+type LLMMeter struct {
+	UsageCollection  database.Collection[database.LLMUsage, database.LLMUsageResponse]
+	Spends           database.LLMSpendCounter
+	TenantCollection database.Collection[database.Tenant, database.TenantResponse]
+
+	extract       func(openai.OpenAIRequest) (string, openai.Usage, error)
+	prices        map[string]llmPrice
+	defaultBudget database.TenantLLMBudget
+	now           func() time.Time
+
+	warnedMu sync.Mutex
+	// warned are the months, by tenant, a tenant past its soft budget has been warned about
+	warned map[string]string
+}
+
+func NewLLMMeter(
+	cfg config.LLMUsage,
+	usageCollection database.Collection[database.LLMUsage, database.LLMUsageResponse],
+	spends database.LLMSpendCounter,
+	tenantCollection database.Collection[database.Tenant, database.TenantResponse],
+) (*LLMMeter, error) {
+	m := &LLMMeter{
+		UsageCollection:  usageCollection,
+		Spends:           spends,
+		TenantCollection: tenantCollection,
+		extract:          extractWithOpenAI,
+		prices:           make(map[string]llmPrice),
+		defaultBudget:    database.TenantLLMBudget{SoftUSD: cfg.LLMSoftBudgetUSD, HardUSD: cfg.LLMHardBudgetUSD},
+		now:              time.Now,
+		warned:           make(map[string]string),
+	}
+	for _, spec := range cfg.LLMPrices {
+		// model names may hold colons, e.g. fine-tuned ones, the prices are the last two fields
+		parts := strings.Split(spec, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("LLM price %q is not model:input:output", spec)
+		}
+		input, errInput := strconv.ParseFloat(parts[len(parts)-2], 64)
+		output, errOutput := strconv.ParseFloat(parts[len(parts)-1], 64)
+		if errInput != nil || errOutput != nil || input < 0 || output < 0 {
+			return nil, fmt.Errorf("LLM price %q is not model:input:output", spec)
+		}
+		m.prices[strings.Join(parts[:len(parts)-2], ":")] = llmPrice{inputPerMillion: input, outputPerMillion: output}
+	}
+	return m, nil
+}
+
+func extractWithOpenAI(request openai.OpenAIRequest) (string, openai.Usage, error) {
+	return clients.OpenAIClient.ExtractEntityFromText(request)
+}
+
+// Extract asks the LLM request for the tenant, about an email of shipmentID if it is known yet, and records its usage.
+// Failing to record it does not fail the call, which has been paid for.
+func (m *LLMMeter) Extract(ctx context.Context, tenant string, shipmentID string, purpose enum.LLMPurpose, request openai.OpenAIRequest) (string, error) {
+	if m == nil {
+		text, _, err := extractWithOpenAI(request)
+		return text, err
+	}
+	text, usage, err := m.extract(request)
+	if err != nil || usage.TotalTokens == 0 {
+		return text, err
+	}
+
+	now := m.now()
+	record := database.LLMUsage{
+		Tenant:           tenant,
+		ShipmentID:       shipmentID,
+		Purpose:          purpose,
+		Model:            request.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		CostUSD:          m.cost(request.Model, usage),
+		Month:            now.UTC().Format(database.LLMUsageMonthFormat),
+	}
+	if _, err := m.UsageCollection.Create(ctx, record); err != nil {
+		log.Printf("Error recording LLM usage of tenant %s: %v", tenant, err)
+	}
+	if err := m.Spends.Add(ctx, record); err != nil {
+		log.Printf("Error adding to the LLM spend of tenant %s: %v", tenant, err)
+	}
+	return text, nil
+}
+
+// cost is what usage of model costs, nothing if its price is not configured.
+func (m *LLMMeter) cost(model string, usage openai.Usage) float64 {
+	price, ok := m.prices[model]
+	if !ok {
+		log.Printf("No LLM price configured for model %s, its usage is recorded as free", model)
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.inputPerMillion + float64(usage.CompletionTokens)*price.outputPerMillion) / 1e6
+}
+
+// Budget is what the tenant may spend a month, as set with crmctl or else as configured.
+func (m *LLMMeter) Budget(ctx context.Context, tenant string) (database.TenantLLMBudget, error) {
+	stored, err := m.TenantCollection.GetByKeyValue(ctx, "tenant", tenant, tenant)
+	if err == mongo.ErrNoDocuments || err == nil && stored.LLMBudget == nil {
+		return m.defaultBudget, nil
+	}
+	if err != nil {
+		return database.TenantLLMBudget{}, err
+	}
+	return *stored.LLMBudget, nil
+}
+
+// OverBudget reports whether the tenant has spent its hard budget this month, and warns once a month when it has
+// spent its soft budget. The budget is checked before an email is read, so the email that crosses it is still read.
+func (m *LLMMeter) OverBudget(ctx context.Context, tenant string) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+	month := m.now().UTC().Format(database.LLMUsageMonthFormat)
+	spend, err := m.Spends.Get(ctx, tenant, month)
+	if err != nil {
+		return false, err
+	}
+	budget, err := m.Budget(ctx, tenant)
+	if err != nil {
+		return false, err
+	}
+
+	if budget.SoftUSD > 0 && spend.CostUSD >= budget.SoftUSD {
+		m.warnedMu.Lock()
+		if m.warned[tenant] != month {
+			m.warned[tenant] = month
+			log.Printf("Tenant %s has spent $%.2f on LLM calls in %s, past its soft budget of $%.2f", tenant, spend.CostUSD, month, budget.SoftUSD)
+		}
+		m.warnedMu.Unlock()
+	}
+	return budget.HardUSD > 0 && spend.CostUSD >= budget.HardUSD, nil
+}
+
+type llmUsageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *llmUsageTotals) add(usage database.LLMUsageResponse) {
+	t.Calls++
+	t.PromptTokens += usage.PromptTokens
+	t.CompletionTokens += usage.CompletionTokens
+	t.TotalTokens += usage.TotalTokens
+	t.CostUSD += usage.CostUSD
+}
+
+func addLLMUsage(breakdown map[string]*llmUsageTotals, key string, usage database.LLMUsageResponse) {
+	if breakdown[key] == nil {
+		breakdown[key] = &llmUsageTotals{}
+	}
+	breakdown[key].add(usage)
+}
+
+type llmUsageReport struct {
+	Tenant string `json:"tenant"`
+	Month  string `json:"month"`
+	llmUsageTotals
+	Budget             database.TenantLLMBudget   `json:"budget"`
+	SoftBudgetExceeded bool                       `json:"soft_budget_exceeded"`
+	HardBudgetExceeded bool                       `json:"hard_budget_exceeded"`
+	ByPurpose          map[string]*llmUsageTotals `json:"by_purpose"`
+	ByModel            map[string]*llmUsageTotals `json:"by_model"`
+	ByShipment         map[string]*llmUsageTotals `json:"by_shipment"`
+}
+
+// GetUsageReport reports the tenant's LLM usage in the month of the month query parameter, e.g. "2024-03",
+// this month by default, by purpose, model and shipment, against its budget. Calls made before an email was
+// matched to a shipment are reported under an empty shipment.
+func (m *LLMMeter) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		month = m.now().UTC().Format(database.LLMUsageMonthFormat)
+	}
+	if _, err := time.Parse(database.LLMUsageMonthFormat, month); err != nil {
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("month %q is not YYYY-MM", month)))
+		return
+	}
+
+	usages, err := m.UsageCollection.GetAllByKeyValue(r.Context(), "month", month, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	budget, err := m.Budget(r.Context(), tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	report := llmUsageReport{
+		Tenant:     tenant,
+		Month:      month,
+		Budget:     budget,
+		ByPurpose:  map[string]*llmUsageTotals{},
+		ByModel:    map[string]*llmUsageTotals{},
+		ByShipment: map[string]*llmUsageTotals{},
+	}
+	for _, usage := range usages {
+		report.add(usage)
+		addLLMUsage(report.ByPurpose, string(usage.Purpose), usage)
+		addLLMUsage(report.ByModel, usage.Model, usage)
+		addLLMUsage(report.ByShipment, usage.ShipmentID, usage)
+	}
+	report.SoftBudgetExceeded = budget.SoftUSD > 0 && report.CostUSD >= budget.SoftUSD
+	report.HardBudgetExceeded = budget.HardUSD > 0 && report.CostUSD >= budget.HardUSD
+	render.JSON(w, r, report)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/external/openai"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLLMSpends keeps the monthly LLM spends in memory.
+type fakeLLMSpends struct {
+	mu     sync.Mutex
+	spends map[string]database.LLMSpend
+}
+
+func newFakeLLMSpends() *fakeLLMSpends {
+	return &fakeLLMSpends{spends: map[string]database.LLMSpend{}}
+}
+
+func (f *fakeLLMSpends) Get(ctx context.Context, tenant string, month string) (database.LLMSpend, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	spend, ok := f.spends[tenant+":"+month]
+	if !ok {
+		return database.LLMSpend{Key: tenant + ":" + month, Tenant: tenant, Month: month}, nil
+	}
+	return spend, nil
+}
+
+func (f *fakeLLMSpends) Add(ctx context.Context, usage database.LLMUsage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	spend := f.spends[usage.Tenant+":"+usage.Month]
+	spend.Key, spend.Tenant, spend.Month = usage.Tenant+":"+usage.Month, usage.Tenant, usage.Month
+	spend.Calls++
+	spend.TotalTokens += usage.TotalTokens
+	spend.CostUSD += usage.CostUSD
+	f.spends[spend.Key] = spend
+	return nil
+}
+
+func TestLLMMeter(t *testing.T) {
+	ctx := context.Background()
+	usages := database.NewMemoryCollection[database.LLMUsage, database.LLMUsageResponse]()
+	tenants := database.NewMemoryCollection[database.Tenant, database.TenantResponse]()
+	meter, err := NewLLMMeter(config.LLMUsage{LLMPrices: []string{"gpt-4o-mini:0.15:0.60"}, LLMSoftBudgetUSD: 0.5, LLMHardBudgetUSD: 1}, usages, newFakeLLMSpends(), tenants)
+	require.NoError(t, err)
+	meter.now = func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+	meter.extract = func(request openai.OpenAIRequest) (string, openai.Usage, error) {
+		// a million prompt tokens and a hundred thousand completion tokens cost $0.21
+		return `["intention not found"]`, openai.Usage{PromptTokens: 1000000, CompletionTokens: 100000, TotalTokens: 1100000}, nil
+	}
+	request := openai.OpenAIRequest{Model: "gpt-4o-mini"}
+
+	text, err := meter.Extract(ctx, config.CUSTOMERA, "", enum.LLM_PURPOSE_INTENTION, request)
+	require.NoError(t, err)
+	assert.Equal(t, `["intention not found"]`, text)
+	recorded, err := usages.GetAllByKeyValue(ctx, "month", "2024-03", config.CUSTOMERA)
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, enum.LLM_PURPOSE_INTENTION, recorded[0].Purpose)
+	assert.Equal(t, 1100000, recorded[0].TotalTokens)
+	assert.InDelta(t, 0.21, recorded[0].CostUSD, 1e-9)
+
+	// the configured budget holds until the hard budget is spent
+	for i := 0; i < 4; i++ {
+		overBudget, err := meter.OverBudget(ctx, config.CUSTOMERA)
+		require.NoError(t, err)
+		assert.False(t, overBudget, "spent %d calls", i+1)
+		_, err = meter.Extract(ctx, config.CUSTOMERA, "shipment-1", enum.LLM_PURPOSE_ETA, request)
+		require.NoError(t, err)
+	}
+	overBudget, err := meter.OverBudget(ctx, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, overBudget)
+
+	// a tenant's own budget replaces the configured one, and other tenants are not affected
+	_, err = tenants.Create(ctx, database.Tenant{Tenant: config.CUSTOMERA, LLMBudget: &database.TenantLLMBudget{SoftUSD: 5, HardUSD: 10}})
+	require.NoError(t, err)
+	overBudget, err = meter.OverBudget(ctx, config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.False(t, overBudget)
+	overBudget, err = meter.OverBudget(ctx, config.CUSTOMERB)
+	require.NoError(t, err)
+	assert.False(t, overBudget)
+
+	// the report sums the month up by purpose, model and shipment
+	report := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/llm_usage"+query, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "admin@customera.com", Tenant: config.CUSTOMERA}))
+		w := httptest.NewRecorder()
+		meter.GetUsageReport(w, req)
+		return w
+	}
+	w := report("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got llmUsageReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "2024-03", got.Month)
+	assert.Equal(t, 5, got.Calls)
+	assert.InDelta(t, 1.05, got.CostUSD, 1e-9)
+	assert.Equal(t, 1, got.ByPurpose[string(enum.LLM_PURPOSE_INTENTION)].Calls)
+	assert.Equal(t, 4, got.ByPurpose[string(enum.LLM_PURPOSE_ETA)].Calls)
+	assert.Equal(t, 5, got.ByModel["gpt-4o-mini"].Calls)
+	assert.Equal(t, 4, got.ByShipment["shipment-1"].Calls)
+	assert.Equal(t, database.TenantLLMBudget{SoftUSD: 5, HardUSD: 10}, got.Budget)
+	assert.False(t, got.SoftBudgetExceeded)
+
+	w = report("?month=2024-02")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"calls":0`)
+	assert.Equal(t, http.StatusBadRequest, report("?month=March").Code)
+
+	_, err = NewLLMMeter(config.LLMUsage{LLMPrices: []string{"gpt-4o-mini:cheap"}}, nil, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginLockout locks accounts and IP addresses out after repeated failed logins, for longer with every further failure,
+// see config.Lockout. The counts are kept in Mongo, so they apply to every instance of the server.
+// A nil LoginLockout never locks anyone out.
+type LoginLockout struct {
+	attempts database.LoginAttemptCounter
+	cfg      config.Lockout
+}
+
+func NewLoginLockout(attempts database.LoginAttemptCounter, cfg config.Lockout) *LoginLockout {
+	return &LoginLockout{attempts: attempts, cfg: cfg}
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LockedUntil is when the later of the account's and the IP address's lockouts ends, or the zero time if neither is locked.
+func (l *LoginLockout) LockedUntil(ctx context.Context, email string, ip string) (time.Time, error) {
+	var lockedUntil time.Time
+	if l == nil {
+		return lockedUntil, nil
+	}
+	for _, key := range []string{accountAttemptKey(email), ipAttemptKey(ip)} {
+		attempt, err := l.attempts.Get(ctx, key)
+		if err != nil {
+			return lockedUntil, err
+		}
+		if attempt.LockedUntil.After(time.Now()) && attempt.LockedUntil.After(lockedUntil) {
+			lockedUntil = attempt.LockedUntil
+		}
+	}
+	return lockedUntil, nil
+}
+
+// RecordFailure counts a failed login for the account and the IP address, and locks either out once it has failed too often.
+func (l *LoginLockout) RecordFailure(ctx context.Context, email string, ip string) error {
+	if l == nil {
+		return nil
+	}
+	for key, threshold := range map[string]int{accountAttemptKey(email): l.cfg.LockoutAccountThreshold, ipAttemptKey(ip): l.cfg.LockoutIPThreshold} {
+		now := time.Now()
+		attempt, err := l.attempts.RecordFailure(ctx, key, now.Add(l.cfg.LockoutWindow))
+		if err != nil {
+			return err
+		}
+		if duration := l.lockoutDuration(attempt.Failures, threshold); duration > 0 {
+			if err := l.attempts.Lock(ctx, key, now.Add(duration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordSuccess forgets the account's failures. The IP address's are kept, logging in to one account says nothing about the others.
+func (l *LoginLockout) RecordSuccess(ctx context.Context, email string) error {
+	if l == nil {
+		return nil
+	}
+	return l.attempts.Reset(ctx, accountAttemptKey(email))
+}
+
+// lockoutDuration is how long failures reaching threshold lock out for: LockoutDuration at the threshold,
+// doubled for each failure after it, up to LockoutMaxDuration.
+func (l *LoginLockout) lockoutDuration(failures int, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	duration := l.cfg.LockoutDuration
+	for i := threshold; i < failures && duration < l.cfg.LockoutMaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > l.cfg.LockoutMaxDuration {
+		duration = l.cfg.LockoutMaxDuration
+	}
+	return duration
+}
+
+// writeLockedOut answers a request from a locked out account or IP address with when to retry.
+func writeLockedOut(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+}
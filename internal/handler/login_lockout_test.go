@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLoginAttempts keeps login attempts in memory.
+type fakeLoginAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]database.LoginAttempt
+}
+
+func newFakeLoginAttempts() *fakeLoginAttempts {
+	return &fakeLoginAttempts{attempts: map[string]database.LoginAttempt{}}
+}
+
+func (f *fakeLoginAttempts) Get(ctx context.Context, key string) (database.LoginAttempt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempt, ok := f.attempts[key]
+	if !ok {
+		return database.LoginAttempt{Key: key}, nil
+	}
+	return attempt, nil
+}
+
+func (f *fakeLoginAttempts) RecordFailure(ctx context.Context, key string, expiresAt time.Time) (database.LoginAttempt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempt := f.attempts[key]
+	attempt.Key = key
+	attempt.Failures++
+	attempt.ExpiresAt = expiresAt
+	f.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (f *fakeLoginAttempts) Lock(ctx context.Context, key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempt := f.attempts[key]
+	attempt.LockedUntil = until
+	f.attempts[key] = attempt
+	return nil
+}
+
+func (f *fakeLoginAttempts) Reset(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.attempts, key)
+	return nil
+}
+
+var testLockoutConfig = config.Lockout{
+	LockoutAccountThreshold: 3,
+	LockoutIPThreshold:      10,
+	LockoutDuration:         time.Minute,
+	LockoutMaxDuration:      5 * time.Minute,
+	LockoutWindow:           time.Hour,
+}
+
+func TestLoginLockout_LockoutDuration(t *testing.T) {
+	lockout := NewLoginLockout(newFakeLoginAttempts(), testLockoutConfig)
+
+	assert.Equal(t, time.Duration(0), lockout.lockoutDuration(2, 3))
+	assert.Equal(t, time.Minute, lockout.lockoutDuration(3, 3))
+	assert.Equal(t, 2*time.Minute, lockout.lockoutDuration(4, 3))
+	assert.Equal(t, 4*time.Minute, lockout.lockoutDuration(5, 3))
+	assert.Equal(t, 5*time.Minute, lockout.lockoutDuration(6, 3))
+	assert.Equal(t, 5*time.Minute, lockout.lockoutDuration(100, 3))
+	// a threshold of 0 turns the lockout off
+	assert.Equal(t, time.Duration(0), lockout.lockoutDuration(100, 0))
+}
+
+func TestHandler_LoginAndAuth_LockedOut(t *testing.T) {
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]()
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = users.Create(context.Background(), database.TenantUser{Email: "ops@customera.com", Password: hashedPassword, Tenant: config.CUSTOMERA, EmailVerified: true})
+	require.NoError(t, err)
+
+	attempts := newFakeLoginAttempts()
+	handler := NewLoginHandler(users, database.NewMemoryCollection[database.Session, database.SessionResponse](), NewLoginLockout(attempts, testLockoutConfig))
+	r := chi.NewRouter()
+	r.Post("/login", handler.LoginAndAuth)
+
+	login := func(password string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", bytes.NewBufferString(`{"email": "ops@customera.com", "password": "`+password+`"}`))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, login("password123", "10.0.0.1:1234").Code)
+	for i := 0; i < testLockoutConfig.LockoutAccountThreshold; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("wrong", "10.0.0.1:1234").Code)
+	}
+
+	// the account is locked out from every address, even with the right password
+	w := login("password123", "10.0.0.2:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 61, retryAfter, 2)
+
+	// once the lockout is over, the right password logs in and forgets the failures
+	require.NoError(t, attempts.Lock(context.Background(), accountAttemptKey("ops@customera.com"), time.Now().Add(-time.Second)))
+	assert.Equal(t, http.StatusOK, login("password123", "10.0.0.2:1234").Code)
+	attempt, err := attempts.Get(context.Background(), accountAttemptKey("ops@customera.com"))
+	require.NoError(t, err)
+	assert.Zero(t, attempt.Failures)
+
+	// the address's failures are kept
+	attempt, err = attempts.Get(context.Background(), ipAttemptKey("10.0.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, testLockoutConfig.LockoutAccountThreshold, attempt.Failures)
+}
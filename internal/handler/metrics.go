@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"backend-crm/pkg/metrics"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	httpRequestSeconds = metrics.NewHistogramVec("http_request_duration_seconds",
+		"How long requests take to serve, in seconds, by route pattern.", metrics.DefBuckets, "method", "route", "status")
+	feedEmails = metrics.NewCounterVec("feed_emails_total",
+		"Emails posted to the feed, by whether they were matched to a shipment, left unmatched or sent to review.", "tenant", "outcome")
+	timerLoopSeconds = metrics.NewHistogramVec("timer_loop_duration_seconds",
+		"How long each run of a background loop takes, in seconds.", []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300}, "loop")
+)
+
+// The outcomes of an email posted to the feed.
+const (
+	FEED_EMAIL_MATCHED   = "matched"
+	FEED_EMAIL_UNMATCHED = "unmatched"
+	FEED_EMAIL_REVIEW    = "review"
+)
+
+// The background loops whose runs are timed.
+const (
+	TIMER_LOOP_REMINDERS      = "reminders"
+	TIMER_LOOP_TRASH_PURGE    = "trash_purge"
+	TIMER_LOOP_TENANT_REFRESH = "tenant_refresh"
+)
+
+// RecordMetrics times each request by its method, chi route pattern, e.g. "/shipments/{shipment_id}", and status.
+// Requests that match no route are recorded under the route "unmatched", so that unknown paths add no series.
+func RecordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequestSeconds.Since(start, r.Method, route, strconv.Itoa(status))
+	})
+}
+
+// ServeMetrics serves the metrics for Prometheus to scrape. When token is set, the scraper must send it as
+// "Authorization: Bearer <token>", as the metrics name tenants.
+func ServeMetrics(token string) http.HandlerFunc {
+	serve := metrics.Default.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			presented, ok := bearerToken(r)
+			if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		serve.ServeHTTP(w, r)
+	}
+}
+
+// timeLoop records how long a run of the background loop has taken since start, e.g. defer timeLoop(TIMER_LOOP_REMINDERS, time.Now()).
+func timeLoop(loop string, start time.Time) {
+	timerLoopSeconds.Since(start, loop)
+}
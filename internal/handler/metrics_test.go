@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(RecordMetrics)
+	router.Get("/metrics", ServeMetrics("scrape-token"))
+	router.Route("/shipments", func(r chi.Router) {
+		r.Get("/{shipment_id}", func(w http.ResponseWriter, r *http.Request) {
+			if chi.URLParam(r, "shipment_id") == "missing" {
+				http.NotFound(w, r)
+			}
+		})
+	})
+	get := func(path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	before := httpRequestSeconds.Count("GET", "/shipments/{shipment_id}", "200")
+	get("/shipments/1", "")
+	get("/shipments/2", "")
+	get("/shipments/missing", "")
+	get("/no/such/route", "")
+
+	// requests are recorded by route pattern, not by path
+	assert.Equal(t, before+2, httpRequestSeconds.Count("GET", "/shipments/{shipment_id}", "200"))
+	assert.Equal(t, uint64(1), httpRequestSeconds.Count("GET", "/shipments/{shipment_id}", "404"))
+	assert.Equal(t, uint64(1), httpRequestSeconds.Count("GET", "unmatched", "404"))
+
+	// the metrics are only served to the scraper with the token
+	assert.Equal(t, http.StatusUnauthorized, get("/metrics", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/metrics", "wrong").Code)
+	w := get("/metrics", "scrape-token")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, body, `http_request_duration_seconds_bucket{method="GET",route="/shipments/{shipment_id}",status="404",le="+Inf"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, "# TYPE feed_emails_total counter\n")
+	assert.Contains(t, body, "# TYPE mongo_operation_duration_seconds histogram\n")
+	assert.NotContains(t, body, "/no/such/route")
+
+	feedEmails.Inc("customer \"a\"", FEED_EMAIL_MATCHED)
+	assert.Contains(t, get("/metrics", "scrape-token").Body.String(), `feed_emails_total{tenant="customer \"a\"",outcome="matched"} 1`)
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"backend-crm/internal/clients"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxNotificationAttempts is how many times a notification is tried before it is marked as failed
+const maxNotificationAttempts = 5
+
+// notificationClaimTimeout is how long a notification stays claimed by a dispatcher. One still being sent after that
+// was left by a dispatcher that stopped halfway, and is tried again.
+const notificationClaimTimeout = 10 * time.Minute
+
+// notificationSender sends a notification, replaced in tests.
+var notificationSender = sendNotification
+
+// DispatchPendingNotifications sends the tenant's pending notifications, or every tenant's when tenant is empty.
+// It runs after a shipment is created and on every timer tick, so notifications that failed are retried.
+// Each notification is claimed before it is sent, so that dispatchers running at the same time send it once.
+func DispatchPendingNotifications(ctx context.Context, notificationCollection database.Collection[database.Notification, database.NotificationResponse], tenant string) {
+	notifications, err := notificationCollection.GetAll(ctx, tenant)
+	if err != nil {
+		log.Printf("Error fetching notifications: %v", err)
+		return
+	}
+
+	for _, notification := range notifications {
+		abandoned := notification.Status == enum.NOTIFICATION_STATUS_SENDING && time.Since(notification.UpdatedAt) > notificationClaimTimeout
+		if notification.Status != enum.NOTIFICATION_STATUS_PENDING && !abandoned {
+			continue
+		}
+
+		update := database.Notification{
+			Tenant:     notification.Tenant,
+			ShipmentID: notification.ShipmentID,
+			Kind:       notification.Kind,
+			Recipient:  notification.Recipient,
+			Params:     notification.Params,
+			Status:     enum.NOTIFICATION_STATUS_SENDING,
+			Attempts:   notification.Attempts,
+			LastError:  notification.LastError,
+			CreatedAt:  notification.CreatedAt,
+		}
+		// the notification's own tenant, as tenant is empty when every tenant's are dispatched
+		if err := notificationCollection.Update(database.WithExpectedVersion(ctx, notification.Version), notification.ID, notification.Tenant, update); err != nil {
+			if !errors.Is(err, database.ErrVersionConflict) && !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Printf("Error claiming notification %s: %v", notification.ID, err)
+			}
+			// another dispatcher has claimed it
+			continue
+		}
+
+		update.Status = enum.NOTIFICATION_STATUS_SENT
+		update.Attempts++
+		update.LastError = ""
+		update.SentAt = time.Now()
+		if err := notificationSender(notification); err != nil {
+			log.Printf("Error sending notification %s: %v", notification.ID, err)
+			update.Status = enum.NOTIFICATION_STATUS_PENDING
+			update.LastError = err.Error()
+			update.SentAt = time.Time{}
+			if update.Attempts >= maxNotificationAttempts {
+				update.Status = enum.NOTIFICATION_STATUS_FAILED
+			}
+		}
+
+		if err := notificationCollection.Update(database.WithExpectedVersion(ctx, notification.Version+1), notification.ID, notification.Tenant, update); err != nil {
+			log.Printf("Error updating notification %s: %v", notification.ID, err)
+		}
+	}
+}
+
+// queueEmail queues an email of kind to email, sent once ctx's unit of work has committed.
+func queueEmail(ctx context.Context, notificationCollection database.Collection[database.Notification, database.NotificationResponse], tenant string, kind enum.NotificationKind, email string, params map[string]string) error {
+	_, err := notificationCollection.Create(ctx, database.Notification{
+		Tenant:    tenant,
+		Kind:      kind,
+		Recipient: email,
+		Params:    params,
+	})
+	if err != nil {
+		return err
+	}
+	database.AfterCommit(ctx, func(ctx context.Context) {
+		DispatchPendingNotifications(ctx, notificationCollection, tenant)
+	})
+	return nil
+}
+
+func sendNotification(notification database.NotificationResponse) error {
+	switch notification.Kind {
+	case enum.NOTIFICATION_KIND_SHIPMENT_CREATED:
+		_, err := clients.WhatsAppClient.CreateShipmentWhatsAppMessage(
+			notification.Params["agent_name"],
+			notification.Params["vessel_name"],
+			notification.Params["imo_number"],
+			notification.Params["eta_date"],
+			notification.Params["eta_time"],
+			notification.Recipient,
+		)
+		return err
+	case enum.NOTIFICATION_KIND_INVITATION:
+		return clients.EmailClient.SendInvitationEmail(
+			notification.Recipient,
+			notification.Params["tenant"],
+			notification.Params["role"],
+			notification.Params["token"],
+		)
+	case enum.NOTIFICATION_KIND_EMAIL_VERIFICATION:
+		return clients.EmailClient.SendEmailVerificationEmail(notification.Recipient, notification.Params["token"])
+	case enum.NOTIFICATION_KIND_PASSWORD_RESET:
+		return clients.EmailClient.SendPasswordResetEmail(notification.Recipient, notification.Params["token"])
+	}
+	return errors.New("unknown notification kind: " + string(notification.Kind))
+}
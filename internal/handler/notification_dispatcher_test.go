@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchPendingNotifications(t *testing.T) {
+	sent := []string{}
+	failing := map[string]bool{}
+	sender := notificationSender
+	notificationSender = func(notification database.NotificationResponse) error {
+		if failing[notification.Recipient] {
+			return errors.New("smtp is down")
+		}
+		sent = append(sent, notification.Recipient)
+		return nil
+	}
+	t.Cleanup(func() { notificationSender = sender })
+
+	ctx := context.Background()
+	notifications := database.NewMemoryCollection[database.Notification, database.NotificationResponse]()
+	queue := func(tenant string, recipient string) string {
+		id, err := notifications.Create(ctx, database.Notification{Tenant: tenant, Kind: enum.NOTIFICATION_KIND_INVITATION, Recipient: recipient, Status: enum.NOTIFICATION_STATUS_PENDING})
+		require.NoError(t, err)
+		return id
+	}
+	stored := func(id string, tenant string) database.NotificationResponse {
+		notification, err := notifications.GetByID(ctx, id, tenant)
+		require.NoError(t, err)
+		return notification
+	}
+	first := queue(config.CUSTOMERA, "ops@customera.com")
+	second := queue(config.CUSTOMERB, "ops@customerb.com")
+	down := queue(config.CUSTOMERB, "down@customerb.com")
+	failing["down@customerb.com"] = true
+
+	// the timer dispatches every tenant's notifications
+	DispatchPendingNotifications(ctx, notifications, "")
+	for _, sentOne := range []database.NotificationResponse{stored(first, config.CUSTOMERA), stored(second, config.CUSTOMERB)} {
+		assert.Equal(t, enum.NOTIFICATION_STATUS_SENT, sentOne.Status)
+		assert.Equal(t, 1, sentOne.Attempts)
+	}
+	failed := stored(down, config.CUSTOMERB)
+	assert.Equal(t, enum.NOTIFICATION_STATUS_PENDING, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "smtp is down", failed.LastError)
+
+	// sent notifications are not sent again, failing ones are tried until they fail for good
+	for i := 1; i < maxNotificationAttempts; i++ {
+		DispatchPendingNotifications(ctx, notifications, "")
+	}
+	assert.ElementsMatch(t, []string{"ops@customera.com", "ops@customerb.com"}, sent)
+	failed = stored(down, config.CUSTOMERB)
+	assert.Equal(t, enum.NOTIFICATION_STATUS_FAILED, failed.Status)
+	assert.Equal(t, maxNotificationAttempts, failed.Attempts)
+
+	// a notification claimed by another dispatcher is left to it
+	claimed := queue(config.CUSTOMERA, "claimed@customera.com")
+	notification := stored(claimed, config.CUSTOMERA)
+	require.NoError(t, notifications.Update(ctx, claimed, config.CUSTOMERA, database.Notification{Tenant: config.CUSTOMERA, Kind: notification.Kind, Recipient: notification.Recipient, Status: enum.NOTIFICATION_STATUS_SENDING, UpdatedAt: time.Now()}))
+	DispatchPendingNotifications(ctx, notifications, config.CUSTOMERA)
+	assert.NotContains(t, sent, "claimed@customera.com")
+	assert.Equal(t, enum.NOTIFICATION_STATUS_SENDING, stored(claimed, config.CUSTOMERA).Status)
+}
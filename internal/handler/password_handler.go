@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	passwordResetAudience = "password_reset"
+
+	// passwordResetTTL is how long the link to reset a forgotten password works for
+	passwordResetTTL = time.Hour
+)
+
+var (
+	errInvalidPasswordReset = errors.New("the reset link is invalid, has expired or has been used")
+	errSSOTenant            = errors.New("the account logs in with single sign-on, not with a password")
+)
+
+// PasswordHandler changes passwords: a logged in user's, knowing their current password,
+// or a user's who forgot it, with a single use token sent to their email.
+type PasswordHandler struct {
+	LoginCollection         database.Collection[database.TenantUser, database.TenantUserResponse]
+	SessionCollection       database.Collection[database.Session, database.SessionResponse]
+	PasswordResetCollection database.Collection[database.PasswordReset, database.PasswordResetResponse]
+	NotificationCollection  database.Collection[database.Notification, database.NotificationResponse]
+	UnitOfWork              *database.UnitOfWork
+	Lockout                 *LoginLockout
+}
+
+func NewPasswordHandler(
+	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
+	sessionCollection database.Collection[database.Session, database.SessionResponse],
+	passwordResetCollection database.Collection[database.PasswordReset, database.PasswordResetResponse],
+	notificationCollection database.Collection[database.Notification, database.NotificationResponse],
+	unitOfWork *database.UnitOfWork,
+	lockout *LoginLockout,
+) *PasswordHandler {
+	return &PasswordHandler{
+		LoginCollection:         loginCollection,
+		SessionCollection:       sessionCollection,
+		PasswordResetCollection: passwordResetCollection,
+		NotificationCollection:  notificationCollection,
+		UnitOfWork:              unitOfWork,
+		Lockout:                 lockout,
+	}
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePassword sets the logged in user's password and ends their other sessions. A wrong current password
+// counts as a failed login.
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	email := auth.GetEmailFromToken(r.Context())
+	tenant := config.MakeMapping(email)
+
+	var params changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	if err := validatePassword(params.NewPassword); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	ip := clientIP(r)
+	lockedUntil, err := h.Lockout.LockedUntil(r.Context(), email, ip)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		writeLockedOut(w, lockedUntil)
+		return
+	}
+
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if !auth.CheckPasswordHash(params.CurrentPassword, user.Password) {
+		if err := h.Lockout.RecordFailure(r.Context(), email, ip); err != nil {
+			log.Printf("Error recording failed password change: %v", err)
+		}
+		render.Render(w, r, ErrInvalidRequest(errors.New("the current password is wrong")))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.NewPassword)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if err := h.LoginCollection.Patch(r.Context(), user.ID, tenant, passwordPatch(hashedPassword)); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if err := revokeSessions(r.Context(), h.SessionCollection, tenant, email, auth.GetSessionInfoFromToken(r.Context())); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+// ForgotPassword emails a link to reset the password to the user with the email, if there is one and their tenant
+// does not log in with single sign-on. The response is the same either way, so it does not tell who has an account.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var params forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(params.Email))
+	tenant := config.MakeMapping(email)
+
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, tenant)
+	if err != nil && err != mongo.ErrNoDocuments {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if err == nil && !user.Disabled && !config.IsTenantDisabled(tenant) && !config.IsSSOEnabled(tenant) {
+		err = h.UnitOfWork.Do(r.Context(), func(ctx context.Context) error {
+			expiresAt := time.Now().Add(passwordResetTTL)
+			id, err := h.PasswordResetCollection.Create(ctx, database.PasswordReset{Tenant: tenant, Email: user.Email, ExpiresAt: expiresAt})
+			if err != nil {
+				return err
+			}
+			token, err := auth.SignAudienceToken(user.Email, id, passwordResetAudience, expiresAt)
+			if err != nil {
+				return err
+			}
+			return queueEmail(ctx, h.NotificationCollection, tenant, enum.NOTIFICATION_KIND_PASSWORD_RESET, user.Email, map[string]string{"token": token})
+		})
+		if err != nil {
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+	}
+
+	render.Render(w, r, &SuccessResponse{HTTPStatusCode: http.StatusAccepted, Message: "If the email has an account, a link to reset its password has been sent"})
+}
+
+// ResetPassword sets the password of the user a reset token was sent to, ends their sessions and lifts their lockout.
+// Each token can be used once, and not once the user's tenant has moved to single sign-on.
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var params resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	if err := validatePassword(params.NewPassword); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	claims, err := auth.ParseAudienceToken(params.Token, passwordResetAudience)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(errInvalidPasswordReset))
+		return
+	}
+	tenant := config.MakeMapping(claims.Email)
+	if config.IsSSOEnabled(tenant) {
+		render.Render(w, r, ErrInvalidRequest(errSSOTenant))
+		return
+	}
+	reset, err := h.PasswordResetCollection.GetByID(r.Context(), claims.ID, tenant)
+	if err != nil || reset.Email != claims.Email || !reset.UsedAt.IsZero() || time.Now().After(reset.ExpiresAt) {
+		render.Render(w, r, ErrInvalidRequest(errInvalidPasswordReset))
+		return
+	}
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", reset.Email, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(errInvalidPasswordReset))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.NewPassword)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	ctx := database.WithActor(r.Context(), user.Email)
+	err = h.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		used := database.Patch{Set: bson.D{{Key: "usedat", Value: time.Now()}}}
+		if err := h.PasswordResetCollection.Patch(database.WithExpectedVersion(ctx, reset.Version), reset.ID, tenant, used); err != nil {
+			return err
+		}
+		return h.LoginCollection.Patch(ctx, user.ID, tenant, passwordPatch(hashedPassword))
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrInvalidRequest(errInvalidPasswordReset))
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	if err := revokeSessions(ctx, h.SessionCollection, tenant, user.Email, ""); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if err := h.Lockout.RecordSuccess(ctx, user.Email); err != nil {
+		log.Printf("Error lifting lockout: %v", err)
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+func passwordPatch(hashedPassword string) database.Patch {
+	return database.Patch{Set: bson.D{{Key: "password", Value: hashedPassword}}}
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("the password must be at least %d characters", minPasswordLength)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"backend-crm/internal/clients"
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/external/email"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPasswordHandler(t *testing.T) (*PasswordHandler, *database.MemoryCollection[database.TenantUser, database.TenantUserResponse], *database.MemoryCollection[database.Session, database.SessionResponse], *database.MemoryCollection[database.Notification, database.NotificationResponse]) {
+	// emails cannot be sent in tests, so they stay queued where the test can read them
+	emailClient := clients.EmailClient
+	clients.EmailClient = &email.EmailClient{}
+	t.Cleanup(func() { clients.EmailClient = emailClient })
+
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]([]string{"tenant", "email"})
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = users.Create(context.Background(), database.TenantUser{Email: "ops@customera.com", Password: hashedPassword, Tenant: config.CUSTOMERA, EmailVerified: true})
+	require.NoError(t, err)
+
+	sessions := database.NewMemoryCollection[database.Session, database.SessionResponse]()
+	for _, token := range []string{"current", "other"} {
+		_, err := sessions.Create(context.Background(), database.Session{Email: "ops@customera.com", JWTToken: token, Tenant: config.CUSTOMERA})
+		require.NoError(t, err)
+	}
+
+	notifications := database.NewMemoryCollection[database.Notification, database.NotificationResponse]()
+	handler := NewPasswordHandler(
+		users,
+		sessions,
+		database.NewMemoryCollection[database.PasswordReset, database.PasswordResetResponse](),
+		notifications,
+		database.NewUnitOfWork(&fakeTransactor{}),
+		NewLoginLockout(newFakeLoginAttempts(), testLockoutConfig),
+	)
+	return handler, users, sessions, notifications
+}
+
+func sessionTokens(t *testing.T, sessions database.Collection[database.Session, database.SessionResponse]) []string {
+	remaining, err := sessions.GetAllByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	tokens := []string{}
+	for _, session := range remaining {
+		tokens = append(tokens, session.JWTToken)
+	}
+	return tokens
+}
+
+func TestPasswordHandler_ChangePassword(t *testing.T) {
+	handler, users, sessions, _ := newTestPasswordHandler(t)
+
+	r := chi.NewRouter()
+	r.Post("/account/change_password", handler.ChangePassword)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), auth.ContextKeyEmail, "ops@customera.com")
+		ctx = context.WithValue(ctx, auth.ContextKeySession, "current")
+		req := httptest.NewRequest("POST", "/account/change_password", bytes.NewBufferString(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"current_password": "password123", "new_password": "short"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"current_password": "wrong", "new_password": "newpassword"}`).Code)
+	assert.Equal(t, http.StatusOK, post(`{"current_password": "password123", "new_password": "newpassword"}`).Code)
+
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, auth.CheckPasswordHash("newpassword", user.Password))
+	// the session that changed the password is kept, the others are ended
+	assert.Equal(t, []string{"current"}, sessionTokens(t, sessions))
+
+	// wrong current passwords count towards the lockout
+	for i := 1; i < testLockoutConfig.LockoutAccountThreshold; i++ {
+		assert.Equal(t, http.StatusBadRequest, post(`{"current_password": "wrong", "new_password": "newpassword"}`).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, post(`{"current_password": "newpassword", "new_password": "otherpassword"}`).Code)
+}
+
+func TestPasswordHandler_ForgotAndResetPassword(t *testing.T) {
+	handler, users, sessions, notifications := newTestPasswordHandler(t)
+
+	r := chi.NewRouter()
+	r.Post("/login/forgot_password", handler.ForgotPassword)
+	r.Post("/login/reset_password", handler.ResetPassword)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// unknown emails are answered the same, and sent nothing
+	assert.Equal(t, http.StatusAccepted, post("/login/forgot_password", `{"email": "nobody@customera.com"}`).Code)
+	queued, err := notifications.GetAll(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+
+	assert.Equal(t, http.StatusAccepted, post("/login/forgot_password", `{"email": "Ops@customera.com"}`).Code)
+	token := queuedToken(t, notifications, enum.NOTIFICATION_KIND_PASSWORD_RESET, "ops@customera.com")
+
+	// tokens issued for something else are not accepted for resets
+	verification, err := auth.SignAudienceToken("ops@customera.com", "", emailVerificationAudience, time.Now().Add(emailVerificationTTL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, post("/login/reset_password", `{"token": "`+verification+`", "new_password": "newpassword"}`).Code)
+
+	assert.Equal(t, http.StatusBadRequest, post("/login/reset_password", `{"token": "`+token+`", "new_password": "short"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/login/reset_password", `{"token": "`+token+`", "new_password": "newpassword"}`).Code)
+	// a reset token is used once
+	assert.Equal(t, http.StatusBadRequest, post("/login/reset_password", `{"token": "`+token+`", "new_password": "otherpassword"}`).Code)
+
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, auth.CheckPasswordHash("newpassword", user.Password))
+	assert.Empty(t, sessionTokens(t, sessions))
+}
+
+func TestPasswordHandler_SSOTenantHasNoPasswordReset(t *testing.T) {
+	handler, users, _, notifications := newTestPasswordHandler(t)
+
+	r := chi.NewRouter()
+	r.Post("/login/forgot_password", handler.ForgotPassword)
+	r.Post("/login/reset_password", handler.ResetPassword)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusAccepted, post("/login/forgot_password", `{"email": "ops@customera.com"}`).Code)
+	token := queuedToken(t, notifications, enum.NOTIFICATION_KIND_PASSWORD_RESET, "ops@customera.com")
+
+	config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{config.CUSTOMERA: true})
+	t.Cleanup(func() {
+		config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{})
+	})
+
+	// once the tenant has moved to single sign-on no link is sent, and one sent before does not work
+	assert.Equal(t, http.StatusAccepted, post("/login/forgot_password", `{"email": "ops@customera.com"}`).Code)
+	queued, err := notifications.GetAll(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, queued, 1)
+
+	assert.Equal(t, http.StatusBadRequest, post("/login/reset_password", `{"token": "`+token+`", "new_password": "newpassword"}`).Code)
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, auth.CheckPasswordHash("password123", user.Password))
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// patchDocument applies the JSON merge patch in the request body to the tenant's document with id,
+// writing only the fields it names. validate, if given, checks the patch beyond the types of its fields.
+// With an If-Match header the patch only applies to that version, without one it applies to whatever is stored.
+func patchDocument[S any, T any](
+	w http.ResponseWriter,
+	r *http.Request,
+	collection database.Collection[S, T],
+	id string,
+	tenant string,
+	validate func(patch database.Patch) error,
+	readOnly ...string,
+) {
+	ctx := r.Context()
+	if r.Header.Get("If-Match") != "" {
+		var ok bool
+		if ctx, ok = ifMatchContext(w, r); !ok {
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	patch, err := database.NewMergePatch[S](body, readOnly...)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if validate != nil {
+		if err := validate(patch); err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	err = collection.Patch(ctx, id, tenant, patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, primitive.ErrInvalidHex):
+			render.Render(w, r, ErrNotFound)
+		case errors.Is(err, database.ErrVersionConflict):
+			render.Render(w, r, ErrPreconditionFailed)
+		case errors.Is(err, database.ErrDuplicateKey):
+			render.Render(w, r, ErrDuplicate(err))
+		default:
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
+
+// patchField is a field of an entity, by its bson path and its path in a JSON merge patch.
+type patchField struct {
+	Path     string
+	JSONPath string
+}
+
+// refuseRemoving refuses a patch that removes one of the required fields, by setting it to null.
+func refuseRemoving(patch database.Patch, required ...patchField) error {
+	for _, field := range required {
+		if patch.Unsets(field.Path) {
+			return &database.PatchError{Path: field.JSONPath, Reason: "field is required, it cannot be null"}
+		}
+	}
+	return nil
+}
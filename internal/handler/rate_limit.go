@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit scopes, who a token bucket is kept for. The tenant and user of a request are only known once it is
+// authenticated, so public routes such as /login are only limited by IP address.
+const (
+	RATE_LIMIT_SCOPE_TENANT = "tenant"
+	RATE_LIMIT_SCOPE_USER   = "user"
+	RATE_LIMIT_SCOPE_IP     = "ip"
+)
+
+type rateLimit struct {
+	scope     string
+	burst     float64
+	perSecond float64
+}
+
+// RateLimiter limits how fast each route group may be called, and how large the bodies it takes may be, see config.RateLimit.
+type RateLimiter struct {
+	store      database.RateLimitStore
+	limits     map[string][]rateLimit
+	bodyLimits map[string]int64
+	now        func() time.Time
+}
+
+func NewRateLimiter(cfg config.RateLimit, store database.RateLimitStore) (*RateLimiter, error) {
+	l := &RateLimiter{
+		store:      store,
+		limits:     make(map[string][]rateLimit),
+		bodyLimits: make(map[string]int64),
+		now:        time.Now,
+	}
+	for _, spec := range cfg.RateLimits {
+		group, limit, err := parseRateLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		l.limits[group] = append(l.limits[group], limit)
+	}
+	for _, spec := range cfg.BodyLimits {
+		group, size, ok := strings.Cut(spec, ":")
+		bytes, err := strconv.ParseInt(size, 10, 64)
+		if !ok || group == "" || err != nil || bytes <= 0 {
+			return nil, fmt.Errorf("body limit %q is not group:bytes", spec)
+		}
+		l.bodyLimits[group] = bytes
+	}
+	return l, nil
+}
+
+// parseRateLimit parses "group:scope:requests/period" or "group:scope:requests/period:burst".
+func parseRateLimit(spec string) (string, rateLimit, error) {
+	invalid := fmt.Errorf("rate limit %q is not group:scope:requests/period[:burst]", spec)
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 && len(parts) != 4 || parts[0] == "" {
+		return "", rateLimit{}, invalid
+	}
+	scope := parts[1]
+	if scope != RATE_LIMIT_SCOPE_TENANT && scope != RATE_LIMIT_SCOPE_USER && scope != RATE_LIMIT_SCOPE_IP {
+		return "", rateLimit{}, fmt.Errorf("rate limit %q: unknown scope %s", spec, scope)
+	}
+	count, period, ok := strings.Cut(parts[2], "/")
+	requests, errRequests := strconv.Atoi(count)
+	duration, errPeriod := time.ParseDuration(period)
+	if !ok || errRequests != nil || errPeriod != nil || requests <= 0 || duration <= 0 {
+		return "", rateLimit{}, invalid
+	}
+	burst := requests
+	if len(parts) == 4 {
+		var err error
+		if burst, err = strconv.Atoi(parts[3]); err != nil || burst <= 0 {
+			return "", rateLimit{}, invalid
+		}
+	}
+	return parts[0], rateLimit{scope: scope, burst: float64(burst), perSecond: float64(requests) / duration.Seconds()}, nil
+}
+
+// LimitIP limits the group's requests from each IP address. It goes before authentication, so that requests
+// failing it are limited too.
+func (l *RateLimiter) LimitIP(group string) func(http.Handler) http.Handler {
+	return l.limit(group, func(r *http.Request, scope string) string {
+		if scope == RATE_LIMIT_SCOPE_IP {
+			return clientIP(r)
+		}
+		return ""
+	})
+}
+
+// LimitPrincipal limits the group's requests of each tenant and each user or API key, after authentication.
+func (l *RateLimiter) LimitPrincipal(group string) func(http.Handler) http.Handler {
+	return l.limit(group, func(r *http.Request, scope string) string {
+		principal := auth.GetPrincipal(r.Context())
+		switch scope {
+		case RATE_LIMIT_SCOPE_TENANT:
+			return principal.Tenant
+		case RATE_LIMIT_SCOPE_USER:
+			return principal.Actor()
+		}
+		return ""
+	})
+}
+
+// limit takes a token from the bucket of each of the group's limits that identity knows who to keep it for, and
+// refuses the request once one is empty. Requests are let through when the buckets cannot be reached.
+func (l *RateLimiter) limit(group string, identity func(r *http.Request, scope string) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, limit := range l.limits[group] {
+				who := identity(r, limit.scope)
+				if who == "" {
+					continue
+				}
+				wait, err := l.store.Take(r.Context(), group+":"+limit.scope+":"+who, limit.burst, limit.perSecond, l.now())
+				if err != nil {
+					log.Printf("Error taking a %s rate limit token: %v", group, err)
+					continue
+				}
+				if wait > 0 {
+					writeRateLimited(w, wait)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitBody refuses request bodies larger than the group's body limit.
+func (l *RateLimiter) LimitBody(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := l.bodyLimits[group]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > limit {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			// a body without a Content-Length fails to read past the limit
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeRateLimited answers a request over a rate limit with when to retry.
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	retryAfter := int(wait/time.Second) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+}
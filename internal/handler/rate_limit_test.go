@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(config.RateLimit{
+		RateLimits: []string{"api:ip:100/1s", "api:user:2/1m", "api:tenant:3/1m", "login:ip:1/1s:2"},
+		BodyLimits: []string{"api:16"},
+	}, database.NewMemoryRateLimitBuckets())
+	require.NoError(t, err)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	})
+	api := limiter.LimitBody("api")(limiter.LimitIP("api")(limiter.LimitPrincipal("api")(ok)))
+	send := func(handler http.Handler, principal auth.Principal, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/shipments", bytes.NewBufferString(body))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	ops := auth.Principal{Email: "ops@customera.com", Tenant: config.CUSTOMERA}
+	finance := auth.Principal{Email: "finance@customera.com", Tenant: config.CUSTOMERA}
+
+	// each user has their own bucket, within their tenant's
+	assert.Equal(t, http.StatusOK, send(api, ops, "").Code)
+	assert.Equal(t, http.StatusOK, send(api, ops, "").Code)
+	w := send(api, ops, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "31", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, send(api, finance, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(api, finance, "").Code, "the tenant's bucket is empty")
+	assert.Equal(t, http.StatusOK, send(api, auth.Principal{Email: "ops@customerb.com", Tenant: config.CUSTOMERB}, "").Code)
+
+	// buckets refill with time
+	now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusOK, send(api, ops, "").Code)
+
+	// bursts are allowed up to the burst size
+	login := limiter.LimitIP("login")(ok)
+	assert.Equal(t, http.StatusOK, send(login, auth.Principal{}, "").Code)
+	assert.Equal(t, http.StatusOK, send(login, auth.Principal{}, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(login, auth.Principal{}, "").Code)
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, send(login, auth.Principal{}, "").Code)
+
+	// large bodies are refused
+	now = now.Add(time.Hour)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(api, ops, `{"name": "a long shipment name"}`).Code)
+	chunked := httptest.NewRequest("POST", "/shipments", io.MultiReader(bytes.NewBufferString(`{"name": "a long shipment name"}`)))
+	chunked = chunked.WithContext(auth.WithPrincipal(chunked.Context(), finance))
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, chunked)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	for _, spec := range []string{"api:ip:10", "api:everyone:10/1s", "api:ip:0/1s", "api:ip:10/1s:x"} {
+		_, err := NewRateLimiter(config.RateLimit{RateLimits: []string{spec}}, nil)
+		assert.Error(t, err, spec)
+	}
+	_, err = NewRateLimiter(config.RateLimit{BodyLimits: []string{"api:1MB"}}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SessionHandler lets users see where they are logged in, and log out there or here.
+// Expired sessions are removed by Mongo, with the TTL index on expiresat.
+type SessionHandler struct {
+	SessionCollection database.Collection[database.Session, database.SessionResponse]
+}
+
+func NewSessionHandler(sessionCollection database.Collection[database.Session, database.SessionResponse]) *SessionHandler {
+	return &SessionHandler{
+		SessionCollection: sessionCollection,
+	}
+}
+
+// sessionResponse is a session as its user sees it, without its token. Current is the session of the request.
+type sessionResponse struct {
+	SessionID  string    `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Logout ends the session of the request and clears its cookie.
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	email := auth.GetEmailFromToken(r.Context())
+	session, err := h.SessionCollection.GetByKeyValue(r.Context(), "jwt_token", auth.GetSessionInfoFromToken(r.Context()), config.MakeMapping(email))
+	if err != nil && err != mongo.ErrNoDocuments {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := h.SessionCollection.Delete(r.Context(), session.ID, session.Tenant); err != nil && err != mongo.ErrNoDocuments {
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w)
+	render.Render(w, r, SuccessOK)
+}
+
+// GetSessions lists the user's sessions that have not expired, the most recently used first.
+func (h *SessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	email := auth.GetEmailFromToken(r.Context())
+	sessions, err := h.SessionCollection.GetAllByKeyValue(r.Context(), "email", email, config.MakeMapping(email))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	current := auth.GetSessionInfoFromToken(r.Context())
+	response := []sessionResponse{}
+	for _, session := range sessions {
+		if time.Now().After(session.ExpiresAt) {
+			continue
+		}
+		response = append(response, sessionResponse{
+			SessionID:  session.SessionID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.JWTToken == current,
+		})
+	}
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].LastSeenAt.After(response[j].LastSeenAt)
+	})
+	render.JSON(w, r, response)
+}
+
+// RevokeSession ends one of the user's sessions, by its session ID.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	email := auth.GetEmailFromToken(r.Context())
+	session, err := h.SessionCollection.GetByKeyValue(r.Context(), "sessionid", chi.URLParam(r, "session_id"), config.MakeMapping(email))
+	// other users' sessions are not found, rather than forbidden, so as not to tell that they exist
+	if err == mongo.ErrNoDocuments || err == nil && session.Email != email {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	if err := h.SessionCollection.Delete(r.Context(), session.ID, session.Tenant); err != nil && err != mongo.ErrNoDocuments {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if session.JWTToken == auth.GetSessionInfoFromToken(r.Context()) {
+		clearSessionCookie(w)
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+// RevokeSessions ends all of the user's sessions, the one of the request included, and clears its cookie.
+func (h *SessionHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	email := auth.GetEmailFromToken(r.Context())
+	if err := revokeSessions(r.Context(), h.SessionCollection, config.MakeMapping(email), email, ""); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	clearSessionCookie(w)
+	render.Render(w, r, SuccessOK)
+}
+
+// revokeSessions ends the user's sessions, except the one with keepToken.
+func revokeSessions(
+	ctx context.Context,
+	sessionCollection database.Collection[database.Session, database.SessionResponse],
+	tenant string,
+	email string,
+	keepToken string,
+) error {
+	sessions, err := sessionCollection.GetAllByKeyValue(ctx, "email", email, tenant)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.JWTToken == keepToken {
+			continue
+		}
+		if err := sessionCollection.Delete(ctx, session.ID, tenant); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearSessionCookie makes the browser forget the session cookie set at login.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "jwtToken",
+		Value:    "",
+		Path:     "/",
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+	})
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHandler(t *testing.T) {
+	sessions := database.NewMemoryCollection[database.Session, database.SessionResponse]()
+	for _, session := range []database.Session{
+		{SessionID: "laptop", JWTToken: "laptop-token", Email: "ops@customera.com", UserAgent: "Firefox", IP: "10.0.0.1", LastSeenAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(time.Hour)},
+		{SessionID: "phone", JWTToken: "phone-token", Email: "ops@customera.com", UserAgent: "Safari", IP: "10.0.0.2", LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)},
+		{SessionID: "tablet", JWTToken: "tablet-token", Email: "ops@customera.com", ExpiresAt: time.Now().Add(-time.Hour)},
+		{SessionID: "colleague", JWTToken: "colleague-token", Email: "colleague@customera.com", ExpiresAt: time.Now().Add(time.Hour)},
+	} {
+		session.Tenant = config.CUSTOMERA
+		_, err := sessions.Create(context.Background(), session)
+		require.NoError(t, err)
+	}
+
+	handler := NewSessionHandler(sessions)
+	r := chi.NewRouter()
+	r.Post("/logout", handler.Logout)
+	r.Get("/sessions", handler.GetSessions)
+	r.Delete("/sessions", handler.RevokeSessions)
+	r.Delete("/sessions/{session_id}", handler.RevokeSession)
+
+	send := func(method string, path string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), auth.ContextKeyEmail, "ops@customera.com")
+		ctx = context.WithValue(ctx, auth.ContextKeySession, "laptop-token")
+		req := httptest.NewRequest(method, path, nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	sessionIDs := func() []string {
+		w := send("GET", "/sessions")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "-token", "tokens are not listed")
+		var listed []sessionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+		ids := []string{}
+		for _, session := range listed {
+			ids = append(ids, session.SessionID)
+			assert.Equal(t, session.SessionID == "laptop", session.Current)
+		}
+		return ids
+	}
+
+	// the user's sessions that have not expired, most recently used first
+	assert.Equal(t, []string{"phone", "laptop"}, sessionIDs())
+
+	assert.Equal(t, http.StatusNotFound, send("DELETE", "/sessions/colleague").Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", "/sessions/phone").Code)
+	assert.Equal(t, []string{"laptop"}, sessionIDs())
+
+	w := send("POST", "/logout")
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.Equal(t, "jwtToken", w.Result().Cookies()[0].Name)
+	assert.True(t, w.Result().Cookies()[0].MaxAge < 0)
+	assert.Empty(t, sessionIDs())
+
+	_, err := sessions.GetByKeyValue(context.Background(), "jwt_token", "colleague-token", config.CUSTOMERA)
+	assert.NoError(t, err, "other users stay logged in")
+	assert.Equal(t, http.StatusOK, send("DELETE", "/sessions").Code)
+	_, err = sessions.GetByKeyValue(context.Background(), "jwt_token", "tablet-token", config.CUSTOMERA)
+	assert.Error(t, err)
+}
+
+func TestSessionHandler_RefreshedSessionKeepsItsDevice(t *testing.T) {
+	sessions := database.NewMemoryCollection[database.Session, database.SessionResponse]()
+	token, err := auth.GenerateJWT("ops@customera.com", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, err = sessions.Create(context.Background(), database.Session{
+		SessionID: "laptop", JWTToken: token, Email: "ops@customera.com", Tenant: config.CUSTOMERA,
+		UserAgent: "Firefox", IP: "10.0.0.1", LastSeenAt: time.Now().Add(-time.Hour), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	// the token is about to expire, so it is refreshed before the sessions are listed
+	list := NewLoginHandler(nil, sessions, nil).ValidateCookie(http.HandlerFunc(NewSessionHandler(sessions).GetSessions))
+	req := httptest.NewRequest("GET", "/sessions", nil)
+	req.RemoteAddr = "10.0.0.2:41000"
+	req.AddCookie(&http.Cookie{Name: "jwtToken", Value: token})
+	w := httptest.NewRecorder()
+	list.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.NotEqual(t, token, w.Result().Cookies()[0].Value)
+
+	var listed []sessionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.True(t, listed[0].Current)
+	assert.Equal(t, "Firefox", listed[0].UserAgent)
+	assert.Equal(t, "10.0.0.2", listed[0].IP)
+	assert.WithinDuration(t, time.Now(), listed[0].LastSeenAt, time.Minute)
+}
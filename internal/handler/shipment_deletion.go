@@ -0,0 +1,133 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ShipmentDependent is something stored against a shipment by its ID, such as its checklist or feed emails.
+// Dependents go to the trash with the shipment and come back with it.
+type ShipmentDependent struct {
+	Name  string
+	Trash database.Trash
+	// Blocks, if set, reports whether the shipment's dependents keep it from being deleted,
+	// e.g. because they record something that happened rather than something derived from the shipment.
+	// Such a shipment is only deleted when the caller asks for the delete to cascade.
+	Blocks func(ctx context.Context, shipmentId string, tenant string) (bool, error)
+}
+
+// ShipmentDependentsError is a delete blocked by the shipment's dependents.
+type ShipmentDependentsError struct {
+	Dependents []string
+}
+
+func (e *ShipmentDependentsError) Error() string {
+	return "shipment has " + strings.Join(e.Dependents, ", ") + ", delete with cascade=true to delete them too"
+}
+
+// ShipmentDeletion deletes and restores shipments together with their dependents, in one unit of work.
+type ShipmentDeletion struct {
+	UnitOfWork         *database.UnitOfWork
+	ShipmentCollection database.Collection[database.Shipment, database.ShipmentResponse]
+	ShipmentTrash      database.Trash
+	Dependents         []ShipmentDependent
+}
+
+func NewShipmentDeletion(
+	unitOfWork *database.UnitOfWork,
+	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
+	shipmentTrash database.Trash,
+	dependents []ShipmentDependent,
+) *ShipmentDeletion {
+	return &ShipmentDeletion{
+		UnitOfWork:         unitOfWork,
+		ShipmentCollection: shipmentCollection,
+		ShipmentTrash:      shipmentTrash,
+		Dependents:         dependents,
+	}
+}
+
+// Delete moves the tenant's shipment and its dependents to the trash.
+// Unless cascade is set, dependents that block the delete fail it with a *ShipmentDependentsError.
+func (d *ShipmentDeletion) Delete(ctx context.Context, shipmentId string, tenant string, cascade bool) error {
+	if _, err := d.ShipmentCollection.GetByID(ctx, shipmentId, tenant); err != nil {
+		return err
+	}
+
+	if !cascade {
+		var blocking []string
+		for _, dependent := range d.Dependents {
+			if dependent.Blocks == nil {
+				continue
+			}
+			blocks, err := dependent.Blocks(ctx, shipmentId, tenant)
+			if err != nil {
+				return err
+			}
+			if blocks {
+				blocking = append(blocking, dependent.Name)
+			}
+		}
+		if len(blocking) > 0 {
+			return &ShipmentDependentsError{Dependents: blocking}
+		}
+	}
+
+	return d.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := d.ShipmentCollection.Delete(ctx, shipmentId, tenant); err != nil {
+			return err
+		}
+		for _, dependent := range d.Dependents {
+			if _, err := dependent.Trash.DeleteByKeyValue(ctx, "shipmentid", shipmentId, tenant); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore takes the tenant's shipment out of the trash, with the dependents that were deleted with it or since.
+// Dependents deleted on their own before the shipment stay in the trash.
+func (d *ShipmentDeletion) Restore(ctx context.Context, shipmentId string, tenant string) error {
+	deletedAt, err := d.ShipmentTrash.DeletedAt(ctx, shipmentId, tenant)
+	if err != nil {
+		return err
+	}
+
+	return d.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		if err := d.ShipmentTrash.Restore(ctx, shipmentId, tenant); err != nil {
+			return err
+		}
+		for _, dependent := range d.Dependents {
+			if _, err := dependent.Trash.RestoreByKeyValue(ctx, "shipmentid", shipmentId, tenant, deletedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HasFeedEmails blocks deleting shipments that emails have been filed against.
+func HasFeedEmails(feedEmailCollection database.Collection[database.FeedEmail, database.FeedEmailResponse]) func(ctx context.Context, shipmentId string, tenant string) (bool, error) {
+	return func(ctx context.Context, shipmentId string, tenant string) (bool, error) {
+		feedEmails, err := feedEmailCollection.GetAllByKeyValue(ctx, "shipmentid", shipmentId, tenant)
+		return len(feedEmails) > 0, err
+	}
+}
+
+// HasIssuedInvoice blocks deleting shipments whose PDA is no longer a draft, or that have FDA costs.
+func HasIssuedInvoice(invoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse]) func(ctx context.Context, shipmentId string, tenant string) (bool, error) {
+	return func(ctx context.Context, shipmentId string, tenant string) (bool, error) {
+		invoice, err := invoicePricingCollection.GetByKeyValue(ctx, "shipmentid", shipmentId, tenant)
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return !invoice.IsDraft || len(invoice.FDACosts) > 0, nil
+	}
+}
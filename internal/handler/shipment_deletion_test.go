@@ -0,0 +1,121 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeTrash records what was moved in and out of it, by shipment ID.
+type fakeTrash struct {
+	deletedAt time.Time
+	deleted   []string
+	restored  []string
+	since     time.Time
+}
+
+func (t *fakeTrash) GetDeleted(ctx context.Context, tenant string) (interface{}, error) {
+	return t.deleted, nil
+}
+
+func (t *fakeTrash) DeletedAt(ctx context.Context, id string, tenant string) (time.Time, error) {
+	return t.deletedAt, nil
+}
+
+func (t *fakeTrash) Restore(ctx context.Context, id string, tenant string) error {
+	t.restored = append(t.restored, id)
+	return nil
+}
+
+func (t *fakeTrash) DeleteByKeyValue(ctx context.Context, key string, value string, tenant string) (int64, error) {
+	t.deleted = append(t.deleted, value)
+	return 1, nil
+}
+
+func (t *fakeTrash) RestoreByKeyValue(ctx context.Context, key string, value string, tenant string, deletedSince time.Time) (int64, error) {
+	t.restored = append(t.restored, value)
+	t.since = deletedSince
+	return 1, nil
+}
+
+func (t *fakeTrash) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestShipmentHandler_DeleteShipmentById_Dependents(t *testing.T) {
+	blocks := func(ctx context.Context, shipmentId string, tenant string) (bool, error) {
+		return true, nil
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+		deleted  bool
+	}{
+		{name: "blocked", url: "/shipments/1", expected: http.StatusConflict},
+		{name: "cascade", url: "/shipments/1?cascade=true", expected: http.StatusOK, deleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCollection := new(MockShipmentCollection)
+			checklists := &fakeTrash{}
+			feedEmails := &fakeTrash{}
+			transactor := &fakeTransactor{}
+			deletion := NewShipmentDeletion(database.NewUnitOfWork(transactor), mockCollection, nil, []ShipmentDependent{
+				{Name: "checklist", Trash: checklists},
+				{Name: "feed emails", Trash: feedEmails, Blocks: blocks},
+			})
+			handler := NewShipmentHandler(mockCollection, nil, deletion)
+
+			r := chi.NewRouter()
+			r.Delete("/shipments/{shipment_id}", handler.DeleteShipmentById)
+
+			mockCollection.On("GetByID", mock.Anything, "1", mock.Anything).Return(database.ShipmentResponse{ID: "1"}, nil)
+			if tt.deleted {
+				mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
+			}
+
+			req := httptest.NewRequest("DELETE", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			assert.Equal(t, tt.deleted, transactor.committed)
+			if tt.deleted {
+				assert.Equal(t, []string{"1"}, checklists.deleted)
+				assert.Equal(t, []string{"1"}, feedEmails.deleted)
+			} else {
+				assert.Contains(t, w.Body.String(), "feed emails")
+				assert.Empty(t, checklists.deleted)
+			}
+			mockCollection.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShipmentDeletion_Restore(t *testing.T) {
+	deletedAt := time.Date(2024, time.May, 22, 12, 0, 0, 0, time.UTC)
+	shipments := &fakeTrash{deletedAt: deletedAt}
+	checklists := &fakeTrash{}
+	deletion := NewShipmentDeletion(database.NewUnitOfWork(&fakeTransactor{}), nil, shipments, []ShipmentDependent{
+		{Name: "checklist", Trash: checklists},
+	})
+
+	err := deletion.Restore(context.Background(), "1", "tenantA")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, shipments.restored)
+	assert.Equal(t, []string{"1"}, checklists.restored)
+	// dependents deleted on their own before the shipment stay in the trash
+	assert.Equal(t, deletedAt, checklists.since)
+}
@@ -1,17 +1,12 @@
 package handler
 
 import (
-	"backend-crm/internal/clients"
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"backend-crm/pkg/enum"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -20,13 +15,19 @@ import (
 
 type ShipmentHandler struct {
 	ShipmentCollection database.Collection[database.Shipment, database.ShipmentResponse]
+	Provisioner        *ShipmentProvisioner
+	Deletion           *ShipmentDeletion
 }
 
 func NewShipmentHandler(
 	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
+	provisioner *ShipmentProvisioner,
+	deletion *ShipmentDeletion,
 ) *ShipmentHandler {
 	return &ShipmentHandler{
 		ShipmentCollection: shipmentCollection,
+		Provisioner:        provisioner,
+		Deletion:           deletion,
 	}
 }
 
@@ -35,8 +36,7 @@ type getAllShipmentsResponse struct {
 }
 
 func (h *ShipmentHandler) GetAllShipment(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	var shipmentsList []database.ShipmentResponse
 
 	shipmentsList, err := h.ShipmentCollection.GetAll(r.Context(), tenant)
@@ -55,10 +55,12 @@ func (h *ShipmentHandler) GetAllShipment(w http.ResponseWriter, r *http.Request)
 	for _, shipment := range shipmentsList {
 		shipments = append(shipments, database.ShipmentResponse{
 			ID:                   shipment.ID,
+			Version:              shipment.Version,
 			Tenant:               shipment.Tenant,
 			MasterEmail:          shipment.MasterEmail,
 			InitialETA:           shipment.InitialETA,
 			CurrentETA:           shipment.CurrentETA,
+			CurrentETAText:       shipment.CurrentETAText,
 			VoyageNumber:         shipment.VoyageNumber,
 			CurrentStatus:        shipment.CurrentStatus,
 			ShipmentType:         shipment.ShipmentType,
@@ -95,10 +97,12 @@ func (h *ShipmentHandler) GetAllShipmentForETAReminder(w http.ResponseWriter, r
 	for _, shipment := range shipmentsList {
 		shipments = append(shipments, database.ShipmentResponse{
 			ID:                   shipment.ID,
+			Version:              shipment.Version,
 			Tenant:               shipment.Tenant,
 			MasterEmail:          shipment.MasterEmail,
 			InitialETA:           shipment.InitialETA,
 			CurrentETA:           shipment.CurrentETA,
+			CurrentETAText:       shipment.CurrentETAText,
 			VoyageNumber:         shipment.VoyageNumber,
 			CurrentStatus:        shipment.CurrentStatus,
 			ShipmentType:         shipment.ShipmentType,
@@ -113,8 +117,7 @@ func (h *ShipmentHandler) GetAllShipmentForETAReminder(w http.ResponseWriter, r
 }
 
 func (h *ShipmentHandler) CreateShipment(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createShipmentParams database.Shipment
 	log.Println(r.Body)
@@ -126,13 +129,15 @@ func (h *ShipmentHandler) CreateShipment(w http.ResponseWriter, r *http.Request)
 	createShipmentParams.Tenant = tenant
 
 	log.Println(createShipmentParams)
-	shipment_id, err := h.ShipmentCollection.Create(r.Context(), createShipmentParams)
+	// Creates the checklist, PDA draft and notifications along with the shipment, see ShipmentProvisioner
+	shipment_id, err := h.Provisioner.CreateShipment(r.Context(), createShipmentParams)
 
 	if err != nil {
 		if errors.Is(err, database.ErrDuplicateKey) {
 			render.Render(w, r, ErrDuplicate(err))
 			return
 		}
+		log.Printf("Error creating shipment: %v", err)
 		render.Render(w, r, ErrInternalServerError)
 		return
 	}
@@ -146,52 +151,23 @@ func (h *ShipmentHandler) CreateShipment(w http.ResponseWriter, r *http.Request)
 		Data:           shipment_id,
 	}
 	render.Render(w, r, response)
-
-	// Send WhatsApp message
-
-	// Convert to local time
-	// Load the location for GMT+8
-	// location, err := time.LoadLocation("Asia/Singapore")
-	// if err != nil {
-	// 	log.Println("Error loading location:", err)
-	// 	return
-	// }
-	systemTimeNow := time.Now()
-	systemTimeNowLocation := systemTimeNow.Location()
-	// Check if the location is not "Local"
-	if systemTimeNowLocation.String() != "Local" {
-		// Define a fixed time zone with +8 hours offset from UTC
-		systemTimeNowLocation = time.FixedZone("UTC+8", 8*60*60)
-
-	}
-	log.Println("Current Time:", systemTimeNow)
-	log.Println("Time Zone Location:", systemTimeNowLocation)
-
-	localETA := createShipmentParams.CurrentETA.In(systemTimeNowLocation)
-	log.Println("this is local ETA")
-
-	log.Println(localETA, "this is local ETA")
-	_, invalid := clients.WhatsAppClient.CreateShipmentWhatsAppMessage(
-		createShipmentParams.ShipmentDetails.Agent.Name,
-		createShipmentParams.VesselSpecifications.VesselName,
-		strconv.FormatInt(createShipmentParams.VesselSpecifications.ImoNumber, 10), // Convert int64 to string
-		localETA.Format("02-Jan-2006"),
-		localETA.Format("15:04"),
-		createShipmentParams.ShipmentDetails.Agent.Contact,
-	)
-	if invalid != nil {
-		log.Printf("Error sending WhatsApp message: %v", err)
-	}
 }
 
+// DeleteShipmentById moves the shipment and its dependents to the trash.
+// Shipments with emails or an issued invoice are only deleted with ?cascade=true.
 func (h *ShipmentHandler) DeleteShipmentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
+	cascade := r.URL.Query().Get("cascade") == "true"
 
-	err := h.ShipmentCollection.Delete(r.Context(), _id)
+	err := h.Deletion.Delete(r.Context(), _id, tenant, cascade)
 	if err != nil {
+		var dependentsErr *ShipmentDependentsError
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.As(err, &dependentsErr) {
+			render.Render(w, r, ErrDuplicate(err))
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -205,20 +181,29 @@ func (h *ShipmentHandler) DeleteShipmentById(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *ShipmentHandler) UpdateShipmentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 	log.Println(r)
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateShipmentParams database.Shipment
 	if err := json.NewDecoder(r.Body).Decode(&updateShipmentParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateShipmentParams.Tenant = tenant
 	// log.Println(updateShipmentParams)
-	err := h.ShipmentCollection.Update(r.Context(), _id, updateShipmentParams)
+	err := h.ShipmentCollection.Update(ctx, _id, tenant, updateShipmentParams)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -231,9 +216,32 @@ func (h *ShipmentHandler) UpdateShipmentById(w http.ResponseWriter, r *http.Requ
 	render.Render(w, r, SuccessOK)
 }
 
+// requiredShipmentFields are the fields a shipment is matched, reminded and moved through its statuses by,
+// which a patch may change but not remove.
+var requiredShipmentFields = []patchField{
+	{Path: "masteremail", JSONPath: "master_email"},
+	{Path: "currenteta", JSONPath: "current_ETA"},
+	{Path: "currentstatus", JSONPath: "current_status"},
+}
+
+// PatchShipmentById changes only the fields in the JSON merge patch, e.g. {"current_status": "Berthed"}.
+func (h *ShipmentHandler) PatchShipmentById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "shipment_id")
+
+	patchDocument(w, r, h.ShipmentCollection, _id, tenant, func(patch database.Patch) error {
+		if err := refuseRemoving(patch, requiredShipmentFields...); err != nil {
+			return err
+		}
+		if status, ok := patch.Value("currentstatus"); ok && !enum.IsValidShipmentStatus(status.(enum.ShipmentStatus)) {
+			return errors.New("unknown shipment status: " + string(status.(enum.ShipmentStatus)))
+		}
+		return nil
+	})
+}
+
 func (h *ShipmentHandler) GetShipmentFromId(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "shipment_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -251,10 +259,12 @@ func (h *ShipmentHandler) GetShipmentFromId(w http.ResponseWriter, r *http.Reque
 
 	response := database.ShipmentResponse{
 		ID:                   shipment.ID,
+		Version:              shipment.Version,
 		Tenant:               shipment.Tenant,
 		MasterEmail:          shipment.MasterEmail,
 		InitialETA:           shipment.InitialETA,
 		CurrentETA:           shipment.CurrentETA,
+		CurrentETAText:       shipment.CurrentETAText,
 		VoyageNumber:         shipment.VoyageNumber,
 		CurrentStatus:        shipment.CurrentStatus,
 		ShipmentType:         shipment.ShipmentType,
@@ -263,12 +273,12 @@ func (h *ShipmentHandler) GetShipmentFromId(w http.ResponseWriter, r *http.Reque
 		CreatedAt:            shipment.CreatedAt,
 		UpdatedAt:            shipment.UpdatedAt,
 	}
+	setETag(w, shipment.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *ShipmentHandler) FilterShipment(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -283,10 +293,12 @@ func (h *ShipmentHandler) FilterShipment(w http.ResponseWriter, r *http.Request)
 	}
 	response := database.ShipmentResponse{
 		ID:                   shipment.ID,
+		Version:              shipment.Version,
 		Tenant:               shipment.Tenant,
 		MasterEmail:          shipment.MasterEmail,
 		InitialETA:           shipment.InitialETA,
 		CurrentETA:           shipment.CurrentETA,
+		CurrentETAText:       shipment.CurrentETAText,
 		VoyageNumber:         shipment.VoyageNumber,
 		CurrentStatus:        shipment.CurrentStatus,
 		ShipmentType:         shipment.ShipmentType,
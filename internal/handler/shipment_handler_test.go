@@ -2,6 +2,7 @@ package handler
 
 import (
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
 	"backend-crm/pkg/core"
 	"backend-crm/pkg/enum"
 	"bytes"
@@ -15,6 +16,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type MockWhatsAppClient struct {
@@ -55,19 +57,24 @@ func (m *MockShipmentCollection) GetAllByKeyValue(ctx context.Context, key strin
 	return args.Get(0).([]database.ShipmentResponse), args.Error(1)
 }
 
-func (m *MockShipmentCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockShipmentCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
+	return args.Error(0)
+}
+
+func (m *MockShipmentCollection) Update(ctx context.Context, id string, tenant string, updateShipmentParams database.Shipment) error {
+	args := m.Called(ctx, id, tenant, updateShipmentParams)
 	return args.Error(0)
 }
 
-func (m *MockShipmentCollection) Update(ctx context.Context, id string, updateShipmentParams database.Shipment) error {
-	args := m.Called(ctx, id, updateShipmentParams)
+func (m *MockShipmentCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
 	return args.Error(0)
 }
 
 func TestShipmentHandler_GetAllShipment(t *testing.T) {
 	mockCollection := new(MockShipmentCollection)
-	handler := NewShipmentHandler(mockCollection)
+	handler := NewShipmentHandler(mockCollection, nil, nil)
 
 	r := chi.NewRouter()
 	r.Get("/shipments", handler.GetAllShipment)
@@ -183,7 +190,7 @@ func TestShipmentHandler_GetAllShipment(t *testing.T) {
 
 // func TestShipmentHandler_CreateShipment(t *testing.T) {
 // 	mockCollection := new(MockShipmentCollection)
-// 	handler := NewShipmentHandler(mockCollection)
+// 	handler := NewShipmentHandler(mockCollection, nil, nil)
 // 	mockWhatsAppClient := new(MockWhatsAppClient)
 
 // 	r := chi.NewRouter()
@@ -291,7 +298,7 @@ func TestShipmentHandler_GetAllShipment(t *testing.T) {
 
 func TestShipmentHandler_GetShipmentFromId(t *testing.T) {
 	mockCollection := new(MockShipmentCollection)
-	handler := NewShipmentHandler(mockCollection)
+	handler := NewShipmentHandler(mockCollection, nil, nil)
 
 	r := chi.NewRouter()
 	r.Get("/shipments/{shipment_id}", handler.GetShipmentFromId)
@@ -430,12 +437,12 @@ func TestShipmentHandler_GetShipmentFromId(t *testing.T) {
 
 func TestShipmentHandler_UpdateShipmentById(t *testing.T) {
 	mockCollection := new(MockShipmentCollection)
-	handler := NewShipmentHandler(mockCollection)
+	handler := NewShipmentHandler(mockCollection, nil, nil)
 
 	r := chi.NewRouter()
 	r.Put("/shipments/{shipment_id}", handler.UpdateShipmentById)
 
-	mockCollection.On("Update", mock.Anything, "1", mock.MatchedBy(func(shipment database.Shipment) bool {
+	mockCollection.On("Update", mock.Anything, "1", "customerA", mock.MatchedBy(func(shipment database.Shipment) bool {
 		return shipment.MasterEmail == "james@gmail.com" && shipment.Tenant == "customerA" && shipment.ShipmentType.CargoOperations.CargoOperationsActivity[0].TerminalName == "Terminal A"
 	})).Return(nil)
 
@@ -526,6 +533,8 @@ func TestShipmentHandler_UpdateShipmentById(t *testing.T) {
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("shipment_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -534,14 +543,121 @@ func TestShipmentHandler_UpdateShipmentById(t *testing.T) {
 	mockCollection.AssertExpectations(t)
 }
 
+func TestShipmentHandler_UpdateShipmentById_Versioning(t *testing.T) {
+	tests := []struct {
+		name      string
+		ifMatch   string
+		updateErr error
+		update    bool
+		expected  int
+	}{
+		{name: "missing If-Match", expected: http.StatusPreconditionRequired},
+		{name: "not an ETag", ifMatch: "latest", expected: http.StatusPreconditionFailed},
+		{name: "stale version", ifMatch: `"3"`, updateErr: database.ErrVersionConflict, update: true, expected: http.StatusPreconditionFailed},
+		{name: "weak ETag", ifMatch: `W/"4"`, expected: http.StatusPreconditionFailed},
+		{name: "deleted meanwhile", ifMatch: `"4"`, updateErr: mongo.ErrNoDocuments, update: true, expected: http.StatusNotFound},
+		{name: "current version", ifMatch: `"4"`, update: true, expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCollection := new(MockShipmentCollection)
+			handler := NewShipmentHandler(mockCollection, nil, nil)
+
+			r := chi.NewRouter()
+			r.Put("/shipments/{shipment_id}", handler.UpdateShipmentById)
+
+			if tt.update {
+				mockCollection.On("Update", mock.MatchedBy(func(ctx context.Context) bool {
+					_, ok := database.ExpectedVersion(ctx)
+					return ok
+				}), "1", mock.Anything, mock.Anything).Return(tt.updateErr)
+			}
+
+			req := httptest.NewRequest("PUT", "/shipments/1", bytes.NewBufferString(`{"master_email": "james@gmail.com"}`))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			mockCollection.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShipmentHandler_GetShipmentFromId_SetsETag(t *testing.T) {
+	mockCollection := new(MockShipmentCollection)
+	handler := NewShipmentHandler(mockCollection, nil, nil)
+
+	r := chi.NewRouter()
+	r.Get("/shipments/{shipment_id}", handler.GetShipmentFromId)
+
+	mockCollection.On("GetByID", mock.Anything, "1", mock.Anything).Return(database.ShipmentResponse{ID: "1", Version: 7}, nil)
+
+	req := httptest.NewRequest("GET", "/shipments/1", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"7"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"version":7`)
+}
+
+func TestShipmentHandler_PatchShipmentById(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		patchErr error
+		patch    bool
+		expected int
+	}{
+		{name: "changed status", body: `{"current_status": "Berthed"}`, patch: true, expected: http.StatusOK},
+		{name: "unknown status", body: `{"current_status": "Sunk"}`, expected: http.StatusBadRequest},
+		{name: "removed status", body: `{"current_status": null}`, expected: http.StatusBadRequest},
+		{name: "removed ETA", body: `{"current_ETA": null}`, expected: http.StatusBadRequest},
+		{name: "unknown field", body: `{"captain": "Haddock"}`, expected: http.StatusBadRequest},
+		{name: "missing shipment", body: `{"voyage_number": "V2"}`, patchErr: mongo.ErrNoDocuments, patch: true, expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCollection := new(MockShipmentCollection)
+			handler := NewShipmentHandler(mockCollection, nil, nil)
+
+			r := chi.NewRouter()
+			r.Patch("/shipments/{shipment_id}", handler.PatchShipmentById)
+
+			if tt.patch {
+				mockCollection.On("Patch", mock.Anything, "1", mock.Anything, mock.MatchedBy(func(patch database.Patch) bool {
+					return len(patch.Unset) == 0 && len(patch.Set) == 2
+				})).Return(tt.patchErr)
+			}
+
+			req := httptest.NewRequest("PATCH", "/shipments/1", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			mockCollection.AssertExpectations(t)
+		})
+	}
+}
+
 func TestShipmentHandler_DeleteShipmentById(t *testing.T) {
 	mockCollection := new(MockShipmentCollection)
-	handler := NewShipmentHandler(mockCollection)
+	deletion := NewShipmentDeletion(database.NewUnitOfWork(&fakeTransactor{}), mockCollection, nil, nil)
+	handler := NewShipmentHandler(mockCollection, nil, deletion)
 
 	r := chi.NewRouter()
 	r.Delete("/shipments/{shipment_id}", handler.DeleteShipmentById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("GetByID", mock.Anything, "1", mock.Anything).Return(database.ShipmentResponse{ID: "1"}, nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/shipments/1", nil)
 	rctx := chi.NewRouteContext()
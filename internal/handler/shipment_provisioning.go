@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"backend-crm/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Names of the provisioning steps, as used in config.Provisioning.
+const (
+	PROVISIONING_STEP_CHECKLIST     string = "checklist"
+	PROVISIONING_STEP_PDA           string = "pda"
+	PROVISIONING_STEP_NOTIFICATIONS string = "notifications"
+)
+
+// ShipmentProvisioningStep creates something a new shipment needs, such as its checklist.
+// Steps run inside the transaction that creates the shipment and must do all their writes with the ctx they are given.
+type ShipmentProvisioningStep interface {
+	Name() string
+	Provision(ctx context.Context, shipment database.ShipmentResponse) error
+}
+
+// ShipmentProvisioner creates a shipment and runs the provisioning steps for it in one unit of work,
+// so a failing step leaves neither the shipment nor anything an earlier step created.
+type ShipmentProvisioner struct {
+	UnitOfWork         *database.UnitOfWork
+	ShipmentCollection database.Collection[database.Shipment, database.ShipmentResponse]
+	Steps              []ShipmentProvisioningStep
+}
+
+func NewShipmentProvisioner(
+	unitOfWork *database.UnitOfWork,
+	shipmentCollection database.Collection[database.Shipment, database.ShipmentResponse],
+	steps []ShipmentProvisioningStep,
+) *ShipmentProvisioner {
+	return &ShipmentProvisioner{
+		UnitOfWork:         unitOfWork,
+		ShipmentCollection: shipmentCollection,
+		Steps:              steps,
+	}
+}
+
+// CreateShipment returns the ID of the new shipment. The error of a failing step is wrapped with the step's name.
+func (p *ShipmentProvisioner) CreateShipment(ctx context.Context, shipment database.Shipment) (string, error) {
+	var created database.ShipmentResponse
+	err := p.UnitOfWork.Do(ctx, func(ctx context.Context) error {
+		shipmentId, err := p.ShipmentCollection.Create(ctx, shipment)
+		if err != nil {
+			return err
+		}
+
+		created, err = p.ShipmentCollection.GetByID(ctx, shipmentId, shipment.Tenant)
+		if err != nil {
+			return err
+		}
+
+		for _, step := range p.Steps {
+			if err := step.Provision(ctx, created); err != nil {
+				return fmt.Errorf("provisioning %s: %w", step.Name(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// SelectShipmentProvisioningSteps picks the configured steps, in the configured order, from the available ones.
+func SelectShipmentProvisioningSteps(names []string, available ...ShipmentProvisioningStep) ([]ShipmentProvisioningStep, error) {
+	byName := make(map[string]ShipmentProvisioningStep, len(available))
+	for _, step := range available {
+		byName[step.Name()] = step
+	}
+
+	var steps []ShipmentProvisioningStep
+	for _, name := range names {
+		step, ok := byName[name]
+		if !ok {
+			return nil, errors.New("unknown shipment provisioning step: " + name)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// ChecklistProvisioningStep creates the shipment's checklist from the tenant's checklist templates.
+type ChecklistProvisioningStep struct {
+	ChecklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse]
+	ChecklistCollection         database.Collection[database.Checklist, database.ChecklistResponse]
+}
+
+func (s *ChecklistProvisioningStep) Name() string {
+	return PROVISIONING_STEP_CHECKLIST
+}
+
+func (s *ChecklistProvisioningStep) Provision(ctx context.Context, shipment database.ShipmentResponse) error {
+	checklist, err := newChecklistFromTemplates(ctx, s.ChecklistTemplateCollection, shipment)
+	if err != nil {
+		return err
+	}
+	_, err = s.ChecklistCollection.Create(ctx, checklist)
+	return err
+}
+
+// PDAProvisioningStep drafts the shipment's PDA from the tenant's tariff.
+// Tenants without a tariff file get no draft, and the PDA is created by hand as before.
+type PDAProvisioningStep struct {
+	InvoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse]
+	LoadTariff               func(tenant string) (map[string]interface{}, error)
+}
+
+func (s *PDAProvisioningStep) Name() string {
+	return PROVISIONING_STEP_PDA
+}
+
+func (s *PDAProvisioningStep) Provision(ctx context.Context, shipment database.ShipmentResponse) error {
+	tariff, err := s.LoadTariff(shipment.Tenant)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("No tariff for tenant %s, skipping PDA draft", shipment.Tenant)
+			return nil
+		}
+		return err
+	}
+
+	details := utils.DraftPDAInvoicePricingDetails(tariff, shipment.VesselSpecifications.GRT, shipmentTerminal(shipment))
+	_, err = s.InvoicePricingCollection.Create(ctx, database.InvoicePricing{
+		Tenant:                shipment.Tenant,
+		ShipmentID:            shipment.ID,
+		InvoicePricingDetails: details,
+		IsDraft:               true,
+	})
+	return err
+}
+
+// NotificationProvisioningStep queues the WhatsApp message telling the agent about the new shipment.
+// It is sent once the shipment has committed, or retried by the timer, see DispatchPendingNotifications.
+type NotificationProvisioningStep struct {
+	NotificationCollection database.Collection[database.Notification, database.NotificationResponse]
+}
+
+func (s *NotificationProvisioningStep) Name() string {
+	return PROVISIONING_STEP_NOTIFICATIONS
+}
+
+func (s *NotificationProvisioningStep) Provision(ctx context.Context, shipment database.ShipmentResponse) error {
+	agent := shipment.ShipmentDetails.Agent
+	if agent.Contact == "" {
+		return nil
+	}
+
+	// Show the ETA in the agent's own timezone
+	localETA := shipment.CurrentETA.In(config.RecipientLocation(agent.Timezone, shipment.Tenant))
+	_, err := s.NotificationCollection.Create(ctx, database.Notification{
+		Tenant:     shipment.Tenant,
+		ShipmentID: shipment.ID,
+		Kind:       enum.NOTIFICATION_KIND_SHIPMENT_CREATED,
+		Recipient:  agent.Contact,
+		Params: map[string]string{
+			"agent_name":  agent.Name,
+			"vessel_name": shipment.VesselSpecifications.VesselName,
+			"imo_number":  strconv.FormatInt(shipment.VesselSpecifications.ImoNumber, 10),
+			"eta_date":    localETA.Format("02-Jan-2006"),
+			"eta_time":    localETA.Format("15:04"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	database.AfterCommit(ctx, func(ctx context.Context) {
+		DispatchPendingNotifications(ctx, s.NotificationCollection, shipment.Tenant)
+	})
+	return nil
+}
+
+// shipmentTerminal is the terminal of the shipment's first activity that names one.
+func shipmentTerminal(shipment database.ShipmentResponse) string {
+	for _, activity := range shipment.ShipmentType.CargoOperations.CargoOperationsActivity {
+		if activity != nil && activity.TerminalName != "" {
+			return activity.TerminalName
+		}
+	}
+	for _, activity := range shipment.ShipmentType.OwnerMatters.Activity {
+		if activity != nil && activity.TerminalName != "" {
+			return activity.TerminalName
+		}
+	}
+	return ""
+}
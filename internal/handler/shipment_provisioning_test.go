@@ -0,0 +1,125 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeTransactor runs fn directly and records whether the transaction would have committed.
+type fakeTransactor struct {
+	committed  bool
+	rolledBack bool
+}
+
+func (t *fakeTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		t.rolledBack = true
+		return err
+	}
+	t.committed = true
+	return nil
+}
+
+// fakeProvisioningStep records its calls, and whether the hook it registers ran after commit.
+type fakeProvisioningStep struct {
+	name        string
+	err         error
+	calls       int
+	afterCommit bool
+}
+
+func (s *fakeProvisioningStep) Name() string {
+	return s.name
+}
+
+func (s *fakeProvisioningStep) Provision(ctx context.Context, shipment database.ShipmentResponse) error {
+	s.calls++
+	database.AfterCommit(ctx, func(ctx context.Context) {
+		s.afterCommit = true
+	})
+	return s.err
+}
+
+func TestShipmentHandler_CreateShipment_Provisions(t *testing.T) {
+	mockShipmentCollection := new(MockShipmentCollection)
+	mockTemplateCollection := new(MockChecklistTemplateCollection)
+	mockChecklistCollection := new(MockChecklistCollection)
+	transactor := &fakeTransactor{}
+
+	notifications := &fakeProvisioningStep{name: PROVISIONING_STEP_NOTIFICATIONS}
+	provisioner := NewShipmentProvisioner(database.NewUnitOfWork(transactor), mockShipmentCollection, []ShipmentProvisioningStep{
+		&ChecklistProvisioningStep{ChecklistTemplateCollection: mockTemplateCollection, ChecklistCollection: mockChecklistCollection},
+		notifications,
+	})
+	handler := NewShipmentHandler(mockShipmentCollection, provisioner, nil)
+
+	r := chi.NewRouter()
+	r.Post("/shipments", handler.CreateShipment)
+
+	mockShipmentCollection.On("Create", mock.Anything, mock.Anything).Return("abc123", nil)
+	mockShipmentCollection.On("GetByID", mock.Anything, "abc123", mock.Anything).Return(database.ShipmentResponse{ID: "abc123", Tenant: "tenantA"}, nil)
+	mockTemplateCollection.On("GetAll", mock.Anything, "tenantA").Return([]database.ChecklistTemplateResponse{}, nil)
+	mockChecklistCollection.On("Create", mock.Anything, mock.MatchedBy(func(checklist database.Checklist) bool {
+		return checklist.ShipmentID == "abc123" && len(checklist.Items) == len(core.DefaultChecklistTemplateItems)
+	})).Return("checklist1", nil)
+
+	req := httptest.NewRequest("POST", "/shipments", bytes.NewBufferString(`{"vessel_specifications": {"vessel_name": "UOG IOANNIS V"}}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), "abc123")
+	assert.True(t, transactor.committed)
+	assert.True(t, notifications.afterCommit)
+	mockChecklistCollection.AssertExpectations(t)
+}
+
+func TestShipmentHandler_CreateShipment_RollsBackOnStepFailure(t *testing.T) {
+	mockShipmentCollection := new(MockShipmentCollection)
+	transactor := &fakeTransactor{}
+
+	failing := &fakeProvisioningStep{name: PROVISIONING_STEP_PDA, err: errors.New("tariff unreadable")}
+	notifications := &fakeProvisioningStep{name: PROVISIONING_STEP_NOTIFICATIONS}
+	provisioner := NewShipmentProvisioner(database.NewUnitOfWork(transactor), mockShipmentCollection, []ShipmentProvisioningStep{failing, notifications})
+	handler := NewShipmentHandler(mockShipmentCollection, provisioner, nil)
+
+	r := chi.NewRouter()
+	r.Post("/shipments", handler.CreateShipment)
+
+	mockShipmentCollection.On("Create", mock.Anything, mock.Anything).Return("abc123", nil)
+	mockShipmentCollection.On("GetByID", mock.Anything, "abc123", mock.Anything).Return(database.ShipmentResponse{ID: "abc123"}, nil)
+
+	req := httptest.NewRequest("POST", "/shipments", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.True(t, transactor.rolledBack)
+	assert.False(t, failing.afterCommit)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 0, notifications.calls)
+}
+
+func TestSelectShipmentProvisioningSteps(t *testing.T) {
+	checklist := &fakeProvisioningStep{name: PROVISIONING_STEP_CHECKLIST}
+	pda := &fakeProvisioningStep{name: PROVISIONING_STEP_PDA}
+
+	steps, err := SelectShipmentProvisioningSteps([]string{"pda", "checklist"}, checklist, pda)
+	assert.NoError(t, err)
+	assert.Equal(t, []ShipmentProvisioningStep{pda, checklist}, steps)
+
+	_, err = SelectShipmentProvisioningSteps([]string{"fax"}, checklist, pda)
+	assert.Error(t, err)
+}
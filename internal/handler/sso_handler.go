@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Single sign-on with a tenant's OpenID Connect identity provider, set up with crmctl tenant sso. Start sends the user
+// to log in with the provider, which sends them back to Callback; their user is created, or their role updated, from
+// the ID token's claims and they are given a session as if they had logged in with a password.
+// Two-factor authentication is left to the provider.
+
+const (
+	// ssoLoginTTL is how long a user has to log in with their identity provider
+	ssoLoginTTL = 10 * time.Minute
+	// ssoProviderTTL is how long a provider's discovery document is used before it is fetched again
+	ssoProviderTTL  = time.Hour
+	ssoStateCookie  = "ssoState"
+	ssoCallbackPath = "/callback"
+)
+
+type SSOHandler struct {
+	TenantCollection   database.Collection[database.Tenant, database.TenantResponse]
+	LoginCollection    database.Collection[database.TenantUser, database.TenantUserResponse]
+	SSOLoginCollection database.Collection[database.SSOLogin, database.SSOLoginResponse]
+	Login              *LoginHandler
+	Client             *http.Client
+	CallbackBaseURL    string
+	SuccessURL         string
+
+	providersMu sync.Mutex
+	providers   map[string]cachedOIDCProvider
+}
+
+type cachedOIDCProvider struct {
+	provider  *auth.OIDCProvider
+	fetchedAt time.Time
+}
+
+func NewSSOHandler(
+	tenantCollection database.Collection[database.Tenant, database.TenantResponse],
+	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
+	ssoLoginCollection database.Collection[database.SSOLogin, database.SSOLoginResponse],
+	login *LoginHandler,
+	cfg config.SSO,
+) *SSOHandler {
+	return &SSOHandler{
+		TenantCollection:   tenantCollection,
+		LoginCollection:    loginCollection,
+		SSOLoginCollection: ssoLoginCollection,
+		Login:              login,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		CallbackBaseURL:    strings.TrimSuffix(cfg.SSOCallbackBaseURL, "/"),
+		SuccessURL:         cfg.SSOSuccessURL,
+		providers:          make(map[string]cachedOIDCProvider),
+	}
+}
+
+// Start sends the user to log in with their tenant's identity provider.
+func (h *SSOHandler) Start(w http.ResponseWriter, r *http.Request) {
+	tenant := chi.URLParam(r, "tenant")
+	sso, ok := h.tenantSSO(w, r, tenant)
+	if !ok {
+		return
+	}
+	provider, err := h.provider(r.Context(), sso.Issuer)
+	if err != nil {
+		log.Printf("Error discovering identity provider of tenant %s: %v", tenant, err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	state, err := auth.NewOIDCNonce()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	nonce, err := auth.NewOIDCNonce()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	_, err = h.SSOLoginCollection.Create(r.Context(), database.SSOLogin{
+		Tenant:       tenant,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ssoLoginTTL),
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+
+	// the state is also kept in the browser, so that a login started by someone else cannot be finished in it.
+	// It is sent back on the provider's redirect, a top level navigation, which SameSite=Lax allows.
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    state,
+		Path:     "/login/sso/",
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(ssoLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(sso.ClientID, h.redirectURI(tenant), state, nonce, challenge), http.StatusFound)
+}
+
+// Callback finishes the login the identity provider sent the user back from, and logs them in.
+func (h *SSOHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	tenant := chi.URLParam(r, "tenant")
+	query := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: ssoStateCookie, Value: "", Path: "/login/sso/", MaxAge: -1, HttpOnly: true, Secure: true})
+
+	if providerError := query.Get("error"); providerError != "" {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "the identity provider refused the login: "+providerError)
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(ssoStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.refuse(w, r, tenant, http.StatusBadRequest, "the state does not match the browser's")
+		return
+	}
+
+	login, err := h.SSOLoginCollection.GetByKeyValue(r.Context(), "state", state, tenant)
+	if err == mongo.ErrNoDocuments {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "unknown or used state")
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	// each login is finished once, the second of two callbacks racing with the same state finds it deleted
+	err = h.SSOLoginCollection.Delete(r.Context(), login.ID, tenant)
+	if err == mongo.ErrNoDocuments {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "unknown or used state")
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if time.Now().After(login.ExpiresAt) {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "the login expired")
+		return
+	}
+
+	sso, ok := h.tenantSSO(w, r, tenant)
+	if !ok {
+		return
+	}
+	provider, err := h.provider(r.Context(), sso.Issuer)
+	if err != nil {
+		log.Printf("Error discovering identity provider of tenant %s: %v", tenant, err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	idToken, err := provider.Exchange(r.Context(), sso.ClientID, sso.ClientSecret, h.redirectURI(tenant), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "exchanging the code: "+err.Error())
+		return
+	}
+	claims, err := provider.VerifyIDToken(r.Context(), idToken, sso.ClientID, login.Nonce)
+	if err != nil {
+		h.refuse(w, r, tenant, http.StatusUnauthorized, "verifying the ID token: "+err.Error())
+		return
+	}
+
+	email, role, err := ssoIdentity(claims, *sso, tenant)
+	if err != nil {
+		h.refuse(w, r, tenant, http.StatusForbidden, err.Error())
+		return
+	}
+	user, err := h.ssoUser(r.Context(), tenant, email, role)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if user.Disabled {
+		h.refuse(w, r, tenant, http.StatusForbidden, email+" is disabled")
+		return
+	}
+
+	tokenString, sessionID, err := h.Login.startSession(w, r, email, tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	if h.SuccessURL != "" {
+		http.Redirect(w, r, h.SuccessURL, http.StatusFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"jwtToken":  tokenString,
+		"sessionID": sessionID,
+	})
+}
+
+// tenantSSO is the identity provider of an enabled tenant that has one.
+func (h *SSOHandler) tenantSSO(w http.ResponseWriter, r *http.Request, tenant string) (*database.TenantSSO, bool) {
+	stored, err := h.TenantCollection.GetByKeyValue(r.Context(), "tenant", tenant, tenant)
+	if err == mongo.ErrNoDocuments || err == nil && stored.SSO == nil {
+		render.Render(w, r, ErrNotFound)
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return nil, false
+	}
+	if stored.Disabled || config.IsTenantDisabled(tenant) {
+		http.Error(w, "Account disabled", http.StatusForbidden)
+		return nil, false
+	}
+	return stored.SSO, true
+}
+
+// provider is the identity provider of issuer, discovered again once its discovery document is ssoProviderTTL old.
+func (h *SSOHandler) provider(ctx context.Context, issuer string) (*auth.OIDCProvider, error) {
+	h.providersMu.Lock()
+	defer h.providersMu.Unlock()
+	if cached, ok := h.providers[issuer]; ok && time.Since(cached.fetchedAt) < ssoProviderTTL {
+		return cached.provider, nil
+	}
+	provider, err := auth.DiscoverOIDC(ctx, h.Client, issuer)
+	if err != nil {
+		return nil, err
+	}
+	h.providers[issuer] = cachedOIDCProvider{provider: provider, fetchedAt: time.Now()}
+	return provider, nil
+}
+
+func (h *SSOHandler) redirectURI(tenant string) string {
+	return h.CallbackBaseURL + "/login/sso/" + tenant + ssoCallbackPath
+}
+
+// ssoIdentity is the email of the user an ID token is for, which must be in one of the tenant's allowed domains,
+// and their role if the tenant takes roles from a claim, or else empty.
+func ssoIdentity(claims map[string]interface{}, sso database.TenantSSO, tenant string) (string, enum.UserRole, error) {
+	email, _ := claims["email"].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", "", errors.New("the ID token has no email")
+	}
+	// providers that do not say whether they verified the email are trusted for their domains
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return "", "", errors.New(email + " is not verified by the identity provider")
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	allowed := false
+	for _, allowedDomain := range sso.AllowedDomains {
+		if strings.EqualFold(strings.TrimPrefix(allowedDomain, "@"), domain) {
+			allowed = true
+		}
+	}
+	// users belong to the tenant of their email's domain
+	if !allowed || config.MakeMapping(email) != tenant {
+		return "", "", errors.New(email + " is not in one of the tenant's domains")
+	}
+
+	if sso.RoleClaim == "" {
+		return email, "", nil
+	}
+	role := enum.USER_ROLE_MEMBER
+	switch value := claims[sso.RoleClaim].(type) {
+	case string:
+		if value == sso.AdminValue {
+			role = enum.USER_ROLE_ADMIN
+		}
+	case []interface{}:
+		for _, v := range value {
+			if v == sso.AdminValue {
+				role = enum.USER_ROLE_ADMIN
+			}
+		}
+	}
+	return email, role, nil
+}
+
+// ssoUser is the user with email, created as a verified user without a password the first time they log in.
+// When role is set the user's role is kept in step with the identity provider's.
+func (h *SSOHandler) ssoUser(ctx context.Context, tenant string, email string, role enum.UserRole) (database.TenantUserResponse, error) {
+	ctx = database.WithActor(ctx, email)
+	user, err := h.LoginCollection.GetByKeyValue(ctx, "email", email, tenant)
+	if err == mongo.ErrNoDocuments {
+		if role == "" {
+			role = enum.USER_ROLE_MEMBER
+		}
+		if _, err := h.LoginCollection.Create(ctx, database.TenantUser{Email: email, Tenant: tenant, Role: role, EmailVerified: true}); err != nil {
+			return user, err
+		}
+		return h.LoginCollection.GetByKeyValue(ctx, "email", email, tenant)
+	}
+	if err != nil {
+		return user, err
+	}
+
+	changes := bson.D{}
+	if role != "" && user.Role != role {
+		changes = append(changes, bson.E{Key: "role", Value: role})
+	}
+	// the provider has verified the email, e.g. of a user invited who never used their verification link
+	if !user.EmailVerified {
+		changes = append(changes, bson.E{Key: "emailverified", Value: true})
+	}
+	if len(changes) > 0 {
+		if err := h.LoginCollection.Patch(ctx, user.ID, tenant, database.Patch{Set: changes}); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// refuse logs why a single sign-on failed, and tells the user it did.
+func (h *SSOHandler) refuse(w http.ResponseWriter, r *http.Request, tenant string, status int, reason string) {
+	log.Printf("Refused single sign-on to tenant %s from %s: %s", tenant, clientIP(r), reason)
+	http.Error(w, "Single sign-on failed", status)
+}
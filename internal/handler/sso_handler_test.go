@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"backend-crm/pkg/enum"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdentityProvider is an OpenID Connect provider that logs in whoever the test says, once it has checked the
+// code verifier of the login.
+type testIdentityProvider struct {
+	*httptest.Server
+	key        *rsa.PrivateKey
+	challenges map[string]string
+	nonces     map[string]string
+	email      string
+	groups     []string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &testIdentityProvider{key: key, challenges: map[string]string{}, nonces: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		code := r.FormValue("code")
+		if auth.PKCEChallenge(r.FormValue("code_verifier")) != p.challenges[code] {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            p.URL,
+			"aud":            "crm",
+			"sub":            "user-1",
+			"email":          p.email,
+			"email_verified": true,
+			"groups":         p.groups,
+			"nonce":          p.nonces[code],
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize is the user logging in at the provider's authorization URL, which sends them back with a code.
+func (p *testIdentityProvider) authorize(t *testing.T, location string) url.Values {
+	authorization, err := url.Parse(location)
+	require.NoError(t, err)
+	query := authorization.Query()
+	code := "code-" + query.Get("state")
+	p.challenges[code] = query.Get("code_challenge")
+	p.nonces[code] = query.Get("nonce")
+	return url.Values{"code": {code}, "state": {query.Get("state")}}
+}
+
+func TestSSOHandler(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	tenants := database.NewMemoryCollection[database.Tenant, database.TenantResponse]()
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]()
+	sessions := database.NewMemoryCollection[database.Session, database.SessionResponse]()
+	logins := database.NewMemoryCollection[database.SSOLogin, database.SSOLoginResponse]()
+	_, err := tenants.Create(context.Background(), database.Tenant{Tenant: config.CUSTOMERA, SSO: &database.TenantSSO{
+		Issuer:         provider.URL,
+		ClientID:       "crm",
+		ClientSecret:   "secret",
+		AllowedDomains: []string{"customera.com"},
+		RoleClaim:      "groups",
+		AdminValue:     "crm-admins",
+	}})
+	require.NoError(t, err)
+
+	handler := NewSSOHandler(tenants, users, logins, NewLoginHandler(users, sessions, nil), config.SSO{SSOCallbackBaseURL: "https://api.example.com/"})
+	r := chi.NewRouter()
+	r.Get("/login/sso/{tenant}", handler.Start)
+	r.Get("/login/sso/{tenant}/callback", handler.Callback)
+
+	start := func() (string, *http.Cookie) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/login/sso/"+config.CUSTOMERA, nil))
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		return w.Header().Get("Location"), w.Result().Cookies()[0]
+	}
+	callback := func(query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/login/sso/"+config.CUSTOMERA+"/callback?"+query.Encode(), nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	location, cookie := start()
+	assert.Contains(t, location, provider.URL+"/authorize?")
+	assert.Contains(t, location, url.QueryEscape("https://api.example.com/login/sso/"+config.CUSTOMERA+"/callback"))
+	assert.Contains(t, location, "code_challenge_method=S256")
+	assert.Equal(t, ssoStateCookie, cookie.Name)
+
+	// the first login creates the user with the role the provider gives them
+	provider.email, provider.groups = "Ops@customera.com", []string{"staff", "crm-admins"}
+	query := provider.authorize(t, location)
+	w := callback(query, cookie)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response["jwtToken"])
+	session, err := sessions.GetByKeyValue(context.Background(), "sessionid", response["sessionID"], config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, "ops@customera.com", session.Email)
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, enum.USER_ROLE_ADMIN, user.Role)
+	assert.True(t, user.EmailVerified)
+
+	// a state is used once
+	assert.Equal(t, http.StatusUnauthorized, callback(query, cookie).Code)
+
+	// the state must be the one the browser started the login with
+	location, _ = start()
+	_, otherCookie := start()
+	assert.Equal(t, http.StatusBadRequest, callback(provider.authorize(t, location), otherCookie).Code)
+
+	// the role follows the provider's
+	provider.groups = []string{"staff"}
+	location, cookie = start()
+	require.Equal(t, http.StatusOK, callback(provider.authorize(t, location), cookie).Code)
+	user, err = users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.Equal(t, enum.USER_ROLE_MEMBER, user.Role)
+
+	// users of other domains cannot log in to the tenant
+	provider.email = "ops@customerb.com"
+	location, cookie = start()
+	assert.Equal(t, http.StatusForbidden, callback(provider.authorize(t, location), cookie).Code)
+
+	// tenants without single sign-on have nothing to start
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/login/sso/"+config.CUSTOMERB, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
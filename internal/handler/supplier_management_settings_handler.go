@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +9,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type SupplierHandler struct {
@@ -30,8 +29,7 @@ type getAllSuppliersResponse struct {
 }
 
 func (h *SupplierHandler) GetAllSuppliers(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var SuppliersList []database.SupplierManagementResponse
@@ -53,6 +51,7 @@ func (h *SupplierHandler) GetAllSuppliers(w http.ResponseWriter, r *http.Request
 	for _, Supplier := range SuppliersList {
 		Suppliers = append(Suppliers, database.SupplierManagementResponse{
 			ID:                     Supplier.ID,
+			Version:                Supplier.Version,
 			Tenant:                 Supplier.Tenant,
 			SupplierSpecifications: Supplier.SupplierSpecifications,
 			CreatedAt:              Supplier.CreatedAt,
@@ -66,8 +65,7 @@ func (h *SupplierHandler) GetAllSuppliers(w http.ResponseWriter, r *http.Request
 }
 
 func (h *SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.Supplier
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -95,13 +93,14 @@ func (h *SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *SupplierHandler) DeleteSupplierById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "supplier_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.SupplierCollection.Delete(r.Context(), _id)
+	err := h.SupplierCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -116,21 +115,30 @@ func (h *SupplierHandler) DeleteSupplierById(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *SupplierHandler) UpdateSupplierById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "supplier_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Supplier
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.SupplierCollection.Update(r.Context(), _id, updateParams)
+	err := h.SupplierCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -143,9 +151,15 @@ func (h *SupplierHandler) UpdateSupplierById(w http.ResponseWriter, r *http.Requ
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *SupplierHandler) PatchSupplierById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "supplier_id")
+
+	patchDocument(w, r, h.SupplierCollection, _id, tenant, nil)
+}
+
 func (h *SupplierHandler) GetSupplierById(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "supplier_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -164,17 +178,18 @@ func (h *SupplierHandler) GetSupplierById(w http.ResponseWriter, r *http.Request
 
 	response := database.SupplierManagementResponse{
 		ID:                     Supplier.ID,
+		Version:                Supplier.Version,
 		Tenant:                 Supplier.Tenant,
 		SupplierSpecifications: Supplier.SupplierSpecifications,
 		CreatedAt:              Supplier.CreatedAt,
 		UpdatedAt:              Supplier.UpdatedAt,
 	}
+	setETag(w, Supplier.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *SupplierHandler) FilterSupplier(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -190,6 +205,7 @@ func (h *SupplierHandler) FilterSupplier(w http.ResponseWriter, r *http.Request)
 	}
 	response := database.SupplierManagementResponse{
 		ID:                     Supplier.ID,
+		Version:                Supplier.Version,
 		Tenant:                 Supplier.Tenant,
 		SupplierSpecifications: Supplier.SupplierSpecifications,
 		CreatedAt:              Supplier.CreatedAt,
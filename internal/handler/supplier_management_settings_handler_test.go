@@ -2,6 +2,7 @@ package handler
 
 import (
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
 	"backend-crm/pkg/core"
 	"bytes"
 	"context"
@@ -44,13 +45,18 @@ func (m *MockSupplierCollection) GetAllByKeyValue(ctx context.Context, key strin
 	return args.Get(0).([]database.SupplierManagementResponse), args.Error(1)
 }
 
-func (m *MockSupplierCollection) Update(ctx context.Context, id string, supplier database.Supplier) error {
-	args := m.Called(ctx, id, supplier)
+func (m *MockSupplierCollection) Update(ctx context.Context, id string, tenant string, supplier database.Supplier) error {
+	args := m.Called(ctx, id, tenant, supplier)
 	return args.Error(0)
 }
 
-func (m *MockSupplierCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockSupplierCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockSupplierCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
@@ -152,7 +158,7 @@ func TestSupplierHandler_UpdateSupplierById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Put("/supplier_management/{supplier_id}", handler.UpdateSupplierById)
 
-	mockCollection.On("Update", mock.Anything, "1", mock.MatchedBy(func(supplier database.Supplier) bool {
+	mockCollection.On("Update", mock.Anything, "1", "customerA", mock.MatchedBy(func(supplier database.Supplier) bool {
 		return supplier.Tenant == "customerA" && supplier.SupplierSpecifications.Name == "Updated Supplier"
 	})).Return(nil)
 
@@ -168,6 +174,8 @@ func TestSupplierHandler_UpdateSupplierById(t *testing.T) {
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("supplier_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -183,7 +191,7 @@ func TestSupplierHandler_DeleteSupplierById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Delete("/supplier_management/{supplier_id}", handler.DeleteSupplierById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/supplier_management/1", nil)
 	rctx := chi.NewRouteContext()
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// LoadTenants makes the tenants stored in the database known to config.MakeMapping, config.IsTenantDisabled,
+// config.IsTOTPRequired, config.IsSSOEnabled and config.TenantLocation.
+func LoadTenants(ctx context.Context, tenantCollection database.Collection[database.Tenant, database.TenantResponse]) error {
+	tenants, err := tenantCollection.GetAll(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	domains := make(map[string]string)
+	disabled := make(map[string]bool)
+	totpRequired := make(map[string]bool)
+	sso := make(map[string]bool)
+	timezones := make(map[string]string)
+	for _, tenant := range tenants {
+		for _, domain := range tenant.Domains {
+			domains[domain] = tenant.Tenant
+		}
+		if tenant.Disabled {
+			disabled[tenant.Tenant] = true
+		}
+		if tenant.RequireTOTP {
+			totpRequired[tenant.Tenant] = true
+		}
+		if tenant.SSO != nil {
+			sso[tenant.Tenant] = true
+		}
+		if tenant.Timezone != "" {
+			timezones[tenant.Tenant] = tenant.Timezone
+		}
+	}
+	config.SetTenants(domains, disabled, totpRequired, sso)
+	config.SetTenantTimezones(timezones)
+	return nil
+}
+
+// StartTenantRefresh reloads the tenants every interval, so tenants added or disabled with crmctl take effect without a restart.
+func StartTenantRefresh(stopChan chan struct{}, wg *sync.WaitGroup, tenantCollection database.Collection[database.Tenant, database.TenantResponse], interval time.Duration) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			if err := LoadTenants(context.Background(), tenantCollection); err != nil {
+				log.Printf("Error loading tenants: %v", err)
+			}
+			timeLoop(TIMER_LOOP_TENANT_REFRESH, start)
+		case <-stopChan:
+			log.Println("Stopping tenant refresh")
+			return
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTenants(t *testing.T) {
+	ctx := context.Background()
+	tenants := database.NewMemoryCollection[database.Tenant, database.TenantResponse]()
+	_, err := tenants.Create(ctx, database.Tenant{Tenant: "customerC", Domains: []string{"@customerc.com", "@customerc.sg"}, RequireTOTP: true, Timezone: "Europe/Amsterdam"})
+	require.NoError(t, err)
+	_, err = tenants.Create(ctx, database.Tenant{Tenant: config.CUSTOMERB, Disabled: true, SSO: &database.TenantSSO{Issuer: "https://login.customerb.com"}})
+	require.NoError(t, err)
+
+	require.NoError(t, LoadTenants(ctx, tenants))
+	t.Cleanup(func() {
+		config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{})
+		config.SetTenantTimezones(map[string]string{})
+	})
+
+	assert.Equal(t, "customerC", config.MakeMapping("ops@customerc.sg"))
+	assert.Equal(t, config.CUSTOMERA, config.MakeMapping("ops@customera.com"))
+	assert.Equal(t, config.UNKNOWN, config.MakeMapping("ops@customerd.com"))
+	assert.True(t, config.IsKnownTenant("customerC"))
+	assert.True(t, config.IsTenantDisabled(config.CUSTOMERB))
+	assert.False(t, config.IsTenantDisabled("customerC"))
+	assert.True(t, config.IsTOTPRequired("customerC"))
+	assert.True(t, config.IsSSOEnabled(config.CUSTOMERB))
+	assert.False(t, config.IsSSOEnabled("customerC"))
+	assert.False(t, config.IsTOTPRequired(config.CUSTOMERB))
+	assert.Equal(t, "Europe/Amsterdam", config.TenantLocation("customerC").String())
+	assert.Equal(t, config.DEFAULT_TIMEZONE, config.TenantLocation(config.CUSTOMERB).String())
+}
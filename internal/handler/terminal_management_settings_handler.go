@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +9,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type TerminalHandler struct {
@@ -30,8 +29,7 @@ type getAllTerminalsResponse struct {
 }
 
 func (h *TerminalHandler) GetAllTerminals(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var TerminalsList []database.TerminalManagementResponse
@@ -53,6 +51,7 @@ func (h *TerminalHandler) GetAllTerminals(w http.ResponseWriter, r *http.Request
 	for _, Terminal := range TerminalsList {
 		Terminals = append(Terminals, database.TerminalManagementResponse{
 			ID:                     Terminal.ID,
+			Version:                Terminal.Version,
 			Tenant:                 Terminal.Tenant,
 			TerminalSpecifications: Terminal.TerminalSpecifications,
 			CreatedAt:              Terminal.CreatedAt,
@@ -66,8 +65,7 @@ func (h *TerminalHandler) GetAllTerminals(w http.ResponseWriter, r *http.Request
 }
 
 func (h *TerminalHandler) CreateTerminal(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.Terminal
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -95,13 +93,14 @@ func (h *TerminalHandler) CreateTerminal(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *TerminalHandler) DeleteTerminalById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "terminal_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.TerminalCollection.Delete(r.Context(), _id)
+	err := h.TerminalCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -116,21 +115,30 @@ func (h *TerminalHandler) DeleteTerminalById(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *TerminalHandler) UpdateTerminalById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "terminal_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Terminal
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.TerminalCollection.Update(r.Context(), _id, updateParams)
+	err := h.TerminalCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -143,9 +151,15 @@ func (h *TerminalHandler) UpdateTerminalById(w http.ResponseWriter, r *http.Requ
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *TerminalHandler) PatchTerminalById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "terminal_id")
+
+	patchDocument(w, r, h.TerminalCollection, _id, tenant, nil)
+}
+
 func (h *TerminalHandler) GetTerminalById(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "terminal_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -164,17 +178,18 @@ func (h *TerminalHandler) GetTerminalById(w http.ResponseWriter, r *http.Request
 
 	response := database.TerminalManagementResponse{
 		ID:                     Terminal.ID,
+		Version:                Terminal.Version,
 		Tenant:                 Terminal.Tenant,
 		TerminalSpecifications: Terminal.TerminalSpecifications,
 		CreatedAt:              Terminal.CreatedAt,
 		UpdatedAt:              Terminal.UpdatedAt,
 	}
+	setETag(w, Terminal.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *TerminalHandler) FilterTerminal(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -190,6 +205,7 @@ func (h *TerminalHandler) FilterTerminal(w http.ResponseWriter, r *http.Request)
 	}
 	response := database.TerminalManagementResponse{
 		ID:                     Terminal.ID,
+		Version:                Terminal.Version,
 		Tenant:                 Terminal.Tenant,
 		TerminalSpecifications: Terminal.TerminalSpecifications,
 		CreatedAt:              Terminal.CreatedAt,
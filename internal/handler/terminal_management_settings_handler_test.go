@@ -2,6 +2,7 @@ package handler
 
 import (
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
 	"backend-crm/pkg/core"
 	"bytes"
 	"context"
@@ -44,13 +45,18 @@ func (m *MockTerminalCollection) GetAllByKeyValue(ctx context.Context, key strin
 	return args.Get(0).([]database.TerminalManagementResponse), args.Error(1)
 }
 
-func (m *MockTerminalCollection) Update(ctx context.Context, id string, terminal database.Terminal) error {
-	args := m.Called(ctx, id, terminal)
+func (m *MockTerminalCollection) Update(ctx context.Context, id string, tenant string, terminal database.Terminal) error {
+	args := m.Called(ctx, id, tenant, terminal)
 	return args.Error(0)
 }
 
-func (m *MockTerminalCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockTerminalCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockTerminalCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
@@ -152,7 +158,7 @@ func TestTerminalHandler_UpdateTerminalById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Put("/terminal_management/{terminal_id}", handler.UpdateTerminalById)
 
-	mockCollection.On("Update", mock.Anything, "1", mock.MatchedBy(func(terminal database.Terminal) bool {
+	mockCollection.On("Update", mock.Anything, "1", "customerA", mock.MatchedBy(func(terminal database.Terminal) bool {
 		return terminal.Tenant == "customerA" && terminal.TerminalSpecifications.Name == "Updated Terminal"
 	})).Return(nil)
 
@@ -168,6 +174,8 @@ func TestTerminalHandler_UpdateTerminalById(t *testing.T) {
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("terminal_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -183,7 +191,7 @@ func TestTerminalHandler_DeleteTerminalById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Delete("/terminal_management/{terminal_id}", handler.DeleteTerminalById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/terminal_management/1", nil)
 	rctx := chi.NewRouteContext()
@@ -2,11 +2,14 @@ package handler
 
 import (
 	"backend-crm/internal/clients"
+	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/pkg/enum"
 	"context"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,6 +20,7 @@ type ShipmentReminders struct {
 	Within6Hours  bool
 	AGDReminder   bool
 	NORReminder   bool
+	CrewDocuments bool
 }
 
 // [
@@ -41,26 +45,20 @@ type ShipmentReminders struct {
 // ]
 var sentReminders = make(map[string]*ShipmentReminders)
 
-func StartTimer(stopChan chan struct{}, wg *sync.WaitGroup, shipmentCollection *database.ShipmentCollection, interval time.Duration) {
+// crewDocumentsReminderWindow is how long before ETA the agent is chased for missing crew change documents
+const crewDocumentsReminderWindow = 48 * time.Hour
+
+func StartTimer(stopChan chan struct{}, wg *sync.WaitGroup, shipmentCollection *database.ShipmentCollection, crewChangeCollection *database.CrewChangeCollection, notificationCollection *database.NotificationCollection, interval time.Duration) {
 	defer wg.Done()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	ctx := database.WithSource(context.Background(), enum.AUDIT_SOURCE_TIMER)
 	for {
 		log.Println("timer log")
 		select {
 		case <-ticker.C:
-			// Fetch all shipments and process ETA reminders
-			// can put this in a cache next time to avoid hitting db everytime
-			shipments, err := shipmentCollection.GetAll(context.Background(), "")
-			if err != nil {
-				log.Printf("Error fetching shipments: %v", err)
-				continue
-			}
-
-			// Process the shipments
-			CheckETAsAndSendWhatsApp(shipments)
-			// SendAGDs(shipments)
+			sendDueReminders(ctx, shipmentCollection, crewChangeCollection, notificationCollection)
 		case <-stopChan:
 			log.Println("Timer stopped")
 			return
@@ -68,46 +66,77 @@ func StartTimer(stopChan chan struct{}, wg *sync.WaitGroup, shipmentCollection *
 	}
 }
 
+// sendDueReminders retries the notifications that could not be sent when they were queued,
+// and sends the ETA, AGD, NOR and crew documents reminders that are due.
+func sendDueReminders(ctx context.Context, shipmentCollection *database.ShipmentCollection, crewChangeCollection *database.CrewChangeCollection, notificationCollection *database.NotificationCollection) {
+	defer timeLoop(TIMER_LOOP_REMINDERS, time.Now())
+
+	// Retry notifications that could not be sent when they were queued
+	DispatchPendingNotifications(ctx, notificationCollection, "")
+
+	// Fetch all shipments and process ETA reminders
+	// can put this in a cache next time to avoid hitting db everytime
+	shipments, err := shipmentCollection.GetAll(ctx, "")
+	if err != nil {
+		log.Printf("Error fetching shipments: %v", err)
+		return
+	}
+
+	// Process the shipments
+	CheckETAsAndSendWhatsApp(shipments)
+
+	crewChanges, err := crewChangeCollection.GetAll(ctx, "")
+	if err != nil {
+		log.Printf("Error fetching crew changes: %v", err)
+		return
+	}
+	CheckCrewDocumentsAndSendWhatsApp(shipments, crewChanges)
+	// SendAGDs(shipments)
+}
+
+// Reminder is a WhatsApp reminder that is due for a shipment. Key is what it is recorded as sent under,
+// one of "24", "12", "6", "AGD", "NOR" and "CREW".
+type Reminder struct {
+	Shipment             database.ShipmentResponse
+	Key                  string
+	HoursBeforeETA       string
+	MissingCrewDocuments map[string][]string
+}
+
 func CheckETAsAndSendWhatsApp(shipments []database.ShipmentResponse) {
-	currentTime := time.Now()
+	SendReminders(DueETAReminders(shipments, time.Now()))
+}
 
+// DueETAReminders works out the ETA, AGD and NOR reminders due at currentTime that have not been sent, without sending them.
+func DueETAReminders(shipments []database.ShipmentResponse, currentTime time.Time) []Reminder {
 	bufferTimeForMessages := 15 * time.Minute
 
+	var due []Reminder
 	for _, shipment := range shipments {
 		log.Println(currentTime, "curr")
 		log.Println(shipment.CurrentETA, "ETA")
 		log.Println(shipment.CurrentETA.Sub(currentTime))
 		hoursBeforeETA := formatDuration(shipment.CurrentETA.Sub(currentTime))
 		if shipment.CurrentStatus == enum.SHIPMENT_STATUS_NOR_TENDERED && !hasSentReminder(shipment.ID, "NOR") {
-			log.Printf("Shipment %s status is NOR Tendered \n", shipment.ID)
-			SendNORTenderedWhatsApp(shipment)
-			markReminderSent(shipment.ID, "NOR")
+			due = append(due, Reminder{Shipment: shipment, Key: "NOR"})
 		}
 
 		if shipment.CurrentETA.Sub(currentTime) > 0 {
 			switch {
 			case shipment.CurrentETA.Sub(currentTime) <= 5*time.Minute && !hasSentReminder(shipment.ID, "AGD"):
-				log.Printf("Shipment %s passed ETA, sends AGD reminder\n", shipment.ID)
-				SendAGDWhatsApp(shipment)
-				markReminderSent(shipment.ID, "AGD")
+				due = append(due, Reminder{Shipment: shipment, Key: "AGD"})
 				// delete entry from map to avoid redundant memory usage
 				// delete(sentReminders, shipment.ID)
 				// log.Printf("Deleted reminder for shipment %s as all reminders have been sent\n", shipment.ID)
 
 			case shipment.CurrentETA.Sub(currentTime) <= 6*time.Hour+bufferTimeForMessages && !hasSentReminder(shipment.ID, "6"):
-				log.Printf("Shipment %s is within 6 hours of ETA\n", shipment.ID)
-				SendETAWhatsApp(shipment, hoursBeforeETA)
-				markReminderSent(shipment.ID, "6")
+				due = append(due, Reminder{Shipment: shipment, Key: "6", HoursBeforeETA: hoursBeforeETA})
 
 			case shipment.CurrentETA.Sub(currentTime) <= 12*time.Hour+bufferTimeForMessages && !hasSentReminder(shipment.ID, "12"):
-				log.Printf("Shipment %s is within 12 hours of ETA\n", shipment.ID)
-				SendETAWhatsApp(shipment, hoursBeforeETA)
-				markReminderSent(shipment.ID, "12")
+				due = append(due, Reminder{Shipment: shipment, Key: "12", HoursBeforeETA: hoursBeforeETA})
 
 			case shipment.CurrentETA.Sub(currentTime) <= 24*time.Hour+bufferTimeForMessages && !hasSentReminder(shipment.ID, "24"):
-				log.Printf("Shipment %s is within 24 hours of ETA\n", shipment.ID)
-				SendETAWhatsApp(shipment, hoursBeforeETA)
-				markReminderSent(shipment.ID, "24")
+				due = append(due, Reminder{Shipment: shipment, Key: "24", HoursBeforeETA: hoursBeforeETA})
 			}
 			// put the delete item from hashmap logic to AFTER shipment is marked as completed!
 			// In the future, we have may
@@ -123,6 +152,87 @@ func CheckETAsAndSendWhatsApp(shipments []database.ShipmentResponse) {
 
 		}
 	}
+	return due
+}
+
+// CheckCrewDocumentsAndSendWhatsApp reminds the agent once per shipment when crew joining or leaving
+// within the next 48 hours are still missing passports, seaman books or flights.
+func CheckCrewDocumentsAndSendWhatsApp(shipments []database.ShipmentResponse, crewChanges []database.CrewChangeResponse) {
+	SendReminders(DueCrewDocumentsReminders(shipments, crewChanges, time.Now()))
+}
+
+// DueCrewDocumentsReminders works out the crew document reminders due at currentTime that have not been sent, without sending them.
+func DueCrewDocumentsReminders(shipments []database.ShipmentResponse, crewChanges []database.CrewChangeResponse, currentTime time.Time) []Reminder {
+	crewChangesByShipment := make(map[string]database.CrewChangeResponse, len(crewChanges))
+	for _, crewChange := range crewChanges {
+		crewChangesByShipment[crewChange.ShipmentID] = crewChange
+	}
+
+	var due []Reminder
+	for _, shipment := range shipments {
+		crewChange, ok := crewChangesByShipment[shipment.ID]
+		if !ok || hasSentReminder(shipment.ID, "CREW") {
+			continue
+		}
+		untilETA := shipment.CurrentETA.Sub(currentTime)
+		if untilETA <= 0 || untilETA > crewDocumentsReminderWindow {
+			continue
+		}
+
+		missing := missingCrewDocuments(crewChange.CrewMembers, shipment.CurrentETA)
+		if len(missing) == 0 {
+			continue
+		}
+		due = append(due, Reminder{Shipment: shipment, Key: "CREW", MissingCrewDocuments: missing})
+	}
+	return due
+}
+
+// SendReminders sends each reminder over WhatsApp and records it as sent.
+func SendReminders(reminders []Reminder) {
+	for _, reminder := range reminders {
+		shipment := reminder.Shipment
+		switch reminder.Key {
+		case "NOR":
+			log.Printf("Shipment %s status is NOR Tendered \n", shipment.ID)
+			SendNORTenderedWhatsApp(shipment)
+		case "AGD":
+			log.Printf("Shipment %s passed ETA, sends AGD reminder\n", shipment.ID)
+			SendAGDWhatsApp(shipment)
+		case "6", "12", "24":
+			log.Printf("Shipment %s is within %s hours of ETA\n", shipment.ID, reminder.Key)
+			SendETAWhatsApp(shipment, reminder.HoursBeforeETA)
+		case "CREW":
+			log.Printf("Shipment %s has crew with missing documents\n", shipment.ID)
+			SendCrewDocumentsWhatsApp(shipment, reminder.MissingCrewDocuments)
+		}
+		markReminderSent(shipment.ID, reminder.Key)
+	}
+}
+
+// SendCrewDocumentsWhatsApp sends a WhatsApp message listing the crew change documents still outstanding.
+func SendCrewDocumentsWhatsApp(shipment database.ShipmentResponse, missing map[string][]string) {
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var summary []string
+	for _, name := range names {
+		summary = append(summary, name+" ("+strings.Join(missing[name], ", ")+")")
+	}
+
+	_, err := clients.WhatsAppClient.RemindCrewDocumentsWhatsAppMessage(
+		shipment.ShipmentDetails.Agent.Name,
+		shipment.VesselSpecifications.VesselName,
+		strconv.FormatInt(shipment.VesselSpecifications.ImoNumber, 10), // Convert int64 to string
+		strings.Join(summary, "; "),
+		shipment.ShipmentDetails.Agent.Contact,
+	)
+	if err != nil {
+		log.Printf("Error sending crew documents WhatsApp message: %v", err)
+	}
 }
 
 // SendETAWhatsApp sends a WhatsApp message to remind about the shipment ETA.
@@ -139,13 +249,15 @@ func SendETAWhatsApp(shipment database.ShipmentResponse, hoursBeforeETA string)
 }
 
 // Send sends a WhatsApp message to remind about the AGD (Arrival General Declaration).
+// The ETA is rendered in the agent's timezone rather than the server's.
 func SendAGDWhatsApp(shipment database.ShipmentResponse) {
+	localETA := shipment.CurrentETA.In(config.RecipientLocation(shipment.ShipmentDetails.Agent.Timezone, shipment.Tenant))
 	_, err := clients.WhatsAppClient.RemindAGDWhatsAppMessage(
 		shipment.ShipmentDetails.Agent.Name,
 		shipment.VesselSpecifications.VesselName,
 		strconv.FormatInt(shipment.VesselSpecifications.ImoNumber, 10), // Convert int64 to string
-		shipment.CurrentETA.Local().Format("02-Jan-2006"),
-		shipment.CurrentETA.Local().Format("15:04"),
+		localETA.Format("02-Jan-2006"),
+		localETA.Format("15:04"),
 		shipment.ShipmentDetails.Agent.Contact,
 	)
 	if err != nil {
@@ -189,6 +301,8 @@ func markReminderSent(shipmentID string, key string) {
 		sentReminders[shipmentID].AGDReminder = true
 	case "NOR":
 		sentReminders[shipmentID].NORReminder = true
+	case "CREW":
+		sentReminders[shipmentID].CrewDocuments = true
 	}
 
 }
@@ -207,6 +321,8 @@ func hasSentReminder(shipmentID string, key string) bool {
 			return reminders.AGDReminder
 		case "NOR":
 			return reminders.NORReminder
+		case "CREW":
+			return reminders.CrewDocuments
 
 		}
 
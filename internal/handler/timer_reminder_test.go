@@ -0,0 +1,30 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDueETAReminders(t *testing.T) {
+	now := time.Date(2024, time.May, 22, 8, 0, 0, 0, time.UTC)
+	shipments := []database.ShipmentResponse{
+		{ID: "due-eta-within-12", CurrentETA: now.Add(11 * time.Hour)},
+		{ID: "due-eta-far", CurrentETA: now.Add(48 * time.Hour)},
+		{ID: "due-eta-arriving", CurrentETA: now.Add(3 * time.Minute)},
+		{ID: "due-eta-nor", CurrentETA: now.Add(-time.Hour), CurrentStatus: enum.SHIPMENT_STATUS_NOR_TENDERED},
+	}
+
+	reminders := DueETAReminders(shipments, now)
+
+	keys := map[string]string{}
+	for _, reminder := range reminders {
+		keys[reminder.Shipment.ID] = reminder.Key
+	}
+	assert.Equal(t, map[string]string{"due-eta-within-12": "12", "due-eta-arriving": "AGD", "due-eta-nor": "NOR"}, keys)
+	// working out the reminders does not record them as sent
+	assert.Len(t, DueETAReminders(shipments, now), 3)
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Two-factor authentication with TOTP codes from an authenticator app. A user enrols to get a secret, confirms it with
+// a code to turn it on and is given recovery codes, to log in with once each if they lose their authenticator.
+// Users of a tenant that requires it, who have not enrolled, are given an enrolment token at login to enrol with instead
+// of a session.
+
+const (
+	totpEnrolmentAudience = "totp_enrolment"
+
+	// totpEnrolmentTTL is how long a user made to set up two-factor authentication at login has to do it
+	totpEnrolmentTTL  = 15 * time.Minute
+	totpIssuer        = "Columbus CRM"
+	recoveryCodeCount = 10
+)
+
+type TOTPHandler struct {
+	LoginCollection database.Collection[database.TenantUser, database.TenantUserResponse]
+	Lockout         *LoginLockout
+}
+
+func NewTOTPHandler(
+	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
+	lockout *LoginLockout,
+) *TOTPHandler {
+	return &TOTPHandler{
+		LoginCollection: loginCollection,
+		Lockout:         lockout,
+	}
+}
+
+// totpRequest is the body of every TOTP endpoint. Token is the enrolment token of a user who is not logged in,
+// Code a TOTP code and RecoveryCode a recovery code, which can be given instead of Code where noted.
+type totpRequest struct {
+	Token        string `json:"token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type enrolTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Enrol gives the user a new TOTP secret, and the otpauth URI to add it to an authenticator app with.
+// Two-factor authentication is only turned on once Confirm is given a code for it.
+func (h *TOTPHandler) Enrol(w http.ResponseWriter, r *http.Request) {
+	var params totpRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	user, ok := h.enrollingUser(w, r, params.Token)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		render.Render(w, r, ErrInvalidRequest(errors.New("two-factor authentication is already on")))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	ctx := database.WithActor(r.Context(), user.Email)
+	if err := h.LoginCollection.Patch(ctx, user.ID, user.Tenant, database.Patch{Set: bson.D{{Key: "totpsecret", Value: secret}}}); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.JSON(w, r, enrolTOTPResponse{Secret: secret, URI: auth.TOTPURI(totpIssuer, user.Email, secret)})
+}
+
+// Confirm turns two-factor authentication on, given a code for the secret from Enrol, and returns the recovery codes.
+func (h *TOTPHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var params totpRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return
+	}
+	user, ok := h.enrollingUser(w, r, params.Token)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		render.Render(w, r, ErrInvalidRequest(errors.New("two-factor authentication is already on")))
+		return
+	}
+	if user.TOTPSecret == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("enrol before confirming")))
+		return
+	}
+	if !h.checkNotLockedOut(w, r, user.Email) {
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, params.Code, time.Now(), 0)
+	if !ok {
+		h.recordFailure(r, user.Email)
+		render.Render(w, r, ErrInvalidRequest(errors.New("the code is wrong")))
+		return
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	ctx := database.WithActor(r.Context(), user.Email)
+	enabled := database.Patch{Set: bson.D{
+		{Key: "totpenabled", Value: true},
+		{Key: "totplaststep", Value: step},
+		{Key: "recoverycodes", Value: hashes},
+	}}
+	if err := h.LoginCollection.Patch(database.WithExpectedVersion(ctx, user.Version), user.ID, user.Tenant, enabled); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrDuplicate(errors.New("two-factor authentication was changed at the same time, enrol again")))
+			return
+		}
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.JSON(w, r, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns the logged in user's two-factor authentication off, given a TOTP or recovery code.
+// It cannot be turned off in a tenant that requires it.
+func (h *TOTPHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	if config.IsTOTPRequired(config.MakeMapping(auth.GetEmailFromToken(r.Context()))) {
+		render.Render(w, r, ErrForbidden)
+		return
+	}
+	user, ok := h.checkedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := database.WithActor(r.Context(), user.Email)
+	if err := h.LoginCollection.Patch(ctx, user.ID, user.Tenant, database.DisableTOTPPatch()); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.Render(w, r, SuccessOK)
+}
+
+// RegenerateRecoveryCodes replaces the logged in user's recovery codes, given a TOTP or recovery code, and returns the new ones.
+func (h *TOTPHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.checkedUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	ctx := database.WithActor(r.Context(), user.Email)
+	if err := h.LoginCollection.Patch(ctx, user.ID, user.Tenant, database.Patch{Set: bson.D{{Key: "recoverycodes", Value: hashes}}}); err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.JSON(w, r, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// enrollingUser is the logged in user, or if there is none the user of the enrolment token.
+func (h *TOTPHandler) enrollingUser(w http.ResponseWriter, r *http.Request, token string) (database.TenantUserResponse, bool) {
+	email := auth.GetEmailFromToken(r.Context())
+	if email == "" {
+		claims, err := auth.ParseAudienceToken(token, totpEnrolmentAudience)
+		if err != nil {
+			http.Error(w, "Unauthorized: Invalid enrolment token", http.StatusUnauthorized)
+			return database.TenantUserResponse{}, false
+		}
+		email = claims.Email
+	}
+
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, config.MakeMapping(email))
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return database.TenantUserResponse{}, false
+	}
+	return user, true
+}
+
+// checkedUser is the logged in user, once the TOTP or recovery code in the request has been checked.
+func (h *TOTPHandler) checkedUser(w http.ResponseWriter, r *http.Request) (database.TenantUserResponse, bool) {
+	var params totpRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		render.Render(w, r, ErrBadRequest)
+		return database.TenantUserResponse{}, false
+	}
+	email := auth.GetEmailFromToken(r.Context())
+	user, err := h.LoginCollection.GetByKeyValue(r.Context(), "email", email, config.MakeMapping(email))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return user, false
+	}
+	if !user.TOTPEnabled {
+		render.Render(w, r, ErrInvalidRequest(errors.New("two-factor authentication is off")))
+		return user, false
+	}
+	if !h.checkNotLockedOut(w, r, email) {
+		return user, false
+	}
+
+	ok, err := checkSecondFactor(r.Context(), h.LoginCollection, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return user, false
+	}
+	if !ok {
+		h.recordFailure(r, email)
+		render.Render(w, r, ErrInvalidRequest(errors.New("the code is wrong")))
+		return user, false
+	}
+	return user, true
+}
+
+func (h *TOTPHandler) checkNotLockedOut(w http.ResponseWriter, r *http.Request, email string) bool {
+	lockedUntil, err := h.Lockout.LockedUntil(r.Context(), email, clientIP(r))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		writeLockedOut(w, lockedUntil)
+		return false
+	}
+	return true
+}
+
+func (h *TOTPHandler) recordFailure(r *http.Request, email string) {
+	if err := h.Lockout.RecordFailure(r.Context(), email, clientIP(r)); err != nil {
+		log.Printf("Error recording failed two-factor code: %v", err)
+	}
+}
+
+// checkSecondFactor checks the TOTP code, or if there is none the recovery code, of a user with two-factor authentication on,
+// and uses it up: a TOTP code, and every code before it, or a recovery code can only be used once.
+func checkSecondFactor(
+	ctx context.Context,
+	loginCollection database.Collection[database.TenantUser, database.TenantUserResponse],
+	user database.TenantUserResponse,
+	code string,
+	recoveryCode string,
+) (bool, error) {
+	var used database.Patch
+	switch {
+	case code != "":
+		step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		used = database.Patch{Set: bson.D{{Key: "totplaststep", Value: step}}}
+	case recoveryCode != "":
+		hash := auth.HashRecoveryCode(recoveryCode)
+		remaining := []string{}
+		for _, unused := range user.RecoveryCodes {
+			if unused != hash {
+				remaining = append(remaining, unused)
+			}
+		}
+		if len(remaining) == len(user.RecoveryCodes) {
+			return false, nil
+		}
+		used = database.Patch{Set: bson.D{{Key: "recoverycodes", Value: remaining}}}
+	default:
+		return false, nil
+	}
+
+	// the expected version makes a code used at the same time by two requests only work for one
+	ctx = database.WithActor(ctx, user.Email)
+	err := loginCollection.Patch(database.WithExpectedVersion(ctx, user.Version), user.ID, user.Tenant, used)
+	if errors.Is(err, database.ErrVersionConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"backend-crm/internal/config"
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTOTPRouter(t *testing.T) (chi.Router, *database.MemoryCollection[database.TenantUser, database.TenantUserResponse]) {
+	users := database.NewMemoryCollection[database.TenantUser, database.TenantUserResponse]()
+	hashedPassword, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	_, err = users.Create(context.Background(), database.TenantUser{Email: "ops@customera.com", Password: hashedPassword, Tenant: config.CUSTOMERA, EmailVerified: true})
+	require.NoError(t, err)
+
+	lockout := NewLoginLockout(newFakeLoginAttempts(), testLockoutConfig)
+	loginHandler := NewLoginHandler(users, database.NewMemoryCollection[database.Session, database.SessionResponse](), lockout)
+	totpHandler := NewTOTPHandler(users, lockout)
+
+	r := chi.NewRouter()
+	r.Post("/login", loginHandler.LoginAndAuth)
+	r.Post("/login/totp/enrol", totpHandler.Enrol)
+	r.Post("/login/totp/confirm", totpHandler.Confirm)
+	r.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auth.ContextKeyEmail, "ops@customera.com")))
+			})
+		})
+		r.Post("/account/totp/enrol", totpHandler.Enrol)
+		r.Post("/account/totp/confirm", totpHandler.Confirm)
+		r.Post("/account/totp/disable", totpHandler.Disable)
+		r.Post("/account/totp/recovery_codes", totpHandler.RegenerateRecoveryCodes)
+	})
+	return r, users
+}
+
+func postJSON(r http.Handler, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// enrolTOTP enrols and confirms two-factor authentication at path, and returns the secret and the recovery codes.
+func enrolTOTP(t *testing.T, r http.Handler, path string, token string) (string, []string) {
+	w := postJSON(r, path+"/enrol", `{"token": "`+token+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enrolment enrolTOTPResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrolment))
+	assert.Contains(t, enrolment.URI, "otpauth://totp/")
+	assert.Contains(t, enrolment.URI, "secret="+enrolment.Secret)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(r, path+"/confirm", `{"token": "`+token+`", "code": "000000"}`).Code)
+	code, err := auth.TOTPCode(enrolment.Secret, time.Now())
+	require.NoError(t, err)
+	w = postJSON(r, path+"/confirm", `{"token": "`+token+`", "code": "`+code+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var recovery recoveryCodesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	assert.Len(t, recovery.RecoveryCodes, recoveryCodeCount)
+	return enrolment.Secret, recovery.RecoveryCodes
+}
+
+// totpStepTime is a time in the 30 second TOTP time step, so that tests do not depend on when a step ends.
+func totpStepTime(step int64) time.Time {
+	return time.Unix(step*30, 0)
+}
+
+func TestTOTP_RFC6238(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238, appendix B, to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		code, err := auth.TOTPCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, unix)
+	}
+}
+
+func TestTOTPHandler_EnrolLoginAndDisable(t *testing.T) {
+	r, users := newTestTOTPRouter(t)
+	secret, recoveryCodes := enrolTOTP(t, r, "/account/totp", "")
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.True(t, user.TOTPEnabled)
+	assert.NotContains(t, user.RecoveryCodes, recoveryCodes[0], "recovery codes are stored hashed")
+
+	login := func(extra string) *httptest.ResponseRecorder {
+		return postJSON(r, "/login", `{"email": "ops@customera.com", "password": "password123"`+extra+`}`)
+	}
+	assert.Equal(t, http.StatusUnauthorized, login("").Code)
+
+	// the code used to confirm cannot be used again, the next one can
+	code, err := auth.TOTPCode(secret, totpStepTime(user.TOTPLastStep))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, login(`, "totp_code": "`+code+`"`).Code)
+	next, err := auth.TOTPCode(secret, totpStepTime(user.TOTPLastStep+1))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, login(`, "totp_code": "`+next+`"`).Code)
+
+	// recovery codes work once each
+	assert.Equal(t, http.StatusOK, login(`, "recovery_code": "`+recoveryCodes[0]+`"`).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(`, "recovery_code": "`+recoveryCodes[0]+`"`).Code)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(r, "/account/totp/disable", `{"code": "000000"}`).Code)
+	assert.Equal(t, http.StatusOK, postJSON(r, "/account/totp/disable", `{"recovery_code": "`+recoveryCodes[1]+`"}`).Code)
+	user, err = users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	assert.False(t, user.TOTPEnabled)
+	assert.Empty(t, user.TOTPSecret)
+	assert.Equal(t, http.StatusOK, login("").Code)
+}
+
+func TestTOTPHandler_RequiredByTenant(t *testing.T) {
+	config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{config.CUSTOMERA: true}, map[string]bool{})
+	t.Cleanup(func() {
+		config.SetTenants(map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{})
+	})
+	r, users := newTestTOTPRouter(t)
+
+	// without two-factor authentication the user gets an enrolment token instead of a session
+	w := postJSON(r, "/login", `{"email": "ops@customera.com", "password": "password123"}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	var response map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response["enrolment_token"])
+
+	assert.Equal(t, http.StatusUnauthorized, postJSON(r, "/login/totp/enrol", `{"token": "invalid"}`).Code)
+	secret, recoveryCodes := enrolTOTP(t, r, "/login/totp", response["enrolment_token"])
+
+	user, err := users.GetByKeyValue(context.Background(), "email", "ops@customera.com", config.CUSTOMERA)
+	require.NoError(t, err)
+	next, err := auth.TOTPCode(secret, totpStepTime(user.TOTPLastStep+1))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, postJSON(r, "/login", `{"email": "ops@customera.com", "password": "password123", "totp_code": "`+next+`"}`).Code)
+
+	// it cannot be turned off
+	assert.Equal(t, http.StatusForbidden, postJSON(r, "/account/totp/disable", `{"recovery_code": "`+recoveryCodes[0]+`"}`).Code)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Names of the resources with a trash, as used in the /trash routes.
+const (
+	TRASH_SHIPMENTS           string = "shipments"
+	TRASH_CUSTOMERS           string = "customers"
+	TRASH_VESSELS             string = "vessels"
+	TRASH_SUPPLIERS           string = "suppliers"
+	TRASH_TERMINALS           string = "terminals"
+	TRASH_AGENTS              string = "agents"
+	TRASH_ACTIVITY_TYPES      string = "activity_types"
+	TRASH_PRODUCT_TYPES       string = "product_types"
+	TRASH_CHECKLISTS          string = "checklists"
+	TRASH_CHECKLIST_TEMPLATES string = "checklist_templates"
+	TRASH_INVOICES            string = "invoices"
+	TRASH_CREW_CHANGES        string = "crew_changes"
+	TRASH_FEED_EMAILS         string = "feed_emails"
+	TRASH_NOTIFICATIONS       string = "notifications"
+)
+
+type TrashHandler struct {
+	Bins             map[string]database.Trash
+	ShipmentDeletion *ShipmentDeletion
+}
+
+func NewTrashHandler(bins map[string]database.Trash, shipmentDeletion *ShipmentDeletion) *TrashHandler {
+	return &TrashHandler{
+		Bins:             bins,
+		ShipmentDeletion: shipmentDeletion,
+	}
+}
+
+type getTrashResponse struct {
+	Deleted interface{} `json:"deleted"`
+}
+
+// GetTrash lists the tenant's deleted documents of one resource, most recently deleted first.
+func (h *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+
+	bin, ok := h.Bins[chi.URLParam(r, "resource")]
+	if !ok {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	deleted, err := bin.GetDeleted(r.Context(), tenant)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
+	render.JSON(w, r, getTrashResponse{Deleted: deleted})
+}
+
+// RestoreFromTrash takes a deleted document out of the trash. Shipments come back with their dependents.
+func (h *TrashHandler) RestoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	resource := chi.URLParam(r, "resource")
+	_id := chi.URLParam(r, "id")
+
+	bin, ok := h.Bins[resource]
+	if !ok {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	var err error
+	if resource == TRASH_SHIPMENTS && h.ShipmentDeletion != nil {
+		err = h.ShipmentDeletion.Restore(r.Context(), _id, tenant)
+	} else {
+		err = bin.Restore(r.Context(), _id, tenant)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, primitive.ErrInvalidHex):
+			render.Render(w, r, ErrNotFound)
+		case errors.Is(err, database.ErrDuplicateKey):
+			render.Render(w, r, ErrDuplicate(err))
+		default:
+			render.Render(w, r, ErrInternalServerError)
+		}
+		return
+	}
+
+	render.Render(w, r, SuccessOK)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashHandler(t *testing.T) {
+	customers := &fakeTrash{deleted: []string{"c1"}}
+	handler := NewTrashHandler(map[string]database.Trash{TRASH_CUSTOMERS: customers}, nil)
+
+	r := chi.NewRouter()
+	r.Get("/trash/{resource}", handler.GetTrash)
+	r.Post("/trash/{resource}/{id}/restore", handler.RestoreFromTrash)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		expected int
+	}{
+		{name: "list", method: "GET", url: "/trash/customers", expected: http.StatusOK},
+		{name: "unknown resource", method: "GET", url: "/trash/passwords", expected: http.StatusNotFound},
+		{name: "restore", method: "POST", url: "/trash/customers/c1/restore", expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+	assert.Equal(t, []string{"c1"}, customers.restored)
+}
+
+type purgeRecordingTrash struct {
+	fakeTrash
+	before time.Time
+}
+
+func (t *purgeRecordingTrash) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	t.before = before
+	return 2, nil
+}
+
+func TestPurgeTrash(t *testing.T) {
+	shipments := &purgeRecordingTrash{}
+	before := time.Date(2024, time.May, 22, 12, 0, 0, 0, time.UTC)
+
+	PurgeTrash(context.Background(), map[string]database.Trash{TRASH_SHIPMENTS: shipments}, before)
+
+	assert.Equal(t, before, shipments.before)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// StartTrashPurge empties the trash of documents deleted more than retention ago, every interval.
+func StartTrashPurge(stopChan chan struct{}, wg *sync.WaitGroup, bins map[string]database.Trash, retention time.Duration, interval time.Duration) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			PurgeTrash(database.WithSource(context.Background(), enum.AUDIT_SOURCE_TIMER), bins, start.Add(-retention))
+			timeLoop(TIMER_LOOP_TRASH_PURGE, start)
+		case <-stopChan:
+			log.Println("Stopping trash purge")
+			return
+		}
+	}
+}
+
+// PurgeTrash removes the documents deleted before before from every bin, for good.
+// A bin that fails is logged and the others are still purged.
+func PurgeTrash(ctx context.Context, bins map[string]database.Trash, before time.Time) {
+	for name, bin := range bins {
+		purged, err := bin.PurgeDeleted(ctx, before)
+		if err != nil {
+			log.Printf("Error purging %s trash: %v", name, err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d %s from the trash", purged, name)
+		}
+	}
+}
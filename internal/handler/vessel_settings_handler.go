@@ -1,9 +1,7 @@
 package handler
 
 import (
-	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
-	"backend-crm/pkg/auth"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +9,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type VesselHandler struct {
@@ -30,8 +29,7 @@ type getAllVesselsResponse struct {
 }
 
 func (h *VesselHandler) GetAllVessels(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	log.Println(tenant)
 	var VesselsList []database.VesselManagementResponse
@@ -53,6 +51,7 @@ func (h *VesselHandler) GetAllVessels(w http.ResponseWriter, r *http.Request) {
 	for _, Vessel := range VesselsList {
 		Vessels = append(Vessels, database.VesselManagementResponse{
 			ID:                   Vessel.ID,
+			Version:              Vessel.Version,
 			Tenant:               Vessel.Tenant,
 			VesselSpecifications: Vessel.VesselSpecifications,
 			CreatedAt:            Vessel.CreatedAt,
@@ -66,8 +65,7 @@ func (h *VesselHandler) GetAllVessels(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *VesselHandler) CreateVessel(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 
 	var createParams database.Vessel
 	if err := json.NewDecoder(r.Body).Decode(&createParams); err != nil {
@@ -95,13 +93,14 @@ func (h *VesselHandler) CreateVessel(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *VesselHandler) DeleteVesselById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "vessel_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
-	err := h.VesselCollection.Delete(r.Context(), _id)
+	err := h.VesselCollection.Delete(r.Context(), _id, tenant)
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
@@ -116,21 +115,30 @@ func (h *VesselHandler) DeleteVesselById(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *VesselHandler) UpdateVesselById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "vessel_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
+	ctx, ok := ifMatchContext(w, r)
+	if !ok {
+		return
+	}
+
 	var updateParams database.Vessel
 	if err := json.NewDecoder(r.Body).Decode(&updateParams); err != nil {
 		render.Render(w, r, ErrBadRequest)
 		return
 	}
+	updateParams.Tenant = tenant
 
-	err := h.VesselCollection.Update(r.Context(), _id, updateParams)
+	err := h.VesselCollection.Update(ctx, _id, tenant, updateParams)
 
 	if err != nil {
 		var rnfErr *database.RecordNotFoundError
-		if errors.As(err, &rnfErr) {
+		if errors.As(err, &rnfErr) || errors.Is(err, mongo.ErrNoDocuments) {
 			render.Render(w, r, ErrNotFound)
+		} else if errors.Is(err, database.ErrVersionConflict) {
+			render.Render(w, r, ErrPreconditionFailed)
 		} else {
 			render.Render(w, r, ErrInternalServerError)
 		}
@@ -143,9 +151,15 @@ func (h *VesselHandler) UpdateVesselById(w http.ResponseWriter, r *http.Request)
 	render.Render(w, r, SuccessOK)
 }
 
+func (h *VesselHandler) PatchVesselById(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r.Context())
+	_id := chi.URLParam(r, "vessel_id")
+
+	patchDocument(w, r, h.VesselCollection, _id, tenant, nil)
+}
+
 func (h *VesselHandler) GetVesselById(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := chi.URLParam(r, "vessel_id")
 	log.Printf("Retrieved ID from URL: %s", _id) // Confirm ID retrieval
 
@@ -164,17 +178,18 @@ func (h *VesselHandler) GetVesselById(w http.ResponseWriter, r *http.Request) {
 
 	response := database.VesselManagementResponse{
 		ID:                   Vessel.ID,
+		Version:              Vessel.Version,
 		Tenant:               Vessel.Tenant,
 		VesselSpecifications: Vessel.VesselSpecifications,
 		CreatedAt:            Vessel.CreatedAt,
 		UpdatedAt:            Vessel.UpdatedAt,
 	}
+	setETag(w, Vessel.Version)
 	render.JSON(w, r, response)
 }
 
 func (h *VesselHandler) FilterVessel(w http.ResponseWriter, r *http.Request) {
-	email := auth.GetEmailFromToken(r.Context())
-	tenant := config.MakeMapping(email)
+	tenant := requestTenant(r.Context())
 	_id := r.URL.Query().Get("_id")
 	log.Println(_id)
 
@@ -190,6 +205,7 @@ func (h *VesselHandler) FilterVessel(w http.ResponseWriter, r *http.Request) {
 	}
 	response := database.VesselManagementResponse{
 		ID:                   Vessel.ID,
+		Version:              Vessel.Version,
 		Tenant:               Vessel.Tenant,
 		VesselSpecifications: Vessel.VesselSpecifications,
 		CreatedAt:            Vessel.CreatedAt,
@@ -2,6 +2,7 @@ package handler
 
 import (
 	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/auth"
 	"bytes"
 	"context"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MockVesselCollection struct {
@@ -43,13 +45,18 @@ func (m *MockVesselCollection) GetAllByKeyValue(ctx context.Context, key string,
 	return args.Get(0).([]database.VesselManagementResponse), args.Error(1)
 }
 
-func (m *MockVesselCollection) Update(ctx context.Context, id string, vessel database.Vessel) error {
-	args := m.Called(ctx, id, vessel)
+func (m *MockVesselCollection) Update(ctx context.Context, id string, tenant string, vessel database.Vessel) error {
+	args := m.Called(ctx, id, tenant, vessel)
 	return args.Error(0)
 }
 
-func (m *MockVesselCollection) Delete(ctx context.Context, id string) error {
-	args := m.Called(ctx, id)
+func (m *MockVesselCollection) Patch(ctx context.Context, id string, tenant string, patch database.Patch) error {
+	args := m.Called(ctx, id, tenant, patch)
+	return args.Error(0)
+}
+
+func (m *MockVesselCollection) Delete(ctx context.Context, id string, tenant string) error {
+	args := m.Called(ctx, id, tenant)
 	return args.Error(0)
 }
 
@@ -165,7 +172,7 @@ func TestVesselHandler_UpdateVesselById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Put("/vessel_management/{vessel_id}", handler.UpdateVesselById)
 
-	mockCollection.On("Update", mock.Anything, "1", mock.MatchedBy(func(vessel database.Vessel) bool {
+	mockCollection.On("Update", mock.Anything, "1", "customerA", mock.MatchedBy(func(vessel database.Vessel) bool {
 		return vessel.Tenant == "customerA" && vessel.VesselSpecifications.VesselName == "Updated Vessel"
 	})).Return(nil)
 
@@ -185,6 +192,8 @@ func TestVesselHandler_UpdateVesselById(t *testing.T) {
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("vessel_id", "1")
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	r.ServeHTTP(w, req)
@@ -193,6 +202,24 @@ func TestVesselHandler_UpdateVesselById(t *testing.T) {
 	mockCollection.AssertExpectations(t)
 }
 
+func TestVesselHandler_UpdateMissingVessel(t *testing.T) {
+	handler := NewVesselHandler(database.NewMemoryCollection[database.Vessel, database.VesselManagementResponse]())
+
+	r := chi.NewRouter()
+	r.Put("/vessel_management/{vessel_id}", handler.UpdateVesselById)
+
+	// If-Match: * does not check a version, and the update of a vessel that is not there is still not found
+	id := primitive.NewObjectID().Hex()
+	req := httptest.NewRequest("PUT", "/vessel_management/"+id, bytes.NewBufferString(`{"vessel_specifications": {"vessel_name": "Updated Vessel"}}`))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Email: "ops@customera.com", Tenant: "customerA"}))
+	req.Header.Set("If-Match", "*")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestVesselHandler_DeleteVesselById(t *testing.T) {
 	mockCollection := new(MockVesselCollection)
 	handler := NewVesselHandler(mockCollection)
@@ -200,7 +227,7 @@ func TestVesselHandler_DeleteVesselById(t *testing.T) {
 	r := chi.NewRouter()
 	r.Delete("/vessel_management/{vessel_id}", handler.DeleteVesselById)
 
-	mockCollection.On("Delete", mock.Anything, "1").Return(nil)
+	mockCollection.On("Delete", mock.Anything, "1", mock.Anything).Return(nil)
 
 	req := httptest.NewRequest("DELETE", "/vessel_management/1", nil)
 	rctx := chi.NewRouteContext()
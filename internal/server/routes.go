@@ -2,29 +2,54 @@ package server
 
 import (
 	// "backend-crm/pkg/auth"
+	"backend-crm/internal/handler"
+	"backend-crm/pkg/enum"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 )
 
 func (s *Server) routes() {
 	// Set content type middleware
 	s.router.Use(render.SetContentType(render.ContentTypeJSON))
+	s.router.Use(middleware.RequestID)
+	s.router.Use(handler.RecordRequest(enum.AUDIT_SOURCE_API))
+	s.router.Use(handler.RecordMetrics)
 
 	// Public routes
 	s.router.Route("/login", func(r chi.Router) {
-		r.Post("/create_user", s.loginHandler.CreateTenantUser)
+		r.Use(s.rateLimiter.LimitBody("login"))
+		r.Use(s.rateLimiter.LimitIP("login"))
 		r.Post("/", s.loginHandler.LoginAndAuth)
+		r.Post("/register", s.invitationHandler.Register)
+		r.Post("/verify_email", s.invitationHandler.VerifyEmail)
+		r.Post("/forgot_password", s.passwordHandler.ForgotPassword)
+		r.Post("/reset_password", s.passwordHandler.ResetPassword)
+		// with the enrolment token given at login to users who must set up two-factor authentication
+		r.Post("/totp/enrol", s.totpHandler.Enrol)
+		r.Post("/totp/confirm", s.totpHandler.Confirm)
+		// single sign-on with the tenant's identity provider
+		r.Get("/sso/{tenant}", s.ssoHandler.Start)
+		r.Get("/sso/{tenant}/callback", s.ssoHandler.Callback)
 	})
 
 	s.router.Route("/status_check", func(r chi.Router) {
 		r.Get("/", s.loginHandler.StatusCheck)
 	})
 
+	s.router.Get("/.well-known/jwks.json", s.loginHandler.GetJWKS)
+
+	s.router.Get("/metrics", handler.ServeMetrics(s.cfg.MetricsToken))
+
 	// Private routes with JWT auth
 	s.router.Group(func(r chi.Router) {
 		// r.Use(auth.JWTMiddleware)
-		r.Use(s.loginHandler.ValidateCookie)
+		r.Use(s.rateLimiter.LimitBody("api"))
+		r.Use(s.rateLimiter.LimitIP("api"))
+		r.Use(s.apiKeyHandler.Authenticate(s.loginHandler.ValidateCookie))
+		r.Use(s.rateLimiter.LimitPrincipal("api"))
+		r.Use(handler.RecordActor)
 
 		r.Route("/shipments", func(r chi.Router) {
 			r.Get("/", s.shipmentHandler.GetAllShipment)
@@ -33,9 +58,14 @@ func (s *Server) routes() {
 			r.Get("/query", s.shipmentHandler.FilterShipment)
 			r.Delete("/{shipment_id}", s.shipmentHandler.DeleteShipmentById)
 			r.Put("/{shipment_id}", s.shipmentHandler.UpdateShipmentById)
+			r.Patch("/{shipment_id}", s.shipmentHandler.PatchShipmentById)
 			r.Get("/statuses", s.shipmentHandler.GetAllShipmentStatuses)
 			r.Get("/statuses_with_colours", s.shipmentHandler.GetAllShipmentStatusesWithColours)
 			r.Get("/anchorage_locations", s.shipmentHandler.GetAllAnchorageLocations)
+
+			r.Get("/{shipment_id}/crew_change", s.crewChangeHandler.GetCrewChange)
+			r.Put("/{shipment_id}/crew_change", s.crewChangeHandler.UpsertCrewChange)
+			r.Put("/{shipment_id}/crew_change/{crew_member_id}/status", s.crewChangeHandler.UpdateCrewMemberStatus)
 		})
 
 		r.Route("/invoice", func(r chi.Router) {
@@ -45,11 +75,14 @@ func (s *Server) routes() {
 			r.Get("/pda/{invoice_id}", s.invoicePricingHandler.GetPDAInvoicePricingFromId)
 			r.Post("/pda", s.invoicePricingHandler.CreatePDAInvoicePricing)
 			r.Put("/pda/{invoice_id}", s.invoicePricingHandler.EditPDAInvoicePricing)
+			r.Patch("/pda/{invoice_id}", s.invoicePricingHandler.PatchPDAInvoicePricing)
 		})
 
 		r.Route("/feed", func(r chi.Router) {
 			r.Get("/all", s.feedHandler.GetAllFeedEmails)
 			r.Get("/", s.feedHandler.GetFeedEmailsByMasterEmail)
+			r.Get("/review", s.feedHandler.GetFeedEmailsForReview)
+			r.Put("/review/{feed_id}", s.feedHandler.ResolveFeedEmailReview)
 			r.Get("/{shipment_id}", s.feedHandler.GetFeedEmailsByShipmentId)
 		})
 
@@ -62,6 +95,7 @@ func (s *Server) routes() {
 			r.Get("/query", s.customerHandler.FilterCustomer)
 			r.Delete("/{customer_id}", s.customerHandler.DeleteCustomerById)
 			r.Put("/{customer_id}", s.customerHandler.UpdateCustomerById)
+			r.Patch("/{customer_id}", s.customerHandler.PatchCustomerById)
 		})
 
 		r.Route("/vessel_management", func(r chi.Router) {
@@ -71,6 +105,7 @@ func (s *Server) routes() {
 			r.Get("/query", s.vesselHandler.FilterVessel)
 			r.Delete("/{vessel_id}", s.vesselHandler.DeleteVesselById)
 			r.Put("/{vessel_id}", s.vesselHandler.UpdateVesselById)
+			r.Patch("/{vessel_id}", s.vesselHandler.PatchVesselById)
 		})
 
 		r.Route("/supplier_management", func(r chi.Router) {
@@ -80,6 +115,7 @@ func (s *Server) routes() {
 			r.Get("/query", s.supplierHandler.FilterSupplier)
 			r.Delete("/{supplier_id}", s.supplierHandler.DeleteSupplierById)
 			r.Put("/{supplier_id}", s.supplierHandler.UpdateSupplierById)
+			r.Patch("/{supplier_id}", s.supplierHandler.PatchSupplierById)
 		})
 
 		r.Route("/terminal_management", func(r chi.Router) {
@@ -89,6 +125,7 @@ func (s *Server) routes() {
 			r.Get("/query", s.terminalHandler.FilterTerminal)
 			r.Delete("/{terminal_id}", s.terminalHandler.DeleteTerminalById)
 			r.Put("/{terminal_id}", s.terminalHandler.UpdateTerminalById)
+			r.Patch("/{terminal_id}", s.terminalHandler.PatchTerminalById)
 		})
 
 		r.Route("/agent_management", func(r chi.Router) {
@@ -98,6 +135,7 @@ func (s *Server) routes() {
 			r.Get("/query", s.agentHandler.FilterAgent)
 			r.Delete("/{agent_id}", s.agentHandler.DeleteAgentById)
 			r.Put("/{agent_id}", s.agentHandler.UpdateAgentById)
+			r.Patch("/{agent_id}", s.agentHandler.PatchAgentById)
 		})
 
 		r.Route("/category_management/activity_type", func(r chi.Router) {
@@ -116,6 +154,7 @@ func (s *Server) routes() {
 			r.Get("/product_type_id", s.categoryManagementProductTypeHandler.FilterProductType)
 			r.Delete("/{product_type_id}", s.categoryManagementProductTypeHandler.DeleteProductTypeById)
 			r.Put("/{product_type_id}", s.categoryManagementProductTypeHandler.UpdateProductTypeById)
+			r.Patch("/{product_type_id}", s.categoryManagementProductTypeHandler.PatchProductTypeById)
 		})
 
 		r.Route("/checklist", func(r chi.Router) {
@@ -125,13 +164,82 @@ func (s *Server) routes() {
 			r.Get("/shipment_id", s.checklistHandler.FilterChecklist)
 			r.Delete("/{shipment_id}", s.checklistHandler.DeleteChecklistById)
 			r.Put("/{shipment_id}", s.checklistHandler.UpdateChecklistById)
+			r.Patch("/{shipment_id}", s.checklistHandler.PatchChecklistById)
+			r.Post("/{shipment_id}/from_template", s.checklistTemplateHandler.CreateChecklistFromTemplate)
+			r.Put("/{shipment_id}/items/{item_key}", s.checklistItemHandler.UpdateChecklistItem)
+			r.Put("/{shipment_id}/items/{item_key}/status", s.checklistItemHandler.UpdateChecklistItemStatus)
+			r.Post("/{shipment_id}/items/{item_key}/attachments", s.checklistItemHandler.AddChecklistItemAttachment)
+		})
+
+		r.Route("/checklist_templates", func(r chi.Router) {
+			r.Get("/", s.checklistTemplateHandler.GetAllChecklistTemplates)
+			r.Post("/", s.checklistTemplateHandler.CreateChecklistTemplate)
+			r.Get("/{checklist_template_id}", s.checklistTemplateHandler.GetChecklistTemplateById)
+			r.Put("/{checklist_template_id}", s.checklistTemplateHandler.UpdateChecklistTemplateById)
+			r.Delete("/{checklist_template_id}", s.checklistTemplateHandler.DeleteChecklistTemplateById)
+		})
+
+		r.Route("/trash", func(r chi.Router) {
+			r.Get("/{resource}", s.trashHandler.GetTrash)
+			r.Post("/{resource}/{id}/restore", s.trashHandler.RestoreFromTrash)
+		})
+
+		// Users' own account and the tenant's management, which API keys have no access to
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireUser)
+
+			r.Post("/logout", s.sessionHandler.Logout)
+
+			r.Route("/sessions", func(r chi.Router) {
+				r.Get("/", s.sessionHandler.GetSessions)
+				r.Delete("/", s.sessionHandler.RevokeSessions)
+				r.Delete("/{session_id}", s.sessionHandler.RevokeSession)
+			})
+
+			r.Route("/account", func(r chi.Router) {
+				r.Post("/change_password", s.passwordHandler.ChangePassword)
+				r.Post("/totp/enrol", s.totpHandler.Enrol)
+				r.Post("/totp/confirm", s.totpHandler.Confirm)
+				r.Post("/totp/disable", s.totpHandler.Disable)
+				r.Post("/totp/recovery_codes", s.totpHandler.RegenerateRecoveryCodes)
+			})
+
+			r.Route("/invitations", func(r chi.Router) {
+				r.Use(s.loginHandler.RequireRole(enum.USER_ROLE_ADMIN))
+				r.Get("/", s.invitationHandler.GetInvitations)
+				r.Post("/", s.invitationHandler.CreateInvitation)
+				r.Delete("/{invitation_id}", s.invitationHandler.RevokeInvitation)
+			})
+
+			r.Route("/api_keys", func(r chi.Router) {
+				r.Use(s.loginHandler.RequireRole(enum.USER_ROLE_ADMIN))
+				r.Get("/", s.apiKeyHandler.GetAPIKeys)
+				r.Post("/", s.apiKeyHandler.CreateAPIKey)
+				r.Delete("/{api_key_id}", s.apiKeyHandler.RevokeAPIKey)
+			})
+
+			r.Route("/audit", func(r chi.Router) {
+				r.Use(s.loginHandler.RequireRole(enum.USER_ROLE_ADMIN))
+				r.Get("/", s.auditHandler.GetAuditEntries)
+			})
+
+			r.Route("/llm_usage", func(r chi.Router) {
+				r.Use(s.loginHandler.RequireRole(enum.USER_ROLE_ADMIN))
+				r.Get("/", s.llmMeter.GetUsageReport)
+			})
 		})
 
 	})
 
-	// Special routes without JWT auth
+	// Special routes without JWT auth, for signed requests and API keys
 	s.router.Group(func(r chi.Router) {
 		r.Route("/master_email_messages", func(r chi.Router) {
+			r.Use(handler.RecordRequest(enum.AUDIT_SOURCE_EMAIL))
+			// every email is read by OpenAI, which is paid for
+			r.Use(s.rateLimiter.LimitBody("email"))
+			r.Use(s.rateLimiter.LimitIP("email"))
+			r.Use(s.emailWebhook.Authenticate)
+			r.Use(s.rateLimiter.LimitPrincipal("email"))
 			r.Post("/", s.feedHandler.CreateFeedMessage)
 		})
 	})
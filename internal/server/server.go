@@ -5,6 +5,7 @@ import (
 	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/internal/handler"
+	"backend-crm/pkg/utils"
 	"fmt"
 
 	"context"
@@ -30,6 +31,20 @@ type Server struct {
 	categoryManagementActivityTypeHandler *handler.CategoryManagementActivityTypeHandler
 	categoryManagementProductTypeHandler  *handler.CategoryManagementProductTypeHandler
 	checklistHandler                      *handler.ChecklistHandler
+	crewChangeHandler                     *handler.CrewChangeHandler
+	checklistTemplateHandler              *handler.ChecklistTemplateHandler
+	checklistItemHandler                  *handler.ChecklistItemHandler
+	trashHandler                          *handler.TrashHandler
+	auditHandler                          *handler.AuditHandler
+	invitationHandler                     *handler.InvitationHandler
+	passwordHandler                       *handler.PasswordHandler
+	totpHandler                           *handler.TOTPHandler
+	sessionHandler                        *handler.SessionHandler
+	apiKeyHandler                         *handler.APIKeyHandler
+	emailWebhook                          *handler.EmailWebhook
+	ssoHandler                            *handler.SSOHandler
+	rateLimiter                           *handler.RateLimiter
+	llmMeter                              *handler.LLMMeter
 
 	loginHandler          *handler.LoginHandler
 	invoicePricingHandler *handler.InvoicePricingHandler
@@ -52,16 +67,45 @@ func NewServer(
 	InvoicePricingCollection database.Collection[database.InvoicePricing, database.InvoicePricingResponse],
 	sessionCollection database.Collection[database.Session, database.SessionResponse],
 	checklistColection database.Collection[database.Checklist, database.ChecklistResponse],
+	crewChangeCollection database.Collection[database.CrewChange, database.CrewChangeResponse],
+	checklistTemplateCollection database.Collection[database.ChecklistTemplate, database.ChecklistTemplateResponse],
+	notificationCollection database.Collection[database.Notification, database.NotificationResponse],
+	unitOfWork *database.UnitOfWork,
+	provisioningCfg config.Provisioning,
+	trashBins map[string]database.Trash,
+	auditTrail database.AuditTrail,
+	invitationCollection database.Collection[database.Invitation, database.InvitationResponse],
+	invitationsCfg config.Invitations,
+	passwordResetCollection database.Collection[database.PasswordReset, database.PasswordResetResponse],
+	loginAttempts database.LoginAttemptCounter,
+	lockoutCfg config.Lockout,
+	apiKeyCollection database.Collection[database.APIKey, database.APIKeyResponse],
+	emailWebhookCfg config.EmailWebhook,
+	tenantCollection database.Collection[database.Tenant, database.TenantResponse],
+	ssoLoginCollection database.Collection[database.SSOLogin, database.SSOLoginResponse],
+	ssoCfg config.SSO,
+	rateLimitCfg config.RateLimit,
+	rateLimitStore database.RateLimitStore,
+	llmUsageCollection database.Collection[database.LLMUsage, database.LLMUsageResponse],
+	llmSpends database.LLMSpendCounter,
+	llmUsageCfg config.LLMUsage,
 
 ) *Server {
 	router := chi.NewRouter()
 
+	// every address limited, locked out or allowed is the client's, not the load balancer's
+	trustedProxies, err := handler.NewTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Error configuring trusted proxies: %v", err)
+	}
+	router.Use(trustedProxies.RealIP)
+
 	// Configure CORS middleware to allow all origins
 	cors := cors.New(cors.Options{
 		AllowedOrigins:   []string{"https://www.columbus-crm.com", "http://localhost:5173"}, // Allow all origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -74,11 +118,51 @@ func NewServer(
 	agentHandler := handler.NewAgentHandler(agentCollection)
 	categoryManagementActivityTypeHandler := handler.NewActivityTypeHandler(activityTypeCollection)
 	categoryManagementProductTypeHandler := handler.NewProductTypeHandler(productTypeCollection)
-	shipmentHandler := handler.NewShipmentHandler(shipmentCollection)
-	feedHandler := handler.NewFeedHandler(feedCollection, shipmentCollection, checklistColection)
-	loginHandler := handler.NewLoginHandler(loginCollection, sessionCollection)
+	provisioningSteps, err := handler.SelectShipmentProvisioningSteps(provisioningCfg.ShipmentProvisioningSteps,
+		&handler.ChecklistProvisioningStep{ChecklistTemplateCollection: checklistTemplateCollection, ChecklistCollection: checklistColection},
+		&handler.PDAProvisioningStep{InvoicePricingCollection: InvoicePricingCollection, LoadTariff: utils.LoadInvoiceFeesData},
+		&handler.NotificationProvisioningStep{NotificationCollection: notificationCollection},
+	)
+	if err != nil {
+		log.Fatalf("Error configuring shipment provisioning: %v", err)
+	}
+	shipmentProvisioner := handler.NewShipmentProvisioner(unitOfWork, shipmentCollection, provisioningSteps)
+	shipmentDeletion := handler.NewShipmentDeletion(unitOfWork, shipmentCollection, trashBins[handler.TRASH_SHIPMENTS], []handler.ShipmentDependent{
+		{Name: "checklist", Trash: trashBins[handler.TRASH_CHECKLISTS]},
+		{Name: "crew change", Trash: trashBins[handler.TRASH_CREW_CHANGES]},
+		{Name: "notifications", Trash: trashBins[handler.TRASH_NOTIFICATIONS]},
+		{Name: "issued invoice", Trash: trashBins[handler.TRASH_INVOICES], Blocks: handler.HasIssuedInvoice(InvoicePricingCollection)},
+		{Name: "feed emails", Trash: trashBins[handler.TRASH_FEED_EMAILS], Blocks: handler.HasFeedEmails(feedCollection)},
+	})
+	shipmentHandler := handler.NewShipmentHandler(shipmentCollection, shipmentProvisioner, shipmentDeletion)
+	llmMeter, err := handler.NewLLMMeter(llmUsageCfg, llmUsageCollection, llmSpends, tenantCollection)
+	if err != nil {
+		log.Fatalf("Error configuring LLM usage: %v", err)
+	}
+	feedHandler := handler.NewFeedHandler(feedCollection, shipmentCollection, checklistColection, checklistTemplateCollection, InvoicePricingCollection, crewChangeCollection, unitOfWork, llmMeter)
+	loginLockout := handler.NewLoginLockout(loginAttempts, lockoutCfg)
+	loginHandler := handler.NewLoginHandler(loginCollection, sessionCollection, loginLockout)
 	invoicePricingHandler := handler.NewInvoicePricingHandler(InvoicePricingCollection)
 	checklistHandler := handler.NewChecklistHandler(checklistColection)
+	crewChangeHandler := handler.NewCrewChangeHandler(crewChangeCollection, shipmentCollection, checklistColection, InvoicePricingCollection, unitOfWork)
+	checklistTemplateHandler := handler.NewChecklistTemplateHandler(checklistTemplateCollection, shipmentCollection, checklistColection)
+	checklistItemHandler := handler.NewChecklistItemHandler(checklistColection, supplierCollection, InvoicePricingCollection, unitOfWork)
+	trashHandler := handler.NewTrashHandler(trashBins, shipmentDeletion)
+	auditHandler := handler.NewAuditHandler(auditTrail)
+	invitationHandler := handler.NewInvitationHandler(invitationCollection, loginCollection, notificationCollection, unitOfWork, invitationsCfg.InvitationTTL)
+	totpHandler := handler.NewTOTPHandler(loginCollection, loginLockout)
+	sessionHandler := handler.NewSessionHandler(sessionCollection)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyCollection)
+	emailWebhook, err := handler.NewEmailWebhook(emailWebhookCfg, apiKeyHandler)
+	if err != nil {
+		log.Fatalf("Error configuring the email webhook: %v", err)
+	}
+	rateLimiter, err := handler.NewRateLimiter(rateLimitCfg, rateLimitStore)
+	if err != nil {
+		log.Fatalf("Error configuring rate limits: %v", err)
+	}
+	ssoHandler := handler.NewSSOHandler(tenantCollection, loginCollection, ssoLoginCollection, loginHandler, ssoCfg)
+	passwordHandler := handler.NewPasswordHandler(loginCollection, sessionCollection, passwordResetCollection, notificationCollection, unitOfWork, loginLockout)
 
 	clients.InitClients()
 
@@ -96,6 +180,20 @@ func NewServer(
 		loginHandler:                          loginHandler,
 		invoicePricingHandler:                 invoicePricingHandler,
 		checklistHandler:                      checklistHandler,
+		crewChangeHandler:                     crewChangeHandler,
+		checklistTemplateHandler:              checklistTemplateHandler,
+		checklistItemHandler:                  checklistItemHandler,
+		trashHandler:                          trashHandler,
+		auditHandler:                          auditHandler,
+		invitationHandler:                     invitationHandler,
+		passwordHandler:                       passwordHandler,
+		totpHandler:                           totpHandler,
+		sessionHandler:                        sessionHandler,
+		apiKeyHandler:                         apiKeyHandler,
+		emailWebhook:                          emailWebhook,
+		ssoHandler:                            ssoHandler,
+		rateLimiter:                           rateLimiter,
+		llmMeter:                              llmMeter,
 		router:                                router,
 	}
 
@@ -0,0 +1,176 @@
+package nlp
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETA is an arrival time parsed from free text written by a master.
+// Time is always stored in UTC; Text keeps what the master actually wrote.
+type ETA struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+	Zone string    `json:"zone"`
+}
+
+var ErrETANotFound = errors.New("no ETA date found in text")
+
+var (
+	// "GMT+8", "UTC +08:00", "UTC-0330"
+	etaOffsetZonePattern = regexp.MustCompile(`(?i)\b(?:UTC|GMT)\s*([+-])\s*(\d{1,2})(?::?(\d{2}))?\b`)
+	// "UTC", "GMT", or a nautical "Z" suffix such as "0600Z"
+	etaUTCZonePattern = regexp.MustCompile(`(?i)\b(?:UTC|GMT)\b|\b(\d{2}:?\d{2})Z\b`)
+	// "LT", "L.T.", "local time"
+	etaLocalZonePattern = regexp.MustCompile(`(?i)\bL\.?T\.?(?:\s|/|$|\b)|\blocal\s+time\b`)
+	// "AGW" (all going well), "WSNP" (weather and safe navigation permitting), "WP", "PBG"
+	etaNoisePattern = regexp.MustCompile(`(?i)\b(?:AGW|WSNP|WP|PBG)\b`)
+
+	// "26th Feb'24", "21 Feb 2024", "08-Dec-2024". A bare two digit year is not accepted
+	// since "2nd Jan 0900" would otherwise read the time as the year.
+	etaDatePattern = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?[\s\-/.]*([a-z]{3,9})\b(?:[\s\-/.]*(20\d{2})\b|\s*'(\d{2})\b)?`)
+	// "26/02/2024", "26.02.24"
+	etaNumericDatePattern = regexp.MustCompile(`\b(\d{1,2})[/.](\d{1,2})[/.](\d{4}|\d{2})\b`)
+	// "0600", "06:00", "6:00", "0600hrs"
+	etaTimePattern = regexp.MustCompile(`(?i)\b([01]?\d|2[0-3]):?([0-5]\d)(?:\s*(?:hrs|hours|h))?\b`)
+)
+
+// etaMonths are the month names and their abbreviations, so that words such as "marine" or "decks" are not months.
+var etaMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March,
+	"apr": time.April, "may": time.May, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "sept": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+	"january": time.January, "february": time.February, "march": time.March,
+	"april": time.April, "june": time.June, "july": time.July,
+	"august": time.August, "september": time.September, "october": time.October,
+	"november": time.November, "december": time.December,
+}
+
+// ParseETA extracts an ETA from text such as "0600 LT/26th Feb'24 AGW WSNP" or "21 Feb 2024 12:00 GMT+8".
+// Explicit zone markers (UTC, GMT, GMT+N, Z) are honoured; "LT" or no marker at all
+// means the time is local to the port, so fallback is used.
+// now is used to infer the year when the master leaves it out.
+func ParseETA(text string, fallback *time.Location, now time.Time) (ETA, error) {
+	remaining := etaNoisePattern.ReplaceAllString(text, " ")
+	location, zone, remaining := detectETAZone(remaining, fallback)
+
+	year, month, day, remaining, ok := extractETADate(remaining)
+	if !ok {
+		return ETA{Text: text, Zone: zone}, ErrETANotFound
+	}
+
+	hour, minute := 0, 0
+	if match := etaTimePattern.FindStringSubmatch(remaining); match != nil {
+		hour, _ = strconv.Atoi(match[1])
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	if year == 0 {
+		year = inferETAYear(month, day, now.In(location))
+	}
+
+	eta := time.Date(year, month, day, hour, minute, 0, 0, location)
+	return ETA{
+		Time: eta.UTC(),
+		Text: strings.TrimSpace(text),
+		Zone: zone,
+	}, nil
+}
+
+// detectETAZone finds the zone marker in text and returns the location it refers to,
+// a display name for it, and the text with the marker removed.
+func detectETAZone(text string, fallback *time.Location) (*time.Location, string, string) {
+	if match := etaOffsetZonePattern.FindStringSubmatchIndex(text); match != nil {
+		sign := text[match[2]:match[3]]
+		hours, _ := strconv.Atoi(text[match[4]:match[5]])
+		minutes := 0
+		if match[6] != -1 {
+			minutes, _ = strconv.Atoi(text[match[6]:match[7]])
+		}
+		offset := hours*60*60 + minutes*60
+		if sign == "-" {
+			offset = -offset
+		}
+		name := strings.ToUpper(strings.Join(strings.Fields(text[match[0]:match[1]]), ""))
+		return time.FixedZone(name, offset), name, text[:match[0]] + " " + text[match[1]:]
+	}
+
+	if match := etaUTCZonePattern.FindStringSubmatchIndex(text); match != nil {
+		// keep the digits of "0600Z", only drop the "Z"
+		if match[2] != -1 {
+			return time.UTC, "UTC", text[:match[3]] + " " + text[match[1]:]
+		}
+		return time.UTC, "UTC", text[:match[0]] + " " + text[match[1]:]
+	}
+
+	if fallback == nil {
+		fallback = time.UTC
+	}
+	if match := etaLocalZonePattern.FindStringIndex(text); match != nil {
+		return fallback, fallback.String(), text[:match[0]] + " " + text[match[1]:]
+	}
+	return fallback, fallback.String(), text
+}
+
+// extractETADate returns the first recognisable date in text and the text with that date removed,
+// so that a four digit year is not later mistaken for a time.
+func extractETADate(text string) (int, time.Month, int, string, bool) {
+	for _, match := range etaDatePattern.FindAllStringSubmatchIndex(text, -1) {
+		monthName := strings.ToLower(text[match[4]:match[5]])
+		month, ok := etaMonths[monthName]
+		if !ok {
+			continue
+		}
+		day, _ := strconv.Atoi(text[match[2]:match[3]])
+		if day < 1 || day > 31 {
+			continue
+		}
+		year := 0
+		if match[6] != -1 {
+			year = normaliseETAYear(text[match[6]:match[7]])
+		} else if match[8] != -1 {
+			year = normaliseETAYear(text[match[8]:match[9]])
+		}
+		return year, month, day, text[:match[0]] + " " + text[match[1]:], true
+	}
+
+	if match := etaNumericDatePattern.FindStringSubmatchIndex(text); match != nil {
+		// Masters in this region write dates day first
+		day, _ := strconv.Atoi(text[match[2]:match[3]])
+		month, _ := strconv.Atoi(text[match[4]:match[5]])
+		if day >= 1 && day <= 31 && month >= 1 && month <= 12 {
+			year := normaliseETAYear(text[match[6]:match[7]])
+			return year, time.Month(month), day, text[:match[0]] + " " + text[match[1]:], true
+		}
+	}
+
+	return 0, 0, 0, text, false
+}
+
+func normaliseETAYear(year string) int {
+	value, _ := strconv.Atoi(year)
+	if len(year) == 2 {
+		value += 2000
+	}
+	return value
+}
+
+// inferETAYear picks the year that puts the date closest to now,
+// so a "2nd Jan" ETA sent on 30 Dec lands in the following year.
+func inferETAYear(month time.Month, day int, now time.Time) int {
+	best := now.Year()
+	bestDistance := time.Duration(1<<63 - 1)
+	for _, year := range []int{now.Year() - 1, now.Year(), now.Year() + 1} {
+		distance := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Sub(now)
+		if distance < 0 {
+			distance = -distance
+		}
+		if distance < bestDistance {
+			best, bestDistance = year, distance
+		}
+	}
+	return best
+}
@@ -0,0 +1,100 @@
+package nlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETA(t *testing.T) {
+	singapore := time.FixedZone("SGT", 8*60*60)
+	now := time.Date(2024, time.February, 20, 9, 0, 0, 0, singapore)
+
+	tests := []struct {
+		name     string
+		text     string
+		expected time.Time
+		zone     string
+	}{
+		{
+			name:     "local time marker uses port timezone",
+			text:     "ETA Singapore (PEBGC): 0600 Lt/26th Feb'24 AGW WSNP",
+			expected: time.Date(2024, time.February, 25, 22, 0, 0, 0, time.UTC),
+			zone:     "SGT",
+		},
+		{
+			name:     "no marker uses port timezone",
+			text:     "21 Feb 2024/ 12:00",
+			expected: time.Date(2024, time.February, 21, 4, 0, 0, 0, time.UTC),
+			zone:     "SGT",
+		},
+		{
+			name:     "explicit UTC",
+			text:     "19 Jun 2024 10:00 UTC",
+			expected: time.Date(2024, time.June, 19, 10, 0, 0, 0, time.UTC),
+			zone:     "UTC",
+		},
+		{
+			name:     "nautical Z suffix",
+			text:     "ETA 0600Z 26 Feb",
+			expected: time.Date(2024, time.February, 26, 6, 0, 0, 0, time.UTC),
+			zone:     "UTC",
+		},
+		{
+			name:     "GMT offset",
+			text:     "08 Dec 2024 22:30 GMT+5",
+			expected: time.Date(2024, time.December, 8, 17, 30, 0, 0, time.UTC),
+			zone:     "GMT+5",
+		},
+		{
+			name:     "UTC offset with minutes",
+			text:     "ETA 1st Mar 2024 0800 hrs UTC+05:30",
+			expected: time.Date(2024, time.March, 1, 2, 30, 0, 0, time.UTC),
+			zone:     "UTC+05:30",
+		},
+		{
+			name:     "full month name",
+			text:     "ETA 5 March 2024 1400 LT",
+			expected: time.Date(2024, time.March, 5, 6, 0, 0, 0, time.UTC),
+			zone:     "SGT",
+		},
+		{
+			name:     "words starting like a month are not months",
+			text:     "2 marine surveyors and 3 decks to inspect, ETA 4th Sept 2024 0900",
+			expected: time.Date(2024, time.September, 4, 1, 0, 0, 0, time.UTC),
+			zone:     "SGT",
+		},
+		{
+			name:     "numeric day first date",
+			text:     "ETA 02/03/2024 14:00 LT",
+			expected: time.Date(2024, time.March, 2, 6, 0, 0, 0, time.UTC),
+			zone:     "SGT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eta, err := ParseETA(tt.text, singapore, now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, eta.Time)
+			assert.Equal(t, time.UTC, eta.Time.Location())
+			assert.Equal(t, tt.zone, eta.Zone)
+			assert.Equal(t, tt.text, eta.Text)
+		})
+	}
+}
+
+func TestParseETA_InfersYearAcrossNewYear(t *testing.T) {
+	singapore := time.FixedZone("SGT", 8*60*60)
+	now := time.Date(2024, time.December, 30, 9, 0, 0, 0, singapore)
+
+	eta, err := ParseETA("ETA 2nd Jan 0900 LT", singapore, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, time.January, 2, 1, 0, 0, 0, time.UTC), eta.Time)
+}
+
+func TestParseETA_NoDate(t *testing.T) {
+	_, err := ParseETA("Pls find attached NOR tendered.", time.UTC, time.Now())
+	assert.ErrorIs(t, err, ErrETANotFound)
+}
@@ -1,13 +1,12 @@
 package nlp
 
 import (
-	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
 	"backend-crm/pkg/external/openai"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
-	"reflect"
 	"strings"
 )
 
@@ -49,9 +48,9 @@ func ParseGetIntentionsFromChecklistOpenAIResponse(response *http.Response) (str
 	return parsedIntention, nil
 }
 
-func GetIntentionsFromChecklistOpenAIPrompt() string {
-	// Get intentions from database.Checklist
-	intentions := getIntentionsFromChecklist()
+func GetIntentionsFromChecklistOpenAIPrompt(templateItems []core.ChecklistTemplateItem) string {
+	// Get intentions from the tenant's checklist templates
+	intentions := getIntentionsFromChecklist(templateItems)
 
 	// Create the question prompt with the formatted intentions list
 	questionPrompt := strings.Join([]string{
@@ -71,17 +70,14 @@ func GetIntentionsFromChecklistOpenAIPrompt() string {
 	return questionPrompt
 }
 
-func getIntentionsFromChecklist() []string {
+// getIntentionsFromChecklist lists the item keys of the checklist templates, plus crew changes,
+// which are not a checklist item but are picked up from the same emails.
+func getIntentionsFromChecklist(templateItems []core.ChecklistTemplateItem) []string {
 	var intentions []string
-	checklistType := reflect.TypeOf(database.Checklist{})
-
-	for i := 0; i < checklistType.NumField(); i++ {
-		field := checklistType.Field(i)
-		jsonTag := field.Tag.Get("json")
-		if jsonTag != "" && jsonTag != "extras" {
-			intentions = append(intentions, jsonTag)
-		}
+	for _, item := range templateItems {
+		intentions = append(intentions, item.Key)
 	}
+	intentions = append(intentions, core.CREW_CHANGE_INTENTION)
 
 	return intentions
 }
@@ -89,7 +85,12 @@ func getIntentionsFromChecklist() []string {
 func GetETAFromMasterEmailOpenAIPrompt() string {
 
 	// Create the question prompt with the formatted intentions list
-	questionPrompt := "Output the ETA. For example, \"19 Jun 2023 10:00\" or  \"08 Dec 2024 22:30\""
+	questionPrompt := strings.Join([]string{
+		"Output the ETA.",
+		"Keep any time zone marker exactly as written, such as LT, UTC, GMT+8 or Z. For example, \"19 Jun 2023 10:00 LT\" or \"08 Dec 2024 22:30 UTC\".",
+		"If no time zone is given, output only the date and time. For example, \"19 Jun 2023 10:00\".",
+		"Do not say anything else.",
+	}, " ")
 
 	// Use the questionPrompt as needed
 	log.Println(questionPrompt)
@@ -0,0 +1,229 @@
+package nlp
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/core"
+	"backend-crm/pkg/enum"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weights for each signal the matcher looks for in an inbound email.
+// A single strong identifier (IMO, call sign, vessel name, sender) is enough on its own
+// to reach MATCH_THRESHOLD; weaker signals only help break ties.
+const (
+	IMO_NUMBER_WEIGHT   float64 = 60
+	CALL_SIGN_WEIGHT    float64 = 40
+	VESSEL_NAME_WEIGHT  float64 = 40
+	MASTER_EMAIL_WEIGHT float64 = 40
+	VOYAGE_WEIGHT       float64 = 25
+	ETA_WEIGHT          float64 = 15
+
+	// MATCH_THRESHOLD is the minimum score for an email to be linked to a shipment automatically.
+	MATCH_THRESHOLD float64 = 40
+	// AMBIGUITY_MARGIN is how far the best candidate must lead the runner-up to be linked automatically.
+	AMBIGUITY_MARGIN float64 = 20
+	// REVIEW_THRESHOLD is the minimum score for a shipment to be offered as a candidate for manual review.
+	REVIEW_THRESHOLD float64 = 20
+
+	// vesselNameSimilarity is how close a fuzzy vessel name has to be to count at all.
+	vesselNameSimilarity float64 = 0.8
+	// etaProximityWindow is how far the ETA in an email may be from the shipment's current ETA and still score.
+	etaProximityWindow = 48 * time.Hour
+)
+
+// ShipmentMatchResult is the outcome of matching an email against a tenant's active shipments.
+// Best is only set when the email can be linked without review.
+type ShipmentMatchResult struct {
+	Best       *core.ShipmentCandidate
+	Candidates []core.ShipmentCandidate
+	Ambiguous  bool
+}
+
+var (
+	matcherTokenPattern = regexp.MustCompile(`[A-Za-z0-9]+`)
+	// vessel type prefixes that masters and operators use inconsistently, "MT UOG IOANNIS V" vs "UOG IOANNIS V"
+	vesselPrefixes = map[string]bool{"MT": true, "MV": true, "SS": true, "MS": true, "MY": true, "LPG": true, "LNG": true}
+)
+
+// MatchShipments scores every active shipment against the email and decides whether the email
+// can be linked automatically or needs to go to review.
+func MatchShipments(email database.FeedEmail, shipments []database.ShipmentResponse, location *time.Location, now time.Time) ShipmentMatchResult {
+	text := email.Subject + "\n" + email.BodyContent
+	tokens := tokenise(text)
+	compact := strings.Join(tokens, "")
+
+	var emailETA *time.Time
+	if eta, err := ParseETA(email.BodyContent, location, now); err == nil {
+		emailETA = &eta.Time
+	}
+
+	var candidates []core.ShipmentCandidate
+	for _, shipment := range shipments {
+		if shipment.CurrentStatus == enum.SHIPMENT_STATUS_COSP || shipment.CurrentStatus == enum.SHIPMENT_STATUS_ACTIVITY_COMPLETED {
+			continue
+		}
+		candidate := scoreShipment(email, shipment, tokens, compact, emailETA)
+		if candidate.Score >= REVIEW_THRESHOLD {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	result := ShipmentMatchResult{Candidates: candidates}
+	if len(candidates) == 0 {
+		return result
+	}
+
+	best := candidates[0]
+	leadsRunnerUp := len(candidates) == 1 || best.Score-candidates[1].Score >= AMBIGUITY_MARGIN
+	if best.Score >= MATCH_THRESHOLD && leadsRunnerUp {
+		result.Best = &best
+	} else {
+		result.Ambiguous = true
+	}
+	return result
+}
+
+func scoreShipment(email database.FeedEmail, shipment database.ShipmentResponse, tokens []string, compact string, emailETA *time.Time) core.ShipmentCandidate {
+	candidate := core.ShipmentCandidate{
+		ShipmentID: shipment.ID,
+		VesselName: shipment.VesselSpecifications.VesselName,
+	}
+	add := func(score float64, reason string) {
+		candidate.Score += score
+		candidate.Reasons = append(candidate.Reasons, reason)
+	}
+
+	if imo := shipment.VesselSpecifications.ImoNumber; imo > 0 && containsIMO(tokens, strconv.FormatInt(imo, 10)) {
+		add(IMO_NUMBER_WEIGHT, "imo_number")
+	}
+
+	if callSign := strings.ToUpper(shipment.VesselSpecifications.CallSign); callSign != "" && containsToken(tokens, callSign) {
+		add(CALL_SIGN_WEIGHT, "call_sign")
+	}
+
+	if similarity := vesselNameSimilarityScore(shipment.VesselSpecifications.VesselName, tokens); similarity >= vesselNameSimilarity {
+		add(VESSEL_NAME_WEIGHT*similarity, fmt.Sprintf("vessel_name(%.2f)", similarity))
+	}
+
+	if voyage := strings.Join(tokenise(shipment.VoyageNumber), ""); len(voyage) >= 4 && strings.Contains(compact, voyage) {
+		add(VOYAGE_WEIGHT, "voyage_number")
+	}
+
+	if shipment.MasterEmail != "" && strings.EqualFold(strings.TrimSpace(shipment.MasterEmail), strings.TrimSpace(email.MasterEmail)) {
+		add(MASTER_EMAIL_WEIGHT, "master_email")
+	}
+
+	if emailETA != nil && !shipment.CurrentETA.IsZero() {
+		distance := math.Abs(float64(emailETA.Sub(shipment.CurrentETA)))
+		if distance < float64(etaProximityWindow) {
+			add(ETA_WEIGHT*(1-distance/float64(etaProximityWindow)), "eta_proximity")
+		}
+	}
+
+	candidate.Score = math.Round(candidate.Score*100) / 100
+	return candidate
+}
+
+// tokenise splits text into upper-cased alphanumeric words, so "V-202402/ST" becomes ["V", "202402", "ST"].
+func tokenise(text string) []string {
+	tokens := matcherTokenPattern.FindAllString(text, -1)
+	for i, token := range tokens {
+		tokens[i] = strings.ToUpper(token)
+	}
+	return tokens
+}
+
+func containsToken(tokens []string, value string) bool {
+	for _, token := range tokens {
+		if token == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIMO accepts both a bare "9937938" and "IMO9937938".
+func containsIMO(tokens []string, imo string) bool {
+	for _, token := range tokens {
+		if token == imo || token == "IMO"+imo {
+			return true
+		}
+	}
+	return false
+}
+
+// vesselNameSimilarityScore returns 1 when the vessel name appears verbatim in the tokens,
+// otherwise the best edit-distance similarity against any run of words of about the same length.
+func vesselNameSimilarityScore(vesselName string, tokens []string) float64 {
+	nameTokens := stripVesselPrefix(tokenise(vesselName))
+	if len(nameTokens) == 0 {
+		return 0
+	}
+	name := strings.Join(nameTokens, "")
+
+	best := 0.0
+	for size := len(nameTokens) - 1; size <= len(nameTokens)+1; size++ {
+		if size < 1 {
+			continue
+		}
+		for start := 0; start+size <= len(tokens); start++ {
+			window := strings.Join(tokens[start:start+size], "")
+			if window == name {
+				return 1
+			}
+			if similarity := stringSimilarity(name, window); similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
+
+func stripVesselPrefix(tokens []string) []string {
+	for len(tokens) > 1 && vesselPrefixes[tokens[0]] {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
+
+// stringSimilarity is 1 minus the normalised Levenshtein distance between a and b.
+func stringSimilarity(a, b string) float64 {
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,104 @@
+package nlp
+
+import (
+	database "backend-crm/internal/database/mongodb"
+	"backend-crm/pkg/enum"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchShipments(t *testing.T) {
+	singapore := time.FixedZone("SGT", 8*60*60)
+	now := time.Date(2024, time.February, 24, 9, 0, 0, 0, singapore)
+
+	ioannis := database.ShipmentResponse{
+		ID:            "ioannis",
+		MasterEmail:   "master@uog.com",
+		VoyageNumber:  "V-202402",
+		CurrentStatus: enum.SHIPMENT_STATUS_EN_ROUTE,
+		CurrentETA:    time.Date(2024, time.February, 25, 22, 0, 0, 0, time.UTC),
+		VesselSpecifications: database.VesselSpecifications{
+			VesselName: "MT UOG IOANNIS V",
+			ImoNumber:  9937938,
+			CallSign:   "V7A2345",
+		},
+	}
+	sister := database.ShipmentResponse{
+		ID:            "sister",
+		MasterEmail:   "master@uog.com",
+		CurrentStatus: enum.SHIPMENT_STATUS_NOT_STARTED,
+		CurrentETA:    time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+		VesselSpecifications: database.VesselSpecifications{
+			VesselName: "UOG IOANNIS",
+			ImoNumber:  9123456,
+		},
+	}
+	completed := database.ShipmentResponse{
+		ID:            "completed",
+		MasterEmail:   "master@uog.com",
+		CurrentStatus: enum.SHIPMENT_STATUS_COSP,
+		VesselSpecifications: database.VesselSpecifications{
+			VesselName: "UOG IOANNIS V",
+			ImoNumber:  9937938,
+		},
+	}
+	shipments := []database.ShipmentResponse{ioannis, sister, completed}
+
+	t.Run("IMO number picks the right vessel between similar names", func(t *testing.T) {
+		email := database.FeedEmail{
+			MasterEmail: "master@uog.com",
+			Subject:     "UOG IOANNIS V-202402 / ST Shipping / 12 Hrs ETA Notice",
+			BodyContent: "ETA Singapore (PEBGC): 0600 Lt/26th Feb'24 AGW WSNP\nMT UOG IOANNIS V\nMarshal Islan / V898793/9937938",
+		}
+
+		result := MatchShipments(email, shipments, singapore, now)
+		assert.False(t, result.Ambiguous)
+		assert.NotNil(t, result.Best)
+		assert.Equal(t, "ioannis", result.Best.ShipmentID)
+		assert.Contains(t, result.Best.Reasons, "imo_number")
+		for _, candidate := range result.Candidates {
+			assert.NotEqual(t, "completed", candidate.ShipmentID)
+		}
+	})
+
+	t.Run("same master on two active shipments goes to review", func(t *testing.T) {
+		email := database.FeedEmail{
+			MasterEmail: "master@uog.com",
+			Subject:     "Noon report",
+			BodyContent: "All well on board.",
+		}
+
+		result := MatchShipments(email, shipments, singapore, now)
+		assert.True(t, result.Ambiguous)
+		assert.Nil(t, result.Best)
+		assert.Len(t, result.Candidates, 2)
+	})
+
+	t.Run("fuzzy vessel name with a missing suffix still matches", func(t *testing.T) {
+		email := database.FeedEmail{
+			MasterEmail: "someone@else.com",
+			Subject:     "MT UOG IOANNS V arrival",
+			BodyContent: "Call sign V7A2345",
+		}
+
+		result := MatchShipments(email, []database.ShipmentResponse{ioannis}, singapore, now)
+		assert.NotNil(t, result.Best)
+		assert.Equal(t, "ioannis", result.Best.ShipmentID)
+		assert.Contains(t, result.Best.Reasons, "call_sign")
+	})
+
+	t.Run("unrelated email matches nothing", func(t *testing.T) {
+		email := database.FeedEmail{
+			MasterEmail: "someone@else.com",
+			Subject:     "Newsletter",
+			BodyContent: "Bunker prices this week",
+		}
+
+		result := MatchShipments(email, shipments, singapore, now)
+		assert.False(t, result.Ambiguous)
+		assert.Nil(t, result.Best)
+		assert.Empty(t, result.Candidates)
+	})
+}
@@ -1,17 +1,12 @@
 package nlp
 
 import (
+	"backend-crm/internal/config"
 	database "backend-crm/internal/database/mongodb"
 	"backend-crm/pkg/enum"
 	"fmt"
 	"log"
 	"regexp"
-	"strings"
-
-	"github.com/olebedev/when"
-	"github.com/olebedev/when/rules/common"
-	"github.com/olebedev/when/rules/en"
-
 	"time"
 )
 
@@ -78,89 +73,15 @@ func TranslateMasterEmailContentToStatusUpdate(subject string, content string, c
 	}
 	log.Println(status, "status")
 	if status == enum.SHIPMENT_STATUS_EN_ROUTE {
-		// Define the regex to match exactly 4 digits
-		timeRegex := regexp.MustCompile(`\b\d{4}\b`)
-
-		// Define the regex to match date suffixes (e.g., "1st", "2nd", "3rd", "4th")
-		dateSuffixRegex := regexp.MustCompile(`\b(\d{1,2})(st|nd|rd|th)\b`)
-
-		// Remove the date suffixes by replacing them with just the digits
-		contentWithoutDateSuffix := dateSuffixRegex.ReplaceAllString(content, `$1`)
-
-		// Replace the matched time with the formatted time "HH:MM"
-		updatedContent := timeRegex.ReplaceAllStringFunc(contentWithoutDateSuffix, func(match string) string {
-			// Check if this match is already formatted with a colon (i.e., "HH:MM")
-			if len(match) == 4 && !strings.Contains(match, ":") && isLikelyTime(match, contentWithoutDateSuffix) {
-				// Insert colon to format the time
-				log.Println(match)
-				return match[:2] + ":" + match[2:]
-			}
-			return match
-		})
-		w := when.New(nil)
-		w.Add(en.All...)
-		w.Add(common.All...)
-
-		systemTimeNow := time.Now()
-		systemTimeNowLocation := systemTimeNow.Location()
-		// Check if the location is not "Local"
-		if systemTimeNowLocation.String() != "Local" {
-			// Define a fixed time zone with +8 hours offset from UTC
-			systemTimeNowLocation = time.FixedZone("UTC+8", 8*60*60)
-
-		}
-		fmt.Println(updatedContent, "updatedcontent")
-		currentTime := time.Now().In(systemTimeNowLocation)
-		r, err := w.Parse(updatedContent, currentTime)
-
+		// Masters write "0600 LT", "UTC" or "GMT+8"; anything without a marker is port local time
+		eta, err := ParseETA(content, config.TenantLocation(currentShipmentResponse.Tenant), time.Now())
 		if err != nil {
 			fmt.Println("Error parsing date:", err)
 			return currentShipmentResponse.CurrentETA, currentShipmentResponse.CurrentStatus
 		}
 
-		if r == nil {
-			fmt.Println("No date found")
-			return currentShipmentResponse.CurrentETA, currentShipmentResponse.CurrentStatus
-		}
-
-		fmt.Println("Parsed date:", r.Time)
-		eta := r.Time.In(systemTimeNowLocation)
-		fmt.Println("Constructed ETA:", eta)
-		return eta, status
+		return eta.Time, status
 	}
 
 	return currentShipmentResponse.CurrentETA, status
 }
-
-// isLikelyTime checks if the matched string is more likely a time than a year or part of a date.
-func isLikelyTime(match, originalText string) bool {
-	// Regex to detect a date pattern without ordinal suffixes (e.g., "21 Feb 2024")
-	dateRegex1 := regexp.MustCompile(`\d{1,2} \w{3} \d{4}`)
-
-	// Regex to detect a date pattern with ordinal suffixes (e.g., "21st Feb 2024" or "2nd Jan 2024")
-	// dateRegex2 := regexp.MustCompile(`\d{1,2}(st|nd|rd|th) \w{3} \d{4}`)
-
-	// Regex to detect a date pattern with slashes (e.g., "2/12/2024" or "12/2/2024")
-	dateRegex3 := regexp.MustCompile(`\b\d{1,2}/\d{1,2}/\d{4}\b`)
-
-	// Find all date matches in the text
-	dateMatches1 := dateRegex1.FindAllString(originalText, -1)
-	// dateMatches2 := dateRegex2.FindAllString(originalText, -1)
-	dateMatches3 := dateRegex3.FindAllString(originalText, -1)
-
-	// Combine all types of matches into a single slice
-	dateMatches := append(dateMatches1, dateMatches3...)
-	// dateMatches = append(dateMatches, ...)
-
-	for _, dateMatch := range dateMatches {
-		// If the match is part of a date (e.g., "21 Feb 2024" or "2/12/2024"), treat it as a year, not a time
-		if strings.Contains(dateMatch, match) {
-			log.Println(match, "false")
-			return false
-		}
-	}
-
-	// If there's no obvious date pattern nearby, assume the four digits represent a time
-	log.Println(match, "true")
-	return true
-}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys are "crm_<tenant>_<secret>", the tenant telling where the key is stored. Only their hash is stored.
+const apiKeyPrefix = "crm_"
+
+// GenerateAPIKey returns a new API key of tenant, to give to its user once, and the hash to store of it.
+func GenerateAPIKey(tenant string) (key string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + tenant + "_" + hex.EncodeToString(secret)
+	return key, HashAPIKey(key), nil
+}
+
+// APIKeyTenant is the tenant an API key is of, or false if it is not an API key.
+func APIKeyTenant(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(key, apiKeyPrefix)
+	i := strings.LastIndex(rest, "_")
+	if i <= 0 || i == len(rest)-1 {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// HashAPIKey hashes an API key for storage and lookup. The keys are random, so unlike passwords they need no slow hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
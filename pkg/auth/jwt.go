@@ -2,14 +2,14 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var mySigningKey = []byte("jameslsy") // Replace with your secret key
-
-// Claims struct
+// Claims are the claims of every token: sessions have only an expiry, the tokens sent by email for one purpose,
+// e.g. accepting an invitation, also an audience naming it and usually the ID of the document they are for.
 type Claims struct {
 	Email string `json:"email"`
 	jwt.RegisteredClaims
@@ -78,12 +78,66 @@ func GetSessionInfoFromToken(ctx context.Context) string {
 
 // GenerateJWT generates a JWT token with a given email and an expiration time
 func GenerateJWT(email string, expirationTime time.Time) (string, error) {
-	claims := &Claims{
+	return SignClaims(&Claims{
 		Email: email,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
+	})
+}
+
+// SignClaims signs claims with the current signing key.
+func SignClaims(claims *Claims) (string, error) {
+	return currentKeys().sign(claims)
+}
+
+// ParseSessionToken verifies a session token and returns its claims. The claims of an expired token are returned
+// too, with an error wrapping jwt.ErrTokenExpired, so that the session can be refreshed.
+func ParseSessionToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, currentKeys().verificationKey, jwt.WithValidMethods(validMethods()))
+	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("token is not a session token")
+	}
+	if claims.Email == "" {
+		return nil, errors.New("token has no email")
+	}
+	return claims, err
+}
+
+// SignAudienceToken signs a token for email that is only accepted by ParseAudienceToken with the same audience.
+func SignAudienceToken(email string, id string, audience string, expiresAt time.Time) (string, error) {
+	return SignClaims(&Claims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+}
+
+// ParseAudienceToken verifies a token signed by SignAudienceToken for audience, that has not expired.
+func ParseAudienceToken(tokenString string, audience string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, currentKeys().verificationKey,
+		jwt.WithAudience(audience), jwt.WithValidMethods(validMethods()), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Email == "" {
+		return nil, errors.New("token has no email")
+	}
+	return claims, nil
+}
+
+func validMethods() []string {
+	methods := make([]string, 0, len(signingMethods))
+	for alg := range signingMethods {
+		methods = append(methods, alg)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(mySigningKey)
+	return methods
 }
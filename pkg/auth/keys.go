@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one of the keys tokens are signed with, identified in their kid header by ID.
+// HS256 keys are a shared secret; RS256 and EdDSA keys are a private key to sign with, or a public key
+// that only verifies, e.g. the key of a signer being retired.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// KeySet holds the keys tokens are verified with, and which of them new tokens are signed with.
+// Keys are rotated by adding the new key, signing with it once every instance has it, and removing the old key
+// once the tokens signed with it have expired.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// minHMACKeyLength is the shortest HS256 secret new tokens are signed with, as RFC 7518 requires.
+const minHMACKeyLength = 32
+
+var signingMethods = map[string]jwt.SigningMethod{
+	jwt.SigningMethodHS256.Alg(): jwt.SigningMethodHS256,
+	jwt.SigningMethodRS256.Alg(): jwt.SigningMethodRS256,
+	jwt.SigningMethodEdDSA.Alg(): jwt.SigningMethodEdDSA,
+}
+
+// NewKeySet parses specs, each "kid:algorithm:key": for HS256 the key is the base64 secret, for RS256 and EdDSA
+// the path of a PEM file with a private key or, for a key that only verifies, a public key.
+// New tokens are signed with the key signingKeyID, or the first key if it is empty.
+func NewKeySet(specs []string, signingKeyID string) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key)}
+	for _, spec := range specs {
+		key, err := parseKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		set.keys[key.ID] = key
+		if set.signing == nil && signingKeyID == "" || key.ID == signingKeyID {
+			set.signing = key
+		}
+	}
+
+	switch {
+	case set.signing == nil && signingKeyID != "":
+		return nil, fmt.Errorf("unknown JWT signing key id %q", signingKeyID)
+	case set.signing == nil:
+		return nil, errors.New("no JWT keys")
+	case set.signing.Algorithm == jwt.SigningMethodHS256.Alg() && len(set.signing.secret) < minHMACKeyLength:
+		return nil, fmt.Errorf("JWT signing key %q is shorter than %d bytes", set.signing.ID, minHMACKeyLength)
+	case set.signing.Algorithm != jwt.SigningMethodHS256.Alg() && set.signing.private == nil:
+		return nil, fmt.Errorf("JWT signing key %q is a public key", set.signing.ID)
+	}
+	return set, nil
+}
+
+func parseKey(spec string) (*Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("JWT key %q is not kid:algorithm:key", spec)
+	}
+	key := &Key{ID: parts[0], Algorithm: parts[1]}
+
+	switch key.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		secret, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", key.ID, err)
+		}
+		key.secret = secret
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", key.ID, err)
+		}
+		if err := key.parsePEM(data); err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", key.ID, err)
+		}
+	default:
+		return nil, fmt.Errorf("JWT key %s: unsupported algorithm %q", key.ID, key.Algorithm)
+	}
+	return key, nil
+}
+
+func (k *Key) parsePEM(data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		k.private = signer
+		parsed = signer.Public()
+	}
+	switch parsed.(type) {
+	case *rsa.PublicKey:
+		if k.Algorithm != jwt.SigningMethodRS256.Alg() {
+			return errors.New("an RSA key is for RS256")
+		}
+	case ed25519.PublicKey:
+		if k.Algorithm != jwt.SigningMethodEdDSA.Alg() {
+			return errors.New("an Ed25519 key is for EdDSA")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", parsed)
+	}
+	k.public = parsed
+	return nil
+}
+
+// sign signs claims with the signing key, naming it in the kid header.
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(signingMethods[s.signing.Algorithm], claims)
+	token.Header["kid"] = s.signing.ID
+	if s.signing.secret != nil {
+		return token.SignedString(s.signing.secret)
+	}
+	return token.SignedString(s.signing.private)
+}
+
+// verificationKey is the key a token is verified with: the one its kid names, which must be for the token's algorithm.
+// Tokens from before key IDs have no kid, and are verified with the HS256 keys.
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		var secrets jwt.VerificationKeySet
+		for _, key := range s.keys {
+			if key.secret != nil {
+				secrets.Keys = append(secrets.Keys, key.secret)
+			}
+		}
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() || len(secrets.Keys) == 0 {
+			return nil, errors.New("token has no key id")
+		}
+		return secrets, nil
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %q is not for %s", kid, token.Method.Alg())
+	}
+	if key.secret != nil {
+		return key.secret, nil
+	}
+	return key.public, nil
+}
+
+// JWK is a public key as published in a JSON Web Key Set, RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS is the set of public keys, to verify tokens with elsewhere. HS256 keys are secret and are left out.
+func (s *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keys {
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return set
+}
+
+// The keys tokens are signed and verified with, set from the configuration with SetKeys.
+// Until then a random key is used, which is enough for tests but does not survive a restart.
+var (
+	keysMu sync.RWMutex
+	keys   = randomKeySet()
+)
+
+func randomKeySet() *KeySet {
+	secret := make([]byte, minHMACKeyLength)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	key := &Key{ID: "random", Algorithm: jwt.SigningMethodHS256.Alg(), secret: secret}
+	return &KeySet{signing: key, keys: map[string]*Key{key.ID: key}}
+}
+
+// SetKeys replaces the keys tokens are signed and verified with.
+func SetKeys(set *KeySet) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = set
+}
+
+func currentKeys() *KeySet {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys
+}
+
+// PublicKeys is the JSON Web Key Set of the current keys, see KeySet.JWKS.
+func PublicKeys() JWKSet {
+	return currentKeys().JWKS()
+}
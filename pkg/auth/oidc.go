@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OpenID Connect, for users who log in with their organisation's identity provider: the authorization code flow with
+// PKCE (RFC 7636), ending with an ID token that is verified against the keys the provider publishes.
+
+// oidcKeysRefreshInterval is how often the provider's keys are fetched again at most, when a token names one we do not have
+var oidcKeysRefreshInterval = time.Minute
+
+// OIDCProvider is an identity provider, as its discovery document describes it.
+type OIDCProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	client        *http.Client
+	keysMu        sync.Mutex
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// DiscoverOIDC fetches the discovery document of issuer, which must name issuer exactly.
+func DiscoverOIDC(ctx context.Context, client *http.Client, issuer string) (*OIDCProvider, error) {
+	provider := &OIDCProvider{client: client}
+	if err := getJSON(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", issuer, err)
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("discovering %s: the provider's issuer is %s", issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: endpoints are missing", issuer)
+	}
+	return provider, nil
+}
+
+// NewOIDCNonce returns a random value, for the state and nonce of a login.
+func NewOIDCNonce() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewPKCE returns a PKCE code verifier, kept until the code is exchanged, and its S256 challenge, sent with the login.
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = NewOIDCNonce()
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+// PKCEChallenge is the S256 code challenge of verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the user is sent to log in with the provider, which sends them back to redirectURI with a code.
+func (p *OIDCProvider) AuthCodeURL(clientID string, redirectURI string, state string, nonce string, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", clientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades the code the provider sent the user back with for their ID token. Public clients have no clientSecret.
+func (p *OIDCProvider) Exchange(ctx context.Context, clientID string, clientSecret string, redirectURI string, code string, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientID)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint returned no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken checks that the ID token was signed by the provider, for clientID, for the login with nonce,
+// and has not expired, and returns its claims.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, idToken string, clientID string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("the ID token is for another login")
+	}
+	// a token for several audiences names who it was issued to
+	if azp, ok := claims["azp"].(string); ok && azp != clientID {
+		return nil, errors.New("the ID token was issued to another client")
+	}
+	return claims, nil
+}
+
+// publicKey is the provider's key kid, fetching its keys again when it is not known, e.g. because they were rotated.
+// A token without a kid is verified with the provider's only key.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	if _, ok := p.keys[kid]; !ok && time.Since(p.keysFetchedAt) >= oidcKeysRefreshInterval {
+		keys, err := fetchJWKS(ctx, p.client, p.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// fetchJWKS fetches the RSA and P-256 signing keys of a JSON Web Key Set, by their key ID.
+func fetchJWKS(ctx context.Context, client *http.Client, uri string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, client, uri, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch {
+		case jwk.KeyType == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %q is not a valid RSA key", jwk.KeyID)
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.KeyType == "EC" && jwk.Curve == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+				return nil, fmt.Errorf("key %q is not a valid P-256 key", jwk.KeyID)
+			}
+			// the point is checked to be on the curve as an uncompressed point
+			if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+				return nil, fmt.Errorf("key %q is not a valid P-256 key", jwk.KeyID)
+			}
+			keys[jwk.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", uri, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"backend-crm/pkg/enum"
+	"context"
+)
+
+// ContextKeyPrincipal is the context key of who a request is made by, see WithPrincipal.
+const ContextKeyPrincipal contextKey = "principal"
+
+// Principal is who a request is made by: a logged in user, an API key of a tenant, or a tenant's signed email webhook,
+// which only has a Tenant. Email is empty for an API key, APIKeyID and Scopes for a user, who may do anything their role allows.
+type Principal struct {
+	Email    string
+	Tenant   string
+	APIKeyID string
+	Scopes   []enum.APIKeyScope
+}
+
+func (p Principal) IsAPIKey() bool {
+	return p.APIKeyID != ""
+}
+
+// Actor is who the principal's changes are recorded as made by.
+func (p Principal) Actor() string {
+	if p.IsAPIKey() {
+		return "api_key:" + p.APIKeyID
+	}
+	return p.Email
+}
+
+// HasScope reports whether the principal's API key has scope. Write includes read.
+func (p Principal) HasScope(scope enum.APIKeyScope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == enum.API_KEY_SCOPE_WRITE && scope == enum.API_KEY_SCOPE_READ {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal puts the principal in ctx, and the user's email where GetEmailFromToken finds it.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	ctx = context.WithValue(ctx, ContextKeyPrincipal, principal)
+	if principal.Email != "" {
+		ctx = context.WithValue(ctx, ContextKeyEmail, principal.Email)
+	}
+	return ctx
+}
+
+// GetPrincipal is who the request of ctx is made by, or the zero Principal if it is not authenticated.
+func GetPrincipal(ctx context.Context) Principal {
+	principal, _ := ctx.Value(ContextKeyPrincipal).(Principal)
+	return principal
+}
@@ -1,61 +1,134 @@
 package core
 
-type PortDues struct {
-	ChecklistInformation
-}
-
-type Pilotage struct {
-	ChecklistInformation
-}
-
-type ServiceLaunch struct {
-	ChecklistInformation
-}
-
-type Logistics struct {
-	ChecklistInformation
-}
-
-type HotelCharges struct {
-	ChecklistInformation
-}
-
-type AirTickets struct {
-	ChecklistInformation
-}
-
-type TransportCharges struct {
-	ChecklistInformation
-}
-
-type MedicineSupplies struct {
-	ChecklistInformation
-}
-
-type FreshWaterSupply struct {
-	ChecklistInformation
-}
-
-type MarineAdvisory struct {
-	ChecklistInformation
-}
-
-type CourierServices struct {
-	ChecklistInformation
-}
-
-type CrossHarbourFees struct {
-	ChecklistInformation
-}
-
-type SupplyBoat struct {
-	ChecklistInformation
-}
-
-type Repairs struct {
-	Deslopping Deslopping `json:"deslopping"`
-	LiftRepair LiftRepair `json:"lift_repair"`
-	UWClean    UWClean    `json:"uw_clean"`
+import (
+	"backend-crm/pkg/enum"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Keys of the checklist items that other parts of the system refer to directly.
+// Tenants may add any other items through their checklist templates.
+const (
+	CHECKLIST_ITEM_HOTEL_CHARGES     string = "hotel_charges"
+	CHECKLIST_ITEM_AIR_TICKETS       string = "air_tickets"
+	CHECKLIST_ITEM_TRANSPORT_CHARGES string = "transport_charges"
+
+	// CREW_CHANGE_INTENTION is not a checklist item, crew changes are tracked on the shipment's crew roster
+	CREW_CHANGE_INTENTION string = "crew_change"
+)
+
+// ChecklistItem is one service on a shipment's checklist, created from a ChecklistTemplateItem.
+// Its status moves from requested through to invoiced, or is cancelled, see enum.ChecklistItemStatus.
+type ChecklistItem struct {
+	Key             string                      `json:"key"`
+	Name            string                      `json:"name"`
+	Category        string                      `json:"category"`
+	Required        bool                        `json:"required"`
+	Supplier        string                      `json:"supplier"`
+	ServiceProvided bool                        `json:"service_provided"`
+	Status          enum.ChecklistItemStatus    `json:"status"`
+	StatusUpdatedAt time.Time                   `json:"status_updated_at"`
+	StatusHistory   []ChecklistItemStatusChange `json:"status_history"`
+	Quantity        float64                     `json:"quantity"`
+	Unit            string                      `json:"unit"`
+	Cost            *ChecklistItemCost          `json:"cost"`
+	Notes           string                      `json:"notes"`
+	Attachments     []ChecklistAttachment       `json:"attachments"`
+}
+
+type ChecklistItemStatusChange struct {
+	Status    enum.ChecklistItemStatus `json:"status"`
+	ChangedAt time.Time                `json:"changed_at"`
+}
+
+// ChecklistItemCost is what the supplier charges for the item. SupplierID refers to the SupplierCollection.
+type ChecklistItemCost struct {
+	SupplierID   string  `json:"supplier_id"`
+	SupplierName string  `json:"supplier_name"`
+	UnitPrice    float64 `json:"unit_price"`
+	Amount       float64 `json:"amount"`
+	Currency     string  `json:"currency"`
+}
+
+type ChecklistAttachment struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// FDACost is a line on a shipment's final disbursement account, taken from a delivered or invoiced checklist item.
+type FDACost struct {
+	ItemKey      string                   `json:"item_key"`
+	Name         string                   `json:"name"`
+	Category     string                   `json:"category"`
+	SupplierID   string                   `json:"supplier_id"`
+	SupplierName string                   `json:"supplier_name"`
+	Quantity     float64                  `json:"quantity"`
+	Unit         string                   `json:"unit"`
+	UnitPrice    float64                  `json:"unit_price"`
+	Amount       float64                  `json:"amount"`
+	Currency     string                   `json:"currency"`
+	Status       enum.ChecklistItemStatus `json:"status"`
+}
+
+// TransitionTo moves the item to status and records when it did.
+// A delivered item also counts as the service having been provided.
+func (item *ChecklistItem) TransitionTo(status enum.ChecklistItemStatus, at time.Time) error {
+	if !enum.IsValidChecklistItemStatus(status) {
+		return errors.New("unknown checklist item status: " + string(status))
+	}
+	if !enum.CanTransitionChecklistItemStatus(item.Status, status) {
+		from := string(item.Status)
+		if from == "" {
+			from = "not started"
+		}
+		return errors.New("checklist item cannot move from " + from + " to " + string(status))
+	}
+
+	item.Status = status
+	item.StatusUpdatedAt = at
+	item.StatusHistory = append(item.StatusHistory, ChecklistItemStatusChange{Status: status, ChangedAt: at})
+	if status == enum.CHECKLIST_ITEM_STATUS_DELIVERED {
+		item.ServiceProvided = true
+	}
+	return nil
+}
+
+type ChecklistItems []*ChecklistItem
+
+// Find returns the item with the given key, or nil if the checklist does not have it.
+func (items ChecklistItems) Find(key string) *ChecklistItem {
+	for _, item := range items {
+		if item != nil && item.Key == key {
+			return item
+		}
+	}
+	return nil
+}
+
+// FDACosts returns the costs of the delivered and invoiced items, the ones that belong on the FDA.
+func (items ChecklistItems) FDACosts() []FDACost {
+	var costs []FDACost
+	for _, item := range items {
+		if item == nil || item.Cost == nil || !enum.IsBillableChecklistItemStatus(item.Status) {
+			continue
+		}
+		costs = append(costs, FDACost{
+			ItemKey:      item.Key,
+			Name:         item.Name,
+			Category:     item.Category,
+			SupplierID:   item.Cost.SupplierID,
+			SupplierName: item.Cost.SupplierName,
+			Quantity:     item.Quantity,
+			Unit:         item.Unit,
+			UnitPrice:    item.Cost.UnitPrice,
+			Amount:       item.Cost.Amount,
+			Currency:     item.Cost.Currency,
+			Status:       item.Status,
+		})
+	}
+	return costs
 }
 
 type CrewChange struct {
@@ -63,25 +136,74 @@ type CrewChange struct {
 	SignOff []string `json:"sign_off"`
 }
 
-type ExtrasInformation struct {
+// ChecklistTemplateItem describes a service that checklists created from the template will contain.
+type ChecklistTemplateItem struct {
+	Key             string `json:"key"`
 	Name            string `json:"name"`
-	Supplier        string `json:"supplier"`
-	ServiceProvided bool   `json:"service_provided"`
-}
-
-type Deslopping struct {
-	ChecklistInformation
-}
-
-type LiftRepair struct {
-	ChecklistInformation
-}
-
-type UWClean struct {
-	ChecklistInformation
-}
-
-type ChecklistInformation struct {
-	Supplier        string `json:"supplier"`
-	ServiceProvided bool   `json:"service_provided"`
+	Category        string `json:"category"`
+	Required        bool   `json:"required"`
+	DefaultSupplier string `json:"default_supplier"`
+}
+
+// NewChecklistItem creates an unstarted checklist item from its template, assigned to the default supplier.
+func NewChecklistItem(templateItem ChecklistTemplateItem) *ChecklistItem {
+	return &ChecklistItem{
+		Key:      templateItem.Key,
+		Name:     templateItem.Name,
+		Category: templateItem.Category,
+		Required: templateItem.Required,
+		Supplier: templateItem.DefaultSupplier,
+	}
+}
+
+// NewChecklistItems creates the items of a new checklist, in template order.
+func NewChecklistItems(templateItems []ChecklistTemplateItem) ChecklistItems {
+	items := make(ChecklistItems, 0, len(templateItems))
+	for _, templateItem := range templateItems {
+		items = append(items, NewChecklistItem(templateItem))
+	}
+	return items
+}
+
+// MergeChecklistTemplateItems combines the items of several templates.
+// When two templates share a key, the item from the earlier template is kept.
+func MergeChecklistTemplateItems(itemLists ...[]ChecklistTemplateItem) []ChecklistTemplateItem {
+	var merged []ChecklistTemplateItem
+	seen := make(map[string]bool)
+	for _, items := range itemLists {
+		for _, item := range items {
+			if seen[item.Key] {
+				continue
+			}
+			seen[item.Key] = true
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// ChecklistItemKey turns a display name such as "Sludge Removal" into an item key, "sludge_removal".
+func ChecklistItemKey(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "_")
+}
+
+// DefaultChecklistTemplateItems is used for tenants that have not configured a checklist template.
+// It matches the services the checklist had before templates were introduced.
+var DefaultChecklistTemplateItems = []ChecklistTemplateItem{
+	{Key: "port_dues", Name: "Port Dues", Category: "Port Charges", Required: true},
+	{Key: "pilotage", Name: "Pilotage", Category: "Port Charges", Required: true},
+	{Key: "cross_harbour_fees", Name: "Cross Harbour Fees", Category: "Port Charges"},
+	{Key: "service_launch", Name: "Service Launch", Category: "Marine Services"},
+	{Key: "supply_boat", Name: "Supply Boat", Category: "Marine Services"},
+	{Key: "marine_advisory", Name: "Marine Advisory", Category: "Marine Services"},
+	{Key: "logistics", Name: "Logistics", Category: "Logistics"},
+	{Key: "courier_services", Name: "Courier Services", Category: "Logistics"},
+	{Key: CHECKLIST_ITEM_HOTEL_CHARGES, Name: "Hotel Charges", Category: "Crew"},
+	{Key: CHECKLIST_ITEM_AIR_TICKETS, Name: "Air Tickets", Category: "Crew"},
+	{Key: CHECKLIST_ITEM_TRANSPORT_CHARGES, Name: "Transport Charges", Category: "Crew"},
+	{Key: "medicine_supplies", Name: "Medicine Supplies", Category: "Supplies"},
+	{Key: "fresh_water_supply", Name: "Fresh Water Supply", Category: "Supplies"},
+	{Key: "deslopping", Name: "Deslopping", Category: "Repairs"},
+	{Key: "lift_repair", Name: "Lift Repair", Category: "Repairs"},
+	{Key: "uw_clean", Name: "Underwater Cleaning", Category: "Repairs"},
 }
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"backend-crm/pkg/enum"
+	"time"
+)
+
+// CrewMember is one person joining or leaving the vessel during a crew change.
+type CrewMember struct {
+	ID               string                   `json:"id"`
+	Name             string                   `json:"name"`
+	Rank             string                   `json:"rank"`
+	Nationality      string                   `json:"nationality"`
+	PassportNumber   string                   `json:"passport_number"`
+	PassportExpiry   time.Time                `json:"passport_expiry"`
+	SeamanBookNumber string                   `json:"seaman_book_number"`
+	Direction        enum.CrewChangeDirection `json:"direction"`
+	Status           enum.CrewChangeStatus    `json:"status"`
+	ClearanceStatus  enum.ClearanceStatus     `json:"clearance_status"`
+	Flight           *CrewFlight              `json:"flight,omitempty"`
+	Hotel            *CrewHotel               `json:"hotel,omitempty"`
+	Transport        *CrewTransport           `json:"transport,omitempty"`
+	Notes            string                   `json:"notes"`
+	StatusUpdatedAt  time.Time                `json:"status_updated_at"`
+}
+
+type CrewFlight struct {
+	Airline          string    `json:"airline"`
+	FlightNumber     string    `json:"flight_number"`
+	DepartureAirport string    `json:"departure_airport"`
+	ArrivalAirport   string    `json:"arrival_airport"`
+	DepartureTime    time.Time `json:"departure_time"`
+	ArrivalTime      time.Time `json:"arrival_time"`
+	BookingReference string    `json:"booking_reference"`
+}
+
+type CrewHotel struct {
+	Name             string    `json:"name"`
+	CheckIn          time.Time `json:"check_in"`
+	CheckOut         time.Time `json:"check_out"`
+	BookingReference string    `json:"booking_reference"`
+}
+
+type CrewTransport struct {
+	Provider       string    `json:"provider"`
+	PickupLocation string    `json:"pickup_location"`
+	DropOff        string    `json:"drop_off"`
+	PickupTime     time.Time `json:"pickup_time"`
+}
+
+// MissingDocuments lists what still has to be collected before the crew member can be cleared.
+// The passport must also stay valid past the vessel's ETA.
+func (m CrewMember) MissingDocuments(eta time.Time) []string {
+	var missing []string
+	if m.PassportNumber == "" {
+		missing = append(missing, "passport")
+	} else if !m.PassportExpiry.IsZero() && m.PassportExpiry.Before(eta) {
+		missing = append(missing, "valid passport")
+	}
+	if m.SeamanBookNumber == "" {
+		missing = append(missing, "seaman book")
+	}
+	if m.Flight == nil || m.Flight.FlightNumber == "" {
+		missing = append(missing, "flight details")
+	}
+	return missing
+}
+
+// IsActive reports whether the crew member is still part of the crew change.
+func (m CrewMember) IsActive() bool {
+	return m.Status != enum.CREW_CHANGE_STATUS_CANCELLED
+}
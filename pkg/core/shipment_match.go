@@ -0,0 +1,10 @@
+package core
+
+// ShipmentCandidate is a shipment that an inbound master email may belong to,
+// together with how confident the matcher is and why.
+type ShipmentCandidate struct {
+	ShipmentID string   `json:"shipment_id"`
+	VesselName string   `json:"vessel_name"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+}
@@ -0,0 +1,27 @@
+package enum
+
+// APIKeyScope is what an API key may be used for. A key that may write may also read.
+type APIKeyScope string
+
+const (
+	API_KEY_SCOPE_READ         APIKeyScope = "Read"
+	API_KEY_SCOPE_WRITE        APIKeyScope = "Write"
+	API_KEY_SCOPE_EMAIL_INGEST APIKeyScope = "EmailIngest"
+)
+
+// APIKeyScopes is a slice of all API key scopes
+var APIKeyScopes = []APIKeyScope{
+	API_KEY_SCOPE_READ,
+	API_KEY_SCOPE_WRITE,
+	API_KEY_SCOPE_EMAIL_INGEST,
+}
+
+// IsValidAPIKeyScope reports whether scope is one of the known API key scopes
+func IsValidAPIKeyScope(scope APIKeyScope) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
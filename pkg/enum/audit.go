@@ -0,0 +1,21 @@
+package enum
+
+// AuditSource is where a change recorded in the audit log came from.
+type AuditSource string
+
+const (
+	AUDIT_SOURCE_API   AuditSource = "API"
+	AUDIT_SOURCE_EMAIL AuditSource = "Email"
+	AUDIT_SOURCE_TIMER AuditSource = "Timer"
+	AUDIT_SOURCE_CLI   AuditSource = "CLI"
+)
+
+type AuditAction string
+
+const (
+	AUDIT_ACTION_CREATE  AuditAction = "Create"
+	AUDIT_ACTION_UPDATE  AuditAction = "Update"
+	AUDIT_ACTION_DELETE  AuditAction = "Delete"
+	AUDIT_ACTION_RESTORE AuditAction = "Restore"
+	AUDIT_ACTION_PURGE   AuditAction = "Purge"
+)
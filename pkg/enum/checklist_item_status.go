@@ -0,0 +1,58 @@
+package enum
+
+type ChecklistItemStatus string
+
+const (
+	CHECKLIST_ITEM_STATUS_REQUESTED ChecklistItemStatus = "Requested"
+	CHECKLIST_ITEM_STATUS_ORDERED   ChecklistItemStatus = "Ordered"
+	CHECKLIST_ITEM_STATUS_CONFIRMED ChecklistItemStatus = "Confirmed"
+	CHECKLIST_ITEM_STATUS_DELIVERED ChecklistItemStatus = "Delivered"
+	CHECKLIST_ITEM_STATUS_INVOICED  ChecklistItemStatus = "Invoiced"
+	CHECKLIST_ITEM_STATUS_CANCELLED ChecklistItemStatus = "Cancelled"
+)
+
+// ChecklistItemStatuses is a slice of all checklist item statuses, in the order an item moves through them
+var ChecklistItemStatuses = []ChecklistItemStatus{
+	CHECKLIST_ITEM_STATUS_REQUESTED,
+	CHECKLIST_ITEM_STATUS_ORDERED,
+	CHECKLIST_ITEM_STATUS_CONFIRMED,
+	CHECKLIST_ITEM_STATUS_DELIVERED,
+	CHECKLIST_ITEM_STATUS_INVOICED,
+	CHECKLIST_ITEM_STATUS_CANCELLED,
+}
+
+// checklistItemTransitions lists the statuses each status may move to.
+// An item that has not been requested yet has the empty status.
+var checklistItemTransitions = map[ChecklistItemStatus][]ChecklistItemStatus{
+	"":                              {CHECKLIST_ITEM_STATUS_REQUESTED, CHECKLIST_ITEM_STATUS_ORDERED, CHECKLIST_ITEM_STATUS_CANCELLED},
+	CHECKLIST_ITEM_STATUS_REQUESTED: {CHECKLIST_ITEM_STATUS_ORDERED, CHECKLIST_ITEM_STATUS_CANCELLED},
+	CHECKLIST_ITEM_STATUS_ORDERED:   {CHECKLIST_ITEM_STATUS_CONFIRMED, CHECKLIST_ITEM_STATUS_CANCELLED},
+	CHECKLIST_ITEM_STATUS_CONFIRMED: {CHECKLIST_ITEM_STATUS_DELIVERED, CHECKLIST_ITEM_STATUS_CANCELLED},
+	CHECKLIST_ITEM_STATUS_DELIVERED: {CHECKLIST_ITEM_STATUS_INVOICED},
+	CHECKLIST_ITEM_STATUS_CANCELLED: {CHECKLIST_ITEM_STATUS_REQUESTED},
+}
+
+// IsValidChecklistItemStatus reports whether status is one of the known checklist item statuses
+func IsValidChecklistItemStatus(status ChecklistItemStatus) bool {
+	for _, s := range ChecklistItemStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransitionChecklistItemStatus reports whether an item may move from one status to the next
+func CanTransitionChecklistItemStatus(from ChecklistItemStatus, to ChecklistItemStatus) bool {
+	for _, s := range checklistItemTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBillableChecklistItemStatus reports whether the cost of an item in this status belongs on the FDA
+func IsBillableChecklistItemStatus(status ChecklistItemStatus) bool {
+	return status == CHECKLIST_ITEM_STATUS_DELIVERED || status == CHECKLIST_ITEM_STATUS_INVOICED
+}
@@ -0,0 +1,48 @@
+package enum
+
+type CrewChangeDirection string
+
+const (
+	CREW_CHANGE_SIGN_ON  CrewChangeDirection = "Sign On"
+	CREW_CHANGE_SIGN_OFF CrewChangeDirection = "Sign Off"
+)
+
+type CrewChangeStatus string
+
+const (
+	CREW_CHANGE_STATUS_PENDING            CrewChangeStatus = "Pending"
+	CREW_CHANGE_STATUS_DOCUMENTS_RECEIVED CrewChangeStatus = "Documents Received"
+	CREW_CHANGE_STATUS_TRAVEL_BOOKED      CrewChangeStatus = "Travel Booked"
+	CREW_CHANGE_STATUS_CLEARED            CrewChangeStatus = "Cleared"
+	CREW_CHANGE_STATUS_COMPLETED          CrewChangeStatus = "Completed"
+	CREW_CHANGE_STATUS_CANCELLED          CrewChangeStatus = "Cancelled"
+)
+
+// CrewChangeStatuses is a slice of all crew change statuses, in the order a crew member moves through them
+var CrewChangeStatuses = []CrewChangeStatus{
+	CREW_CHANGE_STATUS_PENDING,
+	CREW_CHANGE_STATUS_DOCUMENTS_RECEIVED,
+	CREW_CHANGE_STATUS_TRAVEL_BOOKED,
+	CREW_CHANGE_STATUS_CLEARED,
+	CREW_CHANGE_STATUS_COMPLETED,
+	CREW_CHANGE_STATUS_CANCELLED,
+}
+
+// IsValidCrewChangeStatus reports whether status is one of the known crew change statuses
+func IsValidCrewChangeStatus(status CrewChangeStatus) bool {
+	for _, s := range CrewChangeStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+type ClearanceStatus string
+
+const (
+	CLEARANCE_STATUS_NOT_SUBMITTED ClearanceStatus = "Not Submitted"
+	CLEARANCE_STATUS_SUBMITTED     ClearanceStatus = "Submitted"
+	CLEARANCE_STATUS_APPROVED      ClearanceStatus = "Approved"
+	CLEARANCE_STATUS_REJECTED      ClearanceStatus = "Rejected"
+)
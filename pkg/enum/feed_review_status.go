@@ -0,0 +1,10 @@
+package enum
+
+type FeedReviewStatus string
+
+const (
+	// FEED_REVIEW_STATUS_PENDING marks an email that matched more than one shipment and is waiting for an operator
+	FEED_REVIEW_STATUS_PENDING FeedReviewStatus = "Pending"
+	// FEED_REVIEW_STATUS_RESOLVED marks a reviewed email that has been linked to a shipment by an operator
+	FEED_REVIEW_STATUS_RESOLVED FeedReviewStatus = "Resolved"
+)
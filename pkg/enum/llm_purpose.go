@@ -0,0 +1,11 @@
+package enum
+
+// LLMPurpose is what an LLM call was made for, which its usage is reported by.
+type LLMPurpose string
+
+const (
+	// LLM_PURPOSE_INTENTION reads which checklist item, if any, a master's email is about
+	LLM_PURPOSE_INTENTION LLMPurpose = "Intention"
+	// LLM_PURPOSE_ETA reads the ETA out of a master's email
+	LLM_PURPOSE_ETA LLMPurpose = "ETA"
+)
@@ -0,0 +1,19 @@
+package enum
+
+type NotificationStatus string
+
+const (
+	NOTIFICATION_STATUS_PENDING NotificationStatus = "Pending"
+	NOTIFICATION_STATUS_SENDING NotificationStatus = "Sending"
+	NOTIFICATION_STATUS_SENT    NotificationStatus = "Sent"
+	NOTIFICATION_STATUS_FAILED  NotificationStatus = "Failed"
+)
+
+type NotificationKind string
+
+const (
+	NOTIFICATION_KIND_SHIPMENT_CREATED   NotificationKind = "Shipment Created"
+	NOTIFICATION_KIND_INVITATION         NotificationKind = "Invitation"
+	NOTIFICATION_KIND_EMAIL_VERIFICATION NotificationKind = "Email Verification"
+	NOTIFICATION_KIND_PASSWORD_RESET     NotificationKind = "Password Reset"
+)
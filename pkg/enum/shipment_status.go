@@ -43,6 +43,16 @@ var ShipmentStatusesWithColours = map[ShipmentStatus]string{
 	SHIPMENT_STATUS_COSP:               "orange",
 }
 
+// IsValidShipmentStatus reports whether status is one of the known shipment statuses
+func IsValidShipmentStatus(status ShipmentStatus) bool {
+	for _, s := range ShipmentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // GetShipmentStatuses returns a slice of all shipment statuses
 func GetShipmentStatuses() []string {
 	statuses := make([]string, len(ShipmentStatuses))
@@ -0,0 +1,25 @@
+package enum
+
+// UserRole is what a user may do within their tenant. Admins also manage the tenant's users.
+type UserRole string
+
+const (
+	USER_ROLE_ADMIN  UserRole = "Admin"
+	USER_ROLE_MEMBER UserRole = "Member"
+)
+
+// UserRoles is a slice of all user roles
+var UserRoles = []UserRole{
+	USER_ROLE_ADMIN,
+	USER_ROLE_MEMBER,
+}
+
+// IsValidUserRole reports whether role is one of the known user roles
+func IsValidUserRole(role UserRole) bool {
+	for _, r := range UserRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
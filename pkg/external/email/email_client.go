@@ -0,0 +1,73 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// ErrNotConfigured is returned when an email is sent without SMTP_HOST set.
+var ErrNotConfigured = errors.New("email is not configured, set SMTP_HOST")
+
+// EmailClient sends email through an SMTP server.
+type EmailClient struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// LinkBaseURL is where the links in emails point, the address of the web app, e.g. https://www.columbus-crm.com
+	LinkBaseURL string
+}
+
+// NewEmailClient initializes a new email client from SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// EMAIL_FROM and EMAIL_LINK_BASE_URL. Without SMTP_HOST it is created, but sending fails with ErrNotConfigured.
+func NewEmailClient() (*EmailClient, error) {
+	client := &EmailClient{
+		Host:        os.Getenv("SMTP_HOST"),
+		Port:        os.Getenv("SMTP_PORT"),
+		Username:    os.Getenv("SMTP_USERNAME"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		From:        os.Getenv("EMAIL_FROM"),
+		LinkBaseURL: strings.TrimSuffix(os.Getenv("EMAIL_LINK_BASE_URL"), "/"),
+	}
+	if client.Port == "" {
+		client.Port = "587"
+	}
+	if client.Host != "" && client.From == "" {
+		return nil, errors.New("EMAIL_FROM is required with SMTP_HOST")
+	}
+	return client, nil
+}
+
+// SendEmail sends a plain text email.
+func (client *EmailClient) SendEmail(message Message) error {
+	if client.Host == "" {
+		return ErrNotConfigured
+	}
+
+	var auth smtp.Auth
+	if client.Username != "" {
+		auth = smtp.PlainAuth("", client.Username, client.Password, client.Host)
+	}
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		client.From, message.To, message.Subject, message.Body)
+	return smtp.SendMail(client.Host+":"+client.Port, auth, client.From, []string{message.To}, []byte(body))
+}
+
+// SendInvitationEmail sends an invitation to join tenant, with a link to register with token.
+func (client *EmailClient) SendInvitationEmail(to, tenant, role, token string) error {
+	return client.SendEmail(InvitationEmail(to, tenant, role, client.LinkBaseURL+"/register?token="+token))
+}
+
+// SendEmailVerificationEmail sends a link to verify the address with token.
+func (client *EmailClient) SendEmailVerificationEmail(to, token string) error {
+	return client.SendEmail(EmailVerificationEmail(to, client.LinkBaseURL+"/verify_email?token="+token))
+}
+
+// SendPasswordResetEmail sends a link to set a new password with token.
+func (client *EmailClient) SendPasswordResetEmail(to, token string) error {
+	return client.SendEmail(PasswordResetEmail(to, client.LinkBaseURL+"/reset_password?token="+token))
+}
@@ -0,0 +1,41 @@
+package email
+
+import "fmt"
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// InvitationEmail creates the email inviting a user to register
+func InvitationEmail(to, tenant, role, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "You have been invited to Columbus CRM",
+		Body: fmt.Sprintf("You have been invited to join %s on Columbus CRM as %s.\r\n\r\n"+
+			"Register with this link before it expires:\r\n%s\r\n\r\n"+
+			"If you were not expecting this invitation you can ignore this email.\r\n", tenant, role, link),
+	}
+}
+
+// EmailVerificationEmail creates the email asking a newly registered user to verify their address
+func EmailVerificationEmail(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your email for Columbus CRM",
+		Body: fmt.Sprintf("Verify your email address to finish registering:\r\n%s\r\n\r\n"+
+			"If you did not register you can ignore this email.\r\n", link),
+	}
+}
+
+// PasswordResetEmail creates the email with the link to reset a forgotten password
+func PasswordResetEmail(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your Columbus CRM password",
+		Body: fmt.Sprintf("Set a new password with this link, which works once and expires in an hour:\r\n%s\r\n\r\n"+
+			"If you did not ask to reset your password you can ignore this email.\r\n", link),
+	}
+}
@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"backend-crm/pkg/metrics"
 	"bytes"
 	"encoding/json"
 	"io"
@@ -11,6 +12,12 @@ import (
 	"time"
 )
 
+var (
+	llmCalls    = metrics.NewCounterVec("llm_calls_total", "Calls to the LLM, by model.", "model")
+	llmRetries  = metrics.NewCounterVec("llm_retries_total", "Requests to the LLM retried after a failed attempt, by model.", "model")
+	llmFailures = metrics.NewCounterVec("llm_failures_total", "Calls to the LLM that failed, after any retries, by model.", "model")
+)
+
 type OpenAIClient struct {
 	AccessToken string
 	OrgID       string
@@ -50,23 +57,31 @@ func NewOpenAIClient() (*OpenAIClient, error) {
 	return client, nil
 }
 
-// Calls OpenAI API to extract entity from text
-func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string, error) {
+// Calls OpenAI API to extract entity from text, and returns the tokens the call used
+func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string, Usage, error) {
 	const maxRetries = 5
 	const initialBackoff = time.Second
 	const maxBackoff = 30 * time.Second
 
+	llmCalls.Inc(request.Model)
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			llmFailures.Inc(request.Model)
+		}
+	}()
+
 	var backoff time.Duration
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Marshal the request data into JSON
 		requestBody, err := json.Marshal(request)
 		if err != nil {
-			return "", err
+			return "", Usage{}, err
 		}
 
 		req, err := http.NewRequest("POST", client.OpenAIApi, bytes.NewBuffer(requestBody))
 		if err != nil {
-			return "", err
+			return "", Usage{}, err
 		}
 
 		req.Header.Set("Content-Type", "application/json")
@@ -75,14 +90,14 @@ func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string
 		httpClient := &http.Client{}
 		resp, err := httpClient.Do(req)
 		if err != nil {
-			return "", err
+			return "", Usage{}, err
 		}
 
 		defer resp.Body.Close()
 
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return "", err
+			return "", Usage{}, err
 		}
 
 		if resp.StatusCode == http.StatusOK {
@@ -90,13 +105,14 @@ func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string
 			var response OpenAIResponse
 			err = json.Unmarshal(body, &response)
 			if err != nil {
-				return "", err
+				return "", Usage{}, err
 			}
 
 			// Print the generated text
 			log.Println("Chat response:")
 			parsedIntention := response.Choices[0].Message.Content
-			return parsedIntention, nil
+			succeeded = true
+			return parsedIntention, response.Usage, nil
 		}
 
 		// Handle non-OK status codes
@@ -111,6 +127,7 @@ func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string
 				backoff += time.Duration(rand.Int63n(int64(backoff)))
 
 				log.Printf("Retrying after %v due to status code %d", backoff, resp.StatusCode)
+				llmRetries.Inc(request.Model)
 				time.Sleep(backoff)
 				continue
 			}
@@ -118,9 +135,9 @@ func (client *OpenAIClient) ExtractEntityFromText(request OpenAIRequest) (string
 
 		// If not retriable or max retries exceeded
 		log.Printf("Failed after %d retries with status code %d", attempt+1, resp.StatusCode)
-		return "", nil
+		return "", Usage{}, nil
 	}
 
 	log.Println("Unexpected error: max retries exceeded")
-	return "", nil
+	return "", Usage{}, nil
 }
@@ -1,6 +1,7 @@
 package whatsapp
 
 import (
+	"backend-crm/pkg/metrics"
 	"bytes"
 	"encoding/json"
 	"log"
@@ -8,6 +9,9 @@ import (
 	"os"
 )
 
+var whatsAppMessages = metrics.NewCounterVec("whatsapp_messages_total",
+	"WhatsApp messages sent, or that failed to send, by template.", "template", "outcome")
+
 // WhatsAppClient defines the structure of the WhatsApp client
 type WhatsAppClient struct {
 	AccessToken   string
@@ -68,8 +72,14 @@ func (client *WhatsAppClient) SendMessage(payload Payload) (*http.Response, erro
 	resp, err := httpClient.Do(req)
 	log.Println(resp, "resp")
 	if err != nil {
+		whatsAppMessages.Inc(payload.Template.Name, "failed")
 		return nil, err
 	}
+	if resp.StatusCode >= 300 {
+		whatsAppMessages.Inc(payload.Template.Name, "failed")
+	} else {
+		whatsAppMessages.Inc(payload.Template.Name, "sent")
+	}
 
 	return resp, nil
 }
@@ -97,3 +107,9 @@ func (client *WhatsAppClient) RemindNORTenderedWhatsAppMessage(agentName, vessel
 	payload := RemindNORTenderedWhatsAppMessage(agentName, vesselName, imoNumber, destinationContactNumber)
 	return client.SendMessage(payload)
 }
+
+// RemindCrewDocumentsWhatsAppMessage creates and sends a reminder about missing crew change documents
+func (client *WhatsAppClient) RemindCrewDocumentsWhatsAppMessage(agentName, vesselName, imoNumber, missingDocuments string, destinationContactNumber string) (*http.Response, error) {
+	payload := RemindCrewDocumentsWhatsAppMessage(agentName, vesselName, imoNumber, missingDocuments, destinationContactNumber)
+	return client.SendMessage(payload)
+}
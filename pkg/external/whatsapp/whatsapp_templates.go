@@ -156,3 +156,33 @@ func RemindAGDWhatsAppMessage(agentName, vesselName, imoNumber, etaDate, etaTime
 		},
 	}
 }
+
+// RemindCrewDocumentsWhatsAppMessage creates a payload for a reminder about crew change documents that are still missing
+func RemindCrewDocumentsWhatsAppMessage(agentName, vesselName, imoNumber, missingDocuments string, destinationContactNumber string) Payload {
+	log.Println(destinationContactNumber, "handphone")
+	return Payload{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               destinationContactNumber,
+		Type:             "template",
+		Template: Template{
+			// this value is from Whatsapp Cloud
+			Name: "columbus_crew_documents_reminder",
+			Language: Language{
+				Policy: "deterministic",
+				Code:   "en_US",
+			},
+			Components: []TemplateComponent{
+				{
+					Type: "body",
+					Parameters: []TemplateParameter{
+						{Type: "text", Text: agentName},
+						{Type: "text", Text: vesselName},
+						{Type: "text", Text: imoNumber},
+						{Type: "text", Text: missingDocuments},
+					},
+				},
+			},
+		},
+	}
+}
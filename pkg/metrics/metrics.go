@@ -0,0 +1,247 @@
+// Package metrics keeps counters and histograms in memory and serves them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the upper bounds, in seconds, of the buckets of a histogram of durations.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics served together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default is the registry the metrics of the server are kept in.
+var Default = NewRegistry()
+
+func (reg *Registry) register(name string, m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.metrics[name]; ok {
+		panic("metrics: " + name + " is registered twice")
+	}
+	reg.metrics[name] = m
+}
+
+// Write writes every metric of the registry, sorted by name.
+func (reg *Registry) Write(w io.Writer) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	names := make([]string, 0, len(reg.metrics))
+	for name := range reg.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reg.metrics[name].write(w)
+	}
+}
+
+// Handler serves the metrics of the registry.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Write(w)
+	})
+}
+
+// vec holds the series of a metric by the values of its labels.
+type vec[S any] struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*S
+	values map[string][]string
+}
+
+func newVec[S any](name string, help string, labels []string) *vec[S] {
+	return &vec[S]{name: name, help: help, labels: labels, series: make(map[string]*S), values: make(map[string][]string)}
+}
+
+// with returns the series of values, made with create the first time.
+func (v *vec[S]) with(values []string, create func() *S) *S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = create()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// get returns the series of values, if there is one.
+func (v *vec[S]) get(values []string) (*S, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[strings.Join(values, "\xff")]
+	return s, ok
+}
+
+// each calls write with the labels of every series, sorted.
+func (v *vec[S]) each(write func(labels string, s *S)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		write(v.formatLabels(v.values[key]), v.series[key])
+	}
+}
+
+func (v *vec[S]) formatLabels(values []string) string {
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = v.labels[i] + `="` + escapeLabel(value) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// CounterVec counts events, by the values of its labels.
+type CounterVec struct {
+	*vec[float64]
+}
+
+// NewCounterVec registers a counter in Default.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec[float64](name, help, labels)}
+	Default.register(name, c)
+	return c
+}
+
+// Inc adds one to the count of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n to the count of the label values.
+func (c *CounterVec) Add(n float64, values ...string) {
+	s := c.with(values, func() *float64 { return new(float64) })
+	c.mu.Lock()
+	*s += n
+	c.mu.Unlock()
+}
+
+// Value is the count of the label values, for tests.
+func (c *CounterVec) Value(values ...string) float64 {
+	s, ok := c.get(values)
+	if !ok {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *s
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.each(func(labels string, s *float64) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, labels, formatFloat(*s))
+	})
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec counts observations in buckets, by the values of its labels.
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram with the buckets, in increasing order, in Default.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec[histogram](name, help, labels), buckets: buckets}
+	Default.register(name, h)
+	return h
+}
+
+// Observe adds value to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	s := h.with(values, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} })
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Since observes the seconds since start, e.g. defer h.Since(time.Now(), "find").
+func (h *HistogramVec) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count is how many values of the label values were observed, for tests.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	s, ok := h.get(values)
+	if !ok {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return s.count
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.each(func(labels string, s *histogram) {
+		separator := ""
+		if labels != "" {
+			separator = ","
+		}
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", h.name, labels, separator, formatFloat(bound), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, labels, separator, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, s.count)
+	})
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
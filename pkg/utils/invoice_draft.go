@@ -0,0 +1,46 @@
+package utils
+
+import "strconv"
+
+// DraftPDAInvoicePricingDetails prices the tariff items that only depend on the vessel and terminal:
+// the agency fee, pilotage by GRT bracket and mooring at the terminal. Items the tariff does not cover are left out,
+// the operator completes the rest of the PDA by hand.
+func DraftPDAInvoicePricingDetails(fees map[string]interface{}, grt int64, terminal string) map[string]string {
+	details := make(map[string]string)
+
+	if agencyFee, ok := fees["agency_fee"].(map[string]interface{}); ok {
+		if value, ok := agencyFee["fees"].(float64); ok {
+			details["agency_fee"] = formatAmount(value)
+		}
+	}
+
+	if brackets, ok := fees["pilotage"].([]interface{}); ok {
+		for _, bracket := range brackets {
+			bracket, ok := bracket.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			min, _ := bracket["min"].(float64)
+			max, _ := bracket["max"].(float64)
+			value, ok := bracket["value"].(float64)
+			if ok && float64(grt) >= min && float64(grt) <= max {
+				details["pilotage"] = formatAmount(value)
+				break
+			}
+		}
+	}
+
+	if mooring, ok := fees["mooring"].(map[string]interface{}); ok {
+		if value, ok := mooring[terminal].(float64); ok {
+			details["mooring"] = formatAmount(value)
+		} else if value, ok := mooring["default"].(float64); ok {
+			details["mooring"] = formatAmount(value)
+		}
+	}
+
+	return details
+}
+
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}